@@ -2,83 +2,180 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"expvar"
+	"flag"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/citadel-corp/halosuster/internal/common/cursor"
 	"github.com/citadel-corp/halosuster/internal/common/db"
+	"github.com/citadel-corp/halosuster/internal/common/jwt"
 	"github.com/citadel-corp/halosuster/internal/common/middleware"
+	"github.com/citadel-corp/halosuster/internal/common/password"
+	"github.com/citadel-corp/halosuster/internal/config"
+	"github.com/citadel-corp/halosuster/internal/drugs"
+	"github.com/citadel-corp/halosuster/internal/icd10"
 	"github.com/citadel-corp/halosuster/internal/image"
+	"github.com/citadel-corp/halosuster/internal/interactions"
 	"github.com/citadel-corp/halosuster/internal/medicalpatients"
 	"github.com/citadel-corp/halosuster/internal/medicalrecords"
+	"github.com/citadel-corp/halosuster/internal/recordtemplates"
 	"github.com/citadel-corp/halosuster/internal/user"
+	"github.com/citadel-corp/halosuster/migrations"
 	"github.com/gorilla/mux"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
+const usage = `Usage:
+  halosuster [serve] [--migrate [--force-dirty]]
+  halosuster migrate up|down N|status|goto V|force V|create NAME [--force-dirty] [--dir DIR]
+  halosuster gc-images [--dry-run] [--grace DURATION] [--unregistered]
+  halosuster make-images-private [--dry-run]
+`
+
 func main() {
 	zerolog.TimeFieldFormat = time.RFC3339
 	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
 
-	// Connect to database
-	// env := os.Getenv("ENV")
-	// sslMode := "disable"
-	// if env == "production" {
-	// 	sslMode = "verify-full sslrootcert=ap-southeast-1-bundle.pem"
-	// }
-	// connStr := "postgres://[user]:[password]@[neon_hostname]/[dbname]?sslmode=require"
-	connStr := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?%s",
-		os.Getenv("DB_USERNAME"), os.Getenv("DB_PASSWORD"), os.Getenv("DB_HOST"), os.Getenv("DB_PORT"), os.Getenv("DB_NAME"), os.Getenv("DB_PARAMS"))
-	// dbURL := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
-	// 	os.Getenv("DB_HOST"), os.Getenv("DB_PORT"), os.Getenv("DB_USERNAME"), os.Getenv("DB_PASSWORD"), os.Getenv("DB_NAME"), sslMode)
-	db, err := db.Connect(connStr)
-	if err != nil {
-		log.Error().Msg(fmt.Sprintf("Cannot connect to database: %v", err))
-		os.Exit(1)
-	}
-
-	// Create migrations
-	// err = db.UpMigration()
-	// if err != nil {
-	// 	log.Error().Msg(fmt.Sprintf("Up migration failed: %v", err))
-	// 	os.Exit(1)
-	// }
+	command, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+	switch command {
+	case "serve":
+		os.Exit(serve(args))
+	case "migrate":
+		os.Exit(runMigrate(args))
+	case "gc-images":
+		os.Exit(runImageGC(args))
+	case "make-images-private":
+		os.Exit(runMakeImagesPrivate(args))
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n%s", command, usage)
+		os.Exit(2)
+	}
+}
+
+// connect loads the configuration and connects to the database.
+func connect() (*config.Config, *db.DB, error) {
+	cfg, err := config.Load(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	db, err := db.Connect(cfg.Database.URL(), cfg.Database.MaxOpenConns, cfg.Database.MaxIdleConns)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot connect to database: %w", err)
+	}
+	return cfg, db, nil
+}
+
+// serve is the serve command, the default, which runs the HTTP server
+// and background jobs until terminated.
+func serve(args []string) int {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	migrateUp := flags.Bool("migrate", false, "apply pending migrations before serving")
+	forceDirty := flags.Bool("force-dirty", false, "with --migrate, retry a migration that failed before")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, db, err := connect()
+	if err != nil {
+		log.Error().Msg(fmt.Sprintf("Cannot start: %v", err))
+		return 1
+	}
+	if *migrateUp {
+		if err = db.Migrate(migrations.FS, *forceDirty); err != nil {
+			log.Error().Msg(fmt.Sprintf("Up migration failed: %v", err))
+			return 1
+		}
+	}
+
+	// initialize image domain
+	imageService, err := newImageService(cfg, db)
+	if err != nil {
+		log.Error().Msg(fmt.Sprintf("Cannot create image service: %v", err))
+		return 1
+	}
+	imageHandler := image.NewHandler(imageService)
+
+	tokens := jwt.NewSigner([]byte(cfg.Auth.JWTSecret))
+	auth := middleware.NewAuthorizer(tokens)
+	cursors := cursor.NewCodec([]byte(cfg.Auth.CursorSecret))
 
 	// initialize user domain
 	userRepository := user.NewRepository(db)
-	userService := user.NewService(userRepository)
+	userService := user.NewService(userRepository, imageService, tokens, password.NewHasher(cfg.Auth.BcryptCost), cfg.Auth.TokenTTL)
 	userHandler := user.NewHandler(userService)
 
 	// initialize medical patient domain
 	medicalPatientRepository := medicalpatients.NewRepository(db)
-	medicalPatientService := medicalpatients.NewService(medicalPatientRepository)
+	medicalPatientService := medicalpatients.NewService(medicalPatientRepository, imageService, cursors)
 	medicalPatientHandler := medicalpatients.NewHandler(medicalPatientService)
 
-	// initialize medical record domain
-	medicalRecordsRepository := medicalrecords.NewRepository(db)
-	medicalRecordsService := medicalrecords.NewService(medicalRecordsRepository, medicalPatientRepository)
-	medicalRecordsHandler := medicalrecords.NewHandler(medicalRecordsService)
+	// initialize icd-10 domain
+	var icd10Catalogue *icd10.Catalogue
+	if cfg.Records.ICD10File != "" {
+		icd10Catalogue, err = icd10.OpenCatalogue(cfg.Records.ICD10File)
+	} else {
+		log.Warn().Msg("ICD10_SAMPLE is set, only the built-in sample of ICD-10 codes can be diagnosed")
+		icd10Catalogue, err = icd10.NewSampleCatalogue()
+	}
+	if err != nil {
+		log.Error().Msg(fmt.Sprintf("Cannot load ICD-10 catalogue: %v", err))
+		return 1
+	}
+	icd10Service := icd10.NewService(icd10Catalogue)
+	icd10Handler := icd10.NewHandler(icd10Service)
 
-	// initialize image domain
-	sess, err := session.NewSession(&aws.Config{
-		Region:      aws.String("ap-southeast-1"),
-		Credentials: credentials.NewStaticCredentials(os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"), ""),
-	})
+	// initialize drug domain
+	drugRepository := drugs.NewRepository(db)
+	drugService := drugs.NewService(drugRepository)
+	drugHandler := drugs.NewHandler(drugService)
+
+	// initialize interaction tables
+	interactionTable, err := interactions.NewTable()
 	if err != nil {
-		log.Error().Msg(fmt.Sprintf("Cannot create AWS session: %v", err))
-		os.Exit(1)
+		log.Error().Msg(fmt.Sprintf("Cannot load interaction tables: %v", err))
+		return 1
 	}
-	imageService := image.NewService(sess)
-	imageHandler := image.NewHandler(imageService)
+
+	// initialize record template domain
+	recordTemplateRepository := recordtemplates.NewRepository(db)
+	recordTemplateService := recordtemplates.NewService(recordTemplateRepository)
+	recordTemplateHandler := recordtemplates.NewHandler(recordTemplateService)
+
+	// initialize medical record domain
+	alertThresholds := medicalrecords.DefaultAlertThresholds
+	if cfg.Records.AlertScore != nil {
+		alertThresholds.Score = *cfg.Records.AlertScore
+	}
+	if cfg.Records.AlertParameterScore != nil {
+		alertThresholds.ParameterScore = *cfg.Records.AlertParameterScore
+	}
+	alertThresholds.Window = cfg.Records.AlertWindow
+	recordSigner, err := medicalrecords.NewSigner([]byte(cfg.Records.SigningKey))
+	if err != nil {
+		log.Error().Msg(fmt.Sprintf("Cannot create record signer: %v", err))
+		return 1
+	}
+	deteriorationAlerts := medicalrecords.NewAlertHook()
+	deteriorationAlerts.Subscribe(medicalrecords.LogAlert)
+	medicalRecordsRepository := medicalrecords.NewRepository(db, recordSigner)
+	medicalRecordsService := medicalrecords.NewService(medicalRecordsRepository, medicalPatientRepository, icd10Service, drugService,
+		interactionTable, recordTemplateService, imageService, cfg.Records.GracePeriod, alertThresholds, deteriorationAlerts,
+		recordSigner, cursors)
+	medicalRecordsHandler := medicalrecords.NewHandler(medicalRecordsService)
 
 	r := mux.NewRouter()
 	r.Use(middleware.Logging)
@@ -90,37 +187,74 @@ func main() {
 		w.WriteHeader(http.StatusOK)
 		io.WriteString(w, "Service ready")
 	})
+	r.HandleFunc("/debug/vars", auth.AuthorizeITUser(expvar.Handler().ServeHTTP)).Methods(http.MethodGet)
 
 	// user routes
 	ur := v1.PathPrefix("/user").Subrouter()
 	ur.HandleFunc("/it/register", userHandler.CreateITUser).Methods(http.MethodPost)
 	ur.HandleFunc("/it/login", userHandler.LoginITUser).Methods(http.MethodPost)
-	ur.HandleFunc("/nurse/register", middleware.AuthorizeITUser(userHandler.CreateNurseUser)).Methods(http.MethodPost)
+	ur.HandleFunc("/nurse/register", auth.AuthorizeITUser(userHandler.CreateNurseUser)).Methods(http.MethodPost)
 	ur.HandleFunc("/nurse/login", userHandler.LoginNurseUser).Methods(http.MethodPost)
-	ur.HandleFunc("", middleware.AuthorizeITUser(userHandler.ListUsers)).Methods(http.MethodGet)
-	ur.HandleFunc("/nurse/{userId}", middleware.AuthorizeITUser(userHandler.UpdateNurse)).Methods(http.MethodPut)
-	ur.HandleFunc("/nurse/{userId}", middleware.AuthorizeITUser(userHandler.DeleteNurse)).Methods(http.MethodDelete)
-	ur.HandleFunc("/nurse/{userId}/access", middleware.AuthorizeITUser(userHandler.GrantNurseAccess)).Methods(http.MethodPost)
+	ur.HandleFunc("", auth.AuthorizeITUser(userHandler.ListUsers)).Methods(http.MethodGet)
+	ur.HandleFunc("/nurse/{userId}", auth.AuthorizeITUser(userHandler.UpdateNurse)).Methods(http.MethodPut)
+	ur.HandleFunc("/nurse/{userId}", auth.AuthorizeITUser(userHandler.DeleteNurse)).Methods(http.MethodDelete)
+	ur.HandleFunc("/nurse/{userId}/access", auth.AuthorizeITUser(userHandler.GrantNurseAccess)).Methods(http.MethodPost)
+	ur.HandleFunc("/nurse/{userId}/roles", auth.AuthorizeITUser(userHandler.SetNurseRoles)).Methods(http.MethodPut)
 
 	// image routes
 	ir := v1.PathPrefix("/image").Subrouter()
-	ir.HandleFunc("", middleware.AuthorizeITAndNurseUser(imageHandler.UploadToS3)).Methods(http.MethodPost)
+	ir.HandleFunc("", auth.AuthorizeITAndNurseUser(imageHandler.Upload)).Methods(http.MethodPost)
+	ir.HandleFunc("", auth.AuthorizeITAndNurseUser(imageHandler.ListImages)).Methods(http.MethodGet)
+	ir.HandleFunc("/uploads", auth.AuthorizeITAndNurseUser(imageHandler.CreateUpload)).Methods(http.MethodPost)
+	ir.HandleFunc("/uploads/{id}", auth.AuthorizeITAndNurseUser(imageHandler.GetUpload)).Methods(http.MethodGet)
+	ir.HandleFunc("/uploads/{id}", auth.AuthorizeITAndNurseUser(imageHandler.PatchUpload)).Methods(http.MethodPatch)
+	ir.HandleFunc("/uploads/{id}/finalize", auth.AuthorizeITAndNurseUser(imageHandler.FinalizeUpload)).Methods(http.MethodPost)
+	ir.HandleFunc("/{key}", auth.AuthorizeITAndNurseUser(imageHandler.Redirect)).Methods(http.MethodGet)
+	ir.HandleFunc("/files/{key}", auth.AuthorizeITAndNurseUser(imageHandler.Download)).Methods(http.MethodGet)
 
 	// medical patient routes
 	mpr := v1.PathPrefix("/medical/patient").Subrouter()
-	mpr.HandleFunc("", middleware.AuthorizeITAndNurseUser(medicalPatientHandler.CreateMedicalPatient)).Methods(http.MethodPost)
-	mpr.HandleFunc("", middleware.AuthorizeITAndNurseUser(medicalPatientHandler.ListMedicalPatient)).Methods(http.MethodGet)
+	mpr.HandleFunc("", auth.AuthorizeITAndNurseUser(medicalPatientHandler.CreateMedicalPatient)).Methods(http.MethodPost)
+	mpr.HandleFunc("", auth.AuthorizeITAndNurseUser(medicalPatientHandler.ListMedicalPatient)).Methods(http.MethodGet)
+	mpr.HandleFunc("/{identityNumber}", auth.AuthorizeITAndNurseUser(medicalPatientHandler.UpdateMedicalPatient)).Methods(http.MethodPatch)
+	mpr.HandleFunc("/deteriorating", auth.AuthorizeITAndNurseUser(medicalRecordsHandler.ListDeteriorating)).Methods(http.MethodGet)
+	mpr.HandleFunc("/{identityNumber}/allergies", auth.AuthorizeITAndNurseUser(medicalPatientHandler.AddAllergy)).Methods(http.MethodPost)
+	mpr.HandleFunc("/{identityNumber}/allergies", auth.AuthorizeITAndNurseUser(medicalPatientHandler.ListAllergies)).Methods(http.MethodGet)
+	mpr.HandleFunc("/{identityNumber}/timeline", auth.AuthorizeITAndNurseUser(medicalPatientHandler.GetTimeline)).Methods(http.MethodGet)
+	mpr.HandleFunc("/{identityNumber}/vitals", auth.AuthorizeITAndNurseUser(medicalRecordsHandler.GetVitalsTrend)).Methods(http.MethodGet)
+
+	// icd-10 routes
+	v1.HandleFunc("/icd10", auth.AuthorizeITAndNurseUser(icd10Handler.Search)).Methods(http.MethodGet)
+
+	// drug routes
+	dr := v1.PathPrefix("/drugs").Subrouter()
+	dr.HandleFunc("", auth.AuthorizeITAndNurseUser(drugHandler.Search)).Methods(http.MethodGet)
+	dr.HandleFunc("/import", auth.AuthorizeITUser(drugHandler.ImportCatalogue)).Methods(http.MethodPost)
 
 	// medical record routes
 	mr := v1.PathPrefix("/medical/record").Subrouter()
-	mr.HandleFunc("", middleware.AuthorizeITAndNurseUser(medicalRecordsHandler.CreateMedicalRecord)).Methods(http.MethodPost)
-	mr.HandleFunc("", middleware.AuthorizeITAndNurseUser(medicalRecordsHandler.ListMedicalRecords)).Methods(http.MethodGet)
+	mr.HandleFunc("", auth.AuthorizeITAndNurseUser(medicalRecordsHandler.CreateMedicalRecord)).Methods(http.MethodPost)
+	mr.HandleFunc("", auth.AuthorizeITAndNurseUser(medicalRecordsHandler.ListMedicalRecords)).Methods(http.MethodGet)
+	mr.HandleFunc("/templates", auth.AuthorizeITUserOrNurseRole(string(user.HeadNurse), recordTemplateHandler.CreateTemplate)).Methods(http.MethodPost)
+	mr.HandleFunc("/templates", auth.AuthorizeITAndNurseUser(recordTemplateHandler.ListTemplates)).Methods(http.MethodGet)
+	mr.HandleFunc("/reviews", auth.AuthorizeNurseRole(string(user.ClinicalReviewer), medicalRecordsHandler.ListReviewInbox)).Methods(http.MethodGet)
+	mr.HandleFunc("/{id}/review", auth.AuthorizeNurseRole(string(user.ClinicalReviewer), medicalRecordsHandler.ReviewMedicalRecord)).Methods(http.MethodPost)
+	mr.HandleFunc("/verify/{identityNumber}", auth.AuthorizeITAndNurseUser(medicalRecordsHandler.VerifyChain)).Methods(http.MethodGet)
+	mr.HandleFunc("/{id}", auth.AuthorizeITAndNurseUser(medicalRecordsHandler.GetMedicalRecord)).Methods(http.MethodGet)
+	mr.HandleFunc("/{id}/amendments", auth.AuthorizeITAndNurseUser(medicalRecordsHandler.AmendMedicalRecord)).Methods(http.MethodPost)
 
 	httpServer := &http.Server{
-		Addr:    ":8080",
+		Addr:    cfg.HTTP.Addr,
 		Handler: r,
 	}
 
+	// background jobs
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	go medicalrecords.RunLocker(jobsCtx, medicalRecordsService, time.Minute)
+	if cfg.Images.GCInterval > 0 {
+		go image.RunGarbageCollector(jobsCtx, imageService, cfg.Images.GCInterval, cfg.Images.GCGrace)
+	}
+
 	go func() {
 		log.Info().Msg(fmt.Sprintf("HTTP server listening on %s", httpServer.Addr))
 		if err := httpServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
@@ -135,7 +269,8 @@ func main() {
 
 	// Block until termination signal received
 	<-stop
-	shutdownCtx, shutdownRelease := context.WithTimeout(context.Background(), 10*time.Second)
+	stopJobs()
+	shutdownCtx, shutdownRelease := context.WithTimeout(context.Background(), cfg.HTTP.ShutdownTimeout)
 	defer shutdownRelease()
 
 	log.Info().Msg(fmt.Sprintf("Shutting down HTTP server listening on %s", httpServer.Addr))
@@ -143,4 +278,186 @@ func main() {
 		log.Error().Msg(fmt.Sprintf("HTTP server shutdown error: %v", err))
 	}
 	log.Info().Msg("Shutdown complete.")
+	return 0
+}
+
+// newImageService creates the image service configured.
+func newImageService(cfg *config.Config, db *db.DB) (image.Service, error) {
+	imageStore, err := newObjectStore(cfg.Images)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create image store: %w", err)
+	}
+	uploadPolicy, err := newUploadPolicy(cfg.Images)
+	if err != nil {
+		return nil, fmt.Errorf("invalid image upload policy: %w", err)
+	}
+	imageVariants, err := newVariantConfig(cfg.Images)
+	if err != nil {
+		return nil, fmt.Errorf("invalid image variants: %w", err)
+	}
+	var imageScanner image.Scanner
+	if cfg.Images.ClamdAddress != "" {
+		imageScanner = image.NewClamdScanner(cfg.Images.ClamdAddress, cfg.Images.ClamdTimeout)
+	} else {
+		log.Warn().Msg("CLAMD_ADDRESS is not set, uploads will not be scanned for malware")
+	}
+	imageRepository := image.NewRepository(db)
+	return image.NewService(imageStore, imageRepository, cfg.Images.URLTTL, uploadPolicy, imageVariants, imageScanner, cfg.Images.UploadWorkers), nil
+}
+
+// newObjectStore creates the image store configured: S3, or a directory
+// for development without AWS credentials.
+func newObjectStore(cfg config.Images) (image.ObjectStore, error) {
+	if cfg.Store == "filesystem" {
+		return image.NewFileStore(cfg.Dir, cfg.BaseURL)
+	}
+	return image.NewS3Store(image.S3Config{
+		Endpoint:        cfg.S3.Endpoint,
+		Region:          cfg.S3.Region,
+		Bucket:          cfg.S3.Bucket,
+		AccessKeyID:     cfg.S3.AccessKeyID,
+		SecretAccessKey: cfg.S3.SecretAccessKey,
+		PathStyle:       cfg.S3.ForcePathStyle,
+	})
+}
+
+// newUploadPolicy overrides the default upload policy with the content
+// types, size limits and document limits configured.
+func newUploadPolicy(cfg config.Images) (image.UploadPolicy, error) {
+	policy := image.DefaultUploadPolicy
+	if len(cfg.AllowedTypes) > 0 {
+		policy.AllowedTypes = cfg.AllowedTypes
+	}
+	if cfg.MinSize != nil {
+		policy.MinSize = *cfg.MinSize
+	}
+	if cfg.MaxSize != nil {
+		policy.MaxSize = *cfg.MaxSize
+	}
+	if len(cfg.DocumentLimits) > 0 {
+		documents := make(map[image.DocumentType]image.DocumentLimit, len(policy.Documents))
+		for documentType, limit := range policy.Documents {
+			documents[documentType] = limit
+		}
+		for name, size := range cfg.DocumentLimits {
+			limit, ok := documents[image.DocumentType(name)]
+			if !ok {
+				return policy, fmt.Errorf("unknown document type %s in IMAGE_DOCUMENT_LIMITS", name)
+			}
+			limit.MaxSize = size
+			documents[image.DocumentType(name)] = limit
+		}
+		policy.Documents = documents
+	}
+	return policy, policy.Validate()
+}
+
+// newVariantConfig overrides the default image variants with those
+// configured, each name:size or name:widthxheight.
+func newVariantConfig(cfg config.Images) (image.VariantConfig, error) {
+	variants := image.DefaultVariantConfig
+	variants.Eager = cfg.VariantsEager
+	if len(cfg.Variants) == 0 {
+		return variants, variants.Validate()
+	}
+	variants.Variants = nil
+	for _, spec := range cfg.Variants {
+		name, size, ok := strings.Cut(spec, ":")
+		if !ok {
+			return variants, fmt.Errorf("invalid IMAGE_VARIANTS entry %q", spec)
+		}
+		width, height, square := strings.Cut(size, "x")
+		if !square {
+			height = width
+		}
+		variant := image.Variant{Name: name}
+		var err error
+		if variant.MaxWidth, err = strconv.Atoi(width); err != nil {
+			return variants, fmt.Errorf("invalid IMAGE_VARIANTS entry %q: %w", spec, err)
+		}
+		if variant.MaxHeight, err = strconv.Atoi(height); err != nil {
+			return variants, fmt.Errorf("invalid IMAGE_VARIANTS entry %q: %w", spec, err)
+		}
+		variants.Variants = append(variants.Variants, variant)
+	}
+	return variants, variants.Validate()
+}
+
+// runImageGC is the gc-images command, which collects orphaned images
+// once and prints the report. With --unregistered it instead sweeps the
+// store for objects that were never registered as images.
+func runImageGC(args []string) int {
+	flags := flag.NewFlagSet("gc-images", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "report orphaned images without deleting them")
+	grace := flags.Duration("grace", 0, "only collect images uploaded longer ago than this (default IMAGE_GC_GRACE)")
+	unregistered := flags.Bool("unregistered", false, "delete stored objects that are not registered images instead")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	cfg, db, err := connect()
+	if err != nil {
+		log.Error().Msg(fmt.Sprintf("Cannot start: %v", err))
+		return 1
+	}
+	graceSet := false
+	flags.Visit(func(f *flag.Flag) { graceSet = graceSet || f.Name == "grace" })
+	if !graceSet {
+		*grace = cfg.Images.GCGrace
+	}
+	imageService, err := newImageService(cfg, db)
+	if err != nil {
+		log.Error().Msg(fmt.Sprintf("Cannot create image service: %v", err))
+		return 1
+	}
+
+	collect := imageService.CollectGarbage
+	if *unregistered {
+		collect = imageService.SweepUnregistered
+	}
+	report, err := collect(context.Background(), *grace, *dryRun)
+	status := 0
+	if err != nil {
+		log.Error().Msg(fmt.Sprintf("Collecting orphaned images failed: %v", err))
+		status = 1
+	}
+	out := json.NewEncoder(os.Stdout)
+	out.SetIndent("", "  ")
+	if err = out.Encode(report); err != nil {
+		log.Error().Msg(fmt.Sprintf("Cannot print report: %v", err))
+		return 1
+	}
+	return status
+}
+
+// runMakeImagesPrivate is the make-images-private command, run once when
+// upgrading from images stored public-read, which revokes public access
+// to every stored object.
+func runMakeImagesPrivate(args []string) int {
+	flags := flag.NewFlagSet("make-images-private", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "count public objects without changing them")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	cfg, err := config.Load(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		log.Error().Msg(fmt.Sprintf("Invalid configuration: %v", err))
+		return 1
+	}
+	store, err := newObjectStore(cfg.Images)
+	if err != nil {
+		log.Error().Msg(fmt.Sprintf("Cannot create image store: %v", err))
+		return 1
+	}
+
+	public, err := store.MakePrivate(context.Background(), *dryRun)
+	if err != nil {
+		log.Error().Msg(fmt.Sprintf("Making images private failed after %d objects: %v", public, err))
+		return 1
+	}
+	if *dryRun {
+		log.Info().Msg(fmt.Sprintf("%d objects are public", public))
+	} else {
+		log.Info().Msg(fmt.Sprintf("Made %d public objects private", public))
+	}
+	return 0
 }
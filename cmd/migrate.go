@@ -0,0 +1,112 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/citadel-corp/halosuster/internal/common/db"
+	"github.com/citadel-corp/halosuster/migrations"
+	"github.com/rs/zerolog/log"
+)
+
+// runMigrate is the migrate command. Migrations are embedded in the
+// binary; only create writes files, into the migrations directory of
+// the source tree.
+func runMigrate(args []string) int {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	forceDirty := flags.Bool("force-dirty", false, "retry a migration that failed before instead of refusing to migrate")
+	dir := flags.String("dir", "migrations", "directory create writes migration files into")
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	action, args := args[0], args[1:]
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	args = flags.Args()
+
+	wantArgs := map[string]int{"up": 0, "status": 0, "down": 1, "goto": 1, "force": 1, "create": 1}
+	n, ok := wantArgs[action]
+	if !ok || len(args) != n {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	if action == "create" {
+		up, down, err := db.CreateMigration(*dir, args[0])
+		if err != nil {
+			log.Error().Msg(fmt.Sprintf("Cannot create migration: %v", err))
+			return 1
+		}
+		fmt.Println(up)
+		fmt.Println(down)
+		return 0
+	}
+
+	_, database, err := connect()
+	if err != nil {
+		log.Error().Msg(fmt.Sprintf("Cannot start: %v", err))
+		return 1
+	}
+	migrator, err := database.NewMigrator(migrations.FS, *forceDirty)
+	if err != nil {
+		log.Error().Msg(fmt.Sprintf("Cannot read migrations: %v", err))
+		return 1
+	}
+	defer migrator.Close()
+
+	switch action {
+	case "up":
+		err = migrator.Up()
+	case "down":
+		var steps int
+		if steps, err = strconv.Atoi(args[0]); err == nil {
+			err = migrator.Down(steps)
+		}
+	case "goto":
+		var version uint64
+		if version, err = strconv.ParseUint(args[0], 10, 64); err == nil {
+			err = migrator.Goto(uint(version))
+		}
+	case "force":
+		var version int
+		if version, err = strconv.Atoi(args[0]); err == nil {
+			err = migrator.Force(version)
+		}
+	case "status":
+		err = printMigrationStatus(migrator)
+	}
+	if err != nil {
+		log.Error().Msg(fmt.Sprintf("Migrate %s failed: %v", action, err))
+		return 1
+	}
+	return 0
+}
+
+func printMigrationStatus(migrator *db.Migrator) error {
+	status, err := migrator.Status()
+	if err != nil {
+		return err
+	}
+	switch {
+	case status.Version == nil:
+		fmt.Println("version: none")
+	case status.Dirty:
+		fmt.Printf("version: %d (dirty)\n", *status.Version)
+	default:
+		fmt.Printf("version: %d\n", *status.Version)
+	}
+	for _, m := range status.Migrations {
+		state := "pending"
+		if m.Applied {
+			state = "applied"
+		} else if status.Dirty && status.Version != nil && m.Version == *status.Version {
+			state = "dirty"
+		}
+		fmt.Printf("%06d  %-8s %s\n", m.Version, state, m.Name)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package cursor
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/citadel-corp/halosuster/internal/common/query"
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// Cursor marks the last row of a page ordered by (created_at, id).
+// Query is the Fingerprint of the listing it pages through.
+type Cursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        string    `json:"i"`
+	Desc      bool      `json:"d"`
+	Query     string    `json:"q"`
+}
+
+// Codec turns cursors into signed tokens and back, so clients cannot
+// forge a position.
+type Codec interface {
+	Encode(c Cursor) string
+	Decode(token string) (*Cursor, error)
+}
+
+type hmacCodec struct {
+	key []byte
+}
+
+func NewCodec(key []byte) Codec {
+	return &hmacCodec{key: key}
+}
+
+// Encode returns an opaque token of the form payload.signature.
+func (h *hmacCodec) Encode(c Cursor) string {
+	payload, _ := json.Marshal(c)
+	p := base64.RawURLEncoding.EncodeToString(payload)
+	return p + "." + base64.RawURLEncoding.EncodeToString(h.sign(p))
+}
+
+func (h *hmacCodec) Decode(token string) (*Cursor, error) {
+	p, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+	gotSig, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(gotSig, h.sign(p)) {
+		return nil, ErrInvalidCursor
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(p)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	c := &Cursor{}
+	if err = json.Unmarshal(payload, c); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCursor, err)
+	}
+	return c, nil
+}
+
+// Fingerprint identifies a listing by its parameters, such as the sort,
+// and its filters, in any order. A cursor is only good for the listing
+// it was made for; with another sort or filter it would skip or repeat
+// rows.
+func Fingerprint(params []string, filters []query.Filter) string {
+	parts := make([]string, len(filters))
+	for i, f := range filters {
+		parts[i] = fmt.Sprintf("%s[%s]=%s", f.Field.Param, f.Op, f.Value)
+	}
+	slices.Sort(parts)
+	sum := sha256.Sum256([]byte(strings.Join(append(params, parts...), "\x00")))
+	return base64.RawURLEncoding.EncodeToString(sum[:12])
+}
+
+// Check returns ErrInvalidCursor unless c was made for the listing with
+// the fingerprint given.
+func (c *Cursor) Check(fingerprint string) error {
+	if c.Query != fingerprint {
+		return fmt.Errorf("%w: cursor was made for another sort or filter", ErrInvalidCursor)
+	}
+	return nil
+}
+
+// Condition selects the rows after c in its sort direction.
+func (c *Cursor) Condition(timeColumn, idColumn string) query.Condition {
+	op := ">"
+	if c.Desc {
+		op = "<"
+	}
+	return query.Raw(fmt.Sprintf("(%s, %s) %s (?, ?)", timeColumn, idColumn, op), c.CreatedAt, c.ID)
+}
+
+func (h *hmacCodec) sign(payload string) []byte {
+	mac := hmac.New(sha256.New, h.key)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
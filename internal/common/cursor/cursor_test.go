@@ -0,0 +1,115 @@
+package cursor
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/citadel-corp/halosuster/internal/common/query"
+)
+
+func TestCodec(t *testing.T) {
+	codec := NewCodec([]byte("secret"))
+	want := Cursor{
+		CreatedAt: time.Date(2024, 5, 1, 8, 30, 0, 123456000, time.UTC),
+		ID:        "record0000000001",
+		Desc:      true,
+		Query:     Fingerprint([]string{"desc", ""}, nil),
+	}
+	got, err := codec.Decode(codec.Encode(want))
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if !got.CreatedAt.Equal(want.CreatedAt) || got.ID != want.ID || got.Desc != want.Desc || got.Query != want.Query {
+		t.Errorf("Decode() = %+v, want %+v", got, want)
+	}
+}
+
+func TestCodecRejectsTampering(t *testing.T) {
+	codec := NewCodec([]byte("secret"))
+	token := codec.Encode(Cursor{CreatedAt: time.Now(), ID: "record0000000001"})
+	payload, signature, _ := strings.Cut(token, ".")
+
+	forged := base64.RawURLEncoding.EncodeToString([]byte(`{"t":"2000-01-01T00:00:00Z","i":"x","d":false,"q":""}`))
+	tests := map[string]string{
+		"empty":             "",
+		"no signature":      payload,
+		"forged payload":    forged + "." + signature,
+		"bad signature":     payload + "." + base64.RawURLEncoding.EncodeToString([]byte("signature")),
+		"signature not b64": payload + ".!!!",
+		"other key":         NewCodec([]byte("other")).Encode(Cursor{ID: "record0000000001"}),
+		"payload not json":  signed(codec, "not json"),
+	}
+	for name, token := range tests {
+		if _, err := codec.Decode(token); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("Decode(%s) error = %v, want ErrInvalidCursor", name, err)
+		}
+	}
+}
+
+// signed signs payload as Encode does, without it being a cursor.
+func signed(codec Codec, payload string) string {
+	p := base64.RawURLEncoding.EncodeToString([]byte(payload))
+	return p + "." + base64.RawURLEncoding.EncodeToString(codec.(*hmacCodec).sign(p))
+}
+
+func TestFingerprint(t *testing.T) {
+	name := query.Field{Param: "name"}
+	birthDate := query.Field{Param: "birthDate"}
+	filters := []query.Filter{
+		{Field: name, Op: query.OpContains, Value: "ani"},
+		{Field: birthDate, Op: query.OpRange, Value: "2000-01-01,"},
+	}
+	base := Fingerprint([]string{"desc", "createdAt"}, filters)
+
+	reordered := []query.Filter{filters[1], filters[0]}
+	if got := Fingerprint([]string{"desc", "createdAt"}, reordered); got != base {
+		t.Errorf("Fingerprint() depends on the order of filters")
+	}
+	others := map[string]string{
+		"sort":      Fingerprint([]string{"desc", "-createdAt"}, filters),
+		"filter":    Fingerprint([]string{"desc", "createdAt"}, filters[:1]),
+		"operator":  Fingerprint([]string{"desc", "createdAt"}, []query.Filter{{Field: name, Op: query.OpPrefix, Value: "ani"}, filters[1]}),
+		"value":     Fingerprint([]string{"desc", "createdAt"}, []query.Filter{{Field: name, Op: query.OpContains, Value: "anj"}, filters[1]}),
+		"parameter": Fingerprint([]string{"descc", "reatedAt"}, filters),
+	}
+	for name, got := range others {
+		if got == base {
+			t.Errorf("Fingerprint() did not change with the %s", name)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	fingerprint := Fingerprint([]string{"desc", ""}, nil)
+	c := &Cursor{Query: fingerprint}
+	if err := c.Check(fingerprint); err != nil {
+		t.Errorf("Check() error = %v", err)
+	}
+	if err := c.Check(Fingerprint([]string{"asc", ""}, nil)); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("Check() of another listing error = %v, want ErrInvalidCursor", err)
+	}
+}
+
+func TestCondition(t *testing.T) {
+	at := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		desc bool
+		want string
+	}{
+		{desc: false, want: "(created_at, id) > ($1, $2)"},
+		{desc: true, want: "(created_at, id) < ($1, $2)"},
+	}
+	for _, tt := range tests {
+		b := query.NewBuilder()
+		c := &Cursor{CreatedAt: at, ID: "x", Desc: tt.desc}
+		if got := c.Condition("created_at", "id").SQL(b); got != tt.want {
+			t.Errorf("Condition() = %q, want %q", got, tt.want)
+		}
+		if args := b.Args(); len(args) != 2 || args[0] != at || args[1] != "x" {
+			t.Errorf("Condition() args = %v", args)
+		}
+	}
+}
@@ -3,24 +3,15 @@ package db
 import (
 	"context"
 	"database/sql"
-	"fmt"
-	"os"
-	"regexp"
-	"strconv"
-	"strings"
 
-	"github.com/golang-migrate/migrate/v4"
-	"github.com/golang-migrate/migrate/v4/database/postgres"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
 	_ "github.com/jackc/pgx/v5/stdlib"
-	"github.com/rs/zerolog/log"
 )
 
 type DB struct {
 	sqlDB *sql.DB
 }
 
-func Connect(dbURL string) (*DB, error) {
+func Connect(dbURL string, maxOpenConns, maxIdleConns int) (*DB, error) {
 	db, err := sql.Open("pgx", dbURL)
 	if err != nil {
 		return nil, err
@@ -29,8 +20,8 @@ func Connect(dbURL string) (*DB, error) {
 	if err != nil {
 		return nil, err
 	}
-	db.SetMaxIdleConns(25)
-	db.SetMaxOpenConns(25)
+	db.SetMaxIdleConns(maxIdleConns)
+	db.SetMaxOpenConns(maxOpenConns)
 	return &DB{sqlDB: db}, nil
 }
 
@@ -38,98 +29,43 @@ func (db *DB) DB() *sql.DB {
 	return db.sqlDB
 }
 
-func (db *DB) StartTx(ctx context.Context, f func(*sql.Tx) error) error {
-	tx, err := db.sqlDB.BeginTx(ctx, &sql.TxOptions{})
+// ExactCountLimit is the size above which a list narrowed by nothing
+// reports the planner's estimate of its table as its total rather than
+// counting every row.
+const ExactCountLimit = 100000
+
+// WindowCount is the column list queries select to count, in the same
+// query, every row their conditions select regardless of the page.
+const WindowCount = "COUNT(*) OVER()"
+
+// EstimateTotal returns the planner's estimate of the rows in table, and
+// true when it is above ExactCountLimit. Only a list that nothing
+// narrows may use it, since only then does the estimate describe the
+// rows listed; other lists, and lists of smaller tables, count with
+// WindowCount. The estimate is cheap but only as fresh as the last
+// ANALYZE.
+func (db *DB) EstimateTotal(ctx context.Context, table string) (int, bool, error) {
+	var n float64
+	err := db.sqlDB.QueryRowContext(ctx, `SELECT reltuples FROM pg_class WHERE oid = to_regclass($1)`, table).Scan(&n)
 	if err != nil {
-		return err
+		return 0, false, err
 	}
-	err = f(tx)
-	if err != nil {
-		tx.Rollback()
-		return err
+	// never analyzed tables report -1
+	if n <= ExactCountLimit {
+		return 0, false, nil
 	}
-	return tx.Commit()
+	return int(n), true, nil
 }
 
-func (db *DB) UpMigration() error {
-	m, err := db.createMigrate()
+func (db *DB) StartTx(ctx context.Context, f func(*sql.Tx) error) error {
+	tx, err := db.sqlDB.BeginTx(ctx, &sql.TxOptions{})
 	if err != nil {
 		return err
 	}
-
-	limit := 0
-	for {
-		if err = m.Up(); err != nil {
-			err = db.migrationErrorHandler(err, m)
-		}
-		if err == nil {
-			log.Info().Msg("Successfully running up migrations.")
-			return nil
-		}
-
-		limit += 1
-		if limit == 5 {
-			log.Error().Msg("Failed running up migrations.")
-			return err
-		}
-	}
-}
-
-func (db *DB) DownMigration() error {
-	m, err := db.createMigrate()
+	err = f(tx)
 	if err != nil {
+		tx.Rollback()
 		return err
 	}
-
-	limit := 0
-	for {
-		if err = m.Down(); err != nil {
-			err = db.migrationErrorHandler(err, m)
-		}
-		if err == nil {
-			log.Info().Msg("Successfully running down migrations.")
-			return nil
-		}
-
-		limit += 1
-		if limit == 5 {
-			log.Info().Msg("Failed running down migrations.")
-			return err
-		}
-	}
-}
-
-func (db *DB) createMigrate() (*migrate.Migrate, error) {
-	driver, err := postgres.WithInstance(db.sqlDB, &postgres.Config{})
-	if err != nil {
-		return nil, err
-	}
-
-	m, err := migrate.NewWithDatabaseInstance(
-		os.Getenv("MIGRATIONS_URI"),
-		"postgres", driver)
-	if err != nil {
-		return nil, err
-	}
-
-	return m, nil
-}
-
-func (db *DB) migrationErrorHandler(err error, m *migrate.Migrate) error {
-	log.Info().Msg(fmt.Sprintf("migration: handling error: %v", err))
-	if strings.Contains(err.Error(), "Dirty database") {
-		re := regexp.MustCompile("[0-9]+")
-		s := re.FindAllString(err.Error(), -1)
-
-		if len(s) > 0 {
-			version, _ := strconv.Atoi(s[0])
-			err := m.Force(version)
-			if err != nil {
-				return err
-			}
-		}
-	} else if err == migrate.ErrNoChange {
-		return nil
-	}
-	return err
+	return tx.Commit()
 }
@@ -0,0 +1,38 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+)
+
+func TestEstimateTotal(t *testing.T) {
+	tests := []struct {
+		reltuples     float64
+		want          int
+		wantEstimated bool
+	}{
+		{reltuples: 2.5e6, want: 2500000, wantEstimated: true},
+		{reltuples: ExactCountLimit, want: 0, wantEstimated: false},
+		{reltuples: 42, want: 0, wantEstimated: false},
+		// never analyzed
+		{reltuples: -1, want: 0, wantEstimated: false},
+	}
+	for _, tt := range tests {
+		var table any
+		fake := &fakeDB{respond: func(query string, args []any) ([]string, [][]driver.Value, error) {
+			table = args[0]
+			return []string{"reltuples"}, [][]driver.Value{{tt.reltuples}}, nil
+		}}
+		n, estimated, err := fake.open().EstimateTotal(context.Background(), "users")
+		if err != nil {
+			t.Fatalf("EstimateTotal() error = %v", err)
+		}
+		if n != tt.want || estimated != tt.wantEstimated {
+			t.Errorf("EstimateTotal() with reltuples %v = %d, %t, want %d, %t", tt.reltuples, n, estimated, tt.want, tt.wantEstimated)
+		}
+		if table != "users" {
+			t.Errorf("EstimateTotal() looked up %v, want users", table)
+		}
+	}
+}
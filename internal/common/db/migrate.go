@@ -0,0 +1,247 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrDirty                = errors.New("database is dirty")
+	ErrInvalidMigrationName = errors.New("migration names may only have lowercase letters, digits and underscores")
+)
+
+var migrationNamePattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// Migration is a migration file pair and whether it has been applied.
+type Migration struct {
+	Version uint
+	Name    string
+	Applied bool
+}
+
+// MigrationStatus is the version the database is at, nil when no
+// migration has been applied, and every migration known.
+type MigrationStatus struct {
+	Version    *uint
+	Dirty      bool
+	Migrations []Migration
+}
+
+// Migrator migrates the database. A migration that failed leaves the
+// database dirty at its version; the migrator then refuses to migrate
+// until the version is forced, unless it was created to force dirty
+// versions itself.
+type Migrator struct {
+	m          *migrate.Migrate
+	source     source.Driver
+	forceDirty bool
+}
+
+// NewMigrator creates a migrator applying the migrations in files, named
+// like 000001_init_users.up.sql. With forceDirty, a dirty version is
+// assumed not to have taken effect and is retried. Migrations run as a
+// single statement batch, which Postgres rolls back as a whole when a
+// statement fails, so this holds unless a migration commits partway.
+func (db *DB) NewMigrator(files fs.FS, forceDirty bool) (*Migrator, error) {
+	src, err := iofs.New(files, ".")
+	if err != nil {
+		return nil, err
+	}
+	// the driver closes the *sql.DB it is given along with itself, so it
+	// only gets a connection of the pool the application keeps using
+	ctx := context.Background()
+	conn, err := db.sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	driver, err := postgres.WithConnection(ctx, conn, &postgres.Config{})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	m, err := migrate.NewWithInstance("iofs", src, "postgres", driver)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	m.Log = migrateLogger{}
+	return &Migrator{m: m, source: src, forceDirty: forceDirty}, nil
+}
+
+// Close returns the connection the migrator holds to the pool; the
+// database stays open.
+func (mg *Migrator) Close() error {
+	srcErr, dbErr := mg.m.Close()
+	return errors.Join(srcErr, dbErr)
+}
+
+// Migrate applies every migration in files not applied yet, as
+// NewMigrator and Up do.
+func (db *DB) Migrate(files fs.FS, forceDirty bool) error {
+	mg, err := db.NewMigrator(files, forceDirty)
+	if err != nil {
+		return err
+	}
+	defer mg.Close()
+	return mg.Up()
+}
+
+// Up applies every migration not applied yet.
+func (mg *Migrator) Up() error {
+	if err := mg.checkDirty(); err != nil {
+		return err
+	}
+	return ignoreNoChange(mg.m.Up())
+}
+
+// Down reverts the last n migrations.
+func (mg *Migrator) Down(n int) error {
+	if n <= 0 {
+		return fmt.Errorf("number of migrations to revert must be positive, got %d", n)
+	}
+	if err := mg.checkDirty(); err != nil {
+		return err
+	}
+	return ignoreNoChange(mg.m.Steps(-n))
+}
+
+// Goto migrates up or down to version.
+func (mg *Migrator) Goto(version uint) error {
+	if err := mg.checkDirty(); err != nil {
+		return err
+	}
+	return ignoreNoChange(mg.m.Migrate(version))
+}
+
+// Force sets the version without running migrations, clearing the dirty
+// state; -1 means no migration is applied.
+func (mg *Migrator) Force(version int) error {
+	if version < database.NilVersion {
+		return fmt.Errorf("invalid version %d", version)
+	}
+	return mg.m.Force(version)
+}
+
+func (mg *Migrator) Status() (*MigrationStatus, error) {
+	status := &MigrationStatus{Migrations: make([]Migration, 0)}
+	version, dirty, err := mg.m.Version()
+	if err != nil && !errors.Is(err, migrate.ErrNilVersion) {
+		return nil, err
+	}
+	if err == nil {
+		status.Version, status.Dirty = &version, dirty
+	}
+
+	v, err := mg.source.First()
+	for err == nil {
+		r, identifier, readErr := mg.source.ReadUp(v)
+		if readErr != nil {
+			return nil, readErr
+		}
+		r.Close()
+		status.Migrations = append(status.Migrations, Migration{
+			Version: v,
+			Name:    identifier,
+			Applied: status.Version != nil && v <= *status.Version && !(dirty && v == version),
+		})
+		v, err = mg.source.Next(v)
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return status, nil
+}
+
+// checkDirty returns ErrDirty when the last migration failed, unless the
+// migrator forces dirty versions, in which case the version before is
+// forced so the failed migration runs again.
+func (mg *Migrator) checkDirty() error {
+	version, dirty, err := mg.m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return nil
+	}
+	if err != nil || !dirty {
+		return err
+	}
+
+	previous := database.NilVersion
+	if v, err := mg.source.Prev(version); err == nil {
+		previous = int(v)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if !mg.forceDirty {
+		return fmt.Errorf("%w at version %d: once it is fixed, force version %d if the migration took effect or %d if it did not",
+			ErrDirty, version, version, previous)
+	}
+	log.Warn().Msg(fmt.Sprintf("Database is dirty at version %d, forcing version %d to run it again", version, previous))
+	return mg.m.Force(previous)
+}
+
+func ignoreNoChange(err error) error {
+	if errors.Is(err, migrate.ErrNoChange) {
+		return nil
+	}
+	return err
+}
+
+// CreateMigration writes empty up and down files of a migration named
+// name into dir, numbered after the last migration there, and returns
+// their paths.
+func CreateMigration(dir, name string) (string, string, error) {
+	if !migrationNamePattern.MatchString(name) {
+		return "", "", ErrInvalidMigrationName
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", "", err
+	}
+	var last uint64
+	for _, entry := range entries {
+		prefix, _, ok := strings.Cut(entry.Name(), "_")
+		if !ok || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+		if v, err := strconv.ParseUint(prefix, 10, 64); err == nil && v > last {
+			last = v
+		}
+	}
+
+	base := filepath.Join(dir, fmt.Sprintf("%06d_%s", last+1, name))
+	up, down := base+".up.sql", base+".down.sql"
+	for _, path := range []string{up, down} {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			return "", "", err
+		}
+		if err = f.Close(); err != nil {
+			return "", "", err
+		}
+	}
+	return up, down, nil
+}
+
+// migrateLogger writes what golang-migrate does to the log.
+type migrateLogger struct{}
+
+func (migrateLogger) Printf(format string, v ...any) {
+	log.Info().Msg(strings.TrimSpace(fmt.Sprintf(format, v...)))
+}
+
+func (migrateLogger) Verbose() bool {
+	return false
+}
@@ -0,0 +1,156 @@
+package db
+
+import (
+	"database/sql/driver"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+var testMigrations = fstest.MapFS{
+	"000001_init_users.up.sql":      {Data: []byte("CREATE TABLE users ();")},
+	"000001_init_users.down.sql":    {Data: []byte("DROP TABLE users;")},
+	"000002_init_patients.up.sql":   {Data: []byte("CREATE TABLE patients ();")},
+	"000002_init_patients.down.sql": {Data: []byte("DROP TABLE patients;")},
+}
+
+// migrationsDB is Postgres as golang-migrate sees it, with the
+// schema_migrations table at version, or empty when version is -1.
+func migrationsDB(version int64, dirty bool) *fakeDB {
+	return &fakeDB{respond: func(query string, args []any) ([]string, [][]driver.Value, error) {
+		switch {
+		case strings.Contains(query, "CURRENT_DATABASE()"):
+			return []string{"current_database"}, [][]driver.Value{{"halosuster"}}, nil
+		case strings.Contains(query, "CURRENT_SCHEMA()"):
+			return []string{"current_schema"}, [][]driver.Value{{"public"}}, nil
+		case strings.Contains(query, "information_schema.tables"):
+			return []string{"count"}, [][]driver.Value{{int64(1)}}, nil
+		case strings.HasPrefix(query, "SELECT version, dirty"):
+			if version < 0 {
+				return []string{"version", "dirty"}, nil, nil
+			}
+			return []string{"version", "dirty"}, [][]driver.Value{{version, dirty}}, nil
+		case strings.HasPrefix(query, "TRUNCATE"):
+			version = -1
+		case strings.HasPrefix(query, "INSERT INTO"):
+			version, dirty = args[0].(int64), args[1].(bool)
+		}
+		return nil, nil, nil
+	}}
+}
+
+func TestMigrateKeepsDatabaseOpen(t *testing.T) {
+	fake := migrationsDB(-1, false)
+	db := fake.open()
+	if err := db.Migrate(testMigrations, false); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	if err := db.DB().Ping(); err != nil {
+		t.Fatalf("Ping() after Migrate() error = %v", err)
+	}
+	for _, stmt := range []string{"CREATE TABLE users ();", "CREATE TABLE patients ();"} {
+		if !slices.Contains(fake.statements, stmt) {
+			t.Errorf("Migrate() did not run %q", stmt)
+		}
+	}
+}
+
+func TestCheckDirty(t *testing.T) {
+	fake := migrationsDB(2, true)
+	mg, err := fake.open().NewMigrator(testMigrations, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mg.Close()
+	err = mg.Up()
+	if !errors.Is(err, ErrDirty) {
+		t.Fatalf("Up() error = %v, want ErrDirty", err)
+	}
+	if want := "force version 2 if the migration took effect or 1 if it did not"; !strings.Contains(err.Error(), want) {
+		t.Errorf("Up() error = %q, want it to say %q", err, want)
+	}
+	if slices.Contains(fake.statements, "CREATE TABLE patients ();") {
+		t.Error("Up() ran a migration on a dirty database")
+	}
+}
+
+func TestCheckDirtyForced(t *testing.T) {
+	tests := []struct {
+		version int64
+		want    []string
+	}{
+		{version: 2, want: []string{"CREATE TABLE patients ();"}},
+		// a failed first migration has no version before it
+		{version: 1, want: []string{"CREATE TABLE users ();", "CREATE TABLE patients ();"}},
+	}
+	for _, tt := range tests {
+		fake := migrationsDB(tt.version, true)
+		mg, err := fake.open().NewMigrator(testMigrations, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = mg.Up(); err != nil {
+			t.Fatalf("Up() at dirty version %d error = %v", tt.version, err)
+		}
+		mg.Close()
+		var ran []string
+		for _, stmt := range fake.statements {
+			if strings.HasPrefix(stmt, "CREATE TABLE") {
+				ran = append(ran, stmt)
+			}
+		}
+		if !slices.Equal(ran, tt.want) {
+			t.Errorf("Up() at dirty version %d ran %q, want %q", tt.version, ran, tt.want)
+		}
+	}
+}
+
+func TestStatus(t *testing.T) {
+	mg, err := migrationsDB(1, false).open().NewMigrator(testMigrations, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mg.Close()
+	status, err := mg.Status()
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	want := []Migration{
+		{Version: 1, Name: "init_users", Applied: true},
+		{Version: 2, Name: "init_patients", Applied: false},
+	}
+	if status.Version == nil || *status.Version != 1 || status.Dirty || !slices.Equal(status.Migrations, want) {
+		t.Errorf("Status() = %+v", status)
+	}
+}
+
+func TestCreateMigration(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"000001_init_users.up.sql", "000009_add_index.down.sql", "README.md", "x_y.sql"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	up, down, err := CreateMigration(dir, "add_wards")
+	if err != nil {
+		t.Fatalf("CreateMigration() error = %v", err)
+	}
+	if up != filepath.Join(dir, "000010_add_wards.up.sql") || down != filepath.Join(dir, "000010_add_wards.down.sql") {
+		t.Errorf("CreateMigration() = %s, %s", up, down)
+	}
+	for _, path := range []string{up, down} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("CreateMigration() did not write %s: %v", path, err)
+		}
+	}
+
+	for _, name := range []string{"", "Add_Wards", "add-wards", "../wards"} {
+		if _, _, err := CreateMigration(dir, name); !errors.Is(err, ErrInvalidMigrationName) {
+			t.Errorf("CreateMigration(%q) error = %v, want ErrInvalidMigrationName", name, err)
+		}
+	}
+}
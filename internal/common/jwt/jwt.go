@@ -3,29 +3,43 @@ package jwt
 import (
 	"errors"
 	"fmt"
-	"os"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
 var (
-	key = []byte(os.Getenv("JWT_SECRET"))
-
 	ErrUnknownClaims = errors.New("unknown claims type")
 	ErrTokenInvalid  = errors.New("invalid token")
 )
 
 type CustomClaims struct {
 	UserType string `json:"userType"`
+	// Roles are those granted to the user when the token was issued.
+	Roles []string `json:"roles,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func Sign(ttl time.Duration, subject string, userType string) (string, error) {
+// Signer issues and verifies access tokens signed with HMAC-SHA256.
+type Signer interface {
+	Sign(ttl time.Duration, subject string, userType string, roles []string) (string, error)
+	Verify(tokenString string) (*CustomClaims, error)
+}
+
+type hmacSigner struct {
+	key []byte
+}
+
+func NewSigner(key []byte) Signer {
+	return &hmacSigner{key: key}
+}
+
+func (s *hmacSigner) Sign(ttl time.Duration, subject string, userType string, roles []string) (string, error) {
 	now := time.Now()
 	expiry := now.Add(ttl)
 	claims := CustomClaims{
 		userType,
+		roles,
 		jwt.RegisteredClaims{
 			// A usual scenario is to set the expiration time relative to the current time
 			ExpiresAt: jwt.NewNumericDate(expiry),
@@ -38,29 +52,29 @@ func Sign(ttl time.Duration, subject string, userType string) (string, error) {
 		jwt.SigningMethodHS256,
 		claims,
 	)
-	return t.SignedString(key)
+	return t.SignedString(s.key)
 }
 
-func VerifyAndGetSubject(tokenString string) (string, string, error) {
+func (s *hmacSigner) Verify(tokenString string) (*CustomClaims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &CustomClaims{}, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
 		}
 
-		return key, nil
+		return s.key, nil
 	})
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
 
 	// Checking token validity
 	if !token.Valid {
-		return "", "", ErrTokenInvalid
+		return nil, ErrTokenInvalid
 	}
 
 	if claims, ok := token.Claims.(*CustomClaims); ok {
-		return claims.Subject, claims.UserType, nil
+		return claims, nil
 	} else {
-		return "", "", ErrUnknownClaims
+		return nil, ErrUnknownClaims
 	}
 }
@@ -3,51 +3,54 @@ package middleware
 import (
 	"context"
 	"net/http"
+	"slices"
 
 	"github.com/citadel-corp/halosuster/internal/common/jwt"
 )
 
 type ContextAuthKey struct{}
 
-func AuthorizeITUser(next func(w http.ResponseWriter, r *http.Request)) func(w http.ResponseWriter, r *http.Request) {
-	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
+// ContextUserTypeKey holds the user type of the token, "IT" or "Nurse".
+type ContextUserTypeKey struct{}
 
-		tokenString := r.Header.Get("Authorization")
-		if tokenString == "" {
-			w.WriteHeader(http.StatusUnauthorized)
-			return
-		}
+// Authorizer lets requests through when they carry a valid access token.
+type Authorizer struct {
+	tokens jwt.Signer
+}
 
-		if len(tokenString) <= len("Bearer ") {
-			w.WriteHeader(http.StatusUnauthorized)
-			return
-		}
+func NewAuthorizer(tokens jwt.Signer) *Authorizer {
+	return &Authorizer{tokens: tokens}
+}
 
-		tokenString = tokenString[len("Bearer "):]
-		if tokenString == "" {
-			w.WriteHeader(http.StatusUnauthorized)
-			return
-		}
+func (a *Authorizer) AuthorizeITUser(next func(w http.ResponseWriter, r *http.Request)) func(w http.ResponseWriter, r *http.Request) {
+	return a.authorize(next, func(claims *jwt.CustomClaims) bool {
+		return claims.UserType == "IT"
+	})
+}
 
-		subject, userType, err := jwt.VerifyAndGetSubject(tokenString)
-		if err != nil {
-			w.WriteHeader(http.StatusUnauthorized)
-			return
-		}
-		if userType != "IT" {
-			w.WriteHeader(http.StatusUnauthorized)
-			return
-		}
+func (a *Authorizer) AuthorizeITAndNurseUser(next func(w http.ResponseWriter, r *http.Request)) func(w http.ResponseWriter, r *http.Request) {
+	return a.authorize(next, func(claims *jwt.CustomClaims) bool {
+		return true
+	})
+}
 
-		ctx := context.WithValue(r.Context(), ContextAuthKey{}, subject)
-		r = r.WithContext(ctx)
+// AuthorizeITUserOrNurseRole lets IT users through, and nurses who were
+// granted role when they logged in.
+func (a *Authorizer) AuthorizeITUserOrNurseRole(role string, next func(w http.ResponseWriter, r *http.Request)) func(w http.ResponseWriter, r *http.Request) {
+	return a.authorize(next, func(claims *jwt.CustomClaims) bool {
+		return claims.UserType == "IT" || (claims.UserType == "Nurse" && slices.Contains(claims.Roles, role))
+	})
+}
 
-		next(w, r)
-	}
+// AuthorizeNurseRole lets through only nurses who were granted role when
+// they logged in.
+func (a *Authorizer) AuthorizeNurseRole(role string, next func(w http.ResponseWriter, r *http.Request)) func(w http.ResponseWriter, r *http.Request) {
+	return a.authorize(next, func(claims *jwt.CustomClaims) bool {
+		return claims.UserType == "Nurse" && slices.Contains(claims.Roles, role)
+	})
 }
 
-func AuthorizeITAndNurseUser(next func(w http.ResponseWriter, r *http.Request)) func(w http.ResponseWriter, r *http.Request) {
+func (a *Authorizer) authorize(next func(w http.ResponseWriter, r *http.Request), allowed func(claims *jwt.CustomClaims) bool) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 
@@ -68,13 +71,18 @@ func AuthorizeITAndNurseUser(next func(w http.ResponseWriter, r *http.Request))
 			return
 		}
 
-		subject, _, err := jwt.VerifyAndGetSubject(tokenString)
+		claims, err := a.tokens.Verify(tokenString)
 		if err != nil {
 			w.WriteHeader(http.StatusUnauthorized)
 			return
 		}
+		if !allowed(claims) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
 
-		ctx := context.WithValue(r.Context(), ContextAuthKey{}, subject)
+		ctx := context.WithValue(r.Context(), ContextAuthKey{}, claims.Subject)
+		ctx = context.WithValue(ctx, ContextUserTypeKey{}, claims.UserType)
 		r = r.WithContext(ctx)
 
 		next(w, r)
@@ -2,22 +2,27 @@ package password
 
 import (
 	"errors"
-	"os"
-	"strconv"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
-var (
-	costStr = os.Getenv("BCRYPT_SALT")
-)
+type Hasher interface {
+	Hash(plaintextPassword string) (string, error)
+	Matches(plaintextPassword, hashedPassword string) (bool, error)
+}
 
-func Hash(plaintextPassword string) (string, error) {
-	cost, err := strconv.Atoi(costStr)
-	if err != nil {
-		return "", err
-	}
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(plaintextPassword), cost)
+type bcryptHasher struct {
+	cost int
+}
+
+// NewHasher creates a hasher hashing new passwords with the bcrypt cost.
+// Existing hashes are matched at whatever cost they were made with.
+func NewHasher(cost int) Hasher {
+	return &bcryptHasher{cost: cost}
+}
+
+func (h *bcryptHasher) Hash(plaintextPassword string) (string, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(plaintextPassword), h.cost)
 	if err != nil {
 		return "", err
 	}
@@ -25,7 +30,7 @@ func Hash(plaintextPassword string) (string, error) {
 	return string(hashedPassword), nil
 }
 
-func Matches(plaintextPassword, hashedPassword string) (bool, error) {
+func (h *bcryptHasher) Matches(plaintextPassword, hashedPassword string) (bool, error) {
 	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(plaintextPassword))
 	if err != nil {
 		switch {
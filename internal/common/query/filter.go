@@ -0,0 +1,212 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidFilter = errors.New("invalid filter")
+	ErrInvalidSort   = errors.New("invalid sort")
+)
+
+type Op string
+
+const (
+	OpEq       Op = "eq"
+	OpPrefix   Op = "prefix"
+	OpContains Op = "contains"
+	OpRange    Op = "range"
+)
+
+// Kind is the type of the values of a filtered column.
+type Kind int
+
+const (
+	KindText Kind = iota
+	KindInt
+	// KindDate values are written as YYYY-MM-DD.
+	KindDate
+)
+
+// parse converts a value compared as is, rather than as text, to the
+// kind of its column.
+func (k Kind) parse(s string) (any, error) {
+	switch k {
+	case KindInt:
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return n, nil
+		}
+		return nil, fmt.Errorf("%q is not an integer", s)
+	case KindDate:
+		if t, err := time.Parse(time.DateOnly, s); err == nil {
+			return t, nil
+		}
+		return nil, fmt.Errorf("%q is not a date written as YYYY-MM-DD", s)
+	default:
+		return s, nil
+	}
+}
+
+// Field whitelists a query string parameter that may be used as a filter.
+// Clients pass either `param=value`, which uses DefaultOp, or
+// `param[op]=value` with any operator listed in Ops. Range values are
+// written as `from,to` with either side optional.
+type Field struct {
+	Param     string
+	Column    string
+	DefaultOp Op
+	Ops       []Op
+	// Fold makes text comparisons case-insensitive.
+	Fold bool
+	// Exists is set for columns of a one-to-many table; the filter then
+	// matches when any related row does. See Exists.
+	Exists string
+	// Kind is checked by ParseFilters for OpEq and OpRange values, which
+	// are compared to the column as they are rather than as text.
+	Kind Kind
+}
+
+func (f Field) allows(op Op) bool {
+	return op == f.DefaultOp || slices.Contains(f.Ops, op)
+}
+
+type Filter struct {
+	Field Field
+	Op    Op
+	Value string
+}
+
+// Condition renders the filter against its field's column.
+func (f Filter) Condition() Condition {
+	if f.Field.Exists != "" {
+		return Exists(f.Field.Exists, f.columnCondition())
+	}
+	return f.columnCondition()
+}
+
+func (f Filter) columnCondition() Condition {
+	// LIKE needs a text operand, so non-text columns are cast
+	column := f.Field.Column + "::text"
+	value := f.Value
+	if f.Field.Fold {
+		column = "LOWER(" + f.Field.Column + ")"
+		value = strings.ToLower(value)
+	}
+	switch f.Op {
+	case OpPrefix:
+		return Prefix(column, value)
+	case OpContains:
+		return Contains(column, value)
+	case OpRange:
+		from, to, _ := strings.Cut(value, ",")
+		return Range(f.Field.Column, f.Field.bound(from), f.Field.bound(to))
+	default:
+		if f.Field.Fold {
+			return Eq(column, value)
+		}
+		return Eq(f.Field.Column, f.Field.value(f.Value))
+	}
+}
+
+// value is s as the kind of the field's column. ParseFilters has checked
+// it can be parsed; a value that cannot is compared as text.
+func (f Field) value(s string) any {
+	v, err := f.Kind.parse(s)
+	if err != nil {
+		return s
+	}
+	return v
+}
+
+// bound is the end of a range written as s, which is open when empty.
+func (f Field) bound(s string) Bound {
+	if s == "" {
+		return Unbounded
+	}
+	return At(f.value(s))
+}
+
+// check reports why value cannot be compared to the field's column with
+// op, if it cannot.
+func (f Field) check(op Op, value string) error {
+	switch {
+	case op == OpRange:
+		from, to, ok := strings.Cut(value, ",")
+		if !ok {
+			return errors.New("range must be written as from,to")
+		}
+		for _, v := range []string{from, to} {
+			if v == "" {
+				continue
+			}
+			if _, err := f.Kind.parse(v); err != nil {
+				return err
+			}
+		}
+	case op == OpEq && !f.Fold:
+		_, err := f.Kind.parse(value)
+		return err
+	}
+	return nil
+}
+
+// ParseFilters reads the whitelisted fields from values. Unknown
+// parameters are ignored; a known parameter with an operator the field
+// does not allow is an error.
+func ParseFilters(values url.Values, fields []Field) ([]Filter, error) {
+	res := make([]Filter, 0)
+	for key := range values {
+		param, op, err := splitKey(key)
+		if err != nil {
+			return nil, err
+		}
+		idx := slices.IndexFunc(fields, func(f Field) bool { return f.Param == param })
+		if idx < 0 {
+			continue
+		}
+		field := fields[idx]
+		if op == "" {
+			op = field.DefaultOp
+		}
+		if !field.allows(op) {
+			return nil, fmt.Errorf("%w: operator %q is not supported for %s", ErrInvalidFilter, op, param)
+		}
+		value := values.Get(key)
+		if value == "" {
+			continue
+		}
+		if err = field.check(op, value); err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidFilter, param, err)
+		}
+		res = append(res, Filter{Field: field, Op: op, Value: value})
+	}
+	// map iteration is random; keep the generated SQL stable
+	slices.SortFunc(res, func(a, b Filter) int { return strings.Compare(a.Field.Param, b.Field.Param) })
+	return res, nil
+}
+
+// Conditions converts filters into conditions ready to be grouped with And or Or.
+func Conditions(filters []Filter) []Condition {
+	res := make([]Condition, len(filters))
+	for i, f := range filters {
+		res[i] = f.Condition()
+	}
+	return res
+}
+
+func splitKey(key string) (string, Op, error) {
+	open := strings.IndexByte(key, '[')
+	if open < 0 {
+		return key, "", nil
+	}
+	if !strings.HasSuffix(key, "]") {
+		return "", "", fmt.Errorf("%w: malformed parameter %q", ErrInvalidFilter, key)
+	}
+	return key[:open], Op(key[open+1 : len(key)-1]), nil
+}
@@ -0,0 +1,160 @@
+package query
+
+import (
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var testFields = []Field{
+	{Param: "identityNumber", Column: "identity_number", DefaultOp: OpEq, Ops: []Op{OpPrefix}, Kind: KindInt},
+	{Param: "name", Column: "name", DefaultOp: OpContains, Ops: []Op{OpEq, OpPrefix}, Fold: true},
+	{Param: "birthDate", Column: "birth_date", DefaultOp: OpEq, Ops: []Op{OpRange}, Kind: KindDate},
+	{Param: "diagnosis", Column: "d.code", DefaultOp: OpEq, Exists: "SELECT 1 FROM d WHERE d.record_id = r.id"},
+}
+
+func TestParseFilters(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		want      []Filter
+		wantError bool
+	}{
+		{
+			name:  "default operators",
+			query: "name=Ani&identityNumber=123",
+			want: []Filter{
+				{Field: testFields[0], Op: OpEq, Value: "123"},
+				{Field: testFields[1], Op: OpContains, Value: "Ani"},
+			},
+		},
+		{
+			name:  "explicit operator",
+			query: "name[prefix]=An&birthDate[range]=2000-01-01,",
+			want: []Filter{
+				{Field: testFields[2], Op: OpRange, Value: "2000-01-01,"},
+				{Field: testFields[1], Op: OpPrefix, Value: "An"},
+			},
+		},
+		{
+			name:  "unknown and empty parameters are ignored",
+			query: "limit=5&sort=name&name=",
+			want:  []Filter{},
+		},
+		{
+			name:      "operator not allowed",
+			query:     "identityNumber[contains]=12",
+			wantError: true,
+		},
+		{
+			name:      "range without comma",
+			query:     "birthDate[range]=2000-01-01",
+			wantError: true,
+		},
+		{
+			name:  "values compared as text are not parsed",
+			query: "identityNumber[prefix]=12a",
+			want:  []Filter{{Field: testFields[0], Op: OpPrefix, Value: "12a"}},
+		},
+		{
+			name:      "range bound not a date",
+			query:     "birthDate[range]=abc,",
+			wantError: true,
+		},
+		{
+			name:      "range bound out of range",
+			query:     "birthDate[range]=,2000-13-01",
+			wantError: true,
+		},
+		{
+			name:      "value not an integer",
+			query:     "identityNumber=12a",
+			wantError: true,
+		},
+		{
+			name:      "malformed parameter",
+			query:     "name[prefix=An",
+			wantError: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := ParseFilters(values, testFields)
+			if tt.wantError {
+				if !errors.Is(err, ErrInvalidFilter) {
+					t.Errorf("ParseFilters() error = %v, want ErrInvalidFilter", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseFilters() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseFilters() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterCondition(t *testing.T) {
+	tests := []struct {
+		name     string
+		filter   Filter
+		wantSQL  string
+		wantArgs []any
+	}{
+		{
+			name:     "eq",
+			filter:   Filter{Field: testFields[0], Op: OpEq, Value: "123"},
+			wantSQL:  "identity_number = $1",
+			wantArgs: []any{int64(123)},
+		},
+		{
+			name:     "prefix casts to text",
+			filter:   Filter{Field: testFields[0], Op: OpPrefix, Value: "12"},
+			wantSQL:  "identity_number::text LIKE $1",
+			wantArgs: []any{"12%"},
+		},
+		{
+			name:     "folded",
+			filter:   Filter{Field: testFields[1], Op: OpContains, Value: "ANI"},
+			wantSQL:  "LOWER(name) LIKE $1",
+			wantArgs: []any{"%ani%"},
+		},
+		{
+			name:     "folded eq",
+			filter:   Filter{Field: testFields[1], Op: OpEq, Value: "Ani"},
+			wantSQL:  "LOWER(name) = $1",
+			wantArgs: []any{"ani"},
+		},
+		{
+			name:     "range open below",
+			filter:   Filter{Field: testFields[2], Op: OpRange, Value: ",2000-12-31"},
+			wantSQL:  "birth_date <= $1",
+			wantArgs: []any{time.Date(2000, 12, 31, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:     "exists",
+			filter:   Filter{Field: testFields[3], Op: OpEq, Value: "A01.0"},
+			wantSQL:  "EXISTS (SELECT 1 FROM d WHERE d.record_id = r.id AND d.code = $1)",
+			wantArgs: []any{"A01.0"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBuilder()
+			if got := tt.filter.Condition().SQL(b); got != tt.wantSQL {
+				t.Errorf("Condition() = %q, want %q", got, tt.wantSQL)
+			}
+			if !reflect.DeepEqual(b.Args(), tt.wantArgs) {
+				t.Errorf("Condition() args = %v, want %v", b.Args(), tt.wantArgs)
+			}
+		})
+	}
+}
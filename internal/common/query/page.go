@@ -0,0 +1,21 @@
+package query
+
+const (
+	DefaultLimit = 5
+	MaxLimit     = 100
+)
+
+// NormalizePage applies the default limit, caps it at MaxLimit and
+// clamps a negative offset to zero.
+func NormalizePage(limit, offset int) (int, int) {
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	if limit > MaxLimit {
+		limit = MaxLimit
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return limit, offset
+}
@@ -0,0 +1,160 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Builder collects positional arguments while conditions are rendered,
+// so every value ends up as a $n placeholder instead of inside the SQL text.
+type Builder struct {
+	args []any
+}
+
+func NewBuilder() *Builder {
+	return &Builder{args: make([]any, 0)}
+}
+
+// Arg registers v as the next positional argument and returns its placeholder.
+func (b *Builder) Arg(v any) string {
+	b.args = append(b.args, v)
+	return fmt.Sprintf("$%d", len(b.args))
+}
+
+func (b *Builder) Args() []any {
+	return b.args
+}
+
+// Where renders c as a WHERE clause, or an empty string when c has no predicates.
+func (b *Builder) Where(c Condition) string {
+	sql := c.SQL(b)
+	if sql == "" {
+		return ""
+	}
+	return " WHERE " + sql
+}
+
+// Condition is a SQL predicate. SQL returns an empty string when the
+// condition does not constrain anything.
+type Condition interface {
+	SQL(b *Builder) string
+}
+
+type conditionFunc func(b *Builder) string
+
+func (f conditionFunc) SQL(b *Builder) string {
+	return f(b)
+}
+
+func Eq(column string, value any) Condition {
+	return conditionFunc(func(b *Builder) string {
+		return fmt.Sprintf("%s = %s", column, b.Arg(value))
+	})
+}
+
+func Prefix(column string, value string) Condition {
+	return conditionFunc(func(b *Builder) string {
+		return fmt.Sprintf("%s LIKE %s", column, b.Arg(escapeLike(value)+"%"))
+	})
+}
+
+func Contains(column string, value string) Condition {
+	return conditionFunc(func(b *Builder) string {
+		return fmt.Sprintf("%s LIKE %s", column, b.Arg("%"+escapeLike(value)+"%"))
+	})
+}
+
+// Bound is one end of a Range. The zero Bound, Unbounded, leaves it open.
+type Bound struct {
+	value  any
+	closed bool
+}
+
+var Unbounded = Bound{}
+
+// At bounds a Range at v, inclusively.
+func At(v any) Bound {
+	return Bound{value: v, closed: true}
+}
+
+// AtIfSet bounds a Range at *v, or leaves it open when v is nil.
+func AtIfSet[T any](v *T) Bound {
+	if v == nil {
+		return Unbounded
+	}
+	return At(*v)
+}
+
+// Range constrains column to [from, to].
+func Range(column string, from, to Bound) Condition {
+	return conditionFunc(func(b *Builder) string {
+		parts := make([]string, 0, 2)
+		if from.closed {
+			parts = append(parts, fmt.Sprintf("%s >= %s", column, b.Arg(from.value)))
+		}
+		if to.closed {
+			parts = append(parts, fmt.Sprintf("%s <= %s", column, b.Arg(to.value)))
+		}
+		return strings.Join(parts, " AND ")
+	})
+}
+
+// Raw embeds a hand-written predicate. Each ? in sql is replaced by the
+// placeholder of the matching argument.
+func Raw(sql string, args ...any) Condition {
+	return conditionFunc(func(b *Builder) string {
+		var sb strings.Builder
+		i := 0
+		for _, r := range sql {
+			if r == '?' && i < len(args) {
+				sb.WriteString(b.Arg(args[i]))
+				i++
+				continue
+			}
+			sb.WriteRune(r)
+		}
+		return sb.String()
+	})
+}
+
+// Exists matches rows for which subquery, narrowed by c, returns a row.
+// The subquery has to end in a WHERE clause, typically correlating it
+// with the outer row.
+func Exists(subquery string, c Condition) Condition {
+	return conditionFunc(func(b *Builder) string {
+		return "EXISTS (" + subquery + " AND " + c.SQL(b) + ")"
+	})
+}
+
+func And(conditions ...Condition) Condition {
+	return group(" AND ", conditions)
+}
+
+func Or(conditions ...Condition) Condition {
+	return group(" OR ", conditions)
+}
+
+func group(sep string, conditions []Condition) Condition {
+	return conditionFunc(func(b *Builder) string {
+		parts := make([]string, 0, len(conditions))
+		for _, c := range conditions {
+			if c == nil {
+				continue
+			}
+			if sql := c.SQL(b); sql != "" {
+				parts = append(parts, sql)
+			}
+		}
+		switch len(parts) {
+		case 0:
+			return ""
+		case 1:
+			return parts[0]
+		}
+		return "(" + strings.Join(parts, sep) + ")"
+	})
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
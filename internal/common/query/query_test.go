@@ -0,0 +1,148 @@
+package query
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuilder(t *testing.T) {
+	year := 2000
+	tests := []struct {
+		name      string
+		condition Condition
+		wantSQL   string
+		wantArgs  []any
+	}{
+		{
+			name:      "eq",
+			condition: Eq("name", "ani"),
+			wantSQL:   " WHERE name = $1",
+			wantArgs:  []any{"ani"},
+		},
+		{
+			name:      "prefix escapes wildcards",
+			condition: Prefix("name", `50%_a\b`),
+			wantSQL:   " WHERE name LIKE $1",
+			wantArgs:  []any{`50\%\_a\\b%`},
+		},
+		{
+			name:      "contains",
+			condition: Contains("name", "ani"),
+			wantSQL:   " WHERE name LIKE $1",
+			wantArgs:  []any{"%ani%"},
+		},
+		{
+			name:      "range",
+			condition: Range("birth_date", At("2000-01-01"), At("2000-12-31")),
+			wantSQL:   " WHERE birth_date >= $1 AND birth_date <= $2",
+			wantArgs:  []any{"2000-01-01", "2000-12-31"},
+		},
+		{
+			name:      "range open above",
+			condition: Range("birth_date", At("2000-01-01"), Unbounded),
+			wantSQL:   " WHERE birth_date >= $1",
+			wantArgs:  []any{"2000-01-01"},
+		},
+		{
+			name:      "range open below by a nil pointer",
+			condition: Range("created_at", AtIfSet((*int)(nil)), AtIfSet(&year)),
+			wantSQL:   " WHERE created_at <= $1",
+			wantArgs:  []any{2000},
+		},
+		{
+			name:      "range open",
+			condition: Range("birth_date", Unbounded, Unbounded),
+			wantSQL:   "",
+			wantArgs:  []any{},
+		},
+		{
+			name:      "raw",
+			condition: Raw("(created_at, id) < (?, ?) AND x = '?'", 1, 2),
+			wantSQL:   " WHERE (created_at, id) < ($1, $2) AND x = '?'",
+			wantArgs:  []any{1, 2},
+		},
+		{
+			name:      "and numbers placeholders in order",
+			condition: And(Eq("a", 1), nil, Range("b", Unbounded, Unbounded), Or(Eq("c", 2), Eq("d", 3))),
+			wantSQL:   " WHERE (a = $1 AND (c = $2 OR d = $3))",
+			wantArgs:  []any{1, 2, 3},
+		},
+		{
+			name:      "single condition is not grouped",
+			condition: And(Eq("a", 1)),
+			wantSQL:   " WHERE a = $1",
+			wantArgs:  []any{1},
+		},
+		{
+			name:      "empty and",
+			condition: And(),
+			wantSQL:   "",
+			wantArgs:  []any{},
+		},
+		{
+			name:      "exists",
+			condition: Exists("SELECT 1 FROM diagnoses WHERE diagnoses.record_id = records.id", Eq("diagnoses.code", "A01.0")),
+			wantSQL:   " WHERE EXISTS (SELECT 1 FROM diagnoses WHERE diagnoses.record_id = records.id AND diagnoses.code = $1)",
+			wantArgs:  []any{"A01.0"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBuilder()
+			if got := b.Where(tt.condition); got != tt.wantSQL {
+				t.Errorf("Where() = %q, want %q", got, tt.wantSQL)
+			}
+			if !reflect.DeepEqual(b.Args(), tt.wantArgs) {
+				t.Errorf("Args() = %v, want %v", b.Args(), tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestBuilderContinuesPlaceholders(t *testing.T) {
+	b := NewBuilder()
+	where := b.Where(Eq("a", 1))
+	limit := b.Arg(10)
+	if where != " WHERE a = $1" || limit != "$2" {
+		t.Errorf("got %q and %q, want placeholders $1 and $2", where, limit)
+	}
+}
+
+func TestParseSort(t *testing.T) {
+	allowed := map[string]string{"createdAt": "created_at", "name": "name"}
+	got, err := ParseSort("name, -createdAt", allowed)
+	if err != nil {
+		t.Fatalf("ParseSort() error = %v", err)
+	}
+	want := []Sort{{Column: "name"}, {Column: "created_at", Desc: true}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseSort() = %+v, want %+v", got, want)
+	}
+	if got := OrderBy(got); got != " ORDER BY name ASC, created_at DESC" {
+		t.Errorf("OrderBy() = %q", got)
+	}
+	if _, err = ParseSort("name,password", allowed); err == nil {
+		t.Error("ParseSort() accepted a key that is not allowed")
+	}
+	if got, _ := ParseSort("", allowed); len(got) != 0 || OrderBy(got) != "" {
+		t.Errorf("ParseSort(\"\") = %+v", got)
+	}
+}
+
+func TestNormalizePage(t *testing.T) {
+	tests := []struct {
+		limit, offset         int
+		wantLimit, wantOffset int
+	}{
+		{limit: 0, offset: 0, wantLimit: DefaultLimit, wantOffset: 0},
+		{limit: -1, offset: -5, wantLimit: DefaultLimit, wantOffset: 0},
+		{limit: 20, offset: 40, wantLimit: 20, wantOffset: 40},
+		{limit: MaxLimit + 1, offset: 0, wantLimit: MaxLimit, wantOffset: 0},
+	}
+	for _, tt := range tests {
+		limit, offset := NormalizePage(tt.limit, tt.offset)
+		if limit != tt.wantLimit || offset != tt.wantOffset {
+			t.Errorf("NormalizePage(%d, %d) = %d, %d, want %d, %d", tt.limit, tt.offset, limit, offset, tt.wantLimit, tt.wantOffset)
+		}
+	}
+}
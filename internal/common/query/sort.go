@@ -0,0 +1,48 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Sort struct {
+	Column string
+	Desc   bool
+}
+
+// ParseSort parses a comma separated list such as `name,-createdAt`.
+// A leading `-` sorts descending. Only keys present in allowed are
+// accepted; allowed maps the public key to its SQL column.
+func ParseSort(value string, allowed map[string]string) ([]Sort, error) {
+	res := make([]Sort, 0)
+	if value == "" {
+		return res, nil
+	}
+	for _, key := range strings.Split(value, ",") {
+		key = strings.TrimSpace(key)
+		desc := strings.HasPrefix(key, "-")
+		key = strings.TrimPrefix(key, "-")
+		column, ok := allowed[key]
+		if !ok {
+			return nil, fmt.Errorf("%w: cannot sort by %q", ErrInvalidSort, key)
+		}
+		res = append(res, Sort{Column: column, Desc: desc})
+	}
+	return res, nil
+}
+
+// OrderBy renders sorts as an ORDER BY clause, or an empty string.
+func OrderBy(sorts []Sort) string {
+	if len(sorts) == 0 {
+		return ""
+	}
+	parts := make([]string, len(sorts))
+	for i, s := range sorts {
+		dir := "ASC"
+		if s.Desc {
+			dir = "DESC"
+		}
+		parts[i] = s.Column + " " + dir
+	}
+	return " ORDER BY " + strings.Join(parts, ", ")
+}
@@ -13,9 +13,12 @@ type ResponseBody struct {
 }
 
 type Pagination struct {
-	Limit  int `json:"limit"`
-	Offset int `json:"offset"`
-	Total  int `json:"total"`
+	Limit     int  `json:"limit"`
+	Offset    int  `json:"offset"`
+	Total     int  `json:"total"`
+	Estimated bool `json:"estimated,omitempty"`
+	// NextCursor continues the listing with keyset paging; see package cursor.
+	NextCursor string `json:"nextCursor,omitempty"`
 }
 
 func JSON(w http.ResponseWriter, status int, data any) error {
@@ -0,0 +1,54 @@
+package response
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// PaginationLinks builds a Link header pointing at the previous and next
+// pages of the current request. The next link is omitted once the last
+// page is reached, unless the total is only an estimate. Requests paged
+// by cursor only get a next link, since cursors cannot walk backwards.
+func PaginationLinks(r *http.Request, meta *Pagination) http.Header {
+	headers := http.Header{}
+	if meta == nil || meta.Limit <= 0 {
+		return headers
+	}
+	if r.URL.Query().Get("cursor") != "" {
+		if meta.NextCursor != "" {
+			u := *r.URL
+			q := u.Query()
+			q.Set("cursor", meta.NextCursor)
+			q.Del("offset")
+			u.RawQuery = q.Encode()
+			headers.Set("Link", fmt.Sprintf(`<%s>; rel="next"`, u.RequestURI()))
+		}
+		return headers
+	}
+	links := make([]string, 0, 2)
+	if meta.Offset > 0 {
+		prev := meta.Offset - meta.Limit
+		if prev < 0 {
+			prev = 0
+		}
+		links = append(links, pageLink(r, meta.Limit, prev, "prev"))
+	}
+	if next := meta.Offset + meta.Limit; next < meta.Total || meta.Estimated {
+		links = append(links, pageLink(r, meta.Limit, next, "next"))
+	}
+	if len(links) > 0 {
+		headers.Set("Link", strings.Join(links, ", "))
+	}
+	return headers
+}
+
+func pageLink(r *http.Request, limit, offset int, rel string) string {
+	u := *r.URL
+	q := u.Query()
+	q.Set("limit", strconv.Itoa(limit))
+	q.Set("offset", strconv.Itoa(offset))
+	u.RawQuery = q.Encode()
+	return fmt.Sprintf(`<%s>; rel="%s"`, u.RequestURI(), rel)
+}
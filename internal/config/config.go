@@ -0,0 +1,192 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is every setting of the service. Settings are read from an
+// optional YAML file, then from the environment, which takes precedence.
+// The env tag names the variable of a setting; for secrets, a variable
+// of the same name suffixed with _FILE may instead name a file holding
+// the value, as Docker and Kubernetes secrets are mounted.
+//
+// Pointer, slice and map settings of the image and record policies are
+// overrides: left unset, the defaults of those domains apply.
+type Config struct {
+	HTTP     HTTP     `yaml:"http"`
+	Database Database `yaml:"database"`
+	Auth     Auth     `yaml:"auth"`
+	Records  Records  `yaml:"records"`
+	Images   Images   `yaml:"images"`
+}
+
+type HTTP struct {
+	Addr            string        `yaml:"addr" env:"HTTP_ADDR"`
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout" env:"HTTP_SHUTDOWN_TIMEOUT"`
+}
+
+type Database struct {
+	Host         string `yaml:"host" env:"DB_HOST"`
+	Port         string `yaml:"port" env:"DB_PORT"`
+	Username     string `yaml:"username" env:"DB_USERNAME"`
+	Password     string `yaml:"password" env:"DB_PASSWORD" secret:"true"`
+	Name         string `yaml:"name" env:"DB_NAME"`
+	Params       string `yaml:"params" env:"DB_PARAMS"`
+	MaxOpenConns int    `yaml:"maxOpenConns" env:"DB_MAX_OPEN_CONNS"`
+	MaxIdleConns int    `yaml:"maxIdleConns" env:"DB_MAX_IDLE_CONNS"`
+}
+
+type Auth struct {
+	JWTSecret string        `yaml:"jwtSecret" env:"JWT_SECRET" secret:"true"`
+	TokenTTL  time.Duration `yaml:"tokenTtl" env:"JWT_TTL"`
+	// BcryptCost keeps the variable name it has always had.
+	BcryptCost int `yaml:"bcryptCost" env:"BCRYPT_SALT"`
+	// CursorSecret signs pagination cursors. It defaults to JWTSecret.
+	CursorSecret string `yaml:"cursorSecret" env:"CURSOR_SECRET" secret:"true"`
+}
+
+type Records struct {
+	// SigningKey signs the hash chains of locked records, and must be at
+	// least 32 bytes. Changing it invalidates the signatures of every
+	// record locked before.
+	SigningKey          string        `yaml:"signingKey" env:"RECORD_SIGNING_KEY" secret:"true"`
+	GracePeriod         time.Duration `yaml:"gracePeriod" env:"RECORD_GRACE_PERIOD"`
+	AlertScore          *int          `yaml:"alertScore" env:"NEWS2_ALERT_SCORE"`
+	AlertParameterScore *int          `yaml:"alertParameterScore" env:"NEWS2_ALERT_PARAMETER_SCORE"`
+	// AlertWindow is how recent the observation raising an alert must be
+	// for the patient to be listed as deteriorating.
+	AlertWindow time.Duration `yaml:"alertWindow" env:"NEWS2_ALERT_WINDOW"`
+	// ICD10File is a CSV of the full ICD-10 tabulation, and is required
+	// unless ICD10Sample is set to make do with the built-in sample, in
+	// which most codes cannot be diagnosed.
+	ICD10File   string `yaml:"icd10File" env:"ICD10_FILE"`
+	ICD10Sample bool   `yaml:"icd10Sample" env:"ICD10_SAMPLE"`
+}
+
+type Images struct {
+	// Store is "s3" or "filesystem", for development without AWS.
+	Store   string        `yaml:"store" env:"IMAGE_STORE"`
+	S3      S3            `yaml:"s3"`
+	Dir     string        `yaml:"dir" env:"IMAGE_STORE_DIR"`
+	BaseURL string        `yaml:"baseUrl" env:"IMAGE_BASE_URL"`
+	URLTTL  time.Duration `yaml:"urlTtl" env:"IMAGE_URL_TTL"`
+
+	AllowedTypes []string `yaml:"allowedTypes" env:"IMAGE_ALLOWED_TYPES"`
+	MinSize      *int64   `yaml:"minSize" env:"IMAGE_MIN_SIZE"`
+	MaxSize      *int64   `yaml:"maxSize" env:"IMAGE_MAX_SIZE"`
+	// DocumentLimits are the size limits in bytes of resumable uploads
+	// by document type, given in the environment as type:bytes,...
+	DocumentLimits map[string]int64 `yaml:"documentLimits" env:"IMAGE_DOCUMENT_LIMITS"`
+	// Variants are name:size or name:WxH.
+	Variants      []string `yaml:"variants" env:"IMAGE_VARIANTS"`
+	VariantsEager bool     `yaml:"variantsEager" env:"IMAGE_VARIANTS_EAGER"`
+
+	GCGrace    time.Duration `yaml:"gcGrace" env:"IMAGE_GC_GRACE"`
+	GCInterval time.Duration `yaml:"gcInterval" env:"IMAGE_GC_INTERVAL"`
+
+	// ClamdAddress is where a ClamAV daemon listens. Without it uploads
+	// are not scanned for malware.
+	ClamdAddress string        `yaml:"clamdAddress" env:"CLAMD_ADDRESS"`
+	ClamdTimeout time.Duration `yaml:"clamdTimeout" env:"CLAMD_TIMEOUT"`
+	// UploadWorkers is how many resumable uploads are scanned and
+	// decoded at once; each may take hundreds of MB.
+	UploadWorkers int `yaml:"uploadWorkers" env:"IMAGE_UPLOAD_WORKERS"`
+}
+
+type S3 struct {
+	Region          string `yaml:"region" env:"AWS_REGION"`
+	Endpoint        string `yaml:"endpoint" env:"AWS_S3_ENDPOINT"`
+	Bucket          string `yaml:"bucket" env:"AWS_S3_BUCKET_NAME"`
+	AccessKeyID     string `yaml:"accessKeyId" env:"AWS_ACCESS_KEY_ID"`
+	SecretAccessKey string `yaml:"secretAccessKey" env:"AWS_SECRET_ACCESS_KEY" secret:"true"`
+	ForcePathStyle  bool   `yaml:"forcePathStyle" env:"AWS_S3_FORCE_PATH_STYLE"`
+}
+
+func Default() *Config {
+	return &Config{
+		HTTP: HTTP{
+			Addr:            ":8080",
+			ShutdownTimeout: 10 * time.Second,
+		},
+		Database: Database{
+			Port:         "5432",
+			MaxOpenConns: 25,
+			MaxIdleConns: 25,
+		},
+		Auth: Auth{
+			TokenTTL: 2 * time.Hour,
+		},
+		Records: Records{
+			GracePeriod: 24 * time.Hour,
+			AlertWindow: 24 * time.Hour,
+		},
+		Images: Images{
+			Store:         "s3",
+			S3:            S3{Region: "ap-southeast-1"},
+			Dir:           "uploads",
+			BaseURL:       "http://localhost:8080",
+			URLTTL:        15 * time.Minute,
+			GCGrace:       24 * time.Hour,
+			GCInterval:    time.Hour,
+			ClamdTimeout:  time.Minute,
+			UploadWorkers: 2,
+		},
+	}
+}
+
+// Load reads the configuration from the YAML file at path, unless path
+// is empty, and the environment, and validates it.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+	if path != "" {
+		if err := cfg.readFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.readEnv(); err != nil {
+		return nil, err
+	}
+	if cfg.Auth.CursorSecret == "" {
+		cfg.Auth.CursorSecret = cfg.Auth.JWTSecret
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// readFile rejects keys that name no setting, so a misspelt one is not
+// silently ignored.
+func (c *Config) readFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("cannot read config file: %w", err)
+	}
+	defer f.Close()
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err = dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// URL is the connection string of the database.
+func (d Database) URL() string {
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(d.Username, d.Password),
+		Host:     net.JoinHostPort(d.Host, d.Port),
+		Path:     "/" + d.Name,
+		RawQuery: d.Params,
+	}
+	return u.String()
+}
@@ -0,0 +1,143 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+const validFile = `
+http:
+  addr: ":9090"
+database:
+  host: db
+  username: halosuster
+  name: halosuster
+auth:
+  jwtSecret: secret
+  bcryptCost: 10
+records:
+  signingKey: 0123456789abcdef0123456789abcdef
+  icd10File: /etc/halosuster/icd10.csv
+images:
+  store: filesystem
+  variants: [thumb:160, medium:800x600]
+`
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	t.Setenv("DB_HOST", "primary")
+	t.Setenv("IMAGE_GC_GRACE", "2h")
+	cfg, err := Load(writeConfig(t, validFile))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.HTTP.Addr != ":9090" || cfg.Database.Name != "halosuster" || cfg.Auth.BcryptCost != 10 {
+		t.Errorf("Load() did not read the file: %+v", cfg)
+	}
+	// the environment takes precedence over the file
+	if cfg.Database.Host != "primary" || cfg.Images.GCGrace != 2*time.Hour {
+		t.Errorf("Load() did not read the environment: %+v", cfg)
+	}
+	if cfg.Database.Port != "5432" || cfg.HTTP.ShutdownTimeout != 10*time.Second {
+		t.Errorf("Load() did not keep the defaults: %+v", cfg)
+	}
+	if cfg.Auth.CursorSecret != "secret" {
+		t.Errorf("CursorSecret = %q, want the JWT secret", cfg.Auth.CursorSecret)
+	}
+	if strings.Join(cfg.Images.Variants, ",") != "thumb:160,medium:800x600" {
+		t.Errorf("Variants = %q", cfg.Images.Variants)
+	}
+}
+
+func TestLoadSecretFile(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "jwt")
+	if err := os.WriteFile(secret, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("JWT_SECRET_FILE", secret)
+	cfg, err := Load(writeConfig(t, validFile))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Auth.JWTSecret != "from-file" {
+		t.Errorf("JWTSecret = %q, want from-file", cfg.Auth.JWTSecret)
+	}
+
+	t.Setenv("JWT_SECRET", "inline")
+	if _, err = Load(writeConfig(t, validFile)); err == nil {
+		t.Error("Load() with both JWT_SECRET and JWT_SECRET_FILE succeeded")
+	}
+}
+
+func TestLoadRejectsUnknownKeys(t *testing.T) {
+	_, err := Load(writeConfig(t, validFile+"  gcGrase: 1h\n"))
+	if err == nil || !strings.Contains(err.Error(), "gcGrase") {
+		t.Errorf("Load() error = %v, want the misspelt key reported", err)
+	}
+}
+
+func TestLoadReportsEveryInvalidSetting(t *testing.T) {
+	t.Setenv("RECORD_SIGNING_KEY", "too-short")
+	t.Setenv("DB_MAX_IDLE_CONNS", "50")
+	t.Setenv("BCRYPT_SALT", "40")
+	t.Setenv("IMAGE_STORE", "ftp")
+	t.Setenv("HTTP_SHUTDOWN_TIMEOUT", "soon")
+	// values that cannot be parsed are reported before validating
+	_, err := Load(writeConfig(t, validFile))
+	var errs validation.Errors
+	if !errors.As(err, &errs) || len(errs) != 1 || errs["HTTP_SHUTDOWN_TIMEOUT"] == nil {
+		t.Fatalf("Load() error = %v, want HTTP_SHUTDOWN_TIMEOUT reported", err)
+	}
+
+	t.Setenv("HTTP_SHUTDOWN_TIMEOUT", "5s")
+	_, err = Load(writeConfig(t, validFile))
+	if !errors.As(err, &errs) {
+		t.Fatalf("Load() error = %v, want validation.Errors", err)
+	}
+	for _, name := range []string{"RECORD_SIGNING_KEY", "DB_MAX_IDLE_CONNS", "BCRYPT_SALT", "IMAGE_STORE"} {
+		if errs[name] == nil {
+			t.Errorf("Load() did not report %s: %v", name, err)
+		}
+	}
+	if len(errs) != 4 {
+		t.Errorf("Load() reported %d settings, want 4: %v", len(errs), err)
+	}
+}
+
+func TestLoadRequiresICD10File(t *testing.T) {
+	t.Setenv("ICD10_FILE", "")
+	_, err := Load(writeConfig(t, validFile))
+	var errs validation.Errors
+	if !errors.As(err, &errs) || errs["ICD10_FILE"] == nil {
+		t.Fatalf("Load() error = %v, want ICD10_FILE reported", err)
+	}
+
+	t.Setenv("ICD10_SAMPLE", "true")
+	if _, err = Load(writeConfig(t, validFile)); err != nil {
+		t.Errorf("Load() with ICD10_SAMPLE error = %v", err)
+	}
+}
+
+func TestLoadRequiresS3Settings(t *testing.T) {
+	t.Setenv("IMAGE_STORE", "s3")
+	t.Setenv("AWS_REGION", "")
+	_, err := Load(writeConfig(t, validFile))
+	var errs validation.Errors
+	if !errors.As(err, &errs) || errs["AWS_REGION"] == nil || errs["AWS_S3_BUCKET_NAME"] == nil {
+		t.Errorf("Load() error = %v, want AWS_REGION and AWS_S3_BUCKET_NAME reported", err)
+	}
+}
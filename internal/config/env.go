@@ -0,0 +1,128 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// readEnv sets every setting whose variable is set, reporting all the
+// values that cannot be parsed at once.
+func (c *Config) readEnv() error {
+	errs := validation.Errors{}
+	readEnv(reflect.ValueOf(c).Elem(), errs)
+	return errs.Filter()
+}
+
+func readEnv(v reflect.Value, errs validation.Errors) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field, value := t.Field(i), v.Field(i)
+		name, ok := field.Tag.Lookup("env")
+		if !ok {
+			if value.Kind() == reflect.Struct {
+				readEnv(value, errs)
+			}
+			continue
+		}
+		s, ok, err := lookup(name, field.Tag.Get("secret") == "true")
+		if err != nil {
+			errs[name] = err
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if err = set(value, s); err != nil {
+			errs[name] = err
+		}
+	}
+}
+
+// lookup returns the value of the variable name or, for a secret, of
+// the file named by name_FILE.
+func lookup(name string, secret bool) (string, bool, error) {
+	s, ok := os.LookupEnv(name)
+	if !secret {
+		return s, ok, nil
+	}
+	path, fromFile := os.LookupEnv(name + "_FILE")
+	if !fromFile {
+		return s, ok, nil
+	}
+	if ok {
+		return "", false, fmt.Errorf("only one of %s and %s_FILE may be set", name, name)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false, fmt.Errorf("cannot read secret file: %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), true, nil
+}
+
+func set(v reflect.Value, s string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", s)
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", s)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", s)
+		}
+		v.SetInt(n)
+	case reflect.Pointer:
+		p := reflect.New(v.Type().Elem())
+		if err := set(p.Elem(), s); err != nil {
+			return err
+		}
+		v.Set(p)
+	case reflect.Slice:
+		list := reflect.MakeSlice(v.Type(), 0, 0)
+		for _, item := range strings.Split(s, ",") {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := set(elem, strings.TrimSpace(item)); err != nil {
+				return err
+			}
+			list = reflect.Append(list, elem)
+		}
+		v.Set(list)
+	case reflect.Map:
+		m := reflect.MakeMap(v.Type())
+		for _, item := range strings.Split(s, ",") {
+			key, value, ok := strings.Cut(strings.TrimSpace(item), ":")
+			if !ok {
+				return fmt.Errorf("invalid entry %q, expected key:value", item)
+			}
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := set(elem, value); err != nil {
+				return err
+			}
+			m.SetMapIndex(reflect.ValueOf(key), elem)
+		}
+		v.Set(m)
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"time"
+
+	"github.com/citadel-corp/halosuster/internal/medicalrecords"
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/go-ozzo/ozzo-validation/v4/is"
+)
+
+// bcrypt accepts costs from 4 to 31; above 14 logins take seconds.
+const (
+	minBcryptCost = 4
+	maxBcryptCost = 31
+)
+
+// the sample diagnoses few codes, so running on it has to be asked for
+var icd10FileRequired = validation.Required.Error("must name the full ICD-10 tabulation, or set ICD10_SAMPLE for the built-in sample")
+
+// Validate reports every invalid setting at once, by the name of its
+// environment variable.
+func (c *Config) Validate() error {
+	errs := validation.Errors{
+		"HTTP_ADDR":             validation.Validate(c.HTTP.Addr, validation.Required),
+		"HTTP_SHUTDOWN_TIMEOUT": validation.Validate(c.HTTP.ShutdownTimeout, validation.Min(time.Second)),
+
+		"DB_HOST":           validation.Validate(c.Database.Host, validation.Required),
+		"DB_PORT":           validation.Validate(c.Database.Port, validation.Required, is.Port),
+		"DB_USERNAME":       validation.Validate(c.Database.Username, validation.Required),
+		"DB_NAME":           validation.Validate(c.Database.Name, validation.Required),
+		"DB_MAX_OPEN_CONNS": validation.Validate(c.Database.MaxOpenConns, validation.Min(1)),
+		"DB_MAX_IDLE_CONNS": validation.Validate(c.Database.MaxIdleConns, validation.Min(0), validation.Max(c.Database.MaxOpenConns)),
+
+		"JWT_SECRET":         validation.Validate(c.Auth.JWTSecret, validation.Required),
+		"RECORD_SIGNING_KEY": validation.Validate(c.Records.SigningKey, validation.Required, validation.Length(medicalrecords.MinSigningKeyLength, 0)),
+		"JWT_TTL":            validation.Validate(c.Auth.TokenTTL, validation.Min(time.Minute)),
+		"BCRYPT_SALT":        validation.Validate(c.Auth.BcryptCost, validation.Required, validation.Min(minBcryptCost), validation.Max(maxBcryptCost)),
+
+		"RECORD_GRACE_PERIOD":         validation.Validate(c.Records.GracePeriod, validation.Min(time.Duration(0))),
+		"NEWS2_ALERT_SCORE":           validation.Validate(c.Records.AlertScore, validation.Min(1)),
+		"NEWS2_ALERT_PARAMETER_SCORE": validation.Validate(c.Records.AlertParameterScore, validation.Min(1), validation.Max(3)),
+		"NEWS2_ALERT_WINDOW":          validation.Validate(c.Records.AlertWindow, validation.Min(time.Minute)),
+		"ICD10_FILE":                  validation.Validate(c.Records.ICD10File, validation.When(!c.Records.ICD10Sample, icd10FileRequired)),
+
+		"IMAGE_STORE":          validation.Validate(c.Images.Store, validation.Required, validation.In("s3", "filesystem")),
+		"IMAGE_URL_TTL":        validation.Validate(c.Images.URLTTL, validation.Min(time.Second)),
+		"IMAGE_GC_GRACE":       validation.Validate(c.Images.GCGrace, validation.Min(time.Duration(0))),
+		"IMAGE_GC_INTERVAL":    validation.Validate(c.Images.GCInterval, validation.Min(time.Duration(0))),
+		"CLAMD_TIMEOUT":        validation.Validate(c.Images.ClamdTimeout, validation.Min(time.Second)),
+		"IMAGE_UPLOAD_WORKERS": validation.Validate(c.Images.UploadWorkers, validation.Min(1)),
+		"AWS_REGION":           validation.Validate(c.Images.S3.Region, validation.When(c.Images.Store == "s3", validation.Required)),
+		"AWS_S3_BUCKET_NAME":   validation.Validate(c.Images.S3.Bucket, validation.When(c.Images.Store == "s3", validation.Required)),
+		"AWS_S3_ENDPOINT":      validation.Validate(c.Images.S3.Endpoint, is.URL),
+		"IMAGE_STORE_DIR":      validation.Validate(c.Images.Dir, validation.When(c.Images.Store == "filesystem", validation.Required)),
+		"IMAGE_BASE_URL":       validation.Validate(c.Images.BaseURL, validation.When(c.Images.Store == "filesystem", validation.Required, is.URL)),
+	}
+	return errs.Filter()
+}
@@ -0,0 +1,111 @@
+package drugs
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var csvHeader = []string{"generic_name", "form", "strengths", "routes", "dose_unit", "min_dose", "max_dose", "max_daily_dose"}
+
+// ParseCSV reads a catalogue with a header row naming csvHeader's columns
+// in any order. Strengths and routes hold several values separated by
+// "|"; max_daily_dose may be empty.
+func ParseCSV(r io.Reader) ([]Drug, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%w: file is empty", ErrInvalidCatalogue)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCatalogue, err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range csvHeader {
+		if _, ok := columns[name]; !ok && name != "max_daily_dose" {
+			return nil, fmt.Errorf("%w: missing column %s", ErrInvalidCatalogue, name)
+		}
+	}
+
+	res := make([]Drug, 0)
+	seen := make(map[string]int)
+	for line := 2; ; line++ {
+		rec, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidCatalogue, err)
+		}
+		field := func(name string) string {
+			i, ok := columns[name]
+			if !ok || i >= len(rec) {
+				return ""
+			}
+			return strings.TrimSpace(rec[i])
+		}
+		d, err := parseDrug(field)
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidCatalogue, line, err)
+		}
+		key := strings.ToLower(d.GenericName + "\x00" + d.Form)
+		if prev, ok := seen[key]; ok {
+			return nil, fmt.Errorf("%w: line %d: %s %s repeats line %d", ErrInvalidCatalogue, line, d.GenericName, d.Form, prev)
+		}
+		seen[key] = line
+		res = append(res, d)
+	}
+	return res, nil
+}
+
+func parseDrug(field func(string) string) (Drug, error) {
+	d := Drug{
+		GenericName: field("generic_name"),
+		Form:        strings.ToLower(field("form")),
+		Strengths:   splitList(field("strengths")),
+		Routes:      splitList(strings.ToLower(field("routes"))),
+		DoseUnit:    strings.ToLower(field("dose_unit")),
+	}
+	switch {
+	case d.GenericName == "" || len(d.GenericName) > 100:
+		return d, fmt.Errorf("generic_name must be 1 to 100 characters")
+	case d.Form == "" || len(d.Form) > 30:
+		return d, fmt.Errorf("form must be 1 to 30 characters")
+	case len(d.Routes) == 0:
+		return d, fmt.Errorf("routes must not be empty")
+	case d.DoseUnit == "" || len(d.DoseUnit) > 10:
+		return d, fmt.Errorf("dose_unit must be 1 to 10 characters")
+	}
+	var err error
+	if d.MinDose, err = strconv.ParseFloat(field("min_dose"), 64); err != nil || d.MinDose <= 0 {
+		return d, fmt.Errorf("min_dose must be a positive number")
+	}
+	if d.MaxDose, err = strconv.ParseFloat(field("max_dose"), 64); err != nil || d.MaxDose < d.MinDose {
+		return d, fmt.Errorf("max_dose must be a number not below min_dose")
+	}
+	if v := field("max_daily_dose"); v != "" {
+		maxDaily, err := strconv.ParseFloat(v, 64)
+		if err != nil || maxDaily < d.MaxDose {
+			return d, fmt.Errorf("max_daily_dose must be a number not below max_dose")
+		}
+		d.MaxDailyDose = &maxDaily
+	}
+	return d, nil
+}
+
+func splitList(s string) []string {
+	res := make([]string, 0)
+	for _, v := range strings.Split(s, "|") {
+		if v = strings.TrimSpace(v); v != "" && !slices.Contains(res, v) {
+			res = append(res, v)
+		}
+	}
+	return res
+}
@@ -0,0 +1,65 @@
+package drugs
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Drug is a catalogue entry for one form of a generic drug. Doses are
+// per administration in DoseUnit; MaxDailyDose is optional.
+type Drug struct {
+	ID           string
+	GenericName  string
+	Form         string
+	Strengths    []string
+	Routes       []string
+	DoseUnit     string
+	MinDose      float64
+	MaxDose      float64
+	MaxDailyDose *float64
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// massUnits are convertible into each other, in milligrams.
+var massUnits = map[string]float64{
+	"mcg": 0.001,
+	"mg":  1,
+	"g":   1000,
+}
+
+// ConvertDose expresses dose given in unit in the drug's dose unit.
+func (d *Drug) ConvertDose(dose float64, unit string) (float64, error) {
+	unit = strings.ToLower(unit)
+	if strings.EqualFold(unit, d.DoseUnit) {
+		return dose, nil
+	}
+	from, okFrom := massUnits[unit]
+	to, okTo := massUnits[strings.ToLower(d.DoseUnit)]
+	if !okFrom || !okTo {
+		return 0, fmt.Errorf("unit %s cannot be converted to %s", unit, d.DoseUnit)
+	}
+	return dose * from / to, nil
+}
+
+// CheckDose checks a dose in the drug's unit against the catalogue range.
+// timesPerDay is nil for doses given as needed.
+func (d *Drug) CheckDose(dose float64, timesPerDay *float64) error {
+	if dose < d.MinDose || dose > d.MaxDose {
+		return fmt.Errorf("dose of %s must be between %g and %g %s", d.GenericName, d.MinDose, d.MaxDose, d.DoseUnit)
+	}
+	if d.MaxDailyDose != nil && timesPerDay != nil && dose*(*timesPerDay) > *d.MaxDailyDose {
+		return fmt.Errorf("daily dose of %s must not exceed %g %s", d.GenericName, *d.MaxDailyDose, d.DoseUnit)
+	}
+	return nil
+}
+
+func (d *Drug) HasRoute(route string) bool {
+	return slices.ContainsFunc(d.Routes, func(r string) bool { return strings.EqualFold(r, route) })
+}
+
+func (d *Drug) HasStrength(strength string) bool {
+	return slices.ContainsFunc(d.Strengths, func(s string) bool { return strings.EqualFold(s, strength) })
+}
@@ -0,0 +1,8 @@
+package drugs
+
+import "errors"
+
+var (
+	ErrDrugNotFound     = errors.New("drug not found")
+	ErrInvalidCatalogue = errors.New("invalid drug catalogue")
+)
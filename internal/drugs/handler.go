@@ -0,0 +1,104 @@
+package drugs
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/citadel-corp/halosuster/internal/common/response"
+	"github.com/gorilla/schema"
+)
+
+const maxCatalogueSize = 10 * 1024 * 1024 // 10 MB
+
+type Handler struct {
+	service Service
+}
+
+func NewHandler(service Service) *Handler {
+	return &Handler{service: service}
+}
+
+// ImportCatalogue takes the CSV either as a multipart "file" field or as
+// the raw request body.
+func (h *Handler) ImportCatalogue(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxCatalogueSize)
+
+	var body io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := r.ParseMultipartForm(maxCatalogueSize); err != nil {
+			response.JSON(w, http.StatusBadRequest, response.ResponseBody{
+				Message: "File must be smaller than 10 MB",
+				Error:   err.Error(),
+			})
+			return
+		}
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			response.JSON(w, http.StatusBadRequest, response.ResponseBody{
+				Message: "File should not be empty",
+				Error:   err.Error(),
+			})
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+
+	res, err := h.service.ImportCSV(r.Context(), body)
+	if errors.Is(err, ErrInvalidCatalogue) {
+		response.JSON(w, http.StatusBadRequest, response.ResponseBody{
+			Message: "Bad request",
+			Error:   err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		response.JSON(w, http.StatusInternalServerError, response.ResponseBody{
+			Message: "Internal server error",
+			Error:   err.Error(),
+		})
+		return
+	}
+	response.JSON(w, http.StatusOK, response.ResponseBody{
+		Message: "Catalogue imported successfully",
+		Data:    res,
+	})
+}
+
+func (h *Handler) Search(w http.ResponseWriter, r *http.Request) {
+	var req SearchPayload
+
+	newSchema := schema.NewDecoder()
+	newSchema.IgnoreUnknownKeys(true)
+
+	if err := newSchema.Decode(&req, r.URL.Query()); err != nil {
+		response.JSON(w, http.StatusBadRequest, response.ResponseBody{
+			Message: "Bad request",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		response.JSON(w, http.StatusBadRequest, response.ResponseBody{
+			Message: "Bad request",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	drugs, err := h.service.Search(r.Context(), req)
+	if err != nil {
+		response.JSON(w, http.StatusInternalServerError, response.ResponseBody{
+			Message: "Internal server error",
+			Error:   err.Error(),
+		})
+		return
+	}
+	response.JSON(w, http.StatusOK, response.ResponseBody{
+		Message: "success",
+		Data:    drugs,
+	})
+}
@@ -0,0 +1,118 @@
+package drugs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/citadel-corp/halosuster/internal/common/db"
+	"github.com/citadel-corp/halosuster/internal/common/id"
+	"github.com/citadel-corp/halosuster/internal/common/query"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type Repository interface {
+	Upsert(ctx context.Context, drugs []Drug) (created int, updated int, err error)
+	GetByID(ctx context.Context, id string) (*Drug, error)
+	Search(ctx context.Context, q string, limit int) ([]Drug, error)
+}
+
+const drugColumns = `
+		id, generic_name, form, strengths, routes, dose_unit,
+		min_dose::float8, max_dose::float8, max_daily_dose::float8, created_at, updated_at
+	`
+
+var typeMap = pgtype.NewMap()
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanDrug(row scanner) (*Drug, error) {
+	d := &Drug{}
+	err := row.Scan(&d.ID, &d.GenericName, &d.Form, typeMap.SQLScanner(&d.Strengths), typeMap.SQLScanner(&d.Routes),
+		&d.DoseUnit, &d.MinDose, &d.MaxDose, &d.MaxDailyDose, &d.CreatedAt, &d.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+type dbRepository struct {
+	db *db.DB
+}
+
+func NewRepository(db *db.DB) Repository {
+	return &dbRepository{db: db}
+}
+
+// Upsert matches drugs on generic name and form, case-insensitively, so
+// importing a catalogue again updates it in place and keeps the ids
+// prescriptions refer to.
+func (d *dbRepository) Upsert(ctx context.Context, drugs []Drug) (int, int, error) {
+	created, updated := 0, 0
+	err := d.db.StartTx(ctx, func(tx *sql.Tx) error {
+		q := `
+			INSERT INTO drugs (id, generic_name, form, strengths, routes, dose_unit, min_dose, max_dose, max_daily_dose)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			ON CONFLICT (lower(generic_name), lower(form)) DO UPDATE
+			SET generic_name = EXCLUDED.generic_name, strengths = EXCLUDED.strengths, routes = EXCLUDED.routes,
+				dose_unit = EXCLUDED.dose_unit, min_dose = EXCLUDED.min_dose, max_dose = EXCLUDED.max_dose,
+				max_daily_dose = EXCLUDED.max_daily_dose, updated_at = current_timestamp
+			RETURNING xmax = 0;
+		`
+		for _, drug := range drugs {
+			var inserted bool
+			err := tx.QueryRowContext(ctx, q, id.GenerateStringID(16), drug.GenericName, drug.Form, drug.Strengths, drug.Routes,
+				drug.DoseUnit, drug.MinDose, drug.MaxDose, drug.MaxDailyDose).Scan(&inserted)
+			if err != nil {
+				return err
+			}
+			if inserted {
+				created++
+			} else {
+				updated++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return created, updated, nil
+}
+
+func (d *dbRepository) GetByID(ctx context.Context, id string) (*Drug, error) {
+	q := "SELECT " + drugColumns + " FROM drugs WHERE id = $1;"
+	drug, err := scanDrug(d.db.DB().QueryRowContext(ctx, q, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrDrugNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return drug, nil
+}
+
+func (d *dbRepository) Search(ctx context.Context, q string, limit int) ([]Drug, error) {
+	b := query.NewBuilder()
+	where := ""
+	if q != "" {
+		where = b.Where(query.Contains("LOWER(generic_name)", q))
+	}
+	rows, err := d.db.DB().QueryContext(ctx, "SELECT "+drugColumns+" FROM drugs"+where+
+		" ORDER BY lower(generic_name), form LIMIT "+b.Arg(limit), b.Args()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := make([]Drug, 0)
+	for rows.Next() {
+		drug, err := scanDrug(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, *drug)
+	}
+	return res, rows.Err()
+}
@@ -0,0 +1,17 @@
+package drugs
+
+import (
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+type SearchPayload struct {
+	Q     string `schema:"q" binding:"omitempty"`
+	Limit int    `schema:"limit" binding:"omitempty"`
+}
+
+func (p SearchPayload) Validate() error {
+	return validation.ValidateStruct(&p,
+		validation.Field(&p.Q, validation.Length(0, 100)),
+		validation.Field(&p.Limit, validation.Min(0), validation.Max(100)),
+	)
+}
@@ -0,0 +1,32 @@
+package drugs
+
+type DrugResponse struct {
+	ID           string   `json:"id"`
+	GenericName  string   `json:"genericName"`
+	Form         string   `json:"form"`
+	Strengths    []string `json:"strengths"`
+	Routes       []string `json:"routes"`
+	DoseUnit     string   `json:"doseUnit"`
+	MinDose      float64  `json:"minDose"`
+	MaxDose      float64  `json:"maxDose"`
+	MaxDailyDose *float64 `json:"maxDailyDose,omitempty"`
+}
+
+type ImportResponse struct {
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+}
+
+func drugResponse(d Drug) DrugResponse {
+	return DrugResponse{
+		ID:           d.ID,
+		GenericName:  d.GenericName,
+		Form:         d.Form,
+		Strengths:    d.Strengths,
+		Routes:       d.Routes,
+		DoseUnit:     d.DoseUnit,
+		MinDose:      d.MinDose,
+		MaxDose:      d.MaxDose,
+		MaxDailyDose: d.MaxDailyDose,
+	}
+}
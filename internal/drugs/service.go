@@ -0,0 +1,56 @@
+package drugs
+
+import (
+	"context"
+	"io"
+	"strings"
+)
+
+const defaultSearchLimit = 20
+
+type Service interface {
+	ImportCSV(ctx context.Context, r io.Reader) (*ImportResponse, error)
+	Search(ctx context.Context, req SearchPayload) ([]DrugResponse, error)
+	GetByID(ctx context.Context, id string) (*Drug, error)
+}
+
+type drugService struct {
+	repository Repository
+}
+
+func NewService(repository Repository) Service {
+	return &drugService{repository: repository}
+}
+
+// ImportCSV adds or updates every drug in the file. Nothing is written
+// unless the whole file is valid.
+func (s *drugService) ImportCSV(ctx context.Context, r io.Reader) (*ImportResponse, error) {
+	drugs, err := ParseCSV(r)
+	if err != nil {
+		return nil, err
+	}
+	created, updated, err := s.repository.Upsert(ctx, drugs)
+	if err != nil {
+		return nil, err
+	}
+	return &ImportResponse{Created: created, Updated: updated}, nil
+}
+
+func (s *drugService) Search(ctx context.Context, req SearchPayload) ([]DrugResponse, error) {
+	if req.Limit == 0 {
+		req.Limit = defaultSearchLimit
+	}
+	drugs, err := s.repository.Search(ctx, strings.ToLower(strings.TrimSpace(req.Q)), req.Limit)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]DrugResponse, len(drugs))
+	for i, d := range drugs {
+		res[i] = drugResponse(d)
+	}
+	return res, nil
+}
+
+func (s *drugService) GetByID(ctx context.Context, id string) (*Drug, error) {
+	return s.repository.GetByID(ctx, id)
+}
@@ -0,0 +1,145 @@
+package icd10
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+// The embedded file is a sample for development and tests: some 160
+// codes in everyday use at the clinic, of the tens of thousands in
+// ICD-10. The full tabulation, in the same layout of
+// code,description_en,description_id with a header row, is loaded with
+// OpenCatalogue; it is licensed separately and not distributed here.
+//
+//go:embed data/icd10_sample.csv
+var sample string
+
+type Catalogue struct {
+	codes  []Code
+	byCode map[string]int
+}
+
+// NewSampleCatalogue loads the embedded sample, which cannot diagnose
+// most codes.
+func NewSampleCatalogue() (*Catalogue, error) {
+	return LoadCatalogue(strings.NewReader(sample))
+}
+
+// OpenCatalogue loads the code table in the file at path.
+func OpenCatalogue(path string) (*Catalogue, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return LoadCatalogue(f)
+}
+
+func LoadCatalogue(r io.Reader) (*Catalogue, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("icd10: catalogue is empty")
+	}
+	c := &Catalogue{byCode: make(map[string]int, len(records)-1)}
+	for i, rec := range records[1:] {
+		if len(rec) != 3 {
+			return nil, fmt.Errorf("icd10: line %d: expected 3 fields, got %d", i+2, len(rec))
+		}
+		code := Normalize(rec[0])
+		chapter, ok := ChapterOf(code)
+		if !ok {
+			return nil, fmt.Errorf("icd10: line %d: %q is not in any chapter", i+2, rec[0])
+		}
+		if _, ok := c.byCode[code]; ok {
+			return nil, fmt.Errorf("icd10: line %d: duplicate code %s", i+2, code)
+		}
+		c.byCode[code] = len(c.codes)
+		c.codes = append(c.codes, Code{Code: code, Chapter: chapter.ID, DescriptionEN: rec[1], DescriptionID: rec[2]})
+	}
+	slices.SortFunc(c.codes, func(a, b Code) int { return strings.Compare(a.Code, b.Code) })
+	for i, code := range c.codes {
+		c.byCode[code.Code] = i
+	}
+	return c, nil
+}
+
+func (c *Catalogue) Lookup(code string) (Code, bool) {
+	i, ok := c.byCode[Normalize(code)]
+	if !ok {
+		return Code{}, false
+	}
+	return c.codes[i], true
+}
+
+const (
+	matchCode = iota
+	matchCodePrefix
+	matchWordPrefix
+	matchContains
+	noMatch
+)
+
+// rank scores how well code matches a search: by code first, then by the
+// words of either description.
+func rank(code Code, q string, terms []string) int {
+	normalized := Normalize(q)
+	switch {
+	case code.Code == normalized:
+		return matchCode
+	case strings.HasPrefix(code.Code, normalized):
+		return matchCodePrefix
+	}
+	descriptions := strings.ToLower(code.DescriptionEN + " " + code.DescriptionID)
+	words := strings.FieldsFunc(descriptions, func(r rune) bool {
+		return !('a' <= r && r <= 'z' || '0' <= r && r <= '9')
+	})
+	best := matchWordPrefix
+	for _, term := range terms {
+		if slices.ContainsFunc(words, func(w string) bool { return strings.HasPrefix(w, term) }) {
+			continue
+		}
+		if !strings.Contains(descriptions, term) {
+			return noMatch
+		}
+		best = matchContains
+	}
+	return best
+}
+
+// Search returns up to limit codes matching q, best matches first, and
+// ties in code order. An empty q lists the codes in order.
+func (c *Catalogue) Search(q, chapter string, limit int) []Code {
+	q = strings.ToLower(strings.TrimSpace(q))
+	terms := strings.Fields(q)
+	type match struct {
+		code Code
+		rank int
+	}
+	matches := make([]match, 0)
+	for _, code := range c.codes {
+		if chapter != "" && !strings.EqualFold(code.Chapter, chapter) {
+			continue
+		}
+		r := matchCode
+		if q != "" {
+			r = rank(code, q, terms)
+		}
+		if r != noMatch {
+			matches = append(matches, match{code, r})
+		}
+	}
+	slices.SortStableFunc(matches, func(a, b match) int { return a.rank - b.rank })
+	res := make([]Code, 0, min(limit, len(matches)))
+	for _, m := range matches[:min(limit, len(matches))] {
+		res = append(res, m.code)
+	}
+	return res
+}
@@ -0,0 +1,34 @@
+package icd10
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenCatalogue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "icd10.csv")
+	content := "code,description_en,description_id\nJ45.9,\"Asthma, unspecified\",\"Asma, tidak spesifik\"\nA00.0,Cholera due to Vibrio cholerae 01,Kolera\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	c, err := OpenCatalogue(path)
+	if err != nil {
+		t.Fatalf("OpenCatalogue() error = %v", err)
+	}
+	if code, ok := c.Lookup("j459"); !ok || code.DescriptionEN != "Asthma, unspecified" {
+		t.Errorf("Lookup(j459) = %+v, %v", code, ok)
+	}
+	if got := c.Search("", "", 10); len(got) != 2 || got[0].Code != "A00.0" {
+		t.Errorf("Search() = %+v, want both codes in order", got)
+	}
+	if _, err = OpenCatalogue(filepath.Join(t.TempDir(), "missing.csv")); err == nil {
+		t.Error("OpenCatalogue() of a missing file succeeded")
+	}
+}
+
+func TestNewSampleCatalogue(t *testing.T) {
+	if _, err := NewSampleCatalogue(); err != nil {
+		t.Fatalf("NewSampleCatalogue() error = %v", err)
+	}
+}
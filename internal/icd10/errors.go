@@ -0,0 +1,8 @@
+package icd10
+
+import "errors"
+
+var (
+	ErrCodeNotFound   = errors.New("icd-10 code not found")
+	ErrUnknownChapter = errors.New("unknown icd-10 chapter")
+)
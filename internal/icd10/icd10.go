@@ -0,0 +1,70 @@
+package icd10
+
+import "strings"
+
+// Chapter is one of the 22 ICD-10 chapters, covering the categories
+// From through To.
+type Chapter struct {
+	ID            string
+	From          string
+	To            string
+	DescriptionEN string
+	DescriptionID string
+}
+
+var Chapters = []Chapter{
+	{"I", "A00", "B99", "Certain infectious and parasitic diseases", "Penyakit infeksi dan parasit tertentu"},
+	{"II", "C00", "D48", "Neoplasms", "Neoplasma"},
+	{"III", "D50", "D89", "Diseases of the blood and blood-forming organs and certain disorders involving the immune mechanism", "Penyakit darah dan organ pembentuk darah serta gangguan tertentu yang melibatkan mekanisme imun"},
+	{"IV", "E00", "E90", "Endocrine, nutritional and metabolic diseases", "Penyakit endokrin, nutrisi dan metabolik"},
+	{"V", "F00", "F99", "Mental and behavioural disorders", "Gangguan mental dan perilaku"},
+	{"VI", "G00", "G99", "Diseases of the nervous system", "Penyakit sistem saraf"},
+	{"VII", "H00", "H59", "Diseases of the eye and adnexa", "Penyakit mata dan adneksa"},
+	{"VIII", "H60", "H95", "Diseases of the ear and mastoid process", "Penyakit telinga dan prosesus mastoid"},
+	{"IX", "I00", "I99", "Diseases of the circulatory system", "Penyakit sistem sirkulasi"},
+	{"X", "J00", "J99", "Diseases of the respiratory system", "Penyakit sistem pernapasan"},
+	{"XI", "K00", "K93", "Diseases of the digestive system", "Penyakit sistem pencernaan"},
+	{"XII", "L00", "L99", "Diseases of the skin and subcutaneous tissue", "Penyakit kulit dan jaringan subkutan"},
+	{"XIII", "M00", "M99", "Diseases of the musculoskeletal system and connective tissue", "Penyakit sistem muskuloskeletal dan jaringan ikat"},
+	{"XIV", "N00", "N99", "Diseases of the genitourinary system", "Penyakit sistem genitourinaria"},
+	{"XV", "O00", "O99", "Pregnancy, childbirth and the puerperium", "Kehamilan, persalinan dan masa nifas"},
+	{"XVI", "P00", "P96", "Certain conditions originating in the perinatal period", "Kondisi tertentu yang bermula pada masa perinatal"},
+	{"XVII", "Q00", "Q99", "Congenital malformations, deformations and chromosomal abnormalities", "Malformasi kongenital, deformasi dan kelainan kromosom"},
+	{"XVIII", "R00", "R99", "Symptoms, signs and abnormal clinical and laboratory findings, not elsewhere classified", "Gejala, tanda dan temuan klinis serta laboratorium abnormal yang tidak diklasifikasikan di tempat lain"},
+	{"XIX", "S00", "T98", "Injury, poisoning and certain other consequences of external causes", "Cedera, keracunan dan akibat tertentu lain dari penyebab eksternal"},
+	{"XX", "V01", "Y98", "External causes of morbidity and mortality", "Penyebab eksternal morbiditas dan mortalitas"},
+	{"XXI", "Z00", "Z99", "Factors influencing health status and contact with health services", "Faktor yang memengaruhi status kesehatan dan kontak dengan pelayanan kesehatan"},
+	{"XXII", "U00", "U99", "Codes for special purposes", "Kode untuk tujuan khusus"},
+}
+
+// ChapterOf returns the chapter a normalized code belongs to.
+func ChapterOf(code string) (Chapter, bool) {
+	if len(code) < 3 {
+		return Chapter{}, false
+	}
+	category := code[:3]
+	for _, c := range Chapters {
+		if category >= c.From && category <= c.To {
+			return c, true
+		}
+	}
+	return Chapter{}, false
+}
+
+// Normalize upper-cases a code and puts the dot after the category, so
+// "j189" and "J18.9" are the same code.
+func Normalize(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	code = strings.ReplaceAll(code, ".", "")
+	if len(code) > 3 {
+		code = code[:3] + "." + code[3:]
+	}
+	return code
+}
+
+type Code struct {
+	Code          string
+	Chapter       string
+	DescriptionEN string
+	DescriptionID string
+}
@@ -0,0 +1,12 @@
+package icd10
+
+type CodeResponse struct {
+	Code          string `json:"code"`
+	Chapter       string `json:"chapter"`
+	DescriptionEN string `json:"descriptionEn"`
+	DescriptionID string `json:"descriptionId"`
+}
+
+func codeResponse(c Code) CodeResponse {
+	return CodeResponse{Code: c.Code, Chapter: c.Chapter, DescriptionEN: c.DescriptionEN, DescriptionID: c.DescriptionID}
+}
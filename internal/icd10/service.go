@@ -0,0 +1,54 @@
+package icd10
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+const defaultSearchLimit = 10
+
+type Service interface {
+	Search(ctx context.Context, req SearchPayload) ([]CodeResponse, error)
+	Lookup(code string) (Code, error)
+}
+
+type icd10Service struct {
+	catalogue *Catalogue
+}
+
+func NewService(catalogue *Catalogue) Service {
+	return &icd10Service{catalogue: catalogue}
+}
+
+func (s *icd10Service) Search(ctx context.Context, req SearchPayload) ([]CodeResponse, error) {
+	if req.Chapter != "" && !knownChapter(req.Chapter) {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownChapter, req.Chapter)
+	}
+	if req.Limit == 0 {
+		req.Limit = defaultSearchLimit
+	}
+	codes := s.catalogue.Search(req.Q, req.Chapter, req.Limit)
+	res := make([]CodeResponse, len(codes))
+	for i, c := range codes {
+		res[i] = codeResponse(c)
+	}
+	return res, nil
+}
+
+func (s *icd10Service) Lookup(code string) (Code, error) {
+	c, ok := s.catalogue.Lookup(code)
+	if !ok {
+		return Code{}, fmt.Errorf("%w: %s", ErrCodeNotFound, code)
+	}
+	return c, nil
+}
+
+func knownChapter(id string) bool {
+	for _, c := range Chapters {
+		if strings.EqualFold(c.ID, id) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,20 @@
+package image
+
+import "errors"
+
+var (
+	ErrImageNotFound  = errors.New("image not found")
+	ErrImageForbidden = errors.New("not allowed to view this image")
+	ErrInvalidUpload  = errors.New("invalid upload")
+	ErrUnknownVariant = errors.New("unknown image size")
+
+	ErrUploadNotFound       = errors.New("upload not found")
+	ErrUploadOffsetMismatch = errors.New("upload offset mismatch")
+	ErrUploadIncomplete     = errors.New("upload is incomplete")
+	ErrUploadFinalized      = errors.New("upload is already finalized")
+
+	ErrInfectedUpload = errors.New("malware found in upload")
+	ErrScanFailed     = errors.New("malware scan failed")
+
+	ErrImageAlreadyExists = errors.New("image already exists")
+)
@@ -0,0 +1,167 @@
+package image
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DownloadPath is the route serving objects of the filesystem driver.
+const DownloadPath = "/v1/image/files/"
+
+type fileStore struct {
+	objects  string
+	metadata string
+	baseURL  string
+}
+
+// NewFileStore keeps objects in root, for development without S3. They
+// are served by the authenticated DownloadPath route of the server at
+// baseURL, so their URLs need a token and do not expire.
+func NewFileStore(root, baseURL string) (ObjectStore, error) {
+	s := &fileStore{
+		objects:  filepath.Join(root, "objects"),
+		metadata: filepath.Join(root, "metadata"),
+		baseURL:  strings.TrimSuffix(baseURL, "/"),
+	}
+	for _, dir := range []string{s.objects, s.metadata} {
+		if err := os.MkdirAll(dir, 0o750); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *fileStore) Put(ctx context.Context, key string, body io.ReadSeeker, info ObjectInfo) error {
+	if !ValidKey(key) {
+		return errors.New("invalid object key")
+	}
+	size, err := writeFile(filepath.Join(s.objects, key), body)
+	if err != nil {
+		return err
+	}
+	info.Key, info.Size = key, size
+	content, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	// the object exists once its metadata does
+	_, err = writeFile(filepath.Join(s.metadata, key+".json"), strings.NewReader(string(content)))
+	return err
+}
+
+// writeFile writes through a temporary file so readers never see a
+// partial object.
+func writeFile(path string, r io.Reader) (int64, error) {
+	f, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(f.Name())
+	size, err := io.Copy(f, r)
+	if err != nil {
+		f.Close()
+		return 0, err
+	}
+	if err = f.Close(); err != nil {
+		return 0, err
+	}
+	return size, os.Rename(f.Name(), path)
+}
+
+func (s *fileStore) Head(ctx context.Context, key string) (*ObjectInfo, error) {
+	if !ValidKey(key) {
+		return nil, ErrImageNotFound
+	}
+	content, err := os.ReadFile(filepath.Join(s.metadata, key+".json"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrImageNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	info := &ObjectInfo{}
+	if err = json.Unmarshal(content, info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func (s *fileStore) Open(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error) {
+	info, err := s.Head(ctx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := os.Open(filepath.Join(s.objects, key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, ErrImageNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, info, nil
+}
+
+func (s *fileStore) Delete(ctx context.Context, key string) error {
+	if !ValidKey(key) {
+		return nil
+	}
+	// the object is gone once its metadata is
+	for _, path := range []string{filepath.Join(s.metadata, key+".json"), filepath.Join(s.objects, key)} {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// PresignURL returns the download route, which checks the bearer token
+// instead of a signature.
+func (s *fileStore) PresignURL(key string, ttl time.Duration) (string, error) {
+	return s.baseURL + DownloadPath + url.PathEscape(key), nil
+}
+
+// MakePrivate does nothing: files are only served through the download
+// route, which has always checked the bearer token.
+func (s *fileStore) MakePrivate(ctx context.Context, dryRun bool) (int, error) {
+	return 0, nil
+}
+
+func (s *fileStore) List(ctx context.Context, fn func(page []StoredObject) error) error {
+	entries, err := os.ReadDir(s.metadata)
+	if err != nil {
+		return err
+	}
+	page := make([]StoredObject, 0, gcBatchSize)
+	for _, entry := range entries {
+		key, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || !ValidKey(key) {
+			continue
+		}
+		info, err := os.Stat(filepath.Join(s.objects, key))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		page = append(page, StoredObject{Key: key, Size: info.Size(), ModifiedAt: info.ModTime()})
+		if len(page) == gcBatchSize {
+			if err = fn(page); err != nil {
+				return err
+			}
+			page = page[:0]
+		}
+	}
+	if len(page) == 0 {
+		return nil
+	}
+	return fn(page)
+}
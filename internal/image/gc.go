@@ -0,0 +1,228 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const gcBatchSize = 100
+
+var (
+	gcRuns           = expvar.NewInt("image_gc_runs")
+	gcDeletedImages  = expvar.NewInt("image_gc_deleted_images")
+	gcReclaimedBytes = expvar.NewInt("image_gc_reclaimed_bytes")
+	gcFailed         = expvar.NewInt("image_gc_failed")
+)
+
+// GCReport is what a garbage collection found. In a dry run nothing is
+// deleted and the counts are what would have been. Failed counts the
+// images, uploads and objects that could not be deleted; they are tried
+// again on the next run.
+type GCReport struct {
+	DryRun         bool     `json:"dryRun"`
+	Images         int      `json:"images"`
+	ExpiredUploads int      `json:"expiredUploads"`
+	ReclaimedBytes int64    `json:"reclaimedBytes"`
+	Failed         int      `json:"failed"`
+	Keys           []string `json:"keys"`
+}
+
+// CollectGarbage deletes images uploaded more than grace ago that no
+// user, patient or record refers to, together with their variants, and
+// the objects whose deletion failed before. Expired resumable uploads
+// are deleted along with their chunks. Objects that were never
+// registered as images are left to SweepUnregistered.
+func (s *imageService) CollectGarbage(ctx context.Context, grace time.Duration, dryRun bool) (*GCReport, error) {
+	report := &GCReport{DryRun: dryRun, Keys: make([]string, 0)}
+	var errs []error
+	if !dryRun {
+		if err := s.retryDeletions(ctx, report); err != nil {
+			errs = append(errs, fmt.Errorf("cannot retry deletions: %w", err))
+		}
+	}
+	if err := s.collectOrphans(ctx, time.Now().Add(-grace), dryRun, report); err != nil {
+		errs = append(errs, fmt.Errorf("cannot list orphaned images: %w", err))
+	}
+	if err := s.expireUploads(ctx, dryRun, report); err != nil {
+		errs = append(errs, fmt.Errorf("cannot list expired uploads: %w", err))
+	}
+
+	if !dryRun {
+		gcRuns.Add(1)
+		gcDeletedImages.Add(int64(report.Images))
+		gcReclaimedBytes.Add(report.ReclaimedBytes)
+		gcFailed.Add(int64(report.Failed))
+	}
+	return report, errors.Join(errs...)
+}
+
+// retryDeletions deletes the objects of images unregistered by earlier
+// runs that could not be deleted then.
+func (s *imageService) retryDeletions(ctx context.Context, report *GCReport) error {
+	after := ""
+	for {
+		keys, err := s.repository.ListPendingDeletions(ctx, after, gcBatchSize)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if err = s.deleteObject(ctx, key); err != nil {
+				log.Error().Msg(fmt.Sprintf("Cannot delete object %s of a collected image: %v", key, err))
+				report.Failed++
+			}
+		}
+		if len(keys) < gcBatchSize {
+			return nil
+		}
+		after = keys[len(keys)-1]
+	}
+}
+
+func (s *imageService) collectOrphans(ctx context.Context, before time.Time, dryRun bool, report *GCReport) error {
+	after := ""
+	for {
+		orphans, err := s.repository.ListOrphans(ctx, before, after, gcBatchSize)
+		if err != nil {
+			return err
+		}
+		for _, image := range orphans {
+			size, err := s.collect(ctx, image, dryRun)
+			if err != nil {
+				log.Error().Msg(fmt.Sprintf("Cannot collect image %s: %v", image.Key, err))
+				report.Failed++
+				continue
+			}
+			if size < 0 {
+				continue
+			}
+			report.Images++
+			report.ReclaimedBytes += size
+			report.Keys = append(report.Keys, image.Key)
+		}
+		if len(orphans) < gcBatchSize {
+			return nil
+		}
+		after = orphans[len(orphans)-1].Key
+	}
+}
+
+// collect deletes the image and its variants, returning the bytes they
+// took or -1 when the image has come to be referenced.
+func (s *imageService) collect(ctx context.Context, image Image, dryRun bool) (int64, error) {
+	size := image.Size
+	keys := []string{image.Key}
+	for _, v := range s.variants.Variants {
+		info, err := s.store.Head(ctx, variantKey(image.Key, v.Name))
+		if errors.Is(err, ErrImageNotFound) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		size += info.Size
+		keys = append(keys, info.Key)
+	}
+	if dryRun {
+		return size, nil
+	}
+
+	// the row goes first: references to it are foreign keys, so once it
+	// is gone nothing can come to refer to the objects. The objects are
+	// recorded as pending deletion with it, so none is left behind when
+	// deleting it fails.
+	deleted, err := s.repository.DeleteOrphan(ctx, image.Key, keys)
+	if err != nil {
+		return 0, err
+	}
+	if !deleted {
+		return -1, nil
+	}
+	for _, key := range keys {
+		if err = s.deleteObject(ctx, key); err != nil {
+			return 0, fmt.Errorf("image %s was unregistered but not deleted, which the next run retries: %w", key, err)
+		}
+	}
+	return size, nil
+}
+
+// deleteObject deletes an object pending deletion, recording the
+// failure when it cannot be.
+func (s *imageService) deleteObject(ctx context.Context, key string) error {
+	if err := s.store.Delete(ctx, key); err != nil {
+		return errors.Join(err, s.repository.FailDeletion(ctx, key, err.Error()))
+	}
+	return s.repository.FinishDeletion(ctx, key)
+}
+
+// SweepUnregistered deletes objects last written more than grace ago
+// that are neither an image, a variant of one, nor kept by the image
+// service itself. Objects uploaded before images were registered were
+// never in the images table, so CollectGarbage cannot find them; this
+// is run once, after the registry has been backfilled.
+func (s *imageService) SweepUnregistered(ctx context.Context, grace time.Duration, dryRun bool) (*GCReport, error) {
+	report := &GCReport{DryRun: dryRun, Keys: make([]string, 0)}
+	before := time.Now().Add(-grace)
+	err := s.store.List(ctx, func(page []StoredObject) error {
+		candidates := make([]StoredObject, 0, len(page))
+		keys := make([]string, 0, 2*len(page))
+		for _, object := range page {
+			if internalKey(object.Key) || !object.ModifiedAt.Before(before) {
+				continue
+			}
+			candidates = append(candidates, object)
+			keys = append(keys, object.Key, s.variants.original(object.Key))
+		}
+		if len(candidates) == 0 {
+			return nil
+		}
+		registered, err := s.repository.RegisteredKeys(ctx, keys)
+		if err != nil {
+			return err
+		}
+		for _, object := range candidates {
+			if registered[object.Key] || registered[s.variants.original(object.Key)] {
+				continue
+			}
+			if !dryRun {
+				if err = s.store.Delete(ctx, object.Key); err != nil {
+					log.Error().Msg(fmt.Sprintf("Cannot delete unregistered object %s: %v", object.Key, err))
+					report.Failed++
+					continue
+				}
+			}
+			report.Images++
+			report.ReclaimedBytes += object.Size
+			report.Keys = append(report.Keys, object.Key)
+		}
+		return nil
+	})
+	return report, err
+}
+
+// RunGarbageCollector collects orphaned images every interval until ctx
+// is cancelled.
+func RunGarbageCollector(ctx context.Context, service Service, interval, grace time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		report, err := service.CollectGarbage(ctx, grace, false)
+		if err != nil {
+			log.Error().Msg(fmt.Sprintf("Collecting orphaned images failed: %v", err))
+		}
+		if report.Images > 0 || report.ExpiredUploads > 0 {
+			log.Info().Msg(fmt.Sprintf("Deleted %d orphaned images and %d expired uploads, reclaiming %d bytes",
+				report.Images, report.ExpiredUploads, report.ReclaimedBytes))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
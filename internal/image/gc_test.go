@@ -0,0 +1,259 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeRepository keeps the images, uploads and pending deletions the
+// garbage collector works through.
+type fakeRepository struct {
+	Repository
+	images     map[string]Image
+	referenced map[string]bool
+	pending    map[string]int
+	uploads    []Upload
+	chunks     map[string][]Chunk
+}
+
+func (r *fakeRepository) ListOrphans(ctx context.Context, uploadedBefore time.Time, afterKey string, limit int) ([]Image, error) {
+	res := make([]Image, 0)
+	for _, image := range r.images {
+		if image.UploadedAt.Before(uploadedBefore) && image.Key > afterKey && !r.referenced[image.Key] {
+			res = append(res, image)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Key < res[j].Key })
+	return res[:min(limit, len(res))], nil
+}
+
+func (r *fakeRepository) DeleteOrphan(ctx context.Context, key string, objectKeys []string) (bool, error) {
+	if _, ok := r.images[key]; !ok || r.referenced[key] {
+		return false, nil
+	}
+	delete(r.images, key)
+	for _, k := range objectKeys {
+		if _, ok := r.pending[k]; !ok {
+			r.pending[k] = 0
+		}
+	}
+	return true, nil
+}
+
+func (r *fakeRepository) ListPendingDeletions(ctx context.Context, afterKey string, limit int) ([]string, error) {
+	res := make([]string, 0)
+	for key := range r.pending {
+		if key > afterKey {
+			res = append(res, key)
+		}
+	}
+	slices.Sort(res)
+	return res[:min(limit, len(res))], nil
+}
+
+func (r *fakeRepository) FinishDeletion(ctx context.Context, key string) error {
+	delete(r.pending, key)
+	return nil
+}
+
+func (r *fakeRepository) FailDeletion(ctx context.Context, key string, reason string) error {
+	r.pending[key]++
+	return nil
+}
+
+func (r *fakeRepository) RegisteredKeys(ctx context.Context, keys []string) (map[string]bool, error) {
+	res := make(map[string]bool)
+	for _, key := range keys {
+		if _, ok := r.images[key]; ok {
+			res[key] = true
+		}
+	}
+	return res, nil
+}
+
+func (r *fakeRepository) ListExpiredUploads(ctx context.Context, before time.Time, afterID string, limit int) ([]Upload, error) {
+	res := make([]Upload, 0)
+	for _, upload := range r.uploads {
+		if upload.ExpiresAt.Before(before) && upload.ID > afterID {
+			res = append(res, upload)
+		}
+	}
+	return res[:min(limit, len(res))], nil
+}
+
+func (r *fakeRepository) ListChunks(ctx context.Context, uploadID string) ([]Chunk, error) {
+	return r.chunks[uploadID], nil
+}
+
+func (r *fakeRepository) DeleteUpload(ctx context.Context, id string) error {
+	r.uploads = slices.DeleteFunc(r.uploads, func(u Upload) bool { return u.ID == id })
+	return nil
+}
+
+// failingStore fails to delete the keys in fail.
+type failingStore struct {
+	ObjectStore
+	fail map[string]bool
+}
+
+func (s *failingStore) Delete(ctx context.Context, key string) error {
+	if s.fail[key] {
+		return errors.New("access denied")
+	}
+	return s.ObjectStore.Delete(ctx, key)
+}
+
+// newGCService stores each of keys, written an hour ago, and registers
+// the images among them as uploaded then too.
+func newGCService(t *testing.T, keys []string, images []string) (*imageService, *fakeRepository, *failingStore) {
+	t.Helper()
+	root := t.TempDir()
+	files, err := NewFileStore(root, "http://localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hourAgo := time.Now().Add(-time.Hour)
+	for _, key := range keys {
+		if err = files.Put(context.Background(), key, strings.NewReader(key), ObjectInfo{}); err != nil {
+			t.Fatal(err)
+		}
+		if err = os.Chtimes(filepath.Join(root, "objects", key), hourAgo, hourAgo); err != nil {
+			t.Fatal(err)
+		}
+	}
+	repository := &fakeRepository{
+		images:     make(map[string]Image),
+		referenced: make(map[string]bool),
+		pending:    make(map[string]int),
+		chunks:     make(map[string][]Chunk),
+	}
+	for _, key := range images {
+		repository.images[key] = Image{Key: key, Size: int64(len(key)), UploadedAt: hourAgo}
+	}
+	store := &failingStore{ObjectStore: files, fail: make(map[string]bool)}
+	variants := VariantConfig{Variants: []Variant{{Name: "thumb", MaxWidth: 8, MaxHeight: 8}}}
+	return NewService(store, repository, time.Minute, UploadPolicy{}, variants, nil, 1).(*imageService), repository, store
+}
+
+func stored(t *testing.T, store ObjectStore) []string {
+	t.Helper()
+	keys := make([]string, 0)
+	err := store.List(context.Background(), func(page []StoredObject) error {
+		for _, object := range page {
+			keys = append(keys, object.Key)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func TestCollectGarbage(t *testing.T) {
+	s, repository, store := newGCService(t, []string{"a", "a_thumb", "b", "c", "chunk-u1"}, []string{"a", "b", "c"})
+	repository.referenced["c"] = true
+	repository.uploads = []Upload{{ID: "u1", ExpiresAt: time.Now().Add(-time.Minute)}}
+	repository.chunks["u1"] = []Chunk{{Key: "chunk-u1", Size: 8}}
+	store.fail["a_thumb"] = true
+
+	report, err := s.CollectGarbage(context.Background(), time.Minute, false)
+	if err != nil {
+		t.Fatalf("CollectGarbage() error = %v", err)
+	}
+	// a failed delete leaves its object pending, and the run goes on
+	if report.Images != 1 || !slices.Equal(report.Keys, []string{"b"}) || report.Failed != 1 || report.ExpiredUploads != 1 {
+		t.Errorf("CollectGarbage() = %+v", report)
+	}
+	if got := stored(t, store); !slices.Equal(got, []string{"a_thumb", "c"}) {
+		t.Errorf("CollectGarbage() left %q, want a_thumb and c", got)
+	}
+	if attempts, ok := repository.pending["a_thumb"]; !ok || attempts != 1 || len(repository.pending) != 1 {
+		t.Errorf("pending deletions = %v, want a_thumb once", repository.pending)
+	}
+
+	delete(store.fail, "a_thumb")
+	report, err = s.CollectGarbage(context.Background(), time.Minute, false)
+	if err != nil {
+		t.Fatalf("CollectGarbage() error = %v", err)
+	}
+	if report.Images != 0 || report.Failed != 0 {
+		t.Errorf("CollectGarbage() = %+v", report)
+	}
+	if got := stored(t, store); !slices.Equal(got, []string{"c"}) {
+		t.Errorf("CollectGarbage() retried and left %q, want c", got)
+	}
+	if len(repository.pending) != 0 {
+		t.Errorf("pending deletions = %v, want none", repository.pending)
+	}
+}
+
+func TestCollectGarbageDryRun(t *testing.T) {
+	keys := []string{"a", "a_thumb", "b", "chunk-u1"}
+	s, repository, store := newGCService(t, keys, []string{"a", "b"})
+	repository.uploads = []Upload{{ID: "u1", ExpiresAt: time.Now().Add(-time.Minute)}}
+	repository.chunks["u1"] = []Chunk{{Key: "chunk-u1", Size: 8}}
+
+	report, err := s.CollectGarbage(context.Background(), time.Minute, true)
+	if err != nil {
+		t.Fatalf("CollectGarbage() error = %v", err)
+	}
+	if !report.DryRun || !slices.Equal(report.Keys, []string{"a", "b"}) || report.ExpiredUploads != 1 ||
+		report.ReclaimedBytes != 1+7+1+8 {
+		t.Errorf("CollectGarbage() = %+v", report)
+	}
+	if got := stored(t, store); !slices.Equal(got, keys) || len(repository.images) != 2 || len(repository.uploads) != 1 {
+		t.Errorf("CollectGarbage() deleted in a dry run, leaving %q", got)
+	}
+}
+
+func TestCollectGarbageKeepsYoungImages(t *testing.T) {
+	s, _, store := newGCService(t, []string{"a"}, []string{"a"})
+	report, err := s.CollectGarbage(context.Background(), 2*time.Hour, false)
+	if err != nil {
+		t.Fatalf("CollectGarbage() error = %v", err)
+	}
+	if report.Images != 0 || !slices.Equal(stored(t, store), []string{"a"}) {
+		t.Errorf("CollectGarbage() collected an image within its grace: %+v", report)
+	}
+}
+
+func TestSweepUnregistered(t *testing.T) {
+	keys := []string{"a", "a_thumb", "chunk-u1", "legacy", "legacy_thumb", "quarantine-x"}
+	s, _, store := newGCService(t, keys, []string{"a"})
+	// written just now, and maybe about to be registered
+	if err := store.Put(context.Background(), "new", strings.NewReader("new"), ObjectInfo{}); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := s.SweepUnregistered(context.Background(), time.Minute, true)
+	if err != nil {
+		t.Fatalf("SweepUnregistered() error = %v", err)
+	}
+	if want := []string{"legacy", "legacy_thumb"}; !slices.Equal(report.Keys, want) || report.ReclaimedBytes != 6+12 {
+		t.Errorf("SweepUnregistered() = %+v, want %q", report, want)
+	}
+	if len(stored(t, store)) != len(keys)+1 {
+		t.Error("SweepUnregistered() deleted in a dry run")
+	}
+
+	store.fail["legacy_thumb"] = true
+	report, err = s.SweepUnregistered(context.Background(), time.Minute, false)
+	if err != nil {
+		t.Fatalf("SweepUnregistered() error = %v", err)
+	}
+	if !slices.Equal(report.Keys, []string{"legacy"}) || report.Failed != 1 {
+		t.Errorf("SweepUnregistered() = %+v", report)
+	}
+	want := []string{"a", "a_thumb", "chunk-u1", "legacy_thumb", "new", "quarantine-x"}
+	if got := stored(t, store); !slices.Equal(got, want) {
+		t.Errorf("SweepUnregistered() left %q, want %q", got, want)
+	}
+}
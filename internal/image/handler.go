@@ -1,12 +1,24 @@
 package image
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
+	"strconv"
 	"strings"
 
+	"github.com/citadel-corp/halosuster/internal/common/middleware"
+	"github.com/citadel-corp/halosuster/internal/common/request"
 	"github.com/citadel-corp/halosuster/internal/common/response"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/schema"
+	"github.com/rs/zerolog/log"
 )
 
+const multipartOverhead = 64 * 1024
+
 type Handler struct {
 	service Service
 }
@@ -15,61 +27,412 @@ func NewHandler(service Service) *Handler {
 	return &Handler{service: service}
 }
 
-func (h *Handler) UploadToS3(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, 2*1024*1024) // 2 MB
+func (h *Handler) Upload(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserID(r)
+	if err != nil {
+		response.JSON(w, http.StatusUnauthorized, response.ResponseBody{
+			Message: "unauthorized",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	policy := h.service.Policy()
+	// leave room for the multipart framing around the file
+	r.Body = http.MaxBytesReader(w, r.Body, policy.MaxSize+multipartOverhead)
 
-	if err := r.ParseMultipartForm(2 * 1024 * 1024); err != nil {
+	if err := r.ParseMultipartForm(policy.MaxSize); err != nil {
 		response.JSON(w, http.StatusBadRequest, response.ResponseBody{
-			Message: "File must be smaller than 2 MB",
+			Message: fmt.Sprintf("File must be smaller than %s", formatSize(policy.MaxSize)),
 		})
 		return
 	}
-	file, header, err := r.FormFile("file")
+	file, _, err := r.FormFile("file")
 	if file == nil {
 		response.JSON(w, http.StatusBadRequest, response.ResponseBody{
 			Message: "File should not be empty",
 		})
 		return
 	}
+	if err != nil {
+		response.JSON(w, http.StatusBadRequest, response.ResponseBody{
+			Message: "Failed to parse file",
+			Error:   err.Error(),
+		})
+		return
+	}
+	defer file.Close()
 
-	if header.Size < 1024*10 {
+	resp, err := h.service.Upload(r.Context(), userId, file)
+	if errors.Is(err, ErrInfectedUpload) {
+		response.JSON(w, http.StatusUnprocessableEntity, response.ResponseBody{
+			Message: "File was rejected by the malware scan",
+			Error:   err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, ErrScanFailed) {
+		response.JSON(w, http.StatusServiceUnavailable, response.ResponseBody{
+			Message: "File could not be scanned, try again later",
+			Error:   err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, ErrInvalidUpload) {
 		response.JSON(w, http.StatusBadRequest, response.ResponseBody{
-			Message: "File must be larger than 10 KB",
+			Message: "Invalid file",
+			Error:   err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		response.JSON(w, http.StatusInternalServerError, response.ResponseBody{
+			Message: "Unable to upload file",
+			Error:   err.Error(),
 		})
 		return
 	}
+	response.JSON(w, http.StatusOK, response.ResponseBody{
+		Message: "File uploaded successfully",
+		Data:    resp,
+	})
+}
 
+func (h *Handler) ListImages(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserID(r)
 	if err != nil {
+		response.JSON(w, http.StatusUnauthorized, response.ResponseBody{
+			Message: "unauthorized",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	newSchema := schema.NewDecoder()
+	newSchema.IgnoreUnknownKeys(true)
+
+	var req ListImagesPayload
+	if err := newSchema.Decode(&req, r.URL.Query()); err != nil {
 		response.JSON(w, http.StatusBadRequest, response.ResponseBody{
-			Message: "Failed to parse file",
+			Message: "Bad request",
 			Error:   err.Error(),
 		})
 		return
 	}
-	defer file.Close()
-	mimeType := header.Header.Get("Content-Type")
-	if mimeType != "image/jpeg" {
-		fileNameSplit := strings.Split(header.Filename, ".")
-		ext := fileNameSplit[len(fileNameSplit)-1]
-		isJPEG := ext == "jpeg" || ext == "jpg"
-		if mimeType == "application/octet-stream" && !isJPEG {
-			response.JSON(w, http.StatusBadRequest, response.ResponseBody{
-				Message: "File is not a jpg/jpeg type",
-			})
-			return
-		}
+	if err := req.Validate(); err != nil {
+		response.JSON(w, http.StatusBadRequest, response.ResponseBody{
+			Message: "Bad request",
+			Error:   err.Error(),
+		})
+		return
 	}
 
-	resp, err := h.service.UploadToS3(r.Context(), file)
+	images, meta, err := h.service.ListImages(r.Context(), userId, req)
 	if err != nil {
 		response.JSON(w, http.StatusInternalServerError, response.ResponseBody{
-			Message: "Unable to upload file",
+			Message: "Internal server error",
+			Error:   err.Error(),
+		})
+		return
+	}
+	response.JSONWithHeaders(w, http.StatusOK, response.ResponseBody{
+		Message: "success",
+		Data:    images,
+		Meta:    meta,
+	}, response.PaginationLinks(r, meta))
+}
+
+// Redirect sends the caller to a short-lived URL of the image, or of its
+// variant given by the size query parameter.
+func (h *Handler) Redirect(w http.ResponseWriter, r *http.Request) {
+	key := mux.Vars(r)["key"]
+	if !h.authorize(w, r, key) {
+		return
+	}
+	key, ok := h.variantKey(w, r, key)
+	if !ok {
+		return
+	}
+	url, err := h.service.PresignURL(key)
+	if err != nil {
+		response.JSON(w, http.StatusInternalServerError, response.ResponseBody{
+			Message: "Internal server error",
+			Error:   err.Error(),
+		})
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, url, http.StatusFound)
+}
+
+func (h *Handler) Download(w http.ResponseWriter, r *http.Request) {
+	key := mux.Vars(r)["key"]
+	if !h.authorize(w, r, key) {
+		return
+	}
+	key, ok := h.variantKey(w, r, key)
+	if !ok {
+		return
+	}
+	body, info, err := h.service.Open(r.Context(), key)
+	if errors.Is(err, ErrImageNotFound) {
+		response.JSON(w, http.StatusNotFound, response.ResponseBody{
+			Message: "Image not found",
+			Error:   err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		response.JSON(w, http.StatusInternalServerError, response.ResponseBody{
+			Message: "Internal server error",
+			Error:   err.Error(),
+		})
+		return
+	}
+	defer body.Close()
+
+	w.Header().Set("Content-Type", info.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	w.WriteHeader(http.StatusOK)
+	if _, err = io.Copy(w, body); err != nil {
+		log.Error().Msg(fmt.Sprintf("Cannot send image %s: %v", info.Key, err))
+	}
+}
+
+func (h *Handler) CreateUpload(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserID(r)
+	if err != nil {
+		response.JSON(w, http.StatusUnauthorized, response.ResponseBody{
+			Message: "unauthorized",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	var req PostUpload
+	err = request.DecodeJSON(w, r, &req)
+	if err != nil {
+		response.JSON(w, http.StatusBadRequest, response.ResponseBody{
+			Message: "Failed to decode JSON",
+			Error:   err.Error(),
+		})
+		return
+	}
+	if err := req.Validate(); err != nil {
+		response.JSON(w, http.StatusBadRequest, response.ResponseBody{
+			Message: "Bad request",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	resp, err := h.service.CreateUpload(r.Context(), userId, req)
+	if err != nil {
+		uploadError(w, err)
+		return
+	}
+	w.Header().Set("Location", r.URL.Path+"/"+resp.ID)
+	response.JSON(w, http.StatusCreated, response.ResponseBody{
+		Message: "Upload created successfully",
+		Data:    resp,
+	})
+}
+
+func (h *Handler) GetUpload(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserID(r)
+	if err != nil {
+		response.JSON(w, http.StatusUnauthorized, response.ResponseBody{
+			Message: "unauthorized",
 			Error:   err.Error(),
 		})
 		return
 	}
+
+	resp, err := h.service.GetUpload(r.Context(), userId, mux.Vars(r)["id"])
+	if err != nil {
+		uploadError(w, err)
+		return
+	}
+	w.Header().Set("Upload-Offset", strconv.FormatInt(resp.Offset, 10))
+	w.Header().Set("Cache-Control", "no-store")
 	response.JSON(w, http.StatusOK, response.ResponseBody{
-		Message: "File uploaded successfully",
+		Message: "success",
+		Data:    resp,
+	})
+}
+
+// PatchUpload appends the request body to the upload. The Upload-Offset
+// header must be the offset the upload has reached, and is set in the
+// response to the offset after the chunk.
+func (h *Handler) PatchUpload(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserID(r)
+	if err != nil {
+		response.JSON(w, http.StatusUnauthorized, response.ResponseBody{
+			Message: "unauthorized",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		response.JSON(w, http.StatusBadRequest, response.ResponseBody{
+			Message: "Upload-Offset header must be a non-negative integer",
+		})
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, MaxChunkSize+1)
+
+	resp, err := h.service.PatchUpload(r.Context(), userId, mux.Vars(r)["id"], offset, r.Body)
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		response.JSON(w, http.StatusRequestEntityTooLarge, response.ResponseBody{
+			Message: fmt.Sprintf("Chunk must be smaller than %s", formatSize(MaxChunkSize)),
+		})
+		return
+	}
+	if err != nil {
+		uploadError(w, err)
+		return
+	}
+	w.Header().Set("Upload-Offset", strconv.FormatInt(resp.Offset, 10))
+	response.JSON(w, http.StatusOK, response.ResponseBody{
+		Message: "Chunk uploaded successfully",
+		Data:    resp,
+	})
+}
+
+func (h *Handler) FinalizeUpload(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserID(r)
+	if err != nil {
+		response.JSON(w, http.StatusUnauthorized, response.ResponseBody{
+			Message: "unauthorized",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	resp, err := h.service.FinalizeUpload(r.Context(), userId, mux.Vars(r)["id"])
+	if err != nil {
+		uploadError(w, err)
+		return
+	}
+	// the client polls the upload until the scan is done
+	if resp.Status == UploadStatusScanning {
+		w.Header().Set("Location", strings.TrimSuffix(r.URL.Path, "/finalize"))
+		response.JSON(w, http.StatusAccepted, response.ResponseBody{
+			Message: "Upload is being scanned",
+			Data:    resp,
+		})
+		return
+	}
+	response.JSON(w, http.StatusOK, response.ResponseBody{
+		Message: "success",
 		Data:    resp,
 	})
 }
+
+// uploadError writes the response for an error of a resumable upload.
+func uploadError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrUploadNotFound) {
+		response.JSON(w, http.StatusNotFound, response.ResponseBody{
+			Message: "Upload not found",
+			Error:   err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, ErrUploadOffsetMismatch) || errors.Is(err, ErrUploadIncomplete) || errors.Is(err, ErrUploadFinalized) {
+		response.JSON(w, http.StatusConflict, response.ResponseBody{
+			Message: "Conflict",
+			Error:   err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, ErrInvalidUpload) {
+		response.JSON(w, http.StatusBadRequest, response.ResponseBody{
+			Message: "Invalid file",
+			Error:   err.Error(),
+		})
+		return
+	}
+	response.JSON(w, http.StatusInternalServerError, response.ResponseBody{
+		Message: "Internal server error",
+		Error:   err.Error(),
+	})
+}
+
+// authorize writes the error response and returns false unless the
+// caller may view the image. IT users may view every image.
+func (h *Handler) authorize(w http.ResponseWriter, r *http.Request, key string) bool {
+	userId, err := getUserID(r)
+	if err != nil {
+		response.JSON(w, http.StatusUnauthorized, response.ResponseBody{
+			Message: "unauthorized",
+			Error:   err.Error(),
+		})
+		return false
+	}
+	userType, _ := r.Context().Value(middleware.ContextUserTypeKey{}).(string)
+
+	err = h.service.Authorize(r.Context(), userId, userType == "IT", key)
+	if errors.Is(err, ErrImageNotFound) {
+		response.JSON(w, http.StatusNotFound, response.ResponseBody{
+			Message: "Image not found",
+			Error:   err.Error(),
+		})
+		return false
+	}
+	if errors.Is(err, ErrImageForbidden) {
+		response.JSON(w, http.StatusForbidden, response.ResponseBody{
+			Message: "Forbidden",
+			Error:   err.Error(),
+		})
+		return false
+	}
+	if err != nil {
+		response.JSON(w, http.StatusInternalServerError, response.ResponseBody{
+			Message: "Internal server error",
+			Error:   err.Error(),
+		})
+		return false
+	}
+	return true
+}
+
+// variantKey writes the error response and returns false unless the
+// size query parameter names a variant of the image.
+func (h *Handler) variantKey(w http.ResponseWriter, r *http.Request, key string) (string, bool) {
+	key, err := h.service.VariantKey(r.Context(), key, r.URL.Query().Get("size"))
+	if errors.Is(err, ErrUnknownVariant) {
+		response.JSON(w, http.StatusBadRequest, response.ResponseBody{
+			Message: "Bad request",
+			Error:   err.Error(),
+		})
+		return "", false
+	}
+	if errors.Is(err, ErrImageNotFound) {
+		response.JSON(w, http.StatusNotFound, response.ResponseBody{
+			Message: "Image not found",
+			Error:   err.Error(),
+		})
+		return "", false
+	}
+	if err != nil {
+		response.JSON(w, http.StatusInternalServerError, response.ResponseBody{
+			Message: "Internal server error",
+			Error:   err.Error(),
+		})
+		return "", false
+	}
+	return key, true
+}
+
+func getUserID(r *http.Request) (string, error) {
+	if authValue, ok := r.Context().Value(middleware.ContextAuthKey{}).(string); ok {
+		return authValue, nil
+	} else {
+		slog.Error("cannot parse auth value from context")
+		return "", errors.New("cannot parse auth value from context")
+	}
+}
@@ -0,0 +1,80 @@
+package image
+
+import (
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Objects under these prefixes are not images: chunks of resumable
+// uploads and quarantined files.
+const (
+	chunkPrefix      = "chunk-"
+	quarantinePrefix = "quarantine-"
+)
+
+// Image is an upload recorded in the images table. Images uploaded
+// before the table existed are only in the object store.
+type Image struct {
+	Key         string
+	UploadedBy  *string
+	Size        int64
+	ContentType string
+	SHA256      string
+	// Width and Height are nil for documents other than images.
+	Width      *int
+	Height     *int
+	UploadedAt time.Time
+}
+
+// QuarantinedFile is an upload the scanner found malware in. It is kept
+// apart from images, for inspection, and never served.
+type QuarantinedFile struct {
+	Key           string
+	UploadedBy    *string
+	Size          int64
+	SHA256        string
+	Signature     string
+	QuarantinedAt time.Time
+}
+
+// ObjectInfo describes an uploaded object. UploadedBy is empty for
+// objects uploaded before uploads recorded their uploader.
+type ObjectInfo struct {
+	Key         string
+	UploadedBy  string
+	ContentType string
+	Size        int64
+}
+
+// StoredObject is an object as the store lists it.
+type StoredObject struct {
+	Key        string
+	Size       int64
+	ModifiedAt time.Time
+}
+
+var keyPattern = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9._-]{0,99}$`)
+
+// ValidKey reports whether key can name an object. It keeps keys from
+// naming files outside the filesystem store.
+func ValidKey(key string) bool {
+	return keyPattern.MatchString(key)
+}
+
+// KeyOf returns the object key of ref, which is either a key or a URL
+// to the object, as uploads returned before images were private.
+func KeyOf(ref string) string {
+	if u, err := url.Parse(ref); err == nil && u.Scheme != "" {
+		return path.Base(u.Path)
+	}
+	return ref
+}
+
+// internalKey reports whether key names an object kept for the image
+// service's own use, which no one may view or refer to.
+func internalKey(key string) bool {
+	return strings.HasPrefix(key, chunkPrefix) || strings.HasPrefix(key, quarantinePrefix)
+}
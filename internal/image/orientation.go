@@ -0,0 +1,158 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	stdimage "image"
+)
+
+const exifOrientationTag = 0x0112
+
+// exifOrientation returns the EXIF orientation of a JPEG or PNG file,
+// from 1 to 8, or 1 when it has none. Cameras store photos as the
+// sensor read them and set the orientation to how they should be shown.
+func exifOrientation(data []byte, format string) int {
+	var tiff []byte
+	switch format {
+	case "jpeg":
+		tiff = jpegExif(data)
+	case "png":
+		tiff = pngExif(data)
+	}
+	o := tiffOrientation(tiff)
+	if o < 1 || o > 8 {
+		return 1
+	}
+	return o
+}
+
+// jpegExif returns the TIFF structure of the EXIF APP1 segment.
+func jpegExif(data []byte) []byte {
+	if len(data) < 2 || data[0] != 0xff || data[1] != 0xd8 {
+		return nil
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xff {
+			return nil
+		}
+		marker := data[i+1]
+		switch {
+		case marker == 0xff:
+			// fill byte
+			i++
+			continue
+		case marker == 0x01 || (marker >= 0xd0 && marker <= 0xd7):
+			i += 2
+			continue
+		case marker == 0xda || marker == 0xd9:
+			// metadata comes before the scan
+			return nil
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return nil
+		}
+		segment := data[i+4 : i+2+length]
+		if marker == 0xe1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return segment[6:]
+		}
+		i += 2 + length
+	}
+	return nil
+}
+
+// pngExif returns the content of the eXIf chunk.
+func pngExif(data []byte) []byte {
+	if len(data) < 8 || !bytes.Equal(data[:8], []byte("\x89PNG\r\n\x1a\n")) {
+		return nil
+	}
+	for i := 8; i+8 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		if length < 0 || i+12+length > len(data) {
+			return nil
+		}
+		switch string(data[i+4 : i+8]) {
+		case "eXIf":
+			return data[i+8 : i+8+length]
+		case "IEND":
+			return nil
+		}
+		i += 12 + length
+	}
+	return nil
+}
+
+// tiffOrientation reads the orientation tag of the first IFD, or 0.
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+	if order.Uint16(tiff[2:]) != 42 {
+		return 0
+	}
+	ifd := int64(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > int64(len(tiff)) {
+		return 0
+	}
+	count := int64(order.Uint16(tiff[ifd:]))
+	for n := int64(0); n < count; n++ {
+		entry := ifd + 2 + n*12
+		if entry+12 > int64(len(tiff)) {
+			return 0
+		}
+		// a SHORT, stored in the first bytes of the value
+		if order.Uint16(tiff[entry:]) == exifOrientationTag && order.Uint16(tiff[entry+2:]) == 3 {
+			return int(order.Uint16(tiff[entry+8:]))
+		}
+	}
+	return 0
+}
+
+// orient turns img the way its EXIF orientation says it should be
+// shown, so it is shown right once the metadata is dropped.
+func orient(img stdimage.Image, orientation int) stdimage.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	// source of the destination pixel at x, y
+	var src func(x, y int) (int, int)
+	switch orientation {
+	case 2: // flip horizontally
+		src = func(x, y int) (int, int) { return w - 1 - x, y }
+	case 3: // rotate 180°
+		src = func(x, y int) (int, int) { return w - 1 - x, h - 1 - y }
+	case 4: // flip vertically
+		src = func(x, y int) (int, int) { return x, h - 1 - y }
+	case 5: // transpose
+		src = func(x, y int) (int, int) { return y, x }
+	case 6: // rotate 90° clockwise
+		src = func(x, y int) (int, int) { return y, h - 1 - x }
+	case 7: // transverse
+		src = func(x, y int) (int, int) { return w - 1 - y, h - 1 - x }
+	case 8: // rotate 90° counterclockwise
+		src = func(x, y int) (int, int) { return w - 1 - y, x }
+	}
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := stdimage.NewRGBA(stdimage.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			sx, sy := src(x, y)
+			dst.Set(x, y, img.At(b.Min.X+sx, b.Min.Y+sy))
+		}
+	}
+	return dst
+}
@@ -0,0 +1,149 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	stdimage "image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// exifWithOrientation is a big-endian TIFF structure holding only the
+// orientation tag.
+func exifWithOrientation(orientation uint16) []byte {
+	var b bytes.Buffer
+	b.WriteString("MM")
+	binary.Write(&b, binary.BigEndian, uint16(42))
+	binary.Write(&b, binary.BigEndian, uint32(8))
+	binary.Write(&b, binary.BigEndian, uint16(1))
+	binary.Write(&b, binary.BigEndian, uint16(exifOrientationTag))
+	binary.Write(&b, binary.BigEndian, uint16(3))
+	binary.Write(&b, binary.BigEndian, uint32(1))
+	binary.Write(&b, binary.BigEndian, orientation)
+	binary.Write(&b, binary.BigEndian, uint16(0))
+	binary.Write(&b, binary.BigEndian, uint32(0))
+	return b.Bytes()
+}
+
+// halves is a 16 by 8 image, red on the left and blue on the right.
+func halves() stdimage.Image {
+	img := stdimage.NewRGBA(stdimage.Rect(0, 0, 16, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 16; x++ {
+			c := color.RGBA{R: 255, A: 255}
+			if x >= 8 {
+				c = color.RGBA{B: 255, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func jpegWithOrientation(t *testing.T, orientation uint16) []byte {
+	t.Helper()
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, halves(), &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatal(err)
+	}
+	segment := append([]byte("Exif\x00\x00"), exifWithOrientation(orientation)...)
+	app1 := []byte{0xff, 0xe1}
+	app1 = binary.BigEndian.AppendUint16(app1, uint16(len(segment)+2))
+	app1 = append(app1, segment...)
+	data := encoded.Bytes()
+	return append(append(append([]byte{}, data[:2]...), app1...), data[2:]...)
+}
+
+func pngWithOrientation(t *testing.T, orientation uint16) []byte {
+	t.Helper()
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, halves()); err != nil {
+		t.Fatal(err)
+	}
+	exif := exifWithOrientation(orientation)
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(exif)))
+	chunk = append(chunk, "eXIf"...)
+	chunk = append(chunk, exif...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+	// after the signature and the IHDR chunk
+	data := encoded.Bytes()
+	at := 8 + 12 + int(binary.BigEndian.Uint32(data[8:]))
+	return append(append(append([]byte{}, data[:at]...), chunk...), data[at:]...)
+}
+
+func TestExifOrientation(t *testing.T) {
+	for orientation := uint16(1); orientation <= 8; orientation++ {
+		if got := exifOrientation(jpegWithOrientation(t, orientation), "jpeg"); got != int(orientation) {
+			t.Errorf("exifOrientation(jpeg) = %d, want %d", got, orientation)
+		}
+		if got := exifOrientation(pngWithOrientation(t, orientation), "png"); got != int(orientation) {
+			t.Errorf("exifOrientation(png) = %d, want %d", got, orientation)
+		}
+	}
+	var plain bytes.Buffer
+	jpeg.Encode(&plain, halves(), nil)
+	if got := exifOrientation(plain.Bytes(), "jpeg"); got != 1 {
+		t.Errorf("exifOrientation() without EXIF = %d, want 1", got)
+	}
+	if got := exifOrientation(jpegWithOrientation(t, 9), "jpeg"); got != 1 {
+		t.Errorf("exifOrientation() of an invalid orientation = %d, want 1", got)
+	}
+}
+
+func TestSanitizeAppliesOrientation(t *testing.T) {
+	red, blue := color.RGBA{R: 255, A: 255}, color.RGBA{B: 255, A: 255}
+	// where the red and blue halves end up, probed at a pixel well
+	// inside each
+	tests := []struct {
+		orientation        uint16
+		width, height      int
+		redProbe, bluProbe stdimage.Point
+	}{
+		{orientation: 1, width: 16, height: 8, redProbe: stdimage.Pt(3, 4), bluProbe: stdimage.Pt(12, 4)},
+		{orientation: 2, width: 16, height: 8, redProbe: stdimage.Pt(12, 4), bluProbe: stdimage.Pt(3, 4)},
+		{orientation: 3, width: 16, height: 8, redProbe: stdimage.Pt(12, 4), bluProbe: stdimage.Pt(3, 4)},
+		{orientation: 4, width: 16, height: 8, redProbe: stdimage.Pt(3, 4), bluProbe: stdimage.Pt(12, 4)},
+		{orientation: 5, width: 8, height: 16, redProbe: stdimage.Pt(4, 3), bluProbe: stdimage.Pt(4, 12)},
+		{orientation: 6, width: 8, height: 16, redProbe: stdimage.Pt(4, 3), bluProbe: stdimage.Pt(4, 12)},
+		{orientation: 7, width: 8, height: 16, redProbe: stdimage.Pt(4, 12), bluProbe: stdimage.Pt(4, 3)},
+		{orientation: 8, width: 8, height: 16, redProbe: stdimage.Pt(4, 12), bluProbe: stdimage.Pt(4, 3)},
+	}
+	policy := UploadPolicy{AllowedTypes: []string{ContentTypeJPEG, ContentTypePNG}, MaxSize: 1 << 20}
+	for _, tt := range tests {
+		for format, data := range map[string][]byte{
+			"jpeg": jpegWithOrientation(t, tt.orientation),
+			"png":  pngWithOrientation(t, tt.orientation),
+		} {
+			out, info, err := policy.sanitize(data)
+			if err != nil {
+				t.Fatalf("sanitize(%s, %d) error = %v", format, tt.orientation, err)
+			}
+			if *info.Width != tt.width || *info.Height != tt.height {
+				t.Errorf("sanitize(%s, %d) = %dx%d, want %dx%d", format, tt.orientation, *info.Width, *info.Height, tt.width, tt.height)
+			}
+			if o := exifOrientation(out, format); o != 1 {
+				t.Errorf("sanitize(%s, %d) kept orientation %d", format, tt.orientation, o)
+			}
+			img, _, err := stdimage.Decode(bytes.NewReader(out))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !near(img.At(tt.redProbe.X, tt.redProbe.Y), red) || !near(img.At(tt.bluProbe.X, tt.bluProbe.Y), blue) {
+				t.Errorf("sanitize(%s, %d) did not turn the image", format, tt.orientation)
+			}
+		}
+	}
+}
+
+// near tells whether c is close to want, allowing for JPEG loss.
+func near(c color.Color, want color.RGBA) bool {
+	r, g, b, _ := c.RGBA()
+	diff := func(a uint32, b uint8) bool {
+		d := int(a>>8) - int(b)
+		return d > -48 && d < 48
+	}
+	return diff(r, want.R) && diff(g, want.G) && diff(b, want.B)
+}
@@ -0,0 +1,412 @@
+package image
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/citadel-corp/halosuster/internal/common/db"
+	"github.com/citadel-corp/halosuster/internal/common/query"
+	"github.com/citadel-corp/halosuster/internal/common/response"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+type Repository interface {
+	Create(ctx context.Context, image *Image) error
+	GetByHash(ctx context.Context, uploadedBy string, sha256 string) (*Image, error)
+	List(ctx context.Context, uploadedBy string, req ListImagesPayload) ([]Image, *response.Pagination, error)
+	IsReferenced(ctx context.Context, key string) (bool, error)
+	ListOrphans(ctx context.Context, uploadedBefore time.Time, afterKey string, limit int) ([]Image, error)
+	DeleteOrphan(ctx context.Context, key string, objectKeys []string) (bool, error)
+	ListPendingDeletions(ctx context.Context, afterKey string, limit int) ([]string, error)
+	FinishDeletion(ctx context.Context, key string) error
+	FailDeletion(ctx context.Context, key string, reason string) error
+	RegisteredKeys(ctx context.Context, keys []string) (map[string]bool, error)
+	GetImage(ctx context.Context, key string) (*Image, error)
+
+	CreateUpload(ctx context.Context, upload *Upload) error
+	GetUpload(ctx context.Context, id string) (*Upload, error)
+	AppendChunk(ctx context.Context, uploadID string, chunk Chunk) error
+	ListChunks(ctx context.Context, uploadID string) ([]Chunk, error)
+	ClaimUpload(ctx context.Context, id string, startedAt time.Time, staleBefore time.Time) (bool, error)
+	FinishUpload(ctx context.Context, id string, startedAt time.Time, status UploadStatus, detail *string, imageKey *string) error
+	ListExpiredUploads(ctx context.Context, before time.Time, afterID string, limit int) ([]Upload, error)
+	DeleteUpload(ctx context.Context, id string) error
+
+	Quarantine(ctx context.Context, file *QuarantinedFile) error
+}
+
+const imageColumns = "key, uploaded_by, size, content_type, sha256, width, height, uploaded_at"
+
+type dbRepository struct {
+	db *db.DB
+}
+
+func NewRepository(db *db.DB) Repository {
+	return &dbRepository{db: db}
+}
+
+func (i *Image) dest() []any {
+	return []any{&i.Key, &i.UploadedBy, &i.Size, &i.ContentType, &i.SHA256, &i.Width, &i.Height, &i.UploadedAt}
+}
+
+// Create returns ErrImageAlreadyExists when the uploader already has an
+// image with the same hash.
+func (d *dbRepository) Create(ctx context.Context, image *Image) error {
+	q := `
+		INSERT INTO images (key, uploaded_by, size, content_type, sha256, width, height)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING uploaded_at;
+	`
+	err := d.db.DB().QueryRowContext(ctx, q, image.Key, image.UploadedBy, image.Size, image.ContentType,
+		image.SHA256, image.Width, image.Height).Scan(&image.UploadedAt)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return ErrImageAlreadyExists
+	}
+	return err
+}
+
+func (d *dbRepository) GetByHash(ctx context.Context, uploadedBy string, sha256 string) (*Image, error) {
+	q := "SELECT " + imageColumns + " FROM images WHERE uploaded_by = $1 AND sha256 = $2;"
+	image := &Image{}
+	err := d.db.DB().QueryRowContext(ctx, q, uploadedBy, sha256).Scan(image.dest()...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrImageNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return image, nil
+}
+
+func (d *dbRepository) GetImage(ctx context.Context, key string) (*Image, error) {
+	q := "SELECT " + imageColumns + " FROM images WHERE key = $1;"
+	image := &Image{}
+	err := d.db.DB().QueryRowContext(ctx, q, key).Scan(image.dest()...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrImageNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return image, nil
+}
+
+func (d *dbRepository) List(ctx context.Context, uploadedBy string, req ListImagesPayload) ([]Image, *response.Pagination, error) {
+	meta := &response.Pagination{Limit: req.Limit, Offset: req.Offset}
+	b := query.NewBuilder()
+	where := b.Where(query.Eq("uploaded_by", uploadedBy))
+	whereArgs := len(b.Args())
+	q := "SELECT " + imageColumns + ", " + db.WindowCount + " FROM images" + where +
+		query.OrderBy([]query.Sort{{Column: "uploaded_at", Desc: req.CreatedAt != "asc"}, {Column: "key"}}) +
+		fmt.Sprintf(" LIMIT %s OFFSET %s;", b.Arg(req.Limit), b.Arg(req.Offset))
+	rows, err := d.db.DB().QueryContext(ctx, q, b.Args()...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	res := make([]Image, 0)
+	for rows.Next() {
+		image := Image{}
+		if err = rows.Scan(append(image.dest(), &meta.Total)...); err != nil {
+			return nil, nil, err
+		}
+		res = append(res, image)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	// a page past the end has no rows to carry the count
+	if len(res) == 0 && req.Offset > 0 {
+		err = d.db.DB().QueryRowContext(ctx, "SELECT COUNT(*) FROM images"+where, b.Args()[:whereArgs]...).Scan(&meta.Total)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return res, meta, nil
+}
+
+// IsReferenced reports whether the image is a patient's identity card or
+// attached to a medical record.
+func (d *dbRepository) IsReferenced(ctx context.Context, key string) (bool, error) {
+	q := `
+		SELECT EXISTS (SELECT 1 FROM medical_patients WHERE identity_card_key = $1)
+			OR EXISTS (SELECT 1 FROM medical_record_attachments WHERE image_key = $1);
+	`
+	var referenced bool
+	err := d.db.DB().QueryRowContext(ctx, q, key).Scan(&referenced)
+	return referenced, err
+}
+
+// orphanCondition matches images nothing refers to: no user's or
+// patient's identity card and no record attachment.
+const orphanCondition = `
+	NOT EXISTS (SELECT 1 FROM users WHERE users.identity_card_key = images.key)
+	AND NOT EXISTS (SELECT 1 FROM medical_patients WHERE medical_patients.identity_card_key = images.key)
+	AND NOT EXISTS (SELECT 1 FROM medical_record_attachments WHERE medical_record_attachments.image_key = images.key)`
+
+// ListOrphans returns up to limit unreferenced images uploaded before
+// uploadedBefore, ordered by key from after afterKey.
+func (d *dbRepository) ListOrphans(ctx context.Context, uploadedBefore time.Time, afterKey string, limit int) ([]Image, error) {
+	q := "SELECT " + imageColumns + " FROM images WHERE uploaded_at < $1 AND key > $2 AND" + orphanCondition +
+		" ORDER BY key LIMIT $3;"
+	rows, err := d.db.DB().QueryContext(ctx, q, uploadedBefore, afterKey, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := make([]Image, 0)
+	for rows.Next() {
+		image := Image{}
+		if err = rows.Scan(image.dest()...); err != nil {
+			return nil, err
+		}
+		res = append(res, image)
+	}
+	return res, rows.Err()
+}
+
+// DeleteOrphan deletes the image row unless something has come to refer
+// to it since it was listed. A reference not committed yet when the
+// condition is checked is caught by its foreign key instead. The
+// objectKeys are recorded as pending deletion along with it, so they are
+// deleted even if deleting them fails this time.
+func (d *dbRepository) DeleteOrphan(ctx context.Context, key string, objectKeys []string) (bool, error) {
+	var deleted bool
+	err := d.db.StartTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, "DELETE FROM images WHERE key = $1 AND"+orphanCondition+";", key)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil || n == 0 {
+			return err
+		}
+		q := "INSERT INTO image_deletions (key) SELECT unnest($1::text[]) ON CONFLICT (key) DO NOTHING;"
+		if _, err = tx.ExecContext(ctx, q, objectKeys); err != nil {
+			return err
+		}
+		deleted = true
+		return nil
+	})
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return deleted, nil
+}
+
+// ListPendingDeletions returns up to limit keys of objects still to be
+// deleted, ordered from after afterKey.
+func (d *dbRepository) ListPendingDeletions(ctx context.Context, afterKey string, limit int) ([]string, error) {
+	q := "SELECT key FROM image_deletions WHERE key > $1 ORDER BY key LIMIT $2;"
+	rows, err := d.db.DB().QueryContext(ctx, q, afterKey, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := make([]string, 0)
+	for rows.Next() {
+		var key string
+		if err = rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		res = append(res, key)
+	}
+	return res, rows.Err()
+}
+
+func (d *dbRepository) FinishDeletion(ctx context.Context, key string) error {
+	_, err := d.db.DB().ExecContext(ctx, "DELETE FROM image_deletions WHERE key = $1;", key)
+	return err
+}
+
+func (d *dbRepository) FailDeletion(ctx context.Context, key string, reason string) error {
+	q := "UPDATE image_deletions SET attempts = attempts + 1, last_error = $2 WHERE key = $1;"
+	_, err := d.db.DB().ExecContext(ctx, q, key, reason)
+	return err
+}
+
+// RegisteredKeys reports which of keys are images.
+func (d *dbRepository) RegisteredKeys(ctx context.Context, keys []string) (map[string]bool, error) {
+	rows, err := d.db.DB().QueryContext(ctx, "SELECT key FROM images WHERE key = ANY($1::text[]);", keys)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := make(map[string]bool)
+	for rows.Next() {
+		var key string
+		if err = rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		res[key] = true
+	}
+	return res, rows.Err()
+}
+
+const uploadColumns = "id, uploaded_by, document_type, size, received, status, status_detail, image_key, scan_started_at, created_at, expires_at"
+
+func (u *Upload) dest() []any {
+	return []any{&u.ID, &u.UploadedBy, &u.DocumentType, &u.Size, &u.Received, &u.Status, &u.StatusDetail,
+		&u.ImageKey, &u.ScanStartedAt, &u.CreatedAt, &u.ExpiresAt}
+}
+
+func (d *dbRepository) CreateUpload(ctx context.Context, upload *Upload) error {
+	q := `
+		INSERT INTO image_uploads (id, uploaded_by, document_type, size, status, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING created_at;
+	`
+	return d.db.DB().QueryRowContext(ctx, q, upload.ID, upload.UploadedBy, upload.DocumentType, upload.Size,
+		upload.Status, upload.ExpiresAt).Scan(&upload.CreatedAt)
+}
+
+func (d *dbRepository) GetUpload(ctx context.Context, id string) (*Upload, error) {
+	q := "SELECT " + uploadColumns + " FROM image_uploads WHERE id = $1;"
+	upload := &Upload{}
+	err := d.db.DB().QueryRowContext(ctx, q, id).Scan(upload.dest()...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUploadNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return upload, nil
+}
+
+// AppendChunk records the chunk and what the upload has received. It
+// returns ErrUploadOffsetMismatch when another chunk was appended since
+// the upload was read, or it was finalized.
+func (d *dbRepository) AppendChunk(ctx context.Context, uploadID string, chunk Chunk) error {
+	return d.db.StartTx(ctx, func(tx *sql.Tx) error {
+		q := `
+			UPDATE image_uploads SET received = received + $1
+			WHERE id = $2 AND received = $3 AND status = 'uploading';
+		`
+		res, err := tx.ExecContext(ctx, q, chunk.Size, uploadID, chunk.Offset)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrUploadOffsetMismatch
+		}
+		q = `
+			INSERT INTO image_upload_chunks (upload_id, start_offset, key, size)
+			VALUES ($1, $2, $3, $4);
+		`
+		_, err = tx.ExecContext(ctx, q, uploadID, chunk.Offset, chunk.Key, chunk.Size)
+		return err
+	})
+}
+
+func (d *dbRepository) ListChunks(ctx context.Context, uploadID string) ([]Chunk, error) {
+	q := "SELECT start_offset, key, size FROM image_upload_chunks WHERE upload_id = $1 ORDER BY start_offset;"
+	rows, err := d.db.DB().QueryContext(ctx, q, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := make([]Chunk, 0)
+	for rows.Next() {
+		chunk := Chunk{}
+		if err = rows.Scan(&chunk.Offset, &chunk.Key, &chunk.Size); err != nil {
+			return nil, err
+		}
+		res = append(res, chunk)
+	}
+	return res, rows.Err()
+}
+
+// ClaimUpload moves a complete upload that is uploading, failed before,
+// or has been scanning since before staleBefore, to scanning started at
+// startedAt. It returns false when the upload is not in such a state,
+// e.g. as it was claimed concurrently.
+func (d *dbRepository) ClaimUpload(ctx context.Context, id string, startedAt time.Time, staleBefore time.Time) (bool, error) {
+	q := `
+		UPDATE image_uploads SET status = 'scanning', status_detail = NULL, scan_started_at = $2
+		WHERE id = $1 AND received = size
+			AND (status IN ('uploading', 'failed') OR (status = 'scanning' AND scan_started_at < $3));
+	`
+	res, err := d.db.DB().ExecContext(ctx, q, id, startedAt, staleBefore)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// FinishUpload records the outcome of the scan started at startedAt. Its
+// chunks are forgotten unless it failed, when they are kept for a retry.
+// It returns ErrUploadFinalized when the scan was taken over by a retry
+// as stale, which now owns the outcome and the chunks.
+func (d *dbRepository) FinishUpload(ctx context.Context, id string, startedAt time.Time, status UploadStatus, detail *string, imageKey *string) error {
+	return d.db.StartTx(ctx, func(tx *sql.Tx) error {
+		q := `
+			UPDATE image_uploads SET status = $1, status_detail = $2, image_key = $3
+			WHERE id = $4 AND status = 'scanning' AND scan_started_at = $5;
+		`
+		res, err := tx.ExecContext(ctx, q, status, detail, imageKey, id, startedAt)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrUploadFinalized
+		}
+		if status == UploadStatusFailed {
+			return nil
+		}
+		_, err = tx.ExecContext(ctx, "DELETE FROM image_upload_chunks WHERE upload_id = $1;", id)
+		return err
+	})
+}
+
+// ListExpiredUploads returns up to limit uploads that expired before
+// before, finalized or not, ordered by ID from after afterID.
+func (d *dbRepository) ListExpiredUploads(ctx context.Context, before time.Time, afterID string, limit int) ([]Upload, error) {
+	q := "SELECT " + uploadColumns + " FROM image_uploads WHERE expires_at < $1 AND id > $2 ORDER BY id LIMIT $3;"
+	rows, err := d.db.DB().QueryContext(ctx, q, before, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := make([]Upload, 0)
+	for rows.Next() {
+		upload := Upload{}
+		if err = rows.Scan(upload.dest()...); err != nil {
+			return nil, err
+		}
+		res = append(res, upload)
+	}
+	return res, rows.Err()
+}
+
+// DeleteUpload deletes the upload and, by cascade, its chunks.
+func (d *dbRepository) DeleteUpload(ctx context.Context, id string) error {
+	_, err := d.db.DB().ExecContext(ctx, "DELETE FROM image_uploads WHERE id = $1;", id)
+	return err
+}
+
+func (d *dbRepository) Quarantine(ctx context.Context, file *QuarantinedFile) error {
+	q := `
+		INSERT INTO quarantined_files (key, uploaded_by, size, sha256, signature)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING quarantined_at;
+	`
+	return d.db.DB().QueryRowContext(ctx, q, file.Key, file.UploadedBy, file.Size, file.SHA256,
+		file.Signature).Scan(&file.QuarantinedAt)
+}
@@ -0,0 +1,28 @@
+package image
+
+import validation "github.com/go-ozzo/ozzo-validation/v4"
+
+type ListImagesPayload struct {
+	CreatedAt string `schema:"createdAt" binding:"omitempty"`
+	Limit     int    `schema:"limit" binding:"omitempty"`
+	Offset    int    `schema:"offset" binding:"omitempty"`
+}
+
+func (p ListImagesPayload) Validate() error {
+	return validation.ValidateStruct(&p,
+		validation.Field(&p.CreatedAt, validation.In("asc", "desc")),
+	)
+}
+
+type PostUpload struct {
+	DocumentType DocumentType `json:"documentType"`
+	Size         int64        `json:"size"`
+}
+
+func (p PostUpload) Validate() error {
+	return validation.ValidateStruct(&p,
+		validation.Field(&p.DocumentType, validation.Required, validation.In(DocumentIdentityCard, DocumentPhoto,
+			DocumentLabResult, DocumentConsentForm, DocumentECG, DocumentUltrasound)),
+		validation.Field(&p.Size, validation.Required, validation.Min(int64(1))),
+	)
+}
@@ -1,5 +1,30 @@
 package image
 
+import "time"
+
 type ImageResponse struct {
 	ImageURL string `json:"imageUrl"`
+	// Key is how records refer to the image.
+	Key         string    `json:"key"`
+	ContentType string    `json:"contentType"`
+	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256"`
+	Width       *int      `json:"width,omitempty"`
+	Height      *int      `json:"height,omitempty"`
+	UploadedAt  time.Time `json:"uploadedAt"`
+}
+
+type UploadResponse struct {
+	ID           string       `json:"id"`
+	DocumentType DocumentType `json:"documentType"`
+	Size         int64        `json:"size"`
+	// Offset is how many bytes have been received, where the next chunk
+	// starts.
+	Offset int64        `json:"offset"`
+	Status UploadStatus `json:"status"`
+	// Detail says why an upload was not accepted.
+	Detail *string `json:"detail,omitempty"`
+	// Image is set once the upload is ready.
+	Image     *ImageResponse `json:"image,omitempty"`
+	ExpiresAt time.Time      `json:"expiresAt"`
 }
@@ -0,0 +1,431 @@
+package image
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/citadel-corp/halosuster/internal/common/id"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// MaxChunkSize is the most a single PATCH may send.
+	MaxChunkSize = 8 * 1024 * 1024
+	uploadTTL    = 24 * time.Hour
+	// scanTimeout is how long an upload may be scanning before the scan
+	// is taken to have been cut short, e.g. by a restart, and the upload
+	// may be finalized again.
+	scanTimeout = 30 * time.Minute
+)
+
+type UploadStatus string
+
+const (
+	// UploadStatusUploading uploads take chunks until finalized.
+	UploadStatusUploading UploadStatus = "uploading"
+	// UploadStatusScanning uploads are being scanned and checked.
+	UploadStatusScanning UploadStatus = "scanning"
+	// UploadStatusReady uploads have become an image.
+	UploadStatusReady UploadStatus = "ready"
+	// UploadStatusInfected uploads had malware in them and were
+	// quarantined.
+	UploadStatusInfected UploadStatus = "infected"
+	// UploadStatusRejected uploads were not an acceptable file.
+	UploadStatusRejected UploadStatus = "rejected"
+	// UploadStatusFailed uploads could not be checked, e.g. as the
+	// scanner was down, and may be finalized again.
+	UploadStatusFailed UploadStatus = "failed"
+)
+
+// Upload is a resumable upload. The client sends Size bytes in chunks,
+// each starting where the previous one ended, and finalizes it once
+// Received reaches Size. The upload is then scanned and checked in the
+// background, and the client polls its status until it is done.
+type Upload struct {
+	ID           string
+	UploadedBy   *string
+	DocumentType DocumentType
+	Size         int64
+	Received     int64
+	Status       UploadStatus
+	// StatusDetail says why an upload was not accepted.
+	StatusDetail *string
+	// ImageKey is set once the upload is ready.
+	ImageKey *string
+	// ScanStartedAt is when the upload was last finalized.
+	ScanStartedAt *time.Time
+	CreatedAt     time.Time
+	ExpiresAt     time.Time
+}
+
+// Chunk is part of an upload, stored as an object of its own until the
+// upload is finalized.
+type Chunk struct {
+	Offset int64
+	Key    string
+	Size   int64
+}
+
+func (s *imageService) CreateUpload(ctx context.Context, userID string, req PostUpload) (*UploadResponse, error) {
+	limit, ok := s.policy.Documents[req.DocumentType]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown document type %s", ErrInvalidUpload, req.DocumentType)
+	}
+	if req.Size > limit.MaxSize {
+		return nil, fmt.Errorf("%w: %s must be smaller than %s", ErrInvalidUpload, req.DocumentType, formatSize(limit.MaxSize))
+	}
+	upload := &Upload{
+		ID:           id.GenerateStringID(16),
+		UploadedBy:   &userID,
+		DocumentType: req.DocumentType,
+		Size:         req.Size,
+		Status:       UploadStatusUploading,
+		ExpiresAt:    time.Now().Add(uploadTTL),
+	}
+	err := s.repository.CreateUpload(ctx, upload)
+	if err != nil {
+		return nil, err
+	}
+	return s.uploadResponse(ctx, upload)
+}
+
+// getUpload returns ErrUploadNotFound for uploads of other users, so
+// their IDs cannot be probed.
+func (s *imageService) getUpload(ctx context.Context, userID string, uploadID string) (*Upload, error) {
+	upload, err := s.repository.GetUpload(ctx, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	if upload.UploadedBy == nil || *upload.UploadedBy != userID || time.Now().After(upload.ExpiresAt) {
+		return nil, ErrUploadNotFound
+	}
+	if upload.stale() {
+		// shown as failed, so clients polling it know to finalize again
+		detail := "scan was interrupted, finalize the upload again"
+		upload.Status, upload.StatusDetail = UploadStatusFailed, &detail
+	}
+	return upload, nil
+}
+
+// stale reports whether the upload has been scanning for so long that
+// the scan must have been cut short.
+func (u *Upload) stale() bool {
+	return u.Status == UploadStatusScanning && u.ScanStartedAt != nil &&
+		time.Since(*u.ScanStartedAt) > scanTimeout
+}
+
+func (s *imageService) GetUpload(ctx context.Context, userID string, uploadID string) (*UploadResponse, error) {
+	upload, err := s.getUpload(ctx, userID, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	return s.uploadResponse(ctx, upload)
+}
+
+// PatchUpload stores body as the chunk starting at offset, which must be
+// what the upload has received so far.
+func (s *imageService) PatchUpload(ctx context.Context, userID string, uploadID string, offset int64, body io.Reader) (*UploadResponse, error) {
+	upload, err := s.getUpload(ctx, userID, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	if upload.Status != UploadStatusUploading {
+		return nil, ErrUploadFinalized
+	}
+	if offset != upload.Received {
+		return nil, fmt.Errorf("%w: expected offset %d", ErrUploadOffsetMismatch, upload.Received)
+	}
+	// one byte more than the rest tells a chunk too large from a last one
+	data, err := io.ReadAll(io.LimitReader(body, min(upload.Size-offset, MaxChunkSize)+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > upload.Size-offset {
+		return nil, fmt.Errorf("%w: chunk goes past the upload size of %d bytes", ErrInvalidUpload, upload.Size)
+	}
+	if int64(len(data)) > MaxChunkSize {
+		return nil, fmt.Errorf("%w: chunk must be smaller than %s", ErrInvalidUpload, formatSize(MaxChunkSize))
+	}
+	if len(data) == 0 {
+		return s.uploadResponse(ctx, upload)
+	}
+
+	chunk := Chunk{Offset: offset, Key: chunkPrefix + uuid.NewString(), Size: int64(len(data))}
+	err = s.store.Put(ctx, chunk.Key, bytes.NewReader(data), ObjectInfo{
+		UploadedBy:  userID,
+		ContentType: "application/octet-stream",
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = s.repository.AppendChunk(ctx, upload.ID, chunk)
+	if err != nil {
+		// a concurrent chunk got there first
+		if delErr := s.store.Delete(ctx, chunk.Key); delErr != nil {
+			return nil, delErr
+		}
+		return nil, err
+	}
+	upload.Received += chunk.Size
+	return s.uploadResponse(ctx, upload)
+}
+
+// FinalizeUpload starts scanning a complete upload and turning it into
+// an image, checked and deduplicated like a single-request upload, in
+// the background. Finalizing an upload already finalized returns its
+// status.
+func (s *imageService) FinalizeUpload(ctx context.Context, userID string, uploadID string) (*UploadResponse, error) {
+	upload, err := s.getUpload(ctx, userID, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	if upload.Status != UploadStatusUploading && upload.Status != UploadStatusFailed {
+		return s.uploadResponse(ctx, upload)
+	}
+	if upload.Received != upload.Size {
+		return nil, fmt.Errorf("%w: received %d of %d bytes", ErrUploadIncomplete, upload.Received, upload.Size)
+	}
+	// Postgres keeps microseconds; the scan is told apart by this time
+	startedAt := time.Now().Truncate(time.Microsecond)
+	claimed, err := s.repository.ClaimUpload(ctx, upload.ID, startedAt, startedAt.Add(-scanTimeout))
+	if err != nil {
+		return nil, err
+	}
+	if !claimed {
+		// finalized concurrently
+		return s.GetUpload(ctx, userID, uploadID)
+	}
+	upload.Status, upload.StatusDetail, upload.ScanStartedAt = UploadStatusScanning, nil, &startedAt
+
+	// the request finishes before the scan does
+	go s.process(context.WithoutCancel(ctx), userID, *upload)
+	return s.uploadResponse(ctx, upload)
+}
+
+// process scans the upload and makes it an image, recording the outcome
+// as its status. Chunks are kept only when it failed, for a retry.
+func (s *imageService) process(ctx context.Context, userID string, upload Upload) {
+	// a large upload takes hundreds of MB to check; the others wait
+	// their turn
+	s.processing <- struct{}{}
+	defer func() { <-s.processing }()
+
+	chunks, err := s.repository.ListChunks(ctx, upload.ID)
+	var image *ImageResponse
+	if err == nil {
+		image, err = s.assemble(ctx, userID, upload, chunks)
+	}
+
+	status, imageKey := UploadStatusReady, (*string)(nil)
+	switch {
+	case err == nil:
+		imageKey = &image.Key
+	case errors.Is(err, ErrInfectedUpload):
+		status = UploadStatusInfected
+	case errors.Is(err, ErrInvalidUpload):
+		status = UploadStatusRejected
+	default:
+		log.Error().Msg(fmt.Sprintf("Cannot process upload %s: %v", upload.ID, err))
+		status = UploadStatusFailed
+	}
+	var detail *string
+	if err != nil {
+		message := err.Error()
+		detail = &message
+	}
+	err = s.repository.FinishUpload(ctx, upload.ID, *upload.ScanStartedAt, status, detail, imageKey)
+	if err != nil {
+		log.Error().Msg(fmt.Sprintf("Cannot record outcome of upload %s: %v", upload.ID, err))
+		return
+	}
+	if status == UploadStatusFailed {
+		return
+	}
+	for _, chunk := range chunks {
+		if err = s.store.Delete(ctx, chunk.Key); err != nil {
+			log.Error().Msg(fmt.Sprintf("Cannot delete chunk %s of upload %s: %v", chunk.Key, upload.ID, err))
+		}
+	}
+}
+
+// assemble joins the chunks, scans the file and stores it as an image.
+// Images are re-encoded; PDFs are stored as received.
+func (s *imageService) assemble(ctx context.Context, userID string, upload Upload, chunks []Chunk) (*ImageResponse, error) {
+	// the chunks are joined in a temporary file, so large documents are
+	// not held in memory
+	f, err := os.CreateTemp("", "upload-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	hash := sha256.New()
+	for _, chunk := range chunks {
+		if err = s.copyChunk(ctx, io.MultiWriter(f, hash), chunk); err != nil {
+			return nil, err
+		}
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+	if err = s.scan(ctx, userID, f, upload.Size, sum); err != nil {
+		return nil, err
+	}
+
+	limit := s.policy.Documents[upload.DocumentType]
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+	contentType := http.DetectContentType(head[:n])
+	if !slices.Contains(limit.AllowedTypes, contentType) {
+		return nil, fmt.Errorf("%w: %s files are not accepted for %s", ErrInvalidUpload, contentType, upload.DocumentType)
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	var body io.ReadSeeker = f
+	image := &Image{Size: upload.Size, ContentType: contentType, SHA256: sum}
+	if contentType == ContentTypePDF {
+		if err = checkPDF(f, upload.Size); err != nil {
+			return nil, err
+		}
+	} else {
+		// the file is checked where it is, so one that is not an image
+		// or is too large to decode is never read into memory
+		policy := UploadPolicy{AllowedTypes: limit.AllowedTypes, MaxSize: limit.MaxSize, MaxPixels: limit.MaxPixels}
+		if err = policy.checkSize(upload.Size); err != nil {
+			return nil, err
+		}
+		if err = policy.checkPixels(bufio.NewReader(f)); err != nil {
+			return nil, err
+		}
+		if _, err = f.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(f)
+		if err != nil {
+			return nil, err
+		}
+		data, image, err = policy.sanitize(data)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+	return s.register(ctx, userID, image, body)
+}
+
+func (s *imageService) copyChunk(ctx context.Context, w io.Writer, chunk Chunk) error {
+	body, _, err := s.store.Open(ctx, chunk.Key)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	_, err = io.Copy(w, body)
+	return err
+}
+
+// checkPDF checks the file ends with the end-of-file marker, which a
+// truncated PDF lacks.
+func checkPDF(f io.ReadSeeker, size int64) error {
+	tail := make([]byte, min(size, 1024))
+	if _, err := f.Seek(-int64(len(tail)), io.SeekEnd); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(f, tail); err != nil {
+		return err
+	}
+	if !bytes.Contains(tail, []byte("%%EOF")) {
+		return fmt.Errorf("%w: file is not a complete PDF", ErrInvalidUpload)
+	}
+	_, err := f.Seek(0, io.SeekStart)
+	return err
+}
+
+func (s *imageService) uploadResponse(ctx context.Context, upload *Upload) (*UploadResponse, error) {
+	res := &UploadResponse{
+		ID:           upload.ID,
+		DocumentType: upload.DocumentType,
+		Size:         upload.Size,
+		Offset:       upload.Received,
+		Status:       upload.Status,
+		Detail:       upload.StatusDetail,
+		ExpiresAt:    upload.ExpiresAt,
+	}
+	if upload.ImageKey != nil {
+		// the image may since have been collected as an orphan
+		image, err := s.repository.GetImage(ctx, *upload.ImageKey)
+		if err != nil && !errors.Is(err, ErrImageNotFound) {
+			return nil, err
+		}
+		if image != nil {
+			if res.Image, err = s.response(*image); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return res, nil
+}
+
+// expireUploads deletes uploads past their expiry together with the
+// chunks never finalized, adding them to the report. An upload whose
+// chunks cannot all be deleted is kept, so the next run tries again.
+func (s *imageService) expireUploads(ctx context.Context, dryRun bool, report *GCReport) error {
+	now := time.Now()
+	after := ""
+	for {
+		uploads, err := s.repository.ListExpiredUploads(ctx, now, after, gcBatchSize)
+		if err != nil {
+			return err
+		}
+		for _, upload := range uploads {
+			size, err := s.expireUpload(ctx, upload, dryRun)
+			if err != nil {
+				log.Error().Msg(fmt.Sprintf("Cannot delete expired upload %s: %v", upload.ID, err))
+				report.Failed++
+				continue
+			}
+			report.ExpiredUploads++
+			report.ReclaimedBytes += size
+		}
+		if len(uploads) < gcBatchSize {
+			return nil
+		}
+		after = uploads[len(uploads)-1].ID
+	}
+}
+
+func (s *imageService) expireUpload(ctx context.Context, upload Upload, dryRun bool) (int64, error) {
+	chunks, err := s.repository.ListChunks(ctx, upload.ID)
+	if err != nil {
+		return 0, err
+	}
+	var size int64
+	for _, chunk := range chunks {
+		size += chunk.Size
+	}
+	if dryRun {
+		return size, nil
+	}
+	for _, chunk := range chunks {
+		if err = s.store.Delete(ctx, chunk.Key); err != nil {
+			return 0, err
+		}
+	}
+	return size, s.repository.DeleteUpload(ctx, upload.ID)
+}
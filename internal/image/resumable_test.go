@@ -0,0 +1,88 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	stdimage "image"
+	"image/png"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func (r *fakeRepository) GetByHash(ctx context.Context, uploadedBy string, sha256 string) (*Image, error) {
+	for _, image := range r.images {
+		if image.SHA256 == sha256 && image.UploadedBy != nil && *image.UploadedBy == uploadedBy {
+			return &image, nil
+		}
+	}
+	return nil, ErrImageNotFound
+}
+
+func (r *fakeRepository) Create(ctx context.Context, image *Image) error {
+	image.UploadedAt = time.Now()
+	r.images[image.Key] = *image
+	return nil
+}
+
+// hugePNG is a PNG whose header claims width by height pixels, followed
+// by padding bytes rather than the pixels.
+func hugePNG(t *testing.T, width, height uint32, padding int) []byte {
+	t.Helper()
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, stdimage.NewGray(stdimage.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	data := encoded.Bytes()
+	// the IHDR chunk follows the 8 byte signature and its own length
+	ihdr := data[12:29]
+	binary.BigEndian.PutUint32(ihdr[4:], width)
+	binary.BigEndian.PutUint32(ihdr[8:], height)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(ihdr))
+	return append(data, make([]byte, padding)...)
+}
+
+func assembleUpload(t *testing.T, content []byte) (*ImageResponse, error) {
+	t.Helper()
+	s, _, store := newGCService(t, nil, nil)
+	s.policy.Documents = map[DocumentType]DocumentLimit{
+		DocumentLabResult: {AllowedTypes: []string{ContentTypePNG}, MaxSize: 64 << 20, MaxPixels: 1_000_000},
+	}
+	if err := store.Put(context.Background(), "chunk-1", bytes.NewReader(content), ObjectInfo{}); err != nil {
+		t.Fatal(err)
+	}
+	upload := Upload{ID: "u1", DocumentType: DocumentLabResult, Size: int64(len(content))}
+	return s.assemble(context.Background(), "user", upload, []Chunk{{Key: "chunk-1", Size: int64(len(content))}})
+}
+
+func TestAssemble(t *testing.T) {
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, halves()); err != nil {
+		t.Fatal(err)
+	}
+	res, err := assembleUpload(t, encoded.Bytes())
+	if err != nil {
+		t.Fatalf("assemble() error = %v", err)
+	}
+	if res.ContentType != ContentTypePNG || res.Width == nil || *res.Width != 16 {
+		t.Errorf("assemble() = %+v", res)
+	}
+}
+
+func TestAssembleChecksBeforeReading(t *testing.T) {
+	const padding = 32 << 20
+	content := hugePNG(t, 50_000, 50_000, padding)
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, err := assembleUpload(t, content)
+	runtime.ReadMemStats(&after)
+	if !errors.Is(err, ErrInvalidUpload) {
+		t.Fatalf("assemble() error = %v, want ErrInvalidUpload", err)
+	}
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > padding/4 {
+		t.Errorf("assemble() allocated %d bytes checking a %d byte file", allocated, len(content))
+	}
+}
@@ -0,0 +1,198 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// uploadedByMetadata is the object metadata recording who uploaded it.
+const uploadedByMetadata = "Uploaded-By"
+
+// S3Config points the S3 driver at AWS or at any S3-compatible service
+// such as MinIO. Endpoint is left empty for AWS; most other services
+// also need PathStyle.
+type S3Config struct {
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	PathStyle       bool
+}
+
+type s3Store struct {
+	client *s3.S3
+	bucket string
+}
+
+func NewS3Store(cfg S3Config) (ObjectStore, error) {
+	awsConfig := &aws.Config{
+		Region:           aws.String(cfg.Region),
+		Credentials:      credentials.NewStaticCredentials(cfg.AccessKeyID, cfg.SecretAccessKey, ""),
+		S3ForcePathStyle: aws.Bool(cfg.PathStyle),
+	}
+	if cfg.Endpoint != "" {
+		awsConfig.Endpoint = aws.String(cfg.Endpoint)
+	}
+	sess, err := session.NewSession(awsConfig)
+	if err != nil {
+		return nil, err
+	}
+	return &s3Store{
+		client: s3.New(sess),
+		bucket: cfg.Bucket,
+	}, nil
+}
+
+func (s *s3Store) Put(ctx context.Context, key string, body io.ReadSeeker, info ObjectInfo) error {
+	_, err := s.client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        body,
+		ContentType: aws.String(info.ContentType),
+		Metadata:    map[string]*string{uploadedByMetadata: aws.String(info.UploadedBy)},
+	})
+	return err
+}
+
+func (s *s3Store) Head(ctx context.Context, key string) (*ObjectInfo, error) {
+	out, err := s.client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if isNotFound(err) {
+		return nil, ErrImageNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return objectInfo(key, out.ContentType, out.ContentLength, out.Metadata), nil
+}
+
+func (s *s3Store) Open(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error) {
+	out, err := s.client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if isNotFound(err) {
+		return nil, nil, ErrImageNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return out.Body, objectInfo(key, out.ContentType, out.ContentLength, out.Metadata), nil
+}
+
+func (s *s3Store) Delete(ctx context.Context, key string) error {
+	_, err := s.client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+func (s *s3Store) PresignURL(key string, ttl time.Duration) (string, error) {
+	req, _ := s.client.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	return req.Presign(ttl)
+}
+
+// allUsersGroup is the grantee of public-read ACLs.
+const allUsersGroup = "http://acs.amazonaws.com/groups/global/AllUsers"
+
+// MakePrivate sets the ACL of every object anyone may read to private.
+// Objects uploaded while images were public-read keep that ACL, and
+// their old URLs keep working, until this runs.
+func (s *s3Store) MakePrivate(ctx context.Context, dryRun bool) (int, error) {
+	var public int
+	var err error
+	input := &s3.ListObjectsV2Input{Bucket: aws.String(s.bucket)}
+	listErr := s.client.ListObjectsV2PagesWithContext(ctx, input, func(page *s3.ListObjectsV2Output, last bool) bool {
+		for _, object := range page.Contents {
+			var acl *s3.GetObjectAclOutput
+			acl, err = s.client.GetObjectAclWithContext(ctx, &s3.GetObjectAclInput{
+				Bucket: aws.String(s.bucket),
+				Key:    object.Key,
+			})
+			if err != nil {
+				return false
+			}
+			if !slices.ContainsFunc(acl.Grants, func(g *s3.Grant) bool {
+				return g.Grantee != nil && aws.StringValue(g.Grantee.URI) == allUsersGroup
+			}) {
+				continue
+			}
+			public++
+			if dryRun {
+				continue
+			}
+			_, err = s.client.PutObjectAclWithContext(ctx, &s3.PutObjectAclInput{
+				Bucket: aws.String(s.bucket),
+				Key:    object.Key,
+				ACL:    aws.String(s3.ObjectCannedACLPrivate),
+			})
+			if err != nil {
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return public, err
+	}
+	return public, listErr
+}
+
+func isNotFound(err error) bool {
+	var reqErr awserr.RequestFailure
+	return errors.As(err, &reqErr) && reqErr.StatusCode() == http.StatusNotFound
+}
+
+func objectInfo(key string, contentType *string, size *int64, metadata map[string]*string) *ObjectInfo {
+	info := &ObjectInfo{
+		Key:         key,
+		ContentType: aws.StringValue(contentType),
+		Size:        aws.Int64Value(size),
+	}
+	// S3 does not keep the case of metadata keys
+	for k, v := range metadata {
+		if strings.EqualFold(k, uploadedByMetadata) {
+			info.UploadedBy = aws.StringValue(v)
+		}
+	}
+	return info
+}
+
+func (s *s3Store) List(ctx context.Context, fn func(page []StoredObject) error) error {
+	var err error
+	input := &s3.ListObjectsV2Input{Bucket: aws.String(s.bucket)}
+	listErr := s.client.ListObjectsV2PagesWithContext(ctx, input, func(page *s3.ListObjectsV2Output, last bool) bool {
+		objects := make([]StoredObject, len(page.Contents))
+		for i, object := range page.Contents {
+			objects[i] = StoredObject{
+				Key:        aws.StringValue(object.Key),
+				Size:       aws.Int64Value(object.Size),
+				ModifiedAt: aws.TimeValue(object.LastModified),
+			}
+		}
+		err = fn(objects)
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+	return listErr
+}
@@ -0,0 +1,111 @@
+package image
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+const clamdChunkSize = 64 * 1024
+
+// ScanResult is the verdict of a malware scan. Signature names what was
+// found in an infected file.
+type ScanResult struct {
+	Infected  bool
+	Signature string
+}
+
+// Scanner checks files for malware before they are stored. Scan returns
+// an error wrapping ErrScanFailed when no verdict could be reached.
+type Scanner interface {
+	Scan(ctx context.Context, file io.Reader) (ScanResult, error)
+}
+
+type clamdScanner struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+// NewClamdScanner creates a scanner talking to a ClamAV daemon at address,
+// either host:port, tcp://host:port or unix:///path/to/clamd.sock. A scan
+// taking longer than timeout fails.
+func NewClamdScanner(address string, timeout time.Duration) Scanner {
+	network := "tcp"
+	if path, ok := strings.CutPrefix(address, "unix://"); ok {
+		network, address = "unix", path
+	} else {
+		address = strings.TrimPrefix(address, "tcp://")
+	}
+	return &clamdScanner{network: network, address: address, timeout: timeout}
+}
+
+// Scan streams the file to clamd with the INSTREAM command: length
+// prefixed chunks ended by an empty one. clamd answers "stream: OK",
+// "stream: <signature> FOUND" or a message ending in "ERROR".
+func (c *clamdScanner) Scan(ctx context.Context, file io.Reader) (ScanResult, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return ScanResult{}, fmt.Errorf("%w: %v", ErrScanFailed, err)
+	}
+	defer conn.Close()
+	deadline := time.Now().Add(c.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err = conn.SetDeadline(deadline); err != nil {
+		return ScanResult{}, fmt.Errorf("%w: %v", ErrScanFailed, err)
+	}
+
+	// the z prefix makes clamd end its reply with a null byte
+	if _, err = conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return ScanResult{}, fmt.Errorf("%w: %v", ErrScanFailed, err)
+	}
+	buf := make([]byte, 4+clamdChunkSize)
+	for {
+		n, readErr := io.ReadFull(file, buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf[:4], uint32(n))
+			if _, err = conn.Write(buf[:4+n]); err != nil {
+				// clamd closes the stream once it exceeds StreamMaxLength,
+				// and says so in its reply
+				break
+			}
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			_, err = conn.Write([]byte{0, 0, 0, 0})
+			break
+		}
+		if readErr != nil {
+			return ScanResult{}, readErr
+		}
+	}
+
+	reply, readErr := bufio.NewReader(conn).ReadBytes(0)
+	if readErr != nil && len(reply) == 0 {
+		if err != nil {
+			return ScanResult{}, fmt.Errorf("%w: %v", ErrScanFailed, err)
+		}
+		return ScanResult{}, fmt.Errorf("%w: %v", ErrScanFailed, readErr)
+	}
+	return parseClamdReply(string(bytes.TrimRight(reply, "\x00\n")))
+}
+
+func parseClamdReply(reply string) (ScanResult, error) {
+	verdict, _ := strings.CutPrefix(reply, "stream: ")
+	switch {
+	case verdict == "OK":
+		return ScanResult{}, nil
+	case strings.HasSuffix(verdict, " FOUND"):
+		return ScanResult{Infected: true, Signature: strings.TrimSuffix(verdict, " FOUND")}, nil
+	default:
+		return ScanResult{}, fmt.Errorf("%w: clamd replied %q", ErrScanFailed, reply)
+	}
+}
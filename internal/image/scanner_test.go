@@ -0,0 +1,192 @@
+package image
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClamd serves the INSTREAM command like clamd does: it reads chunks
+// until the empty one, or until more than maxLength bytes arrived, when
+// it replies with the size limit error and closes the connection without
+// reading the rest. reply returns the verdict for the bytes received.
+type fakeClamd struct {
+	listener  net.Listener
+	maxLength int
+	reply     func(data []byte) string
+	received  chan []byte
+}
+
+func newFakeClamd(t *testing.T, maxLength int, reply func(data []byte) string) *fakeClamd {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot listen: %v", err)
+	}
+	f := &fakeClamd{listener: l, maxLength: maxLength, reply: reply, received: make(chan []byte, 1)}
+	t.Cleanup(func() { l.Close() })
+	go f.serve()
+	return f
+}
+
+func (f *fakeClamd) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		go f.handle(conn)
+	}
+}
+
+func (f *fakeClamd) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	command, err := r.ReadString(0)
+	if err != nil || command != "zINSTREAM\x00" {
+		return
+	}
+	var data []byte
+	for {
+		var size uint32
+		if err = binary.Read(r, binary.BigEndian, &size); err != nil {
+			return
+		}
+		if size == 0 {
+			break
+		}
+		chunk := make([]byte, size)
+		if _, err = io.ReadFull(r, chunk); err != nil {
+			return
+		}
+		data = append(data, chunk...)
+		if len(data) > f.maxLength {
+			conn.Write([]byte("INSTREAM size limit exceeded. ERROR\x00"))
+			f.received <- data
+			return
+		}
+	}
+	f.received <- data
+	if f.reply == nil {
+		// never answer, as a stuck daemon
+		io.Copy(io.Discard, r)
+		return
+	}
+	conn.Write([]byte("stream: " + f.reply(data) + "\x00"))
+}
+
+func (f *fakeClamd) address() string {
+	return f.listener.Addr().String()
+}
+
+func TestClamdScanner(t *testing.T) {
+	eicar := []byte(`X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`)
+	verdict := func(data []byte) string {
+		if bytes.Contains(data, eicar) {
+			return "Eicar-Signature FOUND"
+		}
+		return "OK"
+	}
+	tests := []struct {
+		name      string
+		reply     func(data []byte) string
+		file      []byte
+		want      ScanResult
+		wantError string
+	}{
+		{
+			name:  "clean",
+			reply: verdict,
+			file:  bytes.Repeat([]byte("clean "), 30000),
+			want:  ScanResult{},
+		},
+		{
+			name:  "infected",
+			reply: verdict,
+			file:  append(bytes.Repeat([]byte("x"), 100), eicar...),
+			want:  ScanResult{Infected: true, Signature: "Eicar-Signature"},
+		},
+		{
+			name:      "error",
+			reply:     func([]byte) string { return "Can't allocate memory ERROR" },
+			file:      []byte("anything"),
+			wantError: "Can't allocate memory ERROR",
+		},
+		{
+			name:  "empty",
+			reply: verdict,
+			file:  nil,
+			want:  ScanResult{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clamd := newFakeClamd(t, 1<<30, tt.reply)
+			scanner := NewClamdScanner("tcp://"+clamd.address(), 5*time.Second)
+
+			got, err := scanner.Scan(context.Background(), bytes.NewReader(tt.file))
+			if tt.wantError != "" {
+				if !errors.Is(err, ErrScanFailed) || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("Scan() error = %v, want ErrScanFailed with %q", err, tt.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Scan() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Scan() = %+v, want %+v", got, tt.want)
+			}
+			if received := <-clamd.received; !bytes.Equal(received, tt.file) {
+				t.Errorf("clamd received %d bytes, want %d", len(received), len(tt.file))
+			}
+		})
+	}
+}
+
+func TestClamdScannerStreamMaxLength(t *testing.T) {
+	// far more than fits the socket buffers, so writes fail once clamd
+	// stops reading and the verdict has to be read after that
+	clamd := newFakeClamd(t, 1<<20, func([]byte) string { return "OK" })
+	scanner := NewClamdScanner(clamd.address(), 5*time.Second)
+
+	_, err := scanner.Scan(context.Background(), bytes.NewReader(make([]byte, 64<<20)))
+	if !errors.Is(err, ErrScanFailed) || !strings.Contains(err.Error(), "size limit exceeded") {
+		t.Fatalf("Scan() error = %v, want ErrScanFailed with the size limit reply", err)
+	}
+}
+
+func TestClamdScannerTimeout(t *testing.T) {
+	clamd := newFakeClamd(t, 1<<30, nil)
+	scanner := NewClamdScanner(clamd.address(), 200*time.Millisecond)
+
+	start := time.Now()
+	_, err := scanner.Scan(context.Background(), strings.NewReader("anything"))
+	if !errors.Is(err, ErrScanFailed) {
+		t.Fatalf("Scan() error = %v, want ErrScanFailed", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Scan() took %v, want it to give up after the timeout", elapsed)
+	}
+}
+
+func TestClamdScannerUnreachable(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot listen: %v", err)
+	}
+	address := l.Addr().String()
+	l.Close()
+
+	_, err = NewClamdScanner(address, time.Second).Scan(context.Background(), strings.NewReader("anything"))
+	if !errors.Is(err, ErrScanFailed) {
+		t.Fatalf("Scan() error = %v, want ErrScanFailed", err)
+	}
+}
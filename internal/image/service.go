@@ -1,58 +1,303 @@
 package image
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"io"
-	"os"
+	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/citadel-corp/halosuster/internal/common/query"
+	"github.com/citadel-corp/halosuster/internal/common/response"
 	"github.com/google/uuid"
-)
-
-var (
-	bucket = os.Getenv("AWS_S3_BUCKET_NAME")
-	key    = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	"github.com/rs/zerolog/log"
+	"golang.org/x/sync/singleflight"
 )
 
 type Service interface {
-	UploadToS3(ctx context.Context, readSeeker io.ReadSeeker) (*ImageResponse, error)
+	Policy() UploadPolicy
+	Upload(ctx context.Context, userID string, file io.Reader) (*ImageResponse, error)
+	ListImages(ctx context.Context, userID string, req ListImagesPayload) ([]ImageResponse, *response.Pagination, error)
+	Open(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error)
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+	VariantKey(ctx context.Context, key string, size string) (string, error)
+	Authorize(ctx context.Context, userID string, viewAll bool, key string) error
+	PresignURL(key string) (string, error)
+	CollectGarbage(ctx context.Context, grace time.Duration, dryRun bool) (*GCReport, error)
+	SweepUnregistered(ctx context.Context, grace time.Duration, dryRun bool) (*GCReport, error)
+
+	CreateUpload(ctx context.Context, userID string, req PostUpload) (*UploadResponse, error)
+	GetUpload(ctx context.Context, userID string, uploadID string) (*UploadResponse, error)
+	PatchUpload(ctx context.Context, userID string, uploadID string, offset int64, body io.Reader) (*UploadResponse, error)
+	FinalizeUpload(ctx context.Context, userID string, uploadID string) (*UploadResponse, error)
 }
 
 type imageService struct {
-	awsSession *session.Session
+	store      ObjectStore
+	repository Repository
+	urlTTL     time.Duration
+	policy     UploadPolicy
+	variants   VariantConfig
+	scanner    Scanner
+	// processing holds a token for each upload being processed and
+	// each variant being made.
+	processing chan struct{}
+	// making shares a variant being made among those requesting it.
+	making singleflight.Group
 }
 
-func NewService(awsSession *session.Session) Service {
+// NewService creates the image service. Images are private; the URLs
+// handed out for them expire after urlTTL. Uploads are accepted
+// according to policy, checked by scanner unless it is nil, and resized
+// into variants. At most workers resumable uploads are processed or
+// variants made at once.
+func NewService(store ObjectStore, repository Repository, urlTTL time.Duration, policy UploadPolicy, variants VariantConfig, scanner Scanner, workers int) Service {
 	return &imageService{
-		awsSession: awsSession,
+		store:      store,
+		repository: repository,
+		urlTTL:     urlTTL,
+		policy:     policy,
+		variants:   variants,
+		scanner:    scanner,
+		processing: make(chan struct{}, max(workers, 1)),
+	}
+}
+
+func (s *imageService) Policy() UploadPolicy {
+	return s.policy
+}
+
+// Upload stores the image unless the user has uploaded the same content
+// before, in which case the earlier image is returned. Files with malware
+// in them are quarantined and ErrInfectedUpload is returned.
+func (s *imageService) Upload(ctx context.Context, userID string, file io.Reader) (*ImageResponse, error) {
+	// one byte more than allowed tells a file too large from one at the limit
+	data, err := io.ReadAll(io.LimitReader(file, s.policy.MaxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) <= s.policy.MaxSize {
+		sum := sha256.Sum256(data)
+		err = s.scan(ctx, userID, bytes.NewReader(data), int64(len(data)), hex.EncodeToString(sum[:]))
+		if err != nil {
+			return nil, err
+		}
+	}
+	data, image, err := s.policy.sanitize(data)
+	if err != nil {
+		return nil, err
 	}
+	return s.register(ctx, userID, image, bytes.NewReader(data))
 }
 
-func (s *imageService) UploadToS3(ctx context.Context, readSeeker io.ReadSeeker) (*ImageResponse, error) {
-	svc := s3.New(s.awsSession)
-	filename := uuid.NewString()
-	// This uploads the contents of the buffer to S3
-	_, err := svc.PutObject(&s3.PutObjectInput{
-		Bucket:      aws.String(bucket),
-		Key:         aws.String(filename),
-		ACL:         aws.String("public-read"),
-		Body:        readSeeker,
-		ContentType: aws.String("image/jpeg"),
+// register stores body as the image, described by everything but its key
+// and uploader, unless the user has uploaded the same content before.
+func (s *imageService) register(ctx context.Context, userID string, image *Image, body io.ReadSeeker) (*ImageResponse, error) {
+	existing, err := s.repository.GetByHash(ctx, userID, image.SHA256)
+	if err == nil {
+		return s.response(*existing)
+	}
+	if !errors.Is(err, ErrImageNotFound) {
+		return nil, err
+	}
+
+	image.Key = uuid.NewString()
+	image.UploadedBy = &userID
+	err = s.store.Put(ctx, image.Key, body, ObjectInfo{
+		UploadedBy:  userID,
+		ContentType: image.ContentType,
 	})
 	if err != nil {
 		return nil, err
 	}
-	params := &s3.GetObjectInput{
-		Bucket: aws.String(bucket),
-		Key:    aws.String(filename),
+	err = s.repository.Create(ctx, image)
+	if errors.Is(err, ErrImageAlreadyExists) {
+		// the same content was uploaded concurrently
+		if err = s.store.Delete(ctx, image.Key); err != nil {
+			return nil, err
+		}
+		existing, err = s.repository.GetByHash(ctx, userID, image.SHA256)
+		if err != nil {
+			return nil, err
+		}
+		return s.response(*existing)
 	}
+	if err != nil {
+		return nil, err
+	}
+	if s.variants.Eager && image.ContentType != ContentTypePDF {
+		// a variant that fails now is made when first requested
+		for _, v := range s.variants.Variants {
+			if err = s.makeVariant(ctx, image.Key, v); err != nil {
+				log.Error().Msg(fmt.Sprintf("Cannot make %s variant of image %s: %v", v.Name, image.Key, err))
+			}
+		}
+	}
+	return s.response(*image)
+}
+
+// scan returns ErrInfectedUpload, after moving the file to quarantine,
+// when the scanner finds malware in it. The file is left at its start.
+func (s *imageService) scan(ctx context.Context, userID string, file io.ReadSeeker, size int64, hash string) error {
+	if s.scanner == nil {
+		return nil
+	}
+	result, err := s.scanner.Scan(ctx, file)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if !result.Infected {
+		return nil
+	}
+
+	quarantined := &QuarantinedFile{
+		Key:        quarantinePrefix + uuid.NewString(),
+		UploadedBy: &userID,
+		Size:       size,
+		SHA256:     hash,
+		Signature:  result.Signature,
+	}
+	err = s.store.Put(ctx, quarantined.Key, file, ObjectInfo{
+		UploadedBy:  userID,
+		ContentType: "application/octet-stream",
+	})
+	if err != nil {
+		return err
+	}
+	if err = s.repository.Quarantine(ctx, quarantined); err != nil {
+		return err
+	}
+	log.Warn().Msg(fmt.Sprintf("Quarantined upload of user %s as %s: %s found", userID, quarantined.Key, result.Signature))
+	return fmt.Errorf("%w: %s", ErrInfectedUpload, result.Signature)
+}
 
-	req, _ := svc.GetObjectRequest(params)
-	req.Build()
+func (s *imageService) ListImages(ctx context.Context, userID string, req ListImagesPayload) ([]ImageResponse, *response.Pagination, error) {
+	req.Limit, req.Offset = query.NormalizePage(req.Limit, req.Offset)
+	images, meta, err := s.repository.List(ctx, userID, req)
+	if err != nil {
+		return nil, nil, err
+	}
+	res := make([]ImageResponse, len(images))
+	for i, image := range images {
+		r, err := s.response(image)
+		if err != nil {
+			return nil, nil, err
+		}
+		res[i] = *r
+	}
+	return res, meta, nil
+}
 
+func (s *imageService) response(image Image) (*ImageResponse, error) {
+	url, err := s.PresignURL(image.Key)
+	if err != nil {
+		return nil, err
+	}
 	return &ImageResponse{
-		ImageURL: req.HTTPRequest.URL.String(),
+		ImageURL:    url,
+		Key:         image.Key,
+		ContentType: image.ContentType,
+		Size:        image.Size,
+		SHA256:      image.SHA256,
+		Width:       image.Width,
+		Height:      image.Height,
+		UploadedAt:  image.UploadedAt,
 	}, nil
 }
+
+func (s *imageService) Open(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error) {
+	return s.store.Open(ctx, key)
+}
+
+func (s *imageService) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	if internalKey(key) {
+		return nil, ErrImageNotFound
+	}
+	return s.store.Head(ctx, key)
+}
+
+// VariantKey returns the key of the size variant of the image, making the
+// variant if it does not exist yet. An empty size or "original" is the
+// image itself.
+func (s *imageService) VariantKey(ctx context.Context, key string, size string) (string, error) {
+	if size == "" || size == "original" {
+		return key, nil
+	}
+	v, ok := s.variants.find(size)
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownVariant, size)
+	}
+	key = s.variants.original(key)
+	info, err := s.store.Head(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	if info.ContentType != ContentTypeJPEG && info.ContentType != ContentTypePNG {
+		return "", fmt.Errorf("%w: %s files have no sizes", ErrUnknownVariant, info.ContentType)
+	}
+	_, err = s.store.Head(ctx, variantKey(key, v.Name))
+	if errors.Is(err, ErrImageNotFound) {
+		err = s.makeVariantOnce(ctx, key, v)
+	}
+	if err != nil {
+		return "", err
+	}
+	return variantKey(key, v.Name), nil
+}
+
+// makeVariantOnce makes the variant unless it is being made already, in
+// which case it waits for that. Making it goes on when ctx is cancelled,
+// for the others waiting.
+func (s *imageService) makeVariantOnce(ctx context.Context, key string, v Variant) error {
+	done := s.making.DoChan(variantKey(key, v.Name), func() (any, error) {
+		ctx := context.WithoutCancel(ctx)
+		s.processing <- struct{}{}
+		defer func() { <-s.processing }()
+		// made by a request that finished just before this one started
+		if _, err := s.store.Head(ctx, variantKey(key, v.Name)); err == nil {
+			return nil, nil
+		}
+		return nil, s.makeVariant(ctx, key, v)
+	})
+	select {
+	case res := <-done:
+		return res.Err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Authorize returns ErrImageForbidden unless the user may view the
+// image. Users allowed to viewAll may view every image; others those
+// they uploaded and those of patients and medical records. Variants
+// may be viewed by whoever may view their original.
+func (s *imageService) Authorize(ctx context.Context, userID string, viewAll bool, key string) error {
+	key = s.variants.original(key)
+	info, err := s.Stat(ctx, key)
+	if err != nil {
+		return err
+	}
+	if viewAll || info.UploadedBy == userID {
+		return nil
+	}
+	referenced, err := s.repository.IsReferenced(ctx, key)
+	if err != nil {
+		return err
+	}
+	if !referenced {
+		return ErrImageForbidden
+	}
+	return nil
+}
+
+// PresignURL returns a URL granting read access to the object for the
+// configured TTL.
+func (s *imageService) PresignURL(key string) (string, error) {
+	return s.store.PresignURL(key, s.urlTTL)
+}
@@ -0,0 +1,28 @@
+package image
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// ObjectStore is where uploaded images are kept.
+type ObjectStore interface {
+	// Put stores body under key, recording the uploader and content type
+	// of info.
+	Put(ctx context.Context, key string, body io.ReadSeeker, info ObjectInfo) error
+	// Head returns ErrImageNotFound when nothing is stored under key.
+	Head(ctx context.Context, key string) (*ObjectInfo, error)
+	Open(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error)
+	// Delete succeeds when nothing is stored under key.
+	Delete(ctx context.Context, key string) error
+	// PresignURL is where the object can be read for ttl.
+	PresignURL(key string, ttl time.Duration) (string, error)
+	// MakePrivate revokes public read access to every object, which
+	// objects stored before images were private have, and returns how
+	// many had it. With dryRun they are only counted.
+	MakePrivate(ctx context.Context, dryRun bool) (int, error)
+	// List calls fn with each page of the objects stored, stopping at
+	// the first error fn returns.
+	List(ctx context.Context, fn func(page []StoredObject) error) error
+}
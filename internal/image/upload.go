@@ -0,0 +1,189 @@
+package image
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	stdimage "image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"slices"
+)
+
+const (
+	ContentTypeJPEG = "image/jpeg"
+	ContentTypePNG  = "image/png"
+	ContentTypePDF  = "application/pdf"
+)
+
+// maxPixels is the largest image accepted unless a lower limit is set.
+// Decoding takes up to 4 bytes a pixel.
+const maxPixels = 50_000_000
+
+type DocumentType string
+
+const (
+	DocumentIdentityCard DocumentType = "identity_card"
+	DocumentPhoto        DocumentType = "photo"
+	DocumentLabResult    DocumentType = "lab_result"
+	DocumentConsentForm  DocumentType = "consent_form"
+	DocumentECG          DocumentType = "ecg"
+	DocumentUltrasound   DocumentType = "ultrasound"
+)
+
+// DocumentLimit is what resumable uploads of a document type accept.
+// MaxPixels limits the images, or is 0 for the default.
+type DocumentLimit struct {
+	AllowedTypes []string
+	MaxSize      int64
+	MaxPixels    int
+}
+
+// UploadPolicy is what uploads are accepted. Single-request uploads are
+// limited by AllowedTypes and the sizes; resumable uploads by the limit
+// of their document type.
+type UploadPolicy struct {
+	AllowedTypes []string
+	MinSize      int64
+	MaxSize      int64
+	MaxPixels    int
+	Documents    map[DocumentType]DocumentLimit
+}
+
+var DefaultUploadPolicy = UploadPolicy{
+	AllowedTypes: []string{ContentTypeJPEG, ContentTypePNG},
+	MinSize:      10 * 1024,
+	MaxSize:      2 * 1024 * 1024,
+	Documents: map[DocumentType]DocumentLimit{
+		DocumentIdentityCard: {AllowedTypes: []string{ContentTypeJPEG, ContentTypePNG}, MaxSize: 2 * 1024 * 1024, MaxPixels: 12_000_000},
+		DocumentPhoto:        {AllowedTypes: []string{ContentTypeJPEG, ContentTypePNG}, MaxSize: 10 * 1024 * 1024},
+		// scans of large documents need no more than a camera photo
+		DocumentLabResult:   {AllowedTypes: []string{ContentTypeJPEG, ContentTypePNG, ContentTypePDF}, MaxSize: 20 * 1024 * 1024, MaxPixels: 25_000_000},
+		DocumentConsentForm: {AllowedTypes: []string{ContentTypeJPEG, ContentTypePNG, ContentTypePDF}, MaxSize: 50 * 1024 * 1024, MaxPixels: 25_000_000},
+		DocumentECG:         {AllowedTypes: []string{ContentTypeJPEG, ContentTypePNG, ContentTypePDF}, MaxSize: 20 * 1024 * 1024, MaxPixels: 25_000_000},
+		DocumentUltrasound:  {AllowedTypes: []string{ContentTypeJPEG, ContentTypePNG}, MaxSize: 100 * 1024 * 1024, MaxPixels: 25_000_000},
+	},
+}
+
+// Validate checks only JPEG and PNG are allowed, as they are what can be
+// decoded, PDF too for documents, and that the size limits make sense.
+func (p UploadPolicy) Validate() error {
+	if len(p.AllowedTypes) == 0 {
+		return errors.New("no content type is allowed")
+	}
+	for _, t := range p.AllowedTypes {
+		if t != ContentTypeJPEG && t != ContentTypePNG {
+			return fmt.Errorf("content type %s is not supported", t)
+		}
+	}
+	if p.MinSize < 0 || p.MaxSize <= 0 || p.MinSize > p.MaxSize {
+		return fmt.Errorf("invalid size limits %d to %d bytes", p.MinSize, p.MaxSize)
+	}
+	if p.MaxPixels < 0 || p.MaxPixels > maxPixels {
+		return fmt.Errorf("invalid pixel limit %d", p.MaxPixels)
+	}
+	for documentType, limit := range p.Documents {
+		if len(limit.AllowedTypes) == 0 {
+			return fmt.Errorf("no content type is allowed for %s", documentType)
+		}
+		for _, t := range limit.AllowedTypes {
+			if t != ContentTypeJPEG && t != ContentTypePNG && t != ContentTypePDF {
+				return fmt.Errorf("content type %s is not supported for %s", t, documentType)
+			}
+		}
+		if limit.MaxSize <= 0 {
+			return fmt.Errorf("invalid size limit %d bytes for %s", limit.MaxSize, documentType)
+		}
+		if limit.MaxPixels < 0 || limit.MaxPixels > maxPixels {
+			return fmt.Errorf("invalid pixel limit %d for %s", limit.MaxPixels, documentType)
+		}
+	}
+	return nil
+}
+
+// sanitize checks data is a complete image of an allowed type, judged by
+// its content rather than by what the client claims, and encodes it
+// again. The encoders write no metadata, which drops EXIF data such as
+// the location a photo was taken at; the EXIF orientation is applied to
+// the pixels first so photos are not shown turned. The returned image
+// describes the encoded content.
+func (p UploadPolicy) sanitize(data []byte) ([]byte, *Image, error) {
+	if err := p.checkSize(int64(len(data))); err != nil {
+		return nil, nil, err
+	}
+	contentType := http.DetectContentType(data)
+	if !slices.Contains(p.AllowedTypes, contentType) {
+		return nil, nil, fmt.Errorf("%w: %s files are not accepted", ErrInvalidUpload, contentType)
+	}
+	if err := p.checkPixels(bytes.NewReader(data)); err != nil {
+		return nil, nil, err
+	}
+	img, format, err := stdimage.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: file is not a valid image: %v", ErrInvalidUpload, err)
+	}
+	img = orient(img, exifOrientation(data, format))
+	var out bytes.Buffer
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&out, img, &jpeg.Options{Quality: 90})
+	case "png":
+		err = png.Encode(&out, img)
+	default:
+		return nil, nil, fmt.Errorf("%w: %s files are not accepted", ErrInvalidUpload, format)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	sum := sha256.Sum256(out.Bytes())
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	return out.Bytes(), &Image{
+		Size:        int64(out.Len()),
+		ContentType: contentType,
+		SHA256:      hex.EncodeToString(sum[:]),
+		Width:       &width,
+		Height:      &height,
+	}, nil
+}
+
+func (p UploadPolicy) checkSize(size int64) error {
+	if size < p.MinSize {
+		return fmt.Errorf("%w: file must be larger than %s", ErrInvalidUpload, formatSize(p.MinSize))
+	}
+	if size > p.MaxSize {
+		return fmt.Errorf("%w: file must be smaller than %s", ErrInvalidUpload, formatSize(p.MaxSize))
+	}
+	return nil
+}
+
+// checkPixels reads only the header of the image in r, since a small
+// file can decode to a huge image.
+func (p UploadPolicy) checkPixels(r io.Reader) error {
+	cfg, _, err := stdimage.DecodeConfig(r)
+	if err != nil {
+		return fmt.Errorf("%w: file is not a valid image: %v", ErrInvalidUpload, err)
+	}
+	limit := p.MaxPixels
+	if limit == 0 {
+		limit = maxPixels
+	}
+	if cfg.Width*cfg.Height > limit {
+		return fmt.Errorf("%w: image must be at most %d pixels", ErrInvalidUpload, limit)
+	}
+	return nil
+}
+
+func formatSize(n int64) string {
+	switch {
+	case n >= 1024*1024 && n%(1024*1024) == 0:
+		return fmt.Sprintf("%d MB", n/(1024*1024))
+	case n >= 1024 && n%1024 == 0:
+		return fmt.Sprintf("%d KB", n/1024)
+	default:
+		return fmt.Sprintf("%d bytes", n)
+	}
+}
@@ -0,0 +1,34 @@
+package image
+
+import (
+	"bytes"
+	"errors"
+	stdimage "image"
+	"image/png"
+	"testing"
+)
+
+func TestSanitizePixelLimit(t *testing.T) {
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, stdimage.NewGray(stdimage.Rect(0, 0, 100, 100))); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		maxPixels int
+		wantError bool
+	}{
+		{name: "default", maxPixels: 0},
+		{name: "within", maxPixels: 10_000},
+		{name: "beyond", maxPixels: 9_999, wantError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := UploadPolicy{AllowedTypes: []string{ContentTypePNG}, MaxSize: 1 << 20, MaxPixels: tt.maxPixels}
+			_, _, err := policy.sanitize(encoded.Bytes())
+			if tt.wantError != errors.Is(err, ErrInvalidUpload) {
+				t.Errorf("sanitize() error = %v, want error %v", err, tt.wantError)
+			}
+		})
+	}
+}
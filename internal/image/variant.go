@@ -0,0 +1,178 @@
+package image
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	stdimage "image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"strings"
+)
+
+// Variant is a resized copy of every image, fitting in MaxWidth by
+// MaxHeight. Images already smaller are copied as they are.
+type Variant struct {
+	Name      string
+	MaxWidth  int
+	MaxHeight int
+}
+
+// VariantConfig is what variants are made. Eager variants are made on
+// upload; otherwise each is made the first time it is requested.
+type VariantConfig struct {
+	Variants []Variant
+	Eager    bool
+}
+
+var DefaultVariantConfig = VariantConfig{
+	Variants: []Variant{
+		{Name: "thumb", MaxWidth: 160, MaxHeight: 160},
+		{Name: "medium", MaxWidth: 800, MaxHeight: 800},
+	},
+}
+
+func (c VariantConfig) Validate() error {
+	seen := make(map[string]bool, len(c.Variants))
+	for _, v := range c.Variants {
+		if !ValidKey(v.Name) || v.Name == "original" {
+			return fmt.Errorf("invalid variant name %q", v.Name)
+		}
+		if seen[v.Name] {
+			return fmt.Errorf("variant %s is defined twice", v.Name)
+		}
+		seen[v.Name] = true
+		if v.MaxWidth <= 0 || v.MaxHeight <= 0 {
+			return fmt.Errorf("variant %s must have a positive size", v.Name)
+		}
+	}
+	return nil
+}
+
+func (c VariantConfig) find(name string) (Variant, bool) {
+	for _, v := range c.Variants {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return Variant{}, false
+}
+
+// variantKey is where the variant of the image under key is stored,
+// alongside the original.
+func variantKey(key, name string) string {
+	return key + "_" + name
+}
+
+// original returns the key of the image a variant key was made from,
+// or key itself for an original.
+func (c VariantConfig) original(key string) string {
+	for _, v := range c.Variants {
+		if original, ok := strings.CutSuffix(key, "_"+v.Name); ok {
+			return original
+		}
+	}
+	return key
+}
+
+// makeVariant stores the variant of the image under key, in the format
+// of the original.
+func (s *imageService) makeVariant(ctx context.Context, key string, v Variant) error {
+	body, info, err := s.store.Open(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	img, format, err := stdimage.Decode(bufio.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	resized := fit(img, v.MaxWidth, v.MaxHeight)
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&out, resized, &jpeg.Options{Quality: 85})
+	case "png":
+		err = png.Encode(&out, resized)
+	default:
+		err = fmt.Errorf("cannot make variants of %s images", format)
+	}
+	if err != nil {
+		return err
+	}
+	return s.store.Put(ctx, variantKey(key, v.Name), bytes.NewReader(out.Bytes()), ObjectInfo{
+		UploadedBy:  info.UploadedBy,
+		ContentType: info.ContentType,
+	})
+}
+
+// fit scales img down, keeping its aspect ratio, until it fits in
+// maxWidth by maxHeight. Every pixel of the result averages the source
+// pixels it covers.
+func fit(img stdimage.Image, maxWidth, maxHeight int) stdimage.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= maxWidth && h <= maxHeight {
+		return img
+	}
+	if w*maxHeight > h*maxWidth {
+		w, h = maxWidth, max(1, h*maxWidth/w)
+	} else {
+		w, h = max(1, w*maxHeight/h), maxHeight
+	}
+
+	at := pixelReader(img)
+	dst := stdimage.NewRGBA(stdimage.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0, y1 := b.Min.Y+y*b.Dy()/h, b.Min.Y+(y+1)*b.Dy()/h
+		for x := 0; x < w; x++ {
+			x0, x1 := b.Min.X+x*b.Dx()/w, b.Min.X+(x+1)*b.Dx()/w
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < max(y1, y0+1); sy++ {
+				for sx := x0; sx < max(x1, x0+1); sx++ {
+					cr, cg, cb, ca := at(sx, sy)
+					r, g, bl, a, n = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca), n+1
+				}
+			}
+			dst.SetRGBA64(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(bl / n), A: uint16(a / n)})
+		}
+	}
+	return dst
+}
+
+// pixelReader returns how to read pixels of img as alpha-premultiplied
+// 16-bit RGBA. The types images decode to are read directly; going
+// through At allocates a color for every pixel.
+func pixelReader(img stdimage.Image) func(x, y int) (r, g, b, a uint32) {
+	switch img := img.(type) {
+	case *stdimage.YCbCr:
+		return func(x, y int) (uint32, uint32, uint32, uint32) {
+			yi, ci := img.YOffset(x, y), img.COffset(x, y)
+			r, g, b := color.YCbCrToRGB(img.Y[yi], img.Cb[ci], img.Cr[ci])
+			return uint32(r) * 0x101, uint32(g) * 0x101, uint32(b) * 0x101, 0xffff
+		}
+	case *stdimage.NRGBA:
+		return func(x, y int) (uint32, uint32, uint32, uint32) {
+			p := img.Pix[img.PixOffset(x, y):]
+			a := uint32(p[3])
+			return uint32(p[0]) * 0x101 * a / 0xff, uint32(p[1]) * 0x101 * a / 0xff, uint32(p[2]) * 0x101 * a / 0xff, a * 0x101
+		}
+	case *stdimage.RGBA:
+		return func(x, y int) (uint32, uint32, uint32, uint32) {
+			p := img.Pix[img.PixOffset(x, y):]
+			return uint32(p[0]) * 0x101, uint32(p[1]) * 0x101, uint32(p[2]) * 0x101, uint32(p[3]) * 0x101
+		}
+	case *stdimage.Gray:
+		return func(x, y int) (uint32, uint32, uint32, uint32) {
+			v := uint32(img.Pix[img.PixOffset(x, y)]) * 0x101
+			return v, v, v, 0xffff
+		}
+	default:
+		return func(x, y int) (uint32, uint32, uint32, uint32) {
+			return img.At(x, y).RGBA()
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	stdimage "image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// opaque hides the type of an image, so it is read through At.
+type opaque struct {
+	stdimage.Image
+}
+
+func TestFit(t *testing.T) {
+	tests := []struct {
+		width, height         int
+		wantWidth, wantHeight int
+	}{
+		{width: 1600, height: 800, wantWidth: 160, wantHeight: 80},
+		{width: 800, height: 1600, wantWidth: 80, wantHeight: 160},
+		{width: 3000, height: 10, wantWidth: 160, wantHeight: 1},
+		{width: 100, height: 50, wantWidth: 100, wantHeight: 50},
+	}
+	for _, tt := range tests {
+		img := stdimage.NewGray(stdimage.Rect(0, 0, tt.width, tt.height))
+		b := fit(img, 160, 160).Bounds()
+		if b.Dx() != tt.wantWidth || b.Dy() != tt.wantHeight {
+			t.Errorf("fit(%dx%d) = %dx%d, want %dx%d", tt.width, tt.height, b.Dx(), b.Dy(), tt.wantWidth, tt.wantHeight)
+		}
+	}
+
+	resized := fit(halves(), 8, 8)
+	if b := resized.Bounds(); b.Dx() != 8 || b.Dy() != 4 {
+		t.Fatalf("fit() = %v, want 8x4", b)
+	}
+	if !near(resized.At(1, 2), color.RGBA{R: 255, A: 255}) || !near(resized.At(6, 2), color.RGBA{B: 255, A: 255}) {
+		t.Error("fit() did not keep the halves")
+	}
+}
+
+// TestFitReadsPixelsDirectly checks that reading the decoded types
+// directly gives what At does.
+func TestFitReadsPixelsDirectly(t *testing.T) {
+	rect := stdimage.Rect(0, 0, 64, 48)
+	ycbcr := stdimage.NewYCbCr(rect, stdimage.YCbCrSubsampleRatio420)
+	nrgba := stdimage.NewNRGBA(rect)
+	rgba := stdimage.NewRGBA(rect)
+	gray := stdimage.NewGray(rect)
+	for y := 0; y < rect.Dy(); y++ {
+		for x := 0; x < rect.Dx(); x++ {
+			c := color.NRGBA{R: uint8(x * 4), G: uint8(y * 5), B: uint8(x + y), A: uint8(255 - x)}
+			nrgba.Set(x, y, c)
+			rgba.Set(x, y, c)
+			gray.Set(x, y, c)
+			yy, cb, cr := color.RGBToYCbCr(c.R, c.G, c.B)
+			ycbcr.Y[ycbcr.YOffset(x, y)] = yy
+			ycbcr.Cb[ycbcr.COffset(x, y)], ycbcr.Cr[ycbcr.COffset(x, y)] = cb, cr
+		}
+	}
+	for name, img := range map[string]stdimage.Image{"ycbcr": ycbcr, "nrgba": nrgba, "rgba": rgba, "gray": gray} {
+		got, want := fit(img, 16, 16).(*stdimage.RGBA), fit(opaque{img}, 16, 16).(*stdimage.RGBA)
+		for i := range got.Pix {
+			// YCbCr is converted in 8 bits rather than 16
+			if d := int(got.Pix[i]) - int(want.Pix[i]); d < -1 || d > 1 {
+				t.Errorf("fit(%s) differs from reading through At at byte %d: %d, want %d", name, i, got.Pix[i], want.Pix[i])
+				break
+			}
+		}
+	}
+}
+
+// countingStore counts the objects opened and holds each open until
+// release is closed.
+type countingStore struct {
+	ObjectStore
+	opens   atomic.Int32
+	release chan struct{}
+}
+
+func (s *countingStore) Open(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error) {
+	s.opens.Add(1)
+	<-s.release
+	return s.ObjectStore.Open(ctx, key)
+}
+
+func newVariantService(t *testing.T, contentType string, encode func(w io.Writer, img stdimage.Image) error) (*imageService, *countingStore) {
+	t.Helper()
+	files, err := NewFileStore(t.TempDir(), "http://localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var encoded bytes.Buffer
+	if err = encode(&encoded, halves()); err != nil {
+		t.Fatal(err)
+	}
+	err = files.Put(context.Background(), "original", bytes.NewReader(encoded.Bytes()), ObjectInfo{UploadedBy: "user", ContentType: contentType})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &countingStore{ObjectStore: files, release: make(chan struct{})}
+	variants := VariantConfig{Variants: []Variant{{Name: "thumb", MaxWidth: 8, MaxHeight: 8}}}
+	return NewService(store, nil, time.Minute, UploadPolicy{}, variants, nil, 1).(*imageService), store
+}
+
+func TestMakeVariant(t *testing.T) {
+	formats := map[string]func(w io.Writer, img stdimage.Image) error{
+		ContentTypeJPEG: func(w io.Writer, img stdimage.Image) error { return jpeg.Encode(w, img, nil) },
+		ContentTypePNG:  png.Encode,
+	}
+	for contentType, encode := range formats {
+		s, store := newVariantService(t, contentType, encode)
+		close(store.release)
+		key, err := s.VariantKey(context.Background(), "original", "thumb")
+		if err != nil {
+			t.Fatalf("VariantKey(%s) error = %v", contentType, err)
+		}
+		if key != "original_thumb" {
+			t.Errorf("VariantKey(%s) = %s, want original_thumb", contentType, key)
+		}
+		body, info, err := store.ObjectStore.Open(context.Background(), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		config, _, err := stdimage.DecodeConfig(body)
+		body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.Width != 8 || config.Height != 4 || info.ContentType != contentType || info.UploadedBy != "user" {
+			t.Errorf("variant of %s is %dx%d %s by %s", contentType, config.Width, config.Height, info.ContentType, info.UploadedBy)
+		}
+	}
+}
+
+func TestVariantKeyMakesVariantOnce(t *testing.T) {
+	s, store := newVariantService(t, ContentTypePNG, png.Encode)
+	const requests = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, requests)
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.VariantKey(context.Background(), "original", "thumb")
+			errs <- err
+		}()
+	}
+	// let every request reach the variant being made before it is
+	for store.opens.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(store.release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("VariantKey() error = %v", err)
+		}
+	}
+	if n := store.opens.Load(); n != 1 {
+		t.Errorf("the original was decoded %d times, want once", n)
+	}
+}
+
+func TestVariantKeyStopsWaitingWhenCancelled(t *testing.T) {
+	s, store := newVariantService(t, ContentTypePNG, png.Encode)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := s.VariantKey(ctx, "original", "thumb"); err != context.Canceled {
+		t.Errorf("VariantKey() error = %v, want context.Canceled", err)
+	}
+
+	// the variant is still made, for the requests still waiting
+	close(store.release)
+	if _, err := s.VariantKey(context.Background(), "original", "thumb"); err != nil {
+		t.Fatalf("VariantKey() error = %v", err)
+	}
+	if n := store.opens.Load(); n != 1 {
+		t.Errorf("the original was decoded %d times, want once", n)
+	}
+}
@@ -0,0 +1,5 @@
+package interactions
+
+import "errors"
+
+var ErrInvalidTable = errors.New("invalid interaction table")
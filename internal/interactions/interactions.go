@@ -0,0 +1,56 @@
+package interactions
+
+import "strings"
+
+type Severity string
+
+const (
+	Minor    Severity = "minor"
+	Moderate Severity = "moderate"
+	Severe   Severity = "severe"
+)
+
+func (s Severity) rank() int {
+	switch s {
+	case Severe:
+		return 3
+	case Moderate:
+		return 2
+	case Minor:
+		return 1
+	}
+	return 0
+}
+
+type Kind string
+
+const (
+	DrugAllergy Kind = "drug_allergy"
+	DrugDrug    Kind = "drug_drug"
+)
+
+// Warning is one interaction found for a prescribed drug. With is the
+// allergen for drug-allergy warnings and the other drug otherwise.
+type Warning struct {
+	Kind        Kind     `json:"kind"`
+	Severity    Severity `json:"severity"`
+	Drug        string   `json:"drug"`
+	With        string   `json:"with"`
+	Description string   `json:"description"`
+}
+
+// HasSevere reports whether any of warnings is severe.
+func HasSevere(warnings []Warning) bool {
+	for _, w := range warnings {
+		if w.Severity == Severe {
+			return true
+		}
+	}
+	return false
+}
+
+// normalize makes names from the drug catalogue, the tables and what
+// nurses typed as allergies comparable.
+func normalize(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
@@ -0,0 +1,129 @@
+package interactions
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// The embedded tables cover the interactions and cross-reactions of the
+// drugs in common use at the clinic, by generic name:
+// drug_a,drug_b,severity,description and
+// allergen,drug,severity,description, each with a header row.
+var (
+	//go:embed data/drug_interactions.csv
+	embeddedDrugInteractions string
+	//go:embed data/allergy_cross_reactions.csv
+	embeddedAllergyCrossReactions string
+)
+
+type entry struct {
+	severity    Severity
+	description string
+}
+
+type pair struct{ a, b string }
+
+type Table struct {
+	drugs     map[pair]entry
+	allergies map[pair]entry
+}
+
+// NewTable loads the embedded interaction tables.
+func NewTable() (*Table, error) {
+	return LoadTable(strings.NewReader(embeddedDrugInteractions), strings.NewReader(embeddedAllergyCrossReactions))
+}
+
+func LoadTable(drugInteractions, allergyCrossReactions io.Reader) (*Table, error) {
+	t := &Table{}
+	var err error
+	t.drugs, err = loadPairs(drugInteractions, "drug interactions", func(a, b string) pair {
+		// interactions go both ways
+		if a > b {
+			a, b = b, a
+		}
+		return pair{a, b}
+	})
+	if err != nil {
+		return nil, err
+	}
+	t.allergies, err = loadPairs(allergyCrossReactions, "allergy cross-reactions", func(a, b string) pair {
+		return pair{a, b}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func loadPairs(r io.Reader, name string, key func(a, b string) pair) (map[pair]entry, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidTable, name, err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%w: %s: table is empty", ErrInvalidTable, name)
+	}
+	res := make(map[pair]entry, len(records)-1)
+	for i, rec := range records[1:] {
+		if len(rec) != 4 {
+			return nil, fmt.Errorf("%w: %s: line %d: expected 4 fields, got %d", ErrInvalidTable, name, i+2, len(rec))
+		}
+		severity := Severity(normalize(rec[2]))
+		if severity.rank() == 0 {
+			return nil, fmt.Errorf("%w: %s: line %d: unknown severity %q", ErrInvalidTable, name, i+2, rec[2])
+		}
+		k := key(normalize(rec[0]), normalize(rec[1]))
+		if _, ok := res[k]; ok {
+			return nil, fmt.Errorf("%w: %s: line %d: duplicate entry", ErrInvalidTable, name, i+2)
+		}
+		res[k] = entry{severity: severity, description: rec[3]}
+	}
+	return res, nil
+}
+
+// Check returns the warnings for prescribing drugs to a patient with the
+// given allergies who is already taking active. The prescribed drugs are
+// also checked against each other. Being allergic to the drug itself is
+// always severe. Warnings come most severe first.
+func (t *Table) Check(drugs, active, allergies []string) []Warning {
+	res := make([]Warning, 0)
+	seen := make(map[Warning]bool)
+	add := func(w Warning) {
+		if !seen[w] {
+			seen[w] = true
+			res = append(res, w)
+		}
+	}
+	for i, drug := range drugs {
+		d := normalize(drug)
+		for _, allergen := range allergies {
+			a := normalize(allergen)
+			if a == d {
+				add(Warning{Kind: DrugAllergy, Severity: Severe, Drug: drug, With: allergen,
+					Description: "Patient is allergic to " + drug})
+			} else if e, ok := t.allergies[pair{a, d}]; ok {
+				add(Warning{Kind: DrugAllergy, Severity: e.severity, Drug: drug, With: allergen, Description: e.description})
+			}
+		}
+		others := append(slices.Clone(drugs[i+1:]), active...)
+		for _, other := range others {
+			if e, ok := t.drug(d, normalize(other)); ok {
+				add(Warning{Kind: DrugDrug, Severity: e.severity, Drug: drug, With: other, Description: e.description})
+			}
+		}
+	}
+	slices.SortStableFunc(res, func(a, b Warning) int { return b.Severity.rank() - a.Severity.rank() })
+	return res
+}
+
+func (t *Table) drug(a, b string) (entry, bool) {
+	if a > b {
+		a, b = b, a
+	}
+	e, ok := t.drugs[pair{a, b}]
+	return e, ok
+}
@@ -5,4 +5,6 @@ import "errors"
 var (
 	ErrPatientNotFound              = errors.New("patient not found")
 	ErrPatientIdNumberAlreadyExists = errors.New("identity number already exists")
+	ErrAllergyAlreadyRecorded       = errors.New("allergy has already been recorded")
+	ErrIdentityCardNotFound         = errors.New("identity card scan image not found")
 )
@@ -2,10 +2,15 @@ package medicalpatients
 
 import (
 	"errors"
+	"log/slog"
 	"net/http"
 
+	"github.com/citadel-corp/halosuster/internal/common/cursor"
+	"github.com/citadel-corp/halosuster/internal/common/middleware"
+	"github.com/citadel-corp/halosuster/internal/common/query"
 	"github.com/citadel-corp/halosuster/internal/common/request"
 	"github.com/citadel-corp/halosuster/internal/common/response"
+	"github.com/gorilla/mux"
 	"github.com/gorilla/schema"
 )
 
@@ -18,9 +23,18 @@ func NewHandler(service Service) *Handler {
 }
 
 func (h *Handler) CreateMedicalPatient(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserID(r)
+	if err != nil {
+		response.JSON(w, http.StatusUnauthorized, response.ResponseBody{
+			Message: "unauthorized",
+			Error:   err.Error(),
+		})
+		return
+	}
+
 	var req PostMedicalPatients
 
-	err := request.DecodeJSON(w, r, &req)
+	err = request.DecodeJSON(w, r, &req)
 	if err != nil {
 		response.JSON(w, http.StatusBadRequest, response.ResponseBody{
 			Message: "Failed to decode JSON",
@@ -29,6 +43,8 @@ func (h *Handler) CreateMedicalPatient(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	req.UserId = userId
+
 	err = req.Validate()
 	if err != nil {
 		response.JSON(w, http.StatusBadRequest, response.ResponseBody{
@@ -39,6 +55,13 @@ func (h *Handler) CreateMedicalPatient(w http.ResponseWriter, r *http.Request) {
 	}
 
 	err = h.service.CreateMedicalPatients(r.Context(), req)
+	if errors.Is(err, ErrIdentityCardNotFound) {
+		response.JSON(w, http.StatusBadRequest, response.ResponseBody{
+			Message: "Bad request",
+			Error:   err.Error(),
+		})
+		return
+	}
 	if errors.Is(err, ErrPatientIdNumberAlreadyExists) {
 		response.JSON(w, http.StatusConflict, response.ResponseBody{
 			Message: "conflict",
@@ -58,6 +81,59 @@ func (h *Handler) CreateMedicalPatient(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+func (h *Handler) UpdateMedicalPatient(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserID(r)
+	if err != nil {
+		response.JSON(w, http.StatusUnauthorized, response.ResponseBody{
+			Message: "unauthorized",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	var req PatchMedicalPatient
+
+	err = request.DecodeJSON(w, r, &req)
+	if err != nil {
+		response.JSON(w, http.StatusBadRequest, response.ResponseBody{
+			Message: "Failed to decode JSON",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	req.UserId = userId
+
+	err = req.Validate()
+	if err != nil {
+		response.JSON(w, http.StatusBadRequest, response.ResponseBody{
+			Message: "Bad request",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	patient, err := h.service.UpdateMedicalPatient(r.Context(), mux.Vars(r)["identityNumber"], req)
+	if errors.Is(err, ErrPatientNotFound) {
+		response.JSON(w, http.StatusNotFound, response.ResponseBody{
+			Message: "Not found",
+			Error:   err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		response.JSON(w, http.StatusInternalServerError, response.ResponseBody{
+			Message: "Internal server error",
+			Error:   err.Error(),
+		})
+		return
+	}
+	response.JSON(w, http.StatusOK, response.ResponseBody{
+		Message: "Patient updated successfully",
+		Data:    patient,
+	})
+}
+
 func (h *Handler) ListMedicalPatient(w http.ResponseWriter, r *http.Request) {
 	var req ListPatientsPayload
 
@@ -69,7 +145,24 @@ func (h *Handler) ListMedicalPatient(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	patients, err := h.service.ListMedicalPatients(r.Context(), req)
+	filters, err := query.ParseFilters(r.URL.Query(), listFilterFields)
+	if err != nil {
+		response.JSON(w, http.StatusBadRequest, response.ResponseBody{
+			Message: "Bad request",
+			Error:   err.Error(),
+		})
+		return
+	}
+	req.Filters = filters
+
+	patients, meta, err := h.service.ListMedicalPatients(r.Context(), req)
+	if errors.Is(err, query.ErrInvalidSort) || errors.Is(err, cursor.ErrInvalidCursor) {
+		response.JSON(w, http.StatusBadRequest, response.ResponseBody{
+			Message: "Bad request",
+			Error:   err.Error(),
+		})
+		return
+	}
 	if err != nil {
 		response.JSON(w, http.StatusInternalServerError, response.ResponseBody{
 			Message: "Internal server error",
@@ -77,8 +170,144 @@ func (h *Handler) ListMedicalPatient(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
-	response.JSON(w, http.StatusOK, response.ResponseBody{
+	response.JSONWithHeaders(w, http.StatusOK, response.ResponseBody{
 		Message: "Patients fetched successfully",
 		Data:    patients,
+		Meta:    meta,
+	}, response.PaginationLinks(r, meta))
+}
+
+func (h *Handler) GetTimeline(w http.ResponseWriter, r *http.Request) {
+	var req TimelinePayload
+
+	newSchema := schema.NewDecoder()
+	newSchema.IgnoreUnknownKeys(true)
+
+	if err := newSchema.Decode(&req, r.URL.Query()); err != nil {
+		response.JSON(w, http.StatusBadRequest, response.ResponseBody{
+			Message: "Bad request",
+			Error:   err.Error(),
+		})
+		return
+	}
+	if err := req.Validate(); err != nil {
+		response.JSON(w, http.StatusBadRequest, response.ResponseBody{
+			Message: "Bad request",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	identityNumber := mux.Vars(r)["identityNumber"]
+	events, meta, err := h.service.GetTimeline(r.Context(), identityNumber, req)
+	if errors.Is(err, ErrPatientNotFound) {
+		response.JSON(w, http.StatusNotFound, response.ResponseBody{
+			Message: "Not found",
+			Error:   err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		response.JSON(w, http.StatusInternalServerError, response.ResponseBody{
+			Message: "Internal server error",
+			Error:   err.Error(),
+		})
+		return
+	}
+	response.JSONWithHeaders(w, http.StatusOK, response.ResponseBody{
+		Message: "Timeline fetched successfully",
+		Data:    events,
+		Meta:    meta,
+	}, response.PaginationLinks(r, meta))
+}
+
+func (h *Handler) AddAllergy(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserID(r)
+	if err != nil {
+		response.JSON(w, http.StatusUnauthorized, response.ResponseBody{
+			Message: "unauthorized",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	var req PostAllergy
+
+	err = request.DecodeJSON(w, r, &req)
+	if err != nil {
+		response.JSON(w, http.StatusBadRequest, response.ResponseBody{
+			Message: "Failed to decode JSON",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	req.UserId = userId
+
+	err = req.Validate()
+	if err != nil {
+		response.JSON(w, http.StatusBadRequest, response.ResponseBody{
+			Message: "Bad request",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	allergy, err := h.service.AddAllergy(r.Context(), mux.Vars(r)["identityNumber"], req)
+	if errors.Is(err, ErrPatientNotFound) {
+		response.JSON(w, http.StatusNotFound, response.ResponseBody{
+			Message: "Not found",
+			Error:   err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, ErrAllergyAlreadyRecorded) {
+		response.JSON(w, http.StatusConflict, response.ResponseBody{
+			Message: "conflict",
+			Error:   err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		response.JSON(w, http.StatusInternalServerError, response.ResponseBody{
+			Message: "Internal server error",
+			Error:   err.Error(),
+		})
+		return
+	}
+	response.JSON(w, http.StatusCreated, response.ResponseBody{
+		Message: "Allergy recorded successfully",
+		Data:    allergy,
+	})
+}
+
+func (h *Handler) ListAllergies(w http.ResponseWriter, r *http.Request) {
+	allergies, err := h.service.ListAllergies(r.Context(), mux.Vars(r)["identityNumber"])
+	if errors.Is(err, ErrPatientNotFound) {
+		response.JSON(w, http.StatusNotFound, response.ResponseBody{
+			Message: "Not found",
+			Error:   err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		response.JSON(w, http.StatusInternalServerError, response.ResponseBody{
+			Message: "Internal server error",
+			Error:   err.Error(),
+		})
+		return
+	}
+	response.JSON(w, http.StatusOK, response.ResponseBody{
+		Message: "Allergies fetched successfully",
+		Data:    allergies,
 	})
 }
+
+func getUserID(r *http.Request) (string, error) {
+	if authValue, ok := r.Context().Value(middleware.ContextAuthKey{}).(string); ok {
+		return authValue, nil
+	} else {
+		slog.Error("cannot parse auth value from context")
+		return "", errors.New("cannot parse auth value from context")
+	}
+}
@@ -19,6 +19,64 @@ type MedicalPatients struct {
 	Name            string    `json:"name"`
 	Birthdate       time.Time `json:"birthDate"`
 	Gender          Gender    `json:"gender"`
-	IdentityCardUrl string    `json:"-"`
+	IdentityCardKey string    `json:"-"`
+	CreatedBy       *string   `json:"-"`
 	CreatedAt       time.Time `json:"createdAt"`
+	// IdentityCardScanImg is a short-lived URL of IdentityCardKey, set
+	// for responses.
+	IdentityCardScanImg string `json:"identityCardScanImg"`
+}
+
+type EventType string
+
+const (
+	EventRegistration      EventType = "registration"
+	EventDemographicChange EventType = "demographic_change"
+	EventImageUpload       EventType = "image_upload"
+	EventMedicalRecord     EventType = "medical_record"
+	EventRecordAmended     EventType = "medical_record_amended"
+	EventRecordReviewed    EventType = "medical_record_reviewed"
+	EventAttachment        EventType = "attachment_added"
+	EventAllergy           EventType = "allergy_recorded"
+)
+
+var EventTypes []interface{} = []interface{}{EventRegistration, EventDemographicChange, EventImageUpload, EventMedicalRecord,
+	EventRecordAmended, EventRecordReviewed, EventAttachment, EventAllergy}
+
+// TimelineEvent is one entry of a patient's history. Events are not
+// stored on their own; each type is read from the table that owns it.
+type TimelineEvent struct {
+	Type        EventType
+	OccurredAt  time.Time
+	ReferenceID string
+	Summary     string
+	ActorID     *string
+	ActorNIP    *string
+	ActorName   *string
+}
+
+// PatientChange is an update of a patient's demographics. Changes are
+// keyed by the JSON name of each field changed.
+type PatientChange struct {
+	ID        string
+	PatientID string
+	Changes   map[string]FieldChange
+	ChangedBy *string
+	ChangedAt time.Time
+}
+
+type FieldChange struct {
+	From any `json:"from"`
+	To   any `json:"to"`
+}
+
+// Allergy is a recorded allergy of a patient. Allergen is a drug's
+// generic name or a drug class such as penicillin or NSAID.
+type Allergy struct {
+	ID         string
+	PatientID  string
+	Allergen   string
+	Reaction   *string
+	RecordedBy *string
+	CreatedAt  time.Time
 }
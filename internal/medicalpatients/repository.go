@@ -3,17 +3,39 @@ package medicalpatients
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/citadel-corp/halosuster/internal/common/db"
+	"github.com/citadel-corp/halosuster/internal/common/query"
+	"github.com/citadel-corp/halosuster/internal/common/response"
 	"github.com/jackc/pgx/v5/pgconn"
 )
 
 type Repository interface {
 	Create(ctx context.Context, medicalrecord *MedicalPatients) error
 	GetByIdentityNumber(ctx context.Context, idNumber string) (*MedicalPatients, error)
-	List(ctx context.Context, req ListPatientsPayload) ([]MedicalPatients, error)
+	Update(ctx context.Context, idNumber string, update func(*MedicalPatients) *PatientChange) (*MedicalPatients, error)
+	List(ctx context.Context, req ListPatientsPayload) ([]MedicalPatients, *response.Pagination, error)
+	ListTimeline(ctx context.Context, patientID string, req TimelinePayload) ([]TimelineEvent, *response.Pagination, error)
+	CreateAllergy(ctx context.Context, allergy *Allergy) error
+	ListAllergies(ctx context.Context, patientID string) ([]Allergy, error)
+}
+
+var listFilterFields = []query.Field{
+	{Param: "identityNumber", Column: "identity_number", DefaultOp: query.OpEq, Ops: []query.Op{query.OpPrefix}, Kind: query.KindInt},
+	{Param: "name", Column: "name", DefaultOp: query.OpContains, Ops: []query.Op{query.OpEq, query.OpPrefix}, Fold: true},
+	// phone numbers are stored with their leading + which clients cannot send unescaped
+	{Param: "phoneNumber", Column: "LTRIM(phone_number, '+')", DefaultOp: query.OpContains, Ops: []query.Op{query.OpEq, query.OpPrefix}},
+	{Param: "birthDate", Column: "birth_date", DefaultOp: query.OpEq, Ops: []query.Op{query.OpRange}, Kind: query.KindDate},
+}
+
+var listSortFields = map[string]string{
+	"createdAt": "created_at",
+	"name":      "name",
+	"birthDate": "birth_date",
 }
 
 type dbRepository struct {
@@ -26,17 +48,23 @@ func NewRepository(db *db.DB) Repository {
 
 func (d *dbRepository) Create(ctx context.Context, medicalpatient *MedicalPatients) error {
 	q := `
-        INSERT INTO medical_patients (id, identity_number, phone_number, name, birth_date, gender, identity_card_url)
-        VALUES ($1, $2, $3, $4, $5, $6, $7);
+        INSERT INTO medical_patients (id, identity_number, phone_number, name, birth_date, gender, identity_card_key, created_by)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8);
     `
 	_, err := d.db.DB().ExecContext(ctx, q, medicalpatient.ID, medicalpatient.IdentityNumber, medicalpatient.PhoneNumber,
-		medicalpatient.Name, medicalpatient.Birthdate, medicalpatient.Gender, medicalpatient.IdentityCardUrl)
+		medicalpatient.Name, medicalpatient.Birthdate, medicalpatient.Gender, medicalpatient.IdentityCardKey, medicalpatient.CreatedBy)
 	var pgErr *pgconn.PgError
 	if err != nil {
 		if errors.As(err, &pgErr) {
 			switch pgErr.Code {
 			case "23505":
 				return ErrPatientNotFound
+			case "23503":
+				if pgErr.ConstraintName == "fk_identity_card_key" {
+					// the image was collected since it was checked
+					return ErrIdentityCardNotFound
+				}
+				return err
 			default:
 				return err
 			}
@@ -48,13 +76,13 @@ func (d *dbRepository) Create(ctx context.Context, medicalpatient *MedicalPatien
 
 func (d *dbRepository) GetByIdentityNumber(ctx context.Context, idNumber string) (*MedicalPatients, error) {
 	q := `
-		SELECT id, identity_number, phone_number, name, birth_date, gender, identity_card_url, created_at
+		SELECT id, identity_number, phone_number, name, birth_date, gender, identity_card_key, created_by, created_at
 		FROM medical_patients
 		WHERE identity_number = $1;
 	`
 	row := d.db.DB().QueryRowContext(ctx, q, idNumber)
 	m := &MedicalPatients{}
-	err := row.Scan(&m.ID, &m.IdentityNumber, &m.PhoneNumber, &m.Name, &m.Birthdate, &m.Gender, &m.IdentityCardUrl, &m.CreatedAt)
+	err := row.Scan(&m.ID, &m.IdentityNumber, &m.PhoneNumber, &m.Name, &m.Birthdate, &m.Gender, &m.IdentityCardKey, &m.CreatedBy, &m.CreatedAt)
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, ErrPatientNotFound
 	}
@@ -64,59 +92,244 @@ func (d *dbRepository) GetByIdentityNumber(ctx context.Context, idNumber string)
 	return m, nil
 }
 
-func (d *dbRepository) List(ctx context.Context, req ListPatientsPayload) ([]MedicalPatients, error) {
-	q := `
-			SELECT id, identity_number, phone_number, name, birth_date, gender, identity_card_url, created_at
+// Update locks the patient, lets update change it and, when update
+// returns a change, saves the patient together with the change.
+func (d *dbRepository) Update(ctx context.Context, idNumber string, update func(*MedicalPatients) *PatientChange) (*MedicalPatients, error) {
+	m := &MedicalPatients{}
+	err := d.db.StartTx(ctx, func(tx *sql.Tx) error {
+		q := `
+			SELECT id, identity_number, phone_number, name, birth_date, gender, identity_card_key, created_by, created_at
 			FROM medical_patients
-	`
-	paramNo := 1
-	params := make([]interface{}, 0)
-	if req.IdentityNumber != "" {
-		q += fmt.Sprintf("WHERE identity_number = $%d ", paramNo)
-		paramNo += 1
-		params = append(params, req.IdentityNumber)
-	}
-	if req.Name != "" {
-		q += whereOrAnd(paramNo)
-		q += fmt.Sprintf("LOWER(name) LIKE $%d ", paramNo)
-		paramNo += 1
-		params = append(params, "%"+req.Name+"%")
-	}
-	if req.PhoneNumber != "" {
-		q += whereOrAnd(paramNo)
-		q += fmt.Sprintf("phone_number LIKE $%d ", paramNo)
-		paramNo += 1
-		params = append(params, "%"+req.PhoneNumber+"%")
+			WHERE identity_number = $1
+			FOR UPDATE;
+		`
+		err := tx.QueryRowContext(ctx, q, idNumber).Scan(&m.ID, &m.IdentityNumber, &m.PhoneNumber, &m.Name, &m.Birthdate,
+			&m.Gender, &m.IdentityCardKey, &m.CreatedBy, &m.CreatedAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrPatientNotFound
+		}
+		if err != nil {
+			return err
+		}
+		change := update(m)
+		if change == nil {
+			return nil
+		}
+		q = `
+			UPDATE medical_patients
+			SET phone_number = $2, name = $3, birth_date = $4, gender = $5
+			WHERE id = $1;
+		`
+		_, err = tx.ExecContext(ctx, q, m.ID, m.PhoneNumber, m.Name, m.Birthdate, m.Gender)
+		if err != nil {
+			return err
+		}
+		changes, err := json.Marshal(change.Changes)
+		if err != nil {
+			return err
+		}
+		q = `
+			INSERT INTO medical_patient_changes (id, patient_id, changes, changed_by)
+			VALUES ($1, $2, $3, $4);
+		`
+		_, err = tx.ExecContext(ctx, q, change.ID, m.ID, string(changes), change.ChangedBy)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
+	return m, nil
+}
 
-	if req.CreatedAt == "asc" || req.CreatedAt == "desc" {
-		q += `ORDER BY created_at ` + req.CreatedAt
+func (d *dbRepository) List(ctx context.Context, req ListPatientsPayload) ([]MedicalPatients, *response.Pagination, error) {
+	meta := &response.Pagination{Limit: req.Limit, Offset: req.Offset}
+	if len(req.Filters) == 0 {
+		var err error
+		meta.Total, meta.Estimated, err = d.db.EstimateTotal(ctx, "medical_patients")
+		if err != nil {
+			return nil, nil, err
+		}
 	}
 
-	q += fmt.Sprintf(" OFFSET $%d LIMIT $%d", paramNo, paramNo+1)
-	params = append(params, req.Offset)
-	params = append(params, req.Limit)
+	q := "SELECT id, identity_number, phone_number, name, birth_date, gender, identity_card_key, created_at"
+	// a cursor narrows the rows, so its total has to be counted apart
+	countInline := !meta.Estimated && req.after == nil
+	if countInline {
+		q += ", " + db.WindowCount
+	}
+	q += " FROM medical_patients"
+	b := query.NewBuilder()
+	conditions := query.Conditions(req.Filters)
+	pageConditions := append([]query.Condition{}, conditions...)
+	if req.after != nil {
+		pageConditions = append(pageConditions, req.after.Condition("created_at", "id"))
+	}
+	q += b.Where(query.And(pageConditions...))
+	q += query.OrderBy(req.sorts)
+	q += fmt.Sprintf(" OFFSET %s LIMIT %s", b.Arg(req.Offset), b.Arg(req.Limit))
 
-	rows, err := d.db.DB().QueryContext(ctx, q, params...)
+	rows, err := d.db.DB().QueryContext(ctx, q, b.Args()...)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	defer rows.Close()
 	res := make([]MedicalPatients, 0)
 	for rows.Next() {
 		m := MedicalPatients{}
-		err = rows.Scan(&m.ID, &m.IdentityNumber, &m.PhoneNumber, &m.Name, &m.Birthdate,
-			&m.Gender, &m.IdentityCardUrl, &m.CreatedAt)
+		dest := []any{&m.ID, &m.IdentityNumber, &m.PhoneNumber, &m.Name, &m.Birthdate,
+			&m.Gender, &m.IdentityCardKey, &m.CreatedAt}
+		if countInline {
+			dest = append(dest, &meta.Total)
+		}
+		err = rows.Scan(dest...)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		res = append(res, m)
 	}
-	return res, nil
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	// a page past the end has no rows to carry the count
+	if !meta.Estimated && (!countInline || len(res) == 0 && req.Offset > 0) {
+		cb := query.NewBuilder()
+		where := cb.Where(query.And(conditions...))
+		err = d.db.DB().QueryRowContext(ctx, "SELECT COUNT(*) FROM medical_patients"+where, cb.Args()...).Scan(&meta.Total)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return res, meta, nil
 }
 
-func whereOrAnd(paramNo int) string {
-	if paramNo == 1 {
-		return "WHERE "
+// timelineSources holds one SELECT per event type, each producing
+// (type, occurred_at, reference_id, summary, actor_id) for the patient
+// bound to ?. A new event type only needs a new entry here.
+var timelineSources = []string{
+	`SELECT 'registration', created_at, id, 'Patient ' || name || ' registered', created_by
+		FROM medical_patients WHERE id = ?`,
+	`SELECT 'demographic_change', changed_at, id,
+			'Changed ' || (SELECT string_agg(field, ', ' ORDER BY field) FROM jsonb_object_keys(changes) AS field), changed_by
+		FROM medical_patient_changes WHERE patient_id = ?`,
+	// images are dated by the registry, falling back to the registration
+	// for keys registered before the registry kept who uploaded them
+	`SELECT 'image_upload', COALESCE(images.uploaded_at, p.created_at), p.identity_card_key, 'Identity card scan uploaded',
+			COALESCE(images.uploaded_by, p.created_by)
+		FROM medical_patients p LEFT JOIN images ON images.key = p.identity_card_key WHERE p.id = ?`,
+	`SELECT 'image_upload', uploaded_at, key, 'Attachment image uploaded', uploaded_by
+		FROM images WHERE key IN (
+			SELECT a.image_key FROM medical_record_attachments a JOIN medical_records r ON r.id = a.record_id
+			WHERE r.patient_id = ?)`,
+	`SELECT 'medical_record', created_at, id, 'Symptoms: ' || LEFT(symptoms, 100), user_id
+		FROM medical_records WHERE patient_id = ? AND amends_id IS NULL`,
+	`SELECT 'medical_record_amended', created_at, id, 'Version ' || version || ': ' || LEFT(amend_reason, 100), user_id
+		FROM medical_records WHERE patient_id = ? AND amends_id IS NOT NULL`,
+	`SELECT 'medical_record_reviewed', reviewed_at, id, 'Review ' || review_status || COALESCE(': ' || LEFT(review_comment, 100), ''), reviewed_by
+		FROM medical_records WHERE patient_id = ? AND reviewed_at IS NOT NULL`,
+	// amendments carry over the attachments of the version they amend,
+	// which are only listed when they were first attached
+	`SELECT 'attachment_added', r.created_at, a.image_key,
+			initcap(replace(a.kind::text, '_', ' ')) || ' attached' || COALESCE(': ' || LEFT(a.caption, 100), ''), r.user_id
+		FROM medical_record_attachments a JOIN medical_records r ON r.id = a.record_id
+		WHERE r.patient_id = ? AND NOT EXISTS (
+			SELECT 1 FROM medical_record_attachments prev
+			WHERE prev.record_id = r.amends_id AND prev.image_key = a.image_key)`,
+	`SELECT 'allergy_recorded', created_at, id, 'Allergy to ' || allergen || COALESCE(': ' || LEFT(reaction, 100), ''), recorded_by
+		FROM patient_allergies WHERE patient_id = ?`,
+}
+
+func (d *dbRepository) ListTimeline(ctx context.Context, patientID string, req TimelinePayload) ([]TimelineEvent, *response.Pagination, error) {
+	b := query.NewBuilder()
+	q := `
+		SELECT events.type, events.occurred_at, events.reference_id, events.summary,
+			users.id, users.nip, users.name, ` + db.WindowCount + `
+		` + timelineEvents(b, patientID, req) + `
+	`
+	q += query.OrderBy([]query.Sort{{Column: "events.occurred_at", Desc: req.CreatedAt == "desc"}, {Column: "events.type"}, {Column: "events.reference_id"}})
+	q += fmt.Sprintf(" OFFSET %s LIMIT %s", b.Arg(req.Offset), b.Arg(req.Limit))
+
+	rows, err := d.db.DB().QueryContext(ctx, q, b.Args()...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	meta := &response.Pagination{Limit: req.Limit, Offset: req.Offset}
+	res := make([]TimelineEvent, 0)
+	for rows.Next() {
+		e := TimelineEvent{}
+		err = rows.Scan(&e.Type, &e.OccurredAt, &e.ReferenceID, &e.Summary,
+			&e.ActorID, &e.ActorNIP, &e.ActorName, &meta.Total)
+		if err != nil {
+			return nil, nil, err
+		}
+		res = append(res, e)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	// a page past the end has no rows to carry the count
+	if len(res) == 0 && req.Offset > 0 {
+		b = query.NewBuilder()
+		q = `SELECT COUNT(*) ` + timelineEvents(b, patientID, req)
+		err = d.db.DB().QueryRowContext(ctx, q, b.Args()...).Scan(&meta.Total)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return res, meta, nil
+}
+
+// timelineEvents returns the FROM and WHERE clauses selecting the
+// patient's events of the requested type.
+func timelineEvents(b *query.Builder, patientID string, req TimelinePayload) string {
+	sources := make([]string, len(timelineSources))
+	for i, src := range timelineSources {
+		sources[i] = query.Raw(src, patientID).SQL(b)
+	}
+	q := `FROM (` + strings.Join(sources, " UNION ALL ") + `) AS events (type, occurred_at, reference_id, summary, actor_id)
+		LEFT JOIN users ON users.id = events.actor_id`
+	if req.Type != "" {
+		q += b.Where(query.Eq("events.type", req.Type))
+	}
+	return q
+}
+
+func (d *dbRepository) CreateAllergy(ctx context.Context, allergy *Allergy) error {
+	q := `
+		INSERT INTO patient_allergies (id, patient_id, allergen, reaction, recorded_by)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING created_at;
+	`
+	err := d.db.DB().QueryRowContext(ctx, q, allergy.ID, allergy.PatientID, allergy.Allergen, allergy.Reaction,
+		allergy.RecordedBy).Scan(&allergy.CreatedAt)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return ErrAllergyAlreadyRecorded
+	}
+	return err
+}
+
+func (d *dbRepository) ListAllergies(ctx context.Context, patientID string) ([]Allergy, error) {
+	q := `
+		SELECT id, patient_id, allergen, reaction, recorded_by, created_at
+		FROM patient_allergies
+		WHERE patient_id = $1
+		ORDER BY created_at, id;
+	`
+	rows, err := d.db.DB().QueryContext(ctx, q, patientID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := make([]Allergy, 0)
+	for rows.Next() {
+		a := Allergy{}
+		err = rows.Scan(&a.ID, &a.PatientID, &a.Allergen, &a.Reaction, &a.RecordedBy, &a.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, a)
 	}
-	return "OR "
+	return res, rows.Err()
 }
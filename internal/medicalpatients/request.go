@@ -2,11 +2,13 @@ package medicalpatients
 
 import (
 	"fmt"
-	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/citadel-corp/halosuster/internal/common/cursor"
+	"github.com/citadel-corp/halosuster/internal/common/query"
+	"github.com/citadel-corp/halosuster/internal/image"
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 )
 
@@ -18,10 +20,11 @@ var phoneNumberParamValidationRule = validation.NewStringRule(func(s string) boo
 	return !strings.HasPrefix(s, "+")
 }, "phone number should not start with +")
 
-var imgUrlValidationRule = validation.NewStringRule(func(s string) bool {
-	match, _ := regexp.MatchString(`^(http:\/\/www\.|https:\/\/www\.|http:\/\/|https:\/\/|\/|\/\/)?[A-z0-9_-]*?[:]?[A-z0-9_-]*?[@]?[A-z0-9]+([\-\.]{1}[a-z0-9]+)*\.[a-z]{2,5}(:[0-9]{1,5})?(\/{1}[A-z0-9_\-\:x\=\(\)]+)*(\.(jpg|jpeg|png))?$`, s)
-	return match
-}, "image url is not valid")
+// imgValidationRule accepts the key of an uploaded image, or its URL as
+// uploads returned before images were private.
+var imgValidationRule = validation.NewStringRule(func(s string) bool {
+	return image.ValidKey(image.KeyOf(s))
+}, "image must be the key or url of an uploaded image")
 
 type PostMedicalPatients struct {
 	IdentityNumber      int64     `json:"identityNumber"`
@@ -30,6 +33,7 @@ type PostMedicalPatients struct {
 	Birthdate           time.Time `json:"birthDate"`
 	Gender              Gender    `json:"gender"`
 	IdentityCardScanImg string    `json:"identityCardScanImg"`
+	UserId              string    `json:"-"`
 }
 
 func (p PostMedicalPatients) Validate() error {
@@ -44,15 +48,70 @@ func (p PostMedicalPatients) Validate() error {
 		validation.Field(&p.Name, validation.Required, validation.Length(3, 30)),
 		validation.Field(&p.Birthdate, validation.Required),
 		validation.Field(&p.Gender, validation.Required, validation.In(Genders...)),
-		validation.Field(&p.IdentityCardScanImg, validation.Required, imgUrlValidationRule),
+		validation.Field(&p.IdentityCardScanImg, validation.Required, imgValidationRule),
+	)
+}
+
+// PatchMedicalPatient changes the demographics given; the identity
+// number and card identify the patient and cannot be changed.
+type PatchMedicalPatient struct {
+	PhoneNumber *string    `json:"phoneNumber"`
+	Name        *string    `json:"name"`
+	Birthdate   *time.Time `json:"birthDate"`
+	Gender      *Gender    `json:"gender"`
+	UserId      string     `json:"-"`
+}
+
+func (p PatchMedicalPatient) Validate() error {
+	return validation.ValidateStruct(&p,
+		validation.Field(&p.PhoneNumber, validation.NilOrNotEmpty, phoneNumberValidationRule, validation.Length(10, 15)),
+		validation.Field(&p.Name, validation.NilOrNotEmpty, validation.Length(3, 30)),
+		validation.Field(&p.Birthdate, validation.NilOrNotEmpty),
+		validation.Field(&p.Gender, validation.NilOrNotEmpty, validation.In(Genders...)),
 	)
 }
 
 type ListPatientsPayload struct {
-	IdentityNumber string `schema:"identityNumber" binding:"omitempty"`
-	Name           string `schema:"name" binding:"omitempty"`
-	PhoneNumber    string `schema:"phoneNumber" binding:"omitempty"`
-	CreatedAt      string `schema:"createdAt" binding:"omitempty"`
-	Limit          int    `schema:"limit" binding:"omitempty"`
-	Offset         int    `schema:"offset" binding:"omitempty"`
+	CreatedAt string `schema:"createdAt" binding:"omitempty"`
+	Sort      string `schema:"sort" binding:"omitempty"`
+	Limit     int    `schema:"limit" binding:"omitempty"`
+	Offset    int    `schema:"offset" binding:"omitempty"`
+	Cursor    string `schema:"cursor" binding:"omitempty"`
+
+	Filters []query.Filter `schema:"-"`
+	sorts   []query.Sort
+	after   *cursor.Cursor
+	keyset  bool
+}
+
+// fingerprint identifies the listing for its cursors.
+func (p ListPatientsPayload) fingerprint() string {
+	return cursor.Fingerprint([]string{p.CreatedAt, p.Sort}, p.Filters)
+}
+
+type TimelinePayload struct {
+	Type      string `schema:"type" binding:"omitempty"`
+	CreatedAt string `schema:"createdAt" binding:"omitempty"`
+	Limit     int    `schema:"limit" binding:"omitempty"`
+	Offset    int    `schema:"offset" binding:"omitempty"`
+}
+
+func (p TimelinePayload) Validate() error {
+	return validation.ValidateStruct(&p,
+		validation.Field(&p.Type, validation.In(EventTypes...)),
+		validation.Field(&p.CreatedAt, validation.In("asc", "desc")),
+	)
+}
+
+type PostAllergy struct {
+	UserId   string `json:"-"`
+	Allergen string `json:"allergen"`
+	Reaction string `json:"reaction"`
+}
+
+func (p PostAllergy) Validate() error {
+	return validation.ValidateStruct(&p,
+		validation.Field(&p.Allergen, validation.Required, validation.Length(1, 100)),
+		validation.Field(&p.Reaction, validation.Length(0, 500)),
+	)
 }
@@ -1,5 +1,7 @@
 package medicalpatients
 
+import "time"
+
 type MedicalPatientsResponse struct {
 	IdentityNumber      int64  `json:"identityNumber"`
 	PhoneNumber         string `json:"phoneNumber"`
@@ -8,3 +10,25 @@ type MedicalPatientsResponse struct {
 	Gender              string `json:"gender"`
 	IdentityCardScanImg string `json:"identityCardScanImg"`
 }
+
+type TimelineActor struct {
+	UserID string `json:"userId"`
+	NIP    string `json:"nip"`
+	Name   string `json:"name"`
+}
+
+type TimelineEventResponse struct {
+	Type        EventType      `json:"type"`
+	OccurredAt  time.Time      `json:"occurredAt"`
+	Actor       *TimelineActor `json:"actor"`
+	Summary     string         `json:"summary"`
+	ReferenceID string         `json:"referenceId"`
+}
+
+type AllergyResponse struct {
+	ID         string    `json:"id"`
+	Allergen   string    `json:"allergen"`
+	Reaction   *string   `json:"reaction,omitempty"`
+	RecordedBy *string   `json:"recordedBy,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
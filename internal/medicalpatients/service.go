@@ -2,27 +2,47 @@ package medicalpatients
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"strings"
 
+	"github.com/citadel-corp/halosuster/internal/common/cursor"
 	"github.com/citadel-corp/halosuster/internal/common/id"
+	"github.com/citadel-corp/halosuster/internal/common/query"
+	"github.com/citadel-corp/halosuster/internal/common/response"
+	"github.com/citadel-corp/halosuster/internal/image"
 )
 
 type Service interface {
 	CreateMedicalPatients(ctx context.Context, req PostMedicalPatients) error
-	ListMedicalPatients(ctx context.Context, req ListPatientsPayload) ([]MedicalPatients, error)
+	UpdateMedicalPatient(ctx context.Context, identityNumber string, req PatchMedicalPatient) (*MedicalPatients, error)
+	ListMedicalPatients(ctx context.Context, req ListPatientsPayload) ([]MedicalPatients, *response.Pagination, error)
+	GetTimeline(ctx context.Context, identityNumber string, req TimelinePayload) ([]TimelineEventResponse, *response.Pagination, error)
+	AddAllergy(ctx context.Context, identityNumber string, req PostAllergy) (*AllergyResponse, error)
+	ListAllergies(ctx context.Context, identityNumber string) ([]AllergyResponse, error)
 }
 
 type medicalPatientsService struct {
-	repository Repository
+	repository   Repository
+	imageService image.Service
+	cursors      cursor.Codec
 }
 
-func NewService(repository Repository) Service {
-	return &medicalPatientsService{repository: repository}
+func NewService(repository Repository, imageService image.Service, cursors cursor.Codec) Service {
+	return &medicalPatientsService{repository: repository, imageService: imageService, cursors: cursors}
 }
 
 func (s *medicalPatientsService) CreateMedicalPatients(ctx context.Context, req PostMedicalPatients) error {
 	var err error
 	// idNumber := strconv.Itoa(int(req.IdentityNumber))
+	identityCardKey := image.KeyOf(req.IdentityCardScanImg)
+	_, err = s.imageService.Stat(ctx, identityCardKey)
+	if errors.Is(err, image.ErrImageNotFound) {
+		return ErrIdentityCardNotFound
+	}
+	if err != nil {
+		return err
+	}
 
 	medicalpatient := &MedicalPatients{
 		ID:              id.GenerateStringID(16),
@@ -31,7 +51,8 @@ func (s *medicalPatientsService) CreateMedicalPatients(ctx context.Context, req
 		Name:            req.Name,
 		Birthdate:       req.Birthdate,
 		Gender:          req.Gender,
-		IdentityCardUrl: req.IdentityCardScanImg,
+		IdentityCardKey: identityCardKey,
+		CreatedBy:       &req.UserId,
 	}
 	err = s.repository.Create(ctx, medicalpatient)
 	if err != nil {
@@ -41,20 +62,185 @@ func (s *medicalPatientsService) CreateMedicalPatients(ctx context.Context, req
 	return nil
 }
 
-func (s *medicalPatientsService) ListMedicalPatients(ctx context.Context, req ListPatientsPayload) ([]MedicalPatients, error) {
-	if req.Limit == 0 {
-		req.Limit = 5
+// UpdateMedicalPatient changes the patient's demographics and records
+// what changed, from and to, for their timeline.
+func (s *medicalPatientsService) UpdateMedicalPatient(ctx context.Context, identityNumber string, req PatchMedicalPatient) (*MedicalPatients, error) {
+	patient, err := s.repository.Update(ctx, identityNumber, func(m *MedicalPatients) *PatientChange {
+		changes := make(map[string]FieldChange)
+		if req.PhoneNumber != nil && *req.PhoneNumber != m.PhoneNumber {
+			changes["phoneNumber"] = FieldChange{From: m.PhoneNumber, To: *req.PhoneNumber}
+			m.PhoneNumber = *req.PhoneNumber
+		}
+		if req.Name != nil && *req.Name != m.Name {
+			changes["name"] = FieldChange{From: m.Name, To: *req.Name}
+			m.Name = *req.Name
+		}
+		if req.Birthdate != nil && !req.Birthdate.Equal(m.Birthdate) {
+			changes["birthDate"] = FieldChange{From: m.Birthdate, To: *req.Birthdate}
+			m.Birthdate = *req.Birthdate
+		}
+		if req.Gender != nil && *req.Gender != m.Gender {
+			changes["gender"] = FieldChange{From: m.Gender, To: *req.Gender}
+			m.Gender = *req.Gender
+		}
+		if len(changes) == 0 {
+			return nil
+		}
+		return &PatientChange{
+			ID:        id.GenerateStringID(16),
+			PatientID: m.ID,
+			Changes:   changes,
+			ChangedBy: &req.UserId,
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	patient.IdentityCardScanImg, err = s.imageService.PresignURL(patient.IdentityCardKey)
+	if err != nil {
+		return nil, err
+	}
+	return patient, nil
+}
+
+func (s *medicalPatientsService) ListMedicalPatients(ctx context.Context, req ListPatientsPayload) ([]MedicalPatients, *response.Pagination, error) {
+	var err error
+	req.Limit, req.Offset = query.NormalizePage(req.Limit, req.Offset)
+
+	if req.CreatedAt == "" {
+		req.CreatedAt = "desc"
+	}
+
+	for i, f := range req.Filters {
+		if f.Field.Param == "phoneNumber" {
+			req.Filters[i].Value = strings.TrimSpace(strings.Replace(f.Value, "+", "", 1))
+		}
+	}
+
+	if req.Cursor != "" {
+		req.after, err = s.cursors.Decode(req.Cursor)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err = req.after.Check(req.fingerprint()); err != nil {
+			return nil, nil, err
+		}
+		if req.Sort != "" && strings.TrimPrefix(req.Sort, "-") != "createdAt" {
+			return nil, nil, fmt.Errorf("%w: cursor paging only supports sorting by createdAt", query.ErrInvalidSort)
+		}
+		req.Offset = 0
+		req.sorts = []query.Sort{{Column: "created_at", Desc: req.after.Desc}}
+	} else {
+		req.sorts, err = query.ParseSort(req.Sort, listSortFields)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(req.sorts) == 0 && (req.CreatedAt == "asc" || req.CreatedAt == "desc") {
+			req.sorts = []query.Sort{{Column: "created_at", Desc: req.CreatedAt == "desc"}}
+		}
+	}
+	// ties on created_at are broken by id so the order is total and
+	// the last row of a page can serve as a cursor
+	if len(req.sorts) == 1 && req.sorts[0].Column == "created_at" {
+		req.sorts = append(req.sorts, query.Sort{Column: "id", Desc: req.sorts[0].Desc})
+		req.keyset = true
+	}
+
+	res, meta, err := s.repository.List(ctx, req)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range res {
+		res[i].IdentityCardScanImg, err = s.imageService.PresignURL(res[i].IdentityCardKey)
+		if err != nil {
+			return nil, nil, err
+		}
 	}
+	if req.keyset && len(res) == req.Limit {
+		last := res[len(res)-1]
+		meta.NextCursor = s.cursors.Encode(cursor.Cursor{CreatedAt: last.CreatedAt, ID: last.ID, Desc: req.sorts[0].Desc, Query: req.fingerprint()})
+	}
+	return res, meta, nil
+}
 
+func (s *medicalPatientsService) GetTimeline(ctx context.Context, identityNumber string, req TimelinePayload) ([]TimelineEventResponse, *response.Pagination, error) {
+	req.Limit, req.Offset = query.NormalizePage(req.Limit, req.Offset)
 	if req.CreatedAt == "" {
 		req.CreatedAt = "desc"
 	}
 
-	req.PhoneNumber = strings.Replace(req.PhoneNumber, "+", "", 1)
+	patient, err := s.repository.GetByIdentityNumber(ctx, identityNumber)
+	if err != nil {
+		return nil, nil, err
+	}
+	events, meta, err := s.repository.ListTimeline(ctx, patient.ID, req)
+	if err != nil {
+		return nil, nil, err
+	}
+	res := make([]TimelineEventResponse, len(events))
+	for i, e := range events {
+		res[i] = TimelineEventResponse{
+			Type:        e.Type,
+			OccurredAt:  e.OccurredAt,
+			Summary:     e.Summary,
+			ReferenceID: e.ReferenceID,
+		}
+		// the author may have been deleted since
+		if e.ActorID != nil {
+			res[i].Actor = &TimelineActor{
+				UserID: *e.ActorID,
+				NIP:    *e.ActorNIP,
+				Name:   *e.ActorName,
+			}
+		}
+	}
+	return res, meta, nil
+}
 
-	res, err := s.repository.List(ctx, req)
+func (s *medicalPatientsService) AddAllergy(ctx context.Context, identityNumber string, req PostAllergy) (*AllergyResponse, error) {
+	patient, err := s.repository.GetByIdentityNumber(ctx, identityNumber)
+	if err != nil {
+		return nil, err
+	}
+	allergy := &Allergy{
+		ID:         id.GenerateStringID(16),
+		PatientID:  patient.ID,
+		Allergen:   strings.Join(strings.Fields(req.Allergen), " "),
+		RecordedBy: &req.UserId,
+	}
+	if req.Reaction != "" {
+		allergy.Reaction = &req.Reaction
+	}
+	err = s.repository.CreateAllergy(ctx, allergy)
 	if err != nil {
 		return nil, err
 	}
+	res := allergyResponse(*allergy)
+	return &res, nil
+}
+
+func (s *medicalPatientsService) ListAllergies(ctx context.Context, identityNumber string) ([]AllergyResponse, error) {
+	patient, err := s.repository.GetByIdentityNumber(ctx, identityNumber)
+	if err != nil {
+		return nil, err
+	}
+	allergies, err := s.repository.ListAllergies(ctx, patient.ID)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]AllergyResponse, len(allergies))
+	for i, a := range allergies {
+		res[i] = allergyResponse(a)
+	}
 	return res, nil
 }
+
+func allergyResponse(a Allergy) AllergyResponse {
+	return AllergyResponse{
+		ID:         a.ID,
+		Allergen:   a.Allergen,
+		Reaction:   a.Reaction,
+		RecordedBy: a.RecordedBy,
+		CreatedAt:  a.CreatedAt,
+	}
+}
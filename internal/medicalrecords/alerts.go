@@ -0,0 +1,70 @@
+package medicalrecords
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DeteriorationAlert is published when a new observation set crosses the
+// alert thresholds.
+type DeteriorationAlert struct {
+	RecordID       string
+	PatientID      string
+	IdentityNumber string
+	Ward           *string
+	Score          int
+	Risk           NEWS2Risk
+	MeasuredAt     time.Time
+	RecordedBy     string
+}
+
+type AlertHandler func(ctx context.Context, alert DeteriorationAlert)
+
+// AlertHook fans deterioration alerts out to the subscribed handlers,
+// e.g. a notifier paging the charge nurse. Handlers run in their own
+// goroutine so a slow notifier does not hold up the request.
+type AlertHook struct {
+	mu       sync.RWMutex
+	handlers []AlertHandler
+}
+
+func NewAlertHook() *AlertHook {
+	return &AlertHook{}
+}
+
+func (h *AlertHook) Subscribe(handler AlertHandler) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.handlers = append(h.handlers, handler)
+}
+
+func (h *AlertHook) Publish(ctx context.Context, alert DeteriorationAlert) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	// the request finishes before the handlers do
+	ctx = context.WithoutCancel(ctx)
+	for _, handler := range h.handlers {
+		go func(handler AlertHandler) {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Error().Msg(fmt.Sprintf("Deterioration alert handler panicked: %v", r))
+				}
+			}()
+			handler(ctx, alert)
+		}(handler)
+	}
+}
+
+// LogAlert is an AlertHandler writing alerts to the log.
+func LogAlert(ctx context.Context, alert DeteriorationAlert) {
+	ward := "unassigned"
+	if alert.Ward != nil {
+		ward = *alert.Ward
+	}
+	log.Warn().Msg(fmt.Sprintf("Deterioration alert: patient %s in ward %s scored NEWS2 %d (%s), record %s",
+		alert.IdentityNumber, ward, alert.Score, alert.Risk, alert.RecordID))
+}
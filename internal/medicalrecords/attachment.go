@@ -0,0 +1,60 @@
+package medicalrecords
+
+import (
+	"errors"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+type AttachmentType string
+
+const (
+	AttachmentPhoto       AttachmentType = "photo"
+	AttachmentLabResult   AttachmentType = "lab_result"
+	AttachmentConsentForm AttachmentType = "consent_form"
+	AttachmentECG         AttachmentType = "ecg"
+)
+
+var AttachmentTypes []interface{} = []interface{}{AttachmentPhoto, AttachmentLabResult, AttachmentConsentForm, AttachmentECG}
+
+const maxAttachments = 20
+
+type AttachmentPayload struct {
+	Type     AttachmentType `json:"type"`
+	ImageKey string         `json:"imageKey"`
+	Caption  string         `json:"caption"`
+}
+
+func (p AttachmentPayload) Validate() error {
+	return validation.ValidateStruct(&p,
+		validation.Field(&p.Type, validation.Required, validation.In(AttachmentTypes...)),
+		validation.Field(&p.ImageKey, validation.Required, validation.Length(1, 100)),
+		validation.Field(&p.Caption, validation.Length(0, 200)),
+	)
+}
+
+func uniqueImages(value interface{}) error {
+	attachments, _ := value.([]AttachmentPayload)
+	seen := make(map[string]bool, len(attachments))
+	for _, a := range attachments {
+		if seen[a.ImageKey] {
+			return errors.New("must not attach an image twice")
+		}
+		seen[a.ImageKey] = true
+	}
+	return nil
+}
+
+// Attachment is an image uploaded through the image service and attached
+// to a record. Only the key is stored; URLs expire and are minted for
+// every response.
+type Attachment struct {
+	Type     AttachmentType `json:"type"`
+	ImageKey string         `json:"imageKey"`
+	Caption  *string        `json:"caption,omitempty"`
+}
+
+type AttachmentResponse struct {
+	Attachment
+	URL string `json:"url"`
+}
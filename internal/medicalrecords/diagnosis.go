@@ -0,0 +1,89 @@
+package medicalrecords
+
+import (
+	"errors"
+
+	"github.com/citadel-corp/halosuster/internal/icd10"
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+type DiagnosisType string
+
+const (
+	PrimaryDiagnosis   DiagnosisType = "primary"
+	SecondaryDiagnosis DiagnosisType = "secondary"
+)
+
+var DiagnosisTypes []interface{} = []interface{}{PrimaryDiagnosis, SecondaryDiagnosis}
+
+const maxDiagnoses = 20
+
+// Diagnosis is an ICD-10 coded diagnosis of a record. Chapter is kept
+// with the code so records can be filtered by it.
+type Diagnosis struct {
+	Code    string        `json:"code"`
+	Type    DiagnosisType `json:"type"`
+	Chapter string        `json:"chapter"`
+}
+
+type DiagnosisPayload struct {
+	Code string        `json:"code"`
+	Type DiagnosisType `json:"type"`
+}
+
+func (p DiagnosisPayload) Validate() error {
+	return validation.ValidateStruct(&p,
+		validation.Field(&p.Code, validation.Required, validation.Length(3, 8)),
+		validation.Field(&p.Type, validation.Required, validation.In(DiagnosisTypes...)),
+	)
+}
+
+// validDiagnoses checks a record has exactly one primary diagnosis and no
+// code twice, once it has any.
+func validDiagnoses(value interface{}) error {
+	diagnoses, _ := value.([]DiagnosisPayload)
+	if len(diagnoses) == 0 {
+		return nil
+	}
+	primary := 0
+	seen := make(map[string]bool, len(diagnoses))
+	for _, d := range diagnoses {
+		if d.Type == PrimaryDiagnosis {
+			primary++
+		}
+		code := icd10.Normalize(d.Code)
+		if seen[code] {
+			return errors.New("must not repeat a code")
+		}
+		seen[code] = true
+	}
+	if primary != 1 {
+		return errors.New("must have exactly one primary diagnosis")
+	}
+	return nil
+}
+
+// codeDiagnoses resolves the payload against the catalogue, listing the
+// primary diagnosis first.
+func codeDiagnoses(catalogue icd10.Service, payload []DiagnosisPayload) ([]Diagnosis, error) {
+	res := make([]Diagnosis, 0, len(payload))
+	for _, d := range payload {
+		code, err := catalogue.Lookup(d.Code)
+		if err != nil {
+			return nil, err
+		}
+		diagnosis := Diagnosis{Code: code.Code, Type: d.Type, Chapter: code.Chapter}
+		if d.Type == PrimaryDiagnosis {
+			res = append([]Diagnosis{diagnosis}, res...)
+		} else {
+			res = append(res, diagnosis)
+		}
+	}
+	return res, nil
+}
+
+type DiagnosisResponse struct {
+	Diagnosis
+	DescriptionEN string `json:"descriptionEn,omitempty"`
+	DescriptionID string `json:"descriptionId,omitempty"`
+}
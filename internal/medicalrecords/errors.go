@@ -1,8 +1,40 @@
 package medicalrecords
 
-import "errors"
+import (
+	"errors"
+
+	"github.com/citadel-corp/halosuster/internal/interactions"
+)
 
 var (
-	ErrRecordNotFound       = errors.New("record not found")
-	ErrIdNumberDoesNotExist = errors.New("identity number does not exist")
+	ErrRecordNotFound         = errors.New("record not found")
+	ErrIdNumberDoesNotExist   = errors.New("identity number does not exist")
+	ErrRecordSuperseded       = errors.New("record has already been amended, amend its latest version")
+	ErrRecordLocked           = errors.New("record is locked")
+	ErrNotRecordAuthor        = errors.New("only the author can amend this record")
+	ErrRecordNotPendingReview = errors.New("record is not pending review")
+	ErrSelfReview             = errors.New("a record cannot be reviewed by its author")
+	ErrInvalidDateRange       = errors.New("invalid date range")
+	ErrUnknownDiagnosis       = errors.New("unknown diagnosis code")
+	ErrInvalidPrescription    = errors.New("invalid prescription")
+	ErrSevereInteraction      = errors.New("severe interaction found, an override reason is required")
+	ErrUnknownTemplate        = errors.New("unknown template")
+	ErrInvalidTemplateFields  = errors.New("invalid template fields")
+	ErrInvalidAttachment      = errors.New("invalid attachment")
+	ErrSigningKeyTooShort     = errors.New("record signing key must be at least 32 bytes")
+	ErrUnknownHashFormat      = errors.New("unknown record hash format")
 )
+
+// InteractionError is ErrSevereInteraction with the warnings that have
+// to be overridden.
+type InteractionError struct {
+	Warnings []interactions.Warning
+}
+
+func (e *InteractionError) Error() string {
+	return ErrSevereInteraction.Error()
+}
+
+func (e *InteractionError) Unwrap() error {
+	return ErrSevereInteraction
+}
@@ -5,9 +5,13 @@ import (
 	"log/slog"
 	"net/http"
 
+	"github.com/citadel-corp/halosuster/internal/common/cursor"
 	"github.com/citadel-corp/halosuster/internal/common/middleware"
+	"github.com/citadel-corp/halosuster/internal/common/query"
 	"github.com/citadel-corp/halosuster/internal/common/request"
 	"github.com/citadel-corp/halosuster/internal/common/response"
+	"github.com/citadel-corp/halosuster/internal/medicalpatients"
+	"github.com/gorilla/mux"
 	"github.com/gorilla/schema"
 )
 
@@ -53,7 +57,24 @@ func (h *Handler) CreateMedicalRecord(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.service.CreateMedicalRecord(r.Context(), req)
+	record, err := h.service.CreateMedicalRecord(r.Context(), req)
+	var interactionErr *InteractionError
+	if errors.As(err, &interactionErr) {
+		response.JSON(w, http.StatusConflict, response.ResponseBody{
+			Message: "conflict",
+			Data:    interactionErr.Warnings,
+			Error:   err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, ErrUnknownDiagnosis) || errors.Is(err, ErrInvalidPrescription) ||
+		errors.Is(err, ErrUnknownTemplate) || errors.Is(err, ErrInvalidTemplateFields) || errors.Is(err, ErrInvalidAttachment) {
+		response.JSON(w, http.StatusBadRequest, response.ResponseBody{
+			Message: "Bad request",
+			Error:   err.Error(),
+		})
+		return
+	}
 	if errors.Is(err, ErrIdNumberDoesNotExist) {
 		response.JSON(w, http.StatusNotFound, response.ResponseBody{
 			Message: "not found",
@@ -70,6 +91,126 @@ func (h *Handler) CreateMedicalRecord(w http.ResponseWriter, r *http.Request) {
 	}
 	response.JSON(w, http.StatusCreated, response.ResponseBody{
 		Message: "Record registered successfully",
+		Data:    record,
+	})
+}
+
+func (h *Handler) GetMedicalRecord(w http.ResponseWriter, r *http.Request) {
+	var req GetRecordPayload
+
+	newSchema := schema.NewDecoder()
+	newSchema.IgnoreUnknownKeys(true)
+
+	if err := newSchema.Decode(&req, r.URL.Query()); err != nil {
+		response.JSON(w, http.StatusBadRequest, response.ResponseBody{
+			Message: "Bad request",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	record, err := h.service.GetMedicalRecord(r.Context(), mux.Vars(r)["id"], req)
+	if errors.Is(err, ErrRecordNotFound) {
+		response.JSON(w, http.StatusNotFound, response.ResponseBody{
+			Message: "Not found",
+			Error:   err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		response.JSON(w, http.StatusInternalServerError, response.ResponseBody{
+			Message: "Internal server error",
+			Error:   err.Error(),
+		})
+		return
+	}
+	response.JSON(w, http.StatusOK, response.ResponseBody{
+		Message: "Record fetched successfully",
+		Data:    record,
+	})
+}
+
+func (h *Handler) AmendMedicalRecord(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserID(r)
+	if err != nil {
+		response.JSON(w, http.StatusUnauthorized, response.ResponseBody{
+			Message: "unauthorized",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	var req AmendMedicalRecord
+
+	err = request.DecodeJSON(w, r, &req)
+	if err != nil {
+		response.JSON(w, http.StatusBadRequest, response.ResponseBody{
+			Message: "Failed to decode JSON",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	req.UserId = userId
+
+	err = req.Validate()
+	if err != nil {
+		response.JSON(w, http.StatusBadRequest, response.ResponseBody{
+			Message: "Bad request",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	record, err := h.service.AmendMedicalRecord(r.Context(), mux.Vars(r)["id"], req)
+	var interactionErr *InteractionError
+	if errors.As(err, &interactionErr) {
+		response.JSON(w, http.StatusConflict, response.ResponseBody{
+			Message: "conflict",
+			Data:    interactionErr.Warnings,
+			Error:   err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, ErrUnknownDiagnosis) || errors.Is(err, ErrInvalidPrescription) ||
+		errors.Is(err, ErrUnknownTemplate) || errors.Is(err, ErrInvalidTemplateFields) || errors.Is(err, ErrInvalidAttachment) {
+		response.JSON(w, http.StatusBadRequest, response.ResponseBody{
+			Message: "Bad request",
+			Error:   err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, ErrRecordNotFound) {
+		response.JSON(w, http.StatusNotFound, response.ResponseBody{
+			Message: "Not found",
+			Error:   err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, ErrRecordSuperseded) || errors.Is(err, ErrRecordLocked) {
+		response.JSON(w, http.StatusConflict, response.ResponseBody{
+			Message: "conflict",
+			Error:   err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, ErrNotRecordAuthor) {
+		response.JSON(w, http.StatusForbidden, response.ResponseBody{
+			Message: "forbidden",
+			Error:   err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		response.JSON(w, http.StatusInternalServerError, response.ResponseBody{
+			Message: "Internal server error",
+			Error:   err.Error(),
+		})
+		return
+	}
+	response.JSON(w, http.StatusCreated, response.ResponseBody{
+		Message: "Record amended successfully",
+		Data:    record,
 	})
 }
 
@@ -84,19 +225,76 @@ func (h *Handler) ListMedicalRecords(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if key := r.URL.Query().Get("identityDetail.identityNumber"); key != "" {
-		req.IdentityNumber = key
+	filters, err := query.ParseFilters(r.URL.Query(), listFilterFields)
+	if err != nil {
+		response.JSON(w, http.StatusBadRequest, response.ResponseBody{
+			Message: "Bad request",
+			Error:   err.Error(),
+		})
+		return
+	}
+	req.Filters = filters
+
+	records, meta, err := h.service.ListMedicalRecords(r.Context(), req)
+	if errors.Is(err, query.ErrInvalidSort) || errors.Is(err, cursor.ErrInvalidCursor) || errors.Is(err, ErrInvalidDateRange) {
+		response.JSON(w, http.StatusBadRequest, response.ResponseBody{
+			Message: "Bad request",
+			Error:   err.Error(),
+		})
+		return
 	}
+	if err != nil {
+		response.JSON(w, http.StatusInternalServerError, response.ResponseBody{
+			Message: "Internal server error",
+			Error:   err.Error(),
+		})
+		return
+	}
+	response.JSONWithHeaders(w, http.StatusOK, response.ResponseBody{
+		Message: "Records fetched successfully",
+		Data:    records,
+		Meta:    meta,
+	}, response.PaginationLinks(r, meta))
+}
 
-	if key := r.URL.Query().Get("createdBy.userId"); key != "" {
-		req.UserId = key
+func (h *Handler) ListReviewInbox(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserID(r)
+	if err != nil {
+		response.JSON(w, http.StatusUnauthorized, response.ResponseBody{
+			Message: "unauthorized",
+			Error:   err.Error(),
+		})
+		return
 	}
 
-	if key := r.URL.Query().Get("createdBy.nip"); key != "" {
-		req.NIP = key
+	var req ListRecordsPayload
+
+	newSchema := schema.NewDecoder()
+	newSchema.IgnoreUnknownKeys(true)
+
+	if err := newSchema.Decode(&req, r.URL.Query()); err != nil {
+		response.JSON(w, http.StatusBadRequest, response.ResponseBody{})
+		return
 	}
 
-	records, err := h.service.ListMedicalRecords(r.Context(), req)
+	filters, err := query.ParseFilters(r.URL.Query(), listFilterFields)
+	if err != nil {
+		response.JSON(w, http.StatusBadRequest, response.ResponseBody{
+			Message: "Bad request",
+			Error:   err.Error(),
+		})
+		return
+	}
+	req.Filters = filters
+
+	records, meta, err := h.service.ListReviewInbox(r.Context(), userId, req)
+	if errors.Is(err, query.ErrInvalidSort) || errors.Is(err, cursor.ErrInvalidCursor) || errors.Is(err, ErrInvalidDateRange) {
+		response.JSON(w, http.StatusBadRequest, response.ResponseBody{
+			Message: "Bad request",
+			Error:   err.Error(),
+		})
+		return
+	}
 	if err != nil {
 		response.JSON(w, http.StatusInternalServerError, response.ResponseBody{
 			Message: "Internal server error",
@@ -104,9 +302,169 @@ func (h *Handler) ListMedicalRecords(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
-	response.JSON(w, http.StatusOK, response.ResponseBody{
+	response.JSONWithHeaders(w, http.StatusOK, response.ResponseBody{
 		Message: "Records fetched successfully",
 		Data:    records,
+		Meta:    meta,
+	}, response.PaginationLinks(r, meta))
+}
+
+func (h *Handler) ReviewMedicalRecord(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserID(r)
+	if err != nil {
+		response.JSON(w, http.StatusUnauthorized, response.ResponseBody{
+			Message: "unauthorized",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	var req ReviewMedicalRecord
+
+	err = request.DecodeJSON(w, r, &req)
+	if err != nil {
+		response.JSON(w, http.StatusBadRequest, response.ResponseBody{
+			Message: "Failed to decode JSON",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	req.UserId = userId
+
+	err = req.Validate()
+	if err != nil {
+		response.JSON(w, http.StatusBadRequest, response.ResponseBody{
+			Message: "Bad request",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	record, err := h.service.ReviewMedicalRecord(r.Context(), mux.Vars(r)["id"], req)
+	if errors.Is(err, ErrRecordNotFound) {
+		response.JSON(w, http.StatusNotFound, response.ResponseBody{
+			Message: "Not found",
+			Error:   err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, ErrRecordNotPendingReview) || errors.Is(err, ErrRecordSuperseded) {
+		response.JSON(w, http.StatusConflict, response.ResponseBody{
+			Message: "conflict",
+			Error:   err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, ErrSelfReview) {
+		response.JSON(w, http.StatusForbidden, response.ResponseBody{
+			Message: "forbidden",
+			Error:   err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		response.JSON(w, http.StatusInternalServerError, response.ResponseBody{
+			Message: "Internal server error",
+			Error:   err.Error(),
+		})
+		return
+	}
+	response.JSON(w, http.StatusOK, response.ResponseBody{
+		Message: "Record reviewed successfully",
+		Data:    record,
+	})
+}
+
+func (h *Handler) VerifyChain(w http.ResponseWriter, r *http.Request) {
+	report, err := h.service.VerifyChain(r.Context(), mux.Vars(r)["identityNumber"])
+	if errors.Is(err, medicalpatients.ErrPatientNotFound) {
+		response.JSON(w, http.StatusNotFound, response.ResponseBody{
+			Message: "Not found",
+			Error:   err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		response.JSON(w, http.StatusInternalServerError, response.ResponseBody{
+			Message: "Internal server error",
+			Error:   err.Error(),
+		})
+		return
+	}
+	response.JSON(w, http.StatusOK, response.ResponseBody{
+		Message: "Chain verified",
+		Data:    report,
+	})
+}
+
+func (h *Handler) GetVitalsTrend(w http.ResponseWriter, r *http.Request) {
+	var req VitalsTrendPayload
+
+	newSchema := schema.NewDecoder()
+	newSchema.IgnoreUnknownKeys(true)
+
+	if err := newSchema.Decode(&req, r.URL.Query()); err != nil {
+		response.JSON(w, http.StatusBadRequest, response.ResponseBody{
+			Message: "Bad request",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	trend, err := h.service.GetVitalsTrend(r.Context(), mux.Vars(r)["identityNumber"], req)
+	if errors.Is(err, ErrInvalidDateRange) {
+		response.JSON(w, http.StatusBadRequest, response.ResponseBody{
+			Message: "Bad request",
+			Error:   err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, medicalpatients.ErrPatientNotFound) {
+		response.JSON(w, http.StatusNotFound, response.ResponseBody{
+			Message: "Not found",
+			Error:   err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		response.JSON(w, http.StatusInternalServerError, response.ResponseBody{
+			Message: "Internal server error",
+			Error:   err.Error(),
+		})
+		return
+	}
+	response.JSON(w, http.StatusOK, response.ResponseBody{
+		Message: "Vitals fetched successfully",
+		Data:    trend,
+	})
+}
+
+func (h *Handler) ListDeteriorating(w http.ResponseWriter, r *http.Request) {
+	var req DeterioratingPayload
+
+	newSchema := schema.NewDecoder()
+	newSchema.IgnoreUnknownKeys(true)
+
+	if err := newSchema.Decode(&req, r.URL.Query()); err != nil {
+		response.JSON(w, http.StatusBadRequest, response.ResponseBody{
+			Message: "Bad request",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	wards, err := h.service.ListDeteriorating(r.Context(), req)
+	if err != nil {
+		response.JSON(w, http.StatusInternalServerError, response.ResponseBody{
+			Message: "Internal server error",
+			Error:   err.Error(),
+		})
+		return
+	}
+	response.JSON(w, http.StatusOK, response.ResponseBody{
+		Message: "success",
+		Data:    wards,
 	})
 }
 
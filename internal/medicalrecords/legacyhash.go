@@ -0,0 +1,146 @@
+package medicalrecords
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// jsonContent is the content of records signed in HashFormatJSON. The
+// structs below are copies of what was marshalled when those records
+// were signed; they must not change, or the records no longer verify.
+func jsonContent(prevHash string, r *MedicalRecords) ([]byte, error) {
+	fields := []any{
+		prevHash,
+		r.ID,
+		r.PatientId,
+		r.UserID,
+		r.OriginalID,
+		r.Version,
+		r.AmendsID,
+		r.AmendReason,
+		r.Symptoms,
+		r.Medications,
+		r.CreatedAt.UTC().Format(time.RFC3339Nano),
+	}
+	// the optional parts were only part of the content when present
+	if v := r.Vitals; v != nil {
+		fields = append(fields, jsonVitals{
+			MeasuredAt:         v.MeasuredAt.UTC(),
+			TemperatureC:       v.TemperatureC,
+			SystolicMmHg:       v.SystolicMmHg,
+			DiastolicMmHg:      v.DiastolicMmHg,
+			HeartRateBpm:       v.HeartRateBpm,
+			RespiratoryRate:    v.RespiratoryRate,
+			SpO2Pct:            v.SpO2Pct,
+			WeightKg:           v.WeightKg,
+			HeightCm:           v.HeightCm,
+			PainScore:          v.PainScore,
+			Ward:               v.Ward,
+			SpO2Scale:          v.SpO2Scale,
+			SupplementalOxygen: v.SupplementalOxygen,
+			Consciousness:      (*string)(v.Consciousness),
+			NEWS2Score:         v.NEWS2Score,
+			NEWS2Risk:          (*string)(v.NEWS2Risk),
+			NEWS2Alert:         v.NEWS2Alert,
+		})
+	}
+	if len(r.Diagnoses) > 0 {
+		diagnoses := make([]jsonDiagnosis, len(r.Diagnoses))
+		for i, d := range r.Diagnoses {
+			diagnoses[i] = jsonDiagnosis{Code: d.Code, Type: string(d.Type), Chapter: d.Chapter}
+		}
+		fields = append(fields, diagnoses)
+	}
+	if len(r.Prescriptions) > 0 {
+		prescriptions := make([]jsonPrescription, len(r.Prescriptions))
+		for i, p := range r.Prescriptions {
+			prescriptions[i] = jsonPrescription{
+				DrugID:       p.DrugID,
+				GenericName:  p.GenericName,
+				Form:         p.Form,
+				Strength:     p.Strength,
+				Dose:         p.Dose,
+				Unit:         p.Unit,
+				Route:        p.Route,
+				Frequency:    p.Frequency,
+				TimesPerDay:  p.TimesPerDay,
+				DurationDays: p.DurationDays,
+			}
+		}
+		fields = append(fields, map[string]any{"prescriptions": prescriptions})
+	}
+	if len(r.InteractionWarnings) > 0 {
+		warnings := make([]jsonWarning, len(r.InteractionWarnings))
+		for i, w := range r.InteractionWarnings {
+			warnings[i] = jsonWarning{Kind: string(w.Kind), Severity: string(w.Severity), Drug: w.Drug, With: w.With, Description: w.Description}
+		}
+		fields = append(fields, map[string]any{
+			"interactionWarnings":       warnings,
+			"interactionOverrideReason": r.InteractionOverrideReason,
+		})
+	}
+	if r.TemplateID != nil {
+		fields = append(fields, map[string]any{"templateId": r.TemplateID, "templateFields": r.TemplateFields})
+	}
+	if len(r.Attachments) > 0 {
+		attachments := make([]jsonAttachment, len(r.Attachments))
+		for i, a := range r.Attachments {
+			attachments[i] = jsonAttachment{Type: string(a.Type), ImageKey: a.ImageKey, Caption: a.Caption}
+		}
+		fields = append(fields, map[string]any{"attachments": attachments})
+	}
+	return json.Marshal(fields)
+}
+
+type jsonVitals struct {
+	MeasuredAt         time.Time `json:"measuredAt"`
+	TemperatureC       *float64  `json:"temperatureC"`
+	SystolicMmHg       *int      `json:"systolicMmHg"`
+	DiastolicMmHg      *int      `json:"diastolicMmHg"`
+	HeartRateBpm       *int      `json:"heartRateBpm"`
+	RespiratoryRate    *int      `json:"respiratoryRate"`
+	SpO2Pct            *int      `json:"spo2Pct"`
+	WeightKg           *float64  `json:"weightKg"`
+	HeightCm           *float64  `json:"heightCm"`
+	PainScore          *int      `json:"painScore"`
+	Ward               *string   `json:"ward,omitempty"`
+	SpO2Scale          *int      `json:"spo2Scale,omitempty"`
+	SupplementalOxygen *bool     `json:"supplementalOxygen,omitempty"`
+	Consciousness      *string   `json:"consciousness,omitempty"`
+	NEWS2Score         *int      `json:"news2Score,omitempty"`
+	NEWS2Risk          *string   `json:"news2Risk,omitempty"`
+	NEWS2Alert         bool      `json:"news2Alert,omitempty"`
+}
+
+type jsonDiagnosis struct {
+	Code    string `json:"code"`
+	Type    string `json:"type"`
+	Chapter string `json:"chapter"`
+}
+
+type jsonPrescription struct {
+	DrugID       string   `json:"drugId"`
+	GenericName  string   `json:"genericName"`
+	Form         string   `json:"form"`
+	Strength     *string  `json:"strength,omitempty"`
+	Dose         float64  `json:"dose"`
+	Unit         string   `json:"unit"`
+	Route        string   `json:"route"`
+	Frequency    string   `json:"frequency"`
+	TimesPerDay  *float64 `json:"timesPerDay,omitempty"`
+	DurationDays *int     `json:"durationDays,omitempty"`
+}
+
+type jsonWarning struct {
+	Kind        string `json:"kind"`
+	Severity    string `json:"severity"`
+	Drug        string `json:"drug"`
+	With        string `json:"with"`
+	Description string `json:"description"`
+}
+
+type jsonAttachment struct {
+	Type     string  `json:"type"`
+	ImageKey string  `json:"imageKey"`
+	Caption  *string `json:"caption,omitempty"`
+}
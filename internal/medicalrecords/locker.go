@@ -0,0 +1,30 @@
+package medicalrecords
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// RunLocker locks and signs records whose grace period has passed,
+// checking every interval until ctx is cancelled.
+func RunLocker(ctx context.Context, service Service, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		n, err := service.LockDueRecords(ctx)
+		if err != nil {
+			log.Error().Msg(fmt.Sprintf("Locking medical records failed: %v", err))
+		} else if n > 0 {
+			log.Info().Msg(fmt.Sprintf("Locked %d medical records", n))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
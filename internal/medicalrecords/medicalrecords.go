@@ -1,12 +1,91 @@
 package medicalrecords
 
-import "time"
+import (
+	"strings"
+	"time"
 
+	"github.com/citadel-corp/halosuster/internal/interactions"
+)
+
+type ReviewStatus string
+
+const (
+	ReviewNotRequired ReviewStatus = "not_required"
+	ReviewPending     ReviewStatus = "pending_review"
+	ReviewApproved    ReviewStatus = "approved"
+	ReviewRejected    ReviewStatus = "rejected"
+)
+
+var ReviewStatuses []interface{} = []interface{}{ReviewNotRequired, ReviewPending, ReviewApproved, ReviewRejected}
+
+type ReviewDecision string
+
+const (
+	Approve ReviewDecision = "approve"
+	Reject  ReviewDecision = "reject"
+)
+
+var ReviewDecisions []interface{} = []interface{}{Approve, Reject}
+
+// noMedications are the ways nurses write that nothing was prescribed.
+var noMedications = []string{"", "-", "none", "n/a", "tidak ada"}
+
+// requiresCoSignature reports whether a record has to be approved by a
+// second user before it can be locked. Anything prescribing medication does.
+func requiresCoSignature(medications string) bool {
+	m := strings.ToLower(strings.TrimSpace(medications))
+	for _, none := range noMedications {
+		if m == none {
+			return false
+		}
+	}
+	return true
+}
+
+// MedicalRecords is one version of a record. Clinical content is never
+// updated; an amendment is a new row with AmendsID pointing at the version
+// it replaces and OriginalID shared by every version. Once LockAt passes
+// the row is signed into the patient's hash chain and frozen.
 type MedicalRecords struct {
 	ID          string
 	UserID      string
 	PatientId   string
 	Symptoms    string
 	Medications string
+	OriginalID  string
+	Version     int
+	AmendsID    *string
+	AmendReason *string
 	CreatedAt   time.Time
+	Vitals      *Vitals
+	Diagnoses   []Diagnosis
+	// Prescriptions are rendered into Medications, which old clients read.
+	Prescriptions []Prescription
+	Attachments   []Attachment
+	// InteractionWarnings are what the prescriptions were checked to
+	// interact with; a severe one is only saved with an override reason.
+	InteractionWarnings       []interactions.Warning
+	InteractionOverrideReason *string
+	// TemplateFields are the structured values asked for by the template
+	// the record was written with.
+	TemplateID     *string
+	TemplateFields map[string]any
+
+	// LockAfter is the grace period used to set LockAt when the record is
+	// created. Amendments inherit LockAt from the version they amend.
+	LockAfter   time.Duration
+	LockAt      time.Time
+	Locked      bool
+	LockedAt    *time.Time
+	ChainSeq    *int64
+	PrevHash    *string
+	ContentHash *string
+	// HashFormat is how the content was hashed when it was signed.
+	HashFormat *int
+	Signature  *string
+
+	ReviewStatus  ReviewStatus
+	ReviewedBy    *string
+	ReviewedAt    *time.Time
+	ReviewComment *string
 }
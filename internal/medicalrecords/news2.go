@@ -0,0 +1,207 @@
+package medicalrecords
+
+import "time"
+
+// Consciousness is the ACVPU scale: alert, new confusion, responds to
+// voice, responds to pain, unresponsive.
+type Consciousness string
+
+const (
+	Alert        Consciousness = "A"
+	NewConfusion Consciousness = "C"
+	Voice        Consciousness = "V"
+	Pain         Consciousness = "P"
+	Unresponsive Consciousness = "U"
+)
+
+var ConsciousnessLevels []interface{} = []interface{}{Alert, NewConfusion, Voice, Pain, Unresponsive}
+
+// SpO2Scale2 is used instead of SpO2Scale1 for patients with hypercapnic
+// respiratory failure, whose target saturation is 88-92%.
+const (
+	SpO2Scale1 = 1
+	SpO2Scale2 = 2
+)
+
+var SpO2Scales []interface{} = []interface{}{SpO2Scale1, SpO2Scale2}
+
+type NEWS2Risk string
+
+const (
+	RiskLow       NEWS2Risk = "low"
+	RiskLowMedium NEWS2Risk = "low_medium"
+	RiskMedium    NEWS2Risk = "medium"
+	RiskHigh      NEWS2Risk = "high"
+)
+
+// AlertThresholds decide when an observation set flags its record as
+// deteriorating: an aggregate score of at least Score, or any single
+// parameter scoring at least ParameterScore.
+type AlertThresholds struct {
+	Score          int
+	ParameterScore int
+	// Window is how long an alert stands; a patient not observed since
+	// is no longer listed as deteriorating.
+	Window time.Duration
+}
+
+// DefaultAlertThresholds match the NEWS2 trigger for an urgent response:
+// an aggregate of 5 or a red score of 3 in one parameter. Observations
+// are due at least every 12 hours, so an alert older than a day is stale.
+var DefaultAlertThresholds = AlertThresholds{Score: 5, ParameterScore: 3, Window: 24 * time.Hour}
+
+// news2 scores v with the National Early Warning Score 2. It reports false
+// when the set lacks one of the parameters the score needs.
+func (v *Vitals) news2() (score int, maxParameter int, ok bool) {
+	if v.RespiratoryRate == nil || v.SpO2Pct == nil || v.SupplementalOxygen == nil || v.SystolicMmHg == nil ||
+		v.HeartRateBpm == nil || v.Consciousness == nil || v.TemperatureC == nil {
+		return 0, 0, false
+	}
+	scale := SpO2Scale1
+	if v.SpO2Scale != nil {
+		scale = *v.SpO2Scale
+	}
+	parameters := []int{
+		respiratoryRateScore(*v.RespiratoryRate),
+		spo2Score(*v.SpO2Pct, scale, *v.SupplementalOxygen),
+		supplementalOxygenScore(*v.SupplementalOxygen),
+		systolicScore(*v.SystolicMmHg),
+		heartRateScore(*v.HeartRateBpm),
+		consciousnessScore(*v.Consciousness),
+		temperatureScore(*v.TemperatureC),
+	}
+	for _, p := range parameters {
+		score += p
+		maxParameter = max(maxParameter, p)
+	}
+	return score, maxParameter, true
+}
+
+// scoreNEWS2 stores the score, clinical risk and alert flag on v.
+func (v *Vitals) scoreNEWS2(thresholds AlertThresholds) {
+	score, maxParameter, ok := v.news2()
+	if !ok {
+		v.NEWS2Score, v.NEWS2Risk, v.NEWS2Alert = nil, nil, false
+		return
+	}
+	var risk NEWS2Risk
+	switch {
+	case score >= 7:
+		risk = RiskHigh
+	case score >= 5:
+		risk = RiskMedium
+	case maxParameter >= 3:
+		risk = RiskLowMedium
+	default:
+		risk = RiskLow
+	}
+	v.NEWS2Score, v.NEWS2Risk = &score, &risk
+	v.NEWS2Alert = score >= thresholds.Score || maxParameter >= thresholds.ParameterScore
+}
+
+func respiratoryRateScore(rr int) int {
+	switch {
+	case rr <= 8:
+		return 3
+	case rr <= 11:
+		return 1
+	case rr <= 20:
+		return 0
+	case rr <= 24:
+		return 2
+	default:
+		return 3
+	}
+}
+
+func spo2Score(spo2, scale int, oxygen bool) int {
+	if scale == SpO2Scale2 {
+		switch {
+		case spo2 <= 83:
+			return 3
+		case spo2 <= 85:
+			return 2
+		case spo2 <= 87:
+			return 1
+		case spo2 <= 92 || !oxygen:
+			return 0
+		case spo2 <= 94:
+			return 1
+		case spo2 <= 96:
+			return 2
+		default:
+			return 3
+		}
+	}
+	switch {
+	case spo2 <= 91:
+		return 3
+	case spo2 <= 93:
+		return 2
+	case spo2 <= 95:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func supplementalOxygenScore(oxygen bool) int {
+	if oxygen {
+		return 2
+	}
+	return 0
+}
+
+func systolicScore(systolic int) int {
+	switch {
+	case systolic <= 90:
+		return 3
+	case systolic <= 100:
+		return 2
+	case systolic <= 110:
+		return 1
+	case systolic <= 219:
+		return 0
+	default:
+		return 3
+	}
+}
+
+func heartRateScore(hr int) int {
+	switch {
+	case hr <= 40:
+		return 3
+	case hr <= 50:
+		return 1
+	case hr <= 90:
+		return 0
+	case hr <= 110:
+		return 1
+	case hr <= 130:
+		return 2
+	default:
+		return 3
+	}
+}
+
+func consciousnessScore(c Consciousness) int {
+	if c == Alert {
+		return 0
+	}
+	return 3
+}
+
+func temperatureScore(t float64) int {
+	switch {
+	case t <= 35.0:
+		return 3
+	case t <= 36.0:
+		return 1
+	case t <= 38.0:
+		return 0
+	case t <= 39.0:
+		return 1
+	default:
+		return 2
+	}
+}
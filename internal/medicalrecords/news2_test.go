@@ -0,0 +1,210 @@
+package medicalrecords
+
+import "testing"
+
+// The bands are those of the NEWS2 chart, tested at both edges.
+
+func TestRespiratoryRateScore(t *testing.T) {
+	tests := []struct {
+		rr   int
+		want int
+	}{
+		{rr: 4, want: 3}, {rr: 8, want: 3},
+		{rr: 9, want: 1}, {rr: 11, want: 1},
+		{rr: 12, want: 0}, {rr: 20, want: 0},
+		{rr: 21, want: 2}, {rr: 24, want: 2},
+		{rr: 25, want: 3}, {rr: 40, want: 3},
+	}
+	for _, tt := range tests {
+		if got := respiratoryRateScore(tt.rr); got != tt.want {
+			t.Errorf("respiratoryRateScore(%d) = %d, want %d", tt.rr, got, tt.want)
+		}
+	}
+}
+
+func TestSpO2Score(t *testing.T) {
+	tests := []struct {
+		spo2   int
+		scale  int
+		oxygen bool
+		want   int
+	}{
+		{spo2: 91, scale: SpO2Scale1, want: 3},
+		{spo2: 92, scale: SpO2Scale1, want: 2}, {spo2: 93, scale: SpO2Scale1, want: 2},
+		{spo2: 94, scale: SpO2Scale1, want: 1}, {spo2: 95, scale: SpO2Scale1, want: 1},
+		{spo2: 96, scale: SpO2Scale1, want: 0}, {spo2: 100, scale: SpO2Scale1, oxygen: true, want: 0},
+
+		// scale 2 targets 88-92%; above it only oxygen is penalised
+		{spo2: 83, scale: SpO2Scale2, want: 3},
+		{spo2: 84, scale: SpO2Scale2, want: 2}, {spo2: 85, scale: SpO2Scale2, want: 2},
+		{spo2: 86, scale: SpO2Scale2, want: 1}, {spo2: 87, scale: SpO2Scale2, want: 1},
+		{spo2: 88, scale: SpO2Scale2, want: 0}, {spo2: 92, scale: SpO2Scale2, oxygen: true, want: 0},
+		{spo2: 93, scale: SpO2Scale2, want: 0}, {spo2: 100, scale: SpO2Scale2, want: 0},
+		{spo2: 93, scale: SpO2Scale2, oxygen: true, want: 1}, {spo2: 94, scale: SpO2Scale2, oxygen: true, want: 1},
+		{spo2: 95, scale: SpO2Scale2, oxygen: true, want: 2}, {spo2: 96, scale: SpO2Scale2, oxygen: true, want: 2},
+		{spo2: 97, scale: SpO2Scale2, oxygen: true, want: 3}, {spo2: 100, scale: SpO2Scale2, oxygen: true, want: 3},
+	}
+	for _, tt := range tests {
+		if got := spo2Score(tt.spo2, tt.scale, tt.oxygen); got != tt.want {
+			t.Errorf("spo2Score(%d, scale %d, oxygen %v) = %d, want %d", tt.spo2, tt.scale, tt.oxygen, got, tt.want)
+		}
+	}
+}
+
+func TestSystolicScore(t *testing.T) {
+	tests := []struct {
+		systolic int
+		want     int
+	}{
+		{systolic: 70, want: 3}, {systolic: 90, want: 3},
+		{systolic: 91, want: 2}, {systolic: 100, want: 2},
+		{systolic: 101, want: 1}, {systolic: 110, want: 1},
+		{systolic: 111, want: 0}, {systolic: 219, want: 0},
+		{systolic: 220, want: 3},
+	}
+	for _, tt := range tests {
+		if got := systolicScore(tt.systolic); got != tt.want {
+			t.Errorf("systolicScore(%d) = %d, want %d", tt.systolic, got, tt.want)
+		}
+	}
+}
+
+func TestHeartRateScore(t *testing.T) {
+	tests := []struct {
+		hr   int
+		want int
+	}{
+		{hr: 30, want: 3}, {hr: 40, want: 3},
+		{hr: 41, want: 1}, {hr: 50, want: 1},
+		{hr: 51, want: 0}, {hr: 90, want: 0},
+		{hr: 91, want: 1}, {hr: 110, want: 1},
+		{hr: 111, want: 2}, {hr: 130, want: 2},
+		{hr: 131, want: 3},
+	}
+	for _, tt := range tests {
+		if got := heartRateScore(tt.hr); got != tt.want {
+			t.Errorf("heartRateScore(%d) = %d, want %d", tt.hr, got, tt.want)
+		}
+	}
+}
+
+func TestTemperatureScore(t *testing.T) {
+	tests := []struct {
+		temperature float64
+		want        int
+	}{
+		{temperature: 34.0, want: 3}, {temperature: 35.0, want: 3},
+		{temperature: 35.1, want: 1}, {temperature: 36.0, want: 1},
+		{temperature: 36.1, want: 0}, {temperature: 38.0, want: 0},
+		{temperature: 38.1, want: 1}, {temperature: 39.0, want: 1},
+		{temperature: 39.1, want: 2}, {temperature: 41.0, want: 2},
+	}
+	for _, tt := range tests {
+		if got := temperatureScore(tt.temperature); got != tt.want {
+			t.Errorf("temperatureScore(%v) = %d, want %d", tt.temperature, got, tt.want)
+		}
+	}
+}
+
+func TestConsciousnessScore(t *testing.T) {
+	for _, c := range ConsciousnessLevels {
+		want := 3
+		if c == Alert {
+			want = 0
+		}
+		if got := consciousnessScore(c.(Consciousness)); got != want {
+			t.Errorf("consciousnessScore(%s) = %d, want %d", c, got, want)
+		}
+	}
+}
+
+func TestScoreNEWS2(t *testing.T) {
+	// normal scores 0 in every parameter
+	normal := func() Vitals {
+		rr, spo2, systolic, hr, temperature := 16, 98, 120, 70, 37.0
+		oxygen, consciousness := false, Alert
+		return Vitals{RespiratoryRate: &rr, SpO2Pct: &spo2, SupplementalOxygen: &oxygen, SystolicMmHg: &systolic,
+			HeartRateBpm: &hr, Consciousness: &consciousness, TemperatureC: &temperature}
+	}
+	tests := []struct {
+		name      string
+		change    func(v *Vitals)
+		wantScore *int
+		wantRisk  NEWS2Risk
+		wantAlert bool
+	}{
+		{name: "normal", change: func(v *Vitals) {}, wantScore: ptr(0), wantRisk: RiskLow},
+		{
+			name:      "incomplete",
+			change:    func(v *Vitals) { v.Consciousness = nil },
+			wantScore: nil,
+		},
+		{
+			name:      "single red parameter",
+			change:    func(v *Vitals) { *v.Consciousness = NewConfusion },
+			wantScore: ptr(3), wantRisk: RiskLowMedium, wantAlert: true,
+		},
+		{
+			name: "low aggregate",
+			change: func(v *Vitals) {
+				*v.RespiratoryRate, *v.HeartRateBpm, *v.TemperatureC = 22, 100, 38.5
+			},
+			wantScore: ptr(4), wantRisk: RiskLow,
+		},
+		{
+			name: "medium on oxygen",
+			change: func(v *Vitals) {
+				*v.RespiratoryRate, *v.HeartRateBpm, *v.SupplementalOxygen = 22, 100, true
+			},
+			wantScore: ptr(5), wantRisk: RiskMedium, wantAlert: true,
+		},
+		{
+			name: "high",
+			change: func(v *Vitals) {
+				*v.RespiratoryRate, *v.SpO2Pct, *v.SystolicMmHg, *v.HeartRateBpm = 25, 93, 105, 115
+			},
+			wantScore: ptr(3 + 2 + 1 + 2), wantRisk: RiskHigh, wantAlert: true,
+		},
+		{
+			name: "scale 2 in target range",
+			change: func(v *Vitals) {
+				*v.SpO2Pct = 89
+				v.SpO2Scale = ptr(SpO2Scale2)
+			},
+			wantScore: ptr(0), wantRisk: RiskLow,
+		},
+		{
+			name: "scale 1 at the same saturation",
+			change: func(v *Vitals) {
+				*v.SpO2Pct = 89
+			},
+			wantScore: ptr(3), wantRisk: RiskLowMedium, wantAlert: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := normal()
+			tt.change(&v)
+			v.scoreNEWS2(DefaultAlertThresholds)
+			if tt.wantScore == nil {
+				if v.NEWS2Score != nil || v.NEWS2Risk != nil || v.NEWS2Alert {
+					t.Errorf("scoreNEWS2() scored an incomplete set")
+				}
+				return
+			}
+			if v.NEWS2Score == nil || *v.NEWS2Score != *tt.wantScore {
+				t.Fatalf("scoreNEWS2() score = %v, want %d", v.NEWS2Score, *tt.wantScore)
+			}
+			if *v.NEWS2Risk != tt.wantRisk {
+				t.Errorf("scoreNEWS2() risk = %s, want %s", *v.NEWS2Risk, tt.wantRisk)
+			}
+			if v.NEWS2Alert != tt.wantAlert {
+				t.Errorf("scoreNEWS2() alert = %v, want %v", v.NEWS2Alert, tt.wantAlert)
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
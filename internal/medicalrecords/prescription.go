@@ -0,0 +1,199 @@
+package medicalrecords
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+const maxPrescriptions = 20
+
+type PrescriptionPayload struct {
+	DrugID    string `json:"drugId"`
+	Strength  string `json:"strength"`
+	Dose      string `json:"dose"`
+	Unit      string `json:"unit"`
+	Route     string `json:"route"`
+	Frequency string `json:"frequency"`
+	Duration  string `json:"duration"`
+}
+
+func (p PrescriptionPayload) Validate() error {
+	freq, freqErr := parseFrequency(p.Frequency)
+	return validation.ValidateStruct(&p,
+		validation.Field(&p.DrugID, validation.Required),
+		validation.Field(&p.Strength, validation.Length(0, 30)),
+		validation.Field(&p.Dose, validation.Required, validation.By(func(interface{}) error {
+			_, err := parseDose(p.Dose)
+			return err
+		})),
+		validation.Field(&p.Unit, validation.Required, validation.Length(1, 10)),
+		validation.Field(&p.Route, validation.Required, validation.Length(1, 30)),
+		validation.Field(&p.Frequency, validation.Required, validation.By(func(interface{}) error {
+			return freqErr
+		})),
+		validation.Field(&p.Duration, validation.When(freqErr == nil && !freq.once, validation.Required), validation.By(func(interface{}) error {
+			if p.Duration == "" {
+				return nil
+			}
+			_, err := parseDuration(p.Duration)
+			return err
+		})),
+	)
+}
+
+// Prescription is one prescription line as stored. The drug's name and
+// form are copied from the catalogue so the line reads the same after
+// the catalogue changes; Dose is in the catalogue's dose unit.
+type Prescription struct {
+	DrugID       string   `json:"drugId"`
+	GenericName  string   `json:"genericName"`
+	Form         string   `json:"form"`
+	Strength     *string  `json:"strength,omitempty"`
+	Dose         float64  `json:"dose"`
+	Unit         string   `json:"unit"`
+	Route        string   `json:"route"`
+	Frequency    string   `json:"frequency"`
+	TimesPerDay  *float64 `json:"timesPerDay,omitempty"`
+	DurationDays *int     `json:"durationDays,omitempty"`
+}
+
+// parseDose reads doses as nurses write them: 500, 0.5, 0,5 or 1/2.
+func parseDose(s string) (float64, error) {
+	s = strings.ReplaceAll(strings.TrimSpace(s), ",", ".")
+	var dose float64
+	var err error
+	if num, den, ok := strings.Cut(s, "/"); ok {
+		var n, d float64
+		n, err = strconv.ParseFloat(strings.TrimSpace(num), 64)
+		if err == nil {
+			d, err = strconv.ParseFloat(strings.TrimSpace(den), 64)
+		}
+		if err == nil && d == 0 {
+			err = errors.New("division by zero")
+		}
+		dose = n / d
+	} else {
+		dose, err = strconv.ParseFloat(s, 64)
+	}
+	if err != nil || dose <= 0 || math.IsInf(dose, 0) || math.IsNaN(dose) {
+		return 0, errors.New("must be a positive number or fraction")
+	}
+	return dose, nil
+}
+
+type frequency struct {
+	label       string
+	timesPerDay *float64
+	once        bool
+}
+
+var (
+	timesDailyPattern = regexp.MustCompile(`^(\d+)\s*x\s*(\d+([.,/]\d+)?)?\s*(daily|a day|sehari)?$`)
+	intervalPattern   = regexp.MustCompile(`^(?:q\s*(\d+)\s*h|every (\d+) hours?|tiap (\d+) jam)$`)
+	frequencyAliases  = map[string]int{
+		"od": 1, "qd": 1, "once daily": 1,
+		"bid": 2, "twice daily": 2,
+		"tid": 3,
+		"qid": 4,
+	}
+	asNeeded = []string{"prn", "as needed", "bila perlu"}
+)
+
+// parseFrequency understands Latin abbreviations (bid, q8h), the
+// Indonesian "3x1" notation and plain English or Indonesian phrases.
+func parseFrequency(s string) (frequency, error) {
+	s = strings.ToLower(strings.Join(strings.Fields(s), " "))
+	perDay := func(n float64) frequency {
+		label := fmt.Sprintf("%gx daily", n)
+		if n == 1 {
+			label = "once daily"
+		}
+		return frequency{label: label, timesPerDay: &n}
+	}
+	if n, ok := frequencyAliases[s]; ok {
+		return perDay(float64(n)), nil
+	}
+	for _, alias := range asNeeded {
+		if s == alias {
+			return frequency{label: "as needed"}, nil
+		}
+	}
+	if s == "stat" || s == "once" {
+		n := 1.0
+		return frequency{label: "once", timesPerDay: &n, once: true}, nil
+	}
+	if m := timesDailyPattern.FindStringSubmatch(s); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		if n >= 1 && n <= 24 {
+			return perDay(float64(n)), nil
+		}
+	}
+	if m := intervalPattern.FindStringSubmatch(s); m != nil {
+		hours, _ := strconv.Atoi(m[1] + m[2] + m[3])
+		if hours >= 1 && hours <= 72 {
+			n := 24 / float64(hours)
+			return frequency{label: fmt.Sprintf("every %d hours", hours), timesPerDay: &n}, nil
+		}
+	}
+	return frequency{}, errors.New("must be like 3x1, tid, q8h, every 8 hours or prn")
+}
+
+var durationPattern = regexp.MustCompile(`^(\d+)\s*(d|days?|hari|w|weeks?|minggu|months?|bulan)?$`)
+
+// parseDuration returns the length of a course in days; a bare number
+// is days.
+func parseDuration(s string) (int, error) {
+	m := durationPattern.FindStringSubmatch(strings.ToLower(strings.TrimSpace(s)))
+	if m == nil {
+		return 0, errors.New("must be like 5 days, 2 weeks or 1 month")
+	}
+	n, _ := strconv.Atoi(m[1])
+	switch m[2] {
+	case "w", "week", "weeks", "minggu":
+		n *= 7
+	case "month", "months", "bulan":
+		n *= 30
+	}
+	if n < 1 || n > 365 {
+		return 0, errors.New("must be between 1 day and 1 year")
+	}
+	return n, nil
+}
+
+// render writes the line the way it used to be typed into the free-text
+// medications field.
+func (p Prescription) render() string {
+	var sb strings.Builder
+	sb.WriteString(p.GenericName)
+	if p.Strength != nil {
+		sb.WriteString(" " + *p.Strength)
+	}
+	fmt.Fprintf(&sb, " %s, %g %s %s, %s", p.Form, p.Dose, p.Unit, p.Route, p.Frequency)
+	if p.DurationDays != nil {
+		days := "days"
+		if *p.DurationDays == 1 {
+			days = "day"
+		}
+		fmt.Fprintf(&sb, " for %d %s", *p.DurationDays, days)
+	}
+	return sb.String()
+}
+
+// renderMedications fills the legacy medications field from the
+// prescription lines, followed by any free-text notes.
+func renderMedications(prescriptions []Prescription, notes string) string {
+	lines := make([]string, 0, len(prescriptions)+1)
+	for _, p := range prescriptions {
+		lines = append(lines, p.render())
+	}
+	if notes = strings.TrimSpace(notes); notes != "" {
+		lines = append(lines, notes)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -2,108 +2,708 @@ package medicalrecords
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/citadel-corp/halosuster/internal/common/db"
+	"github.com/citadel-corp/halosuster/internal/common/query"
+	"github.com/citadel-corp/halosuster/internal/common/response"
 	"github.com/citadel-corp/halosuster/internal/medicalpatients"
 	"github.com/citadel-corp/halosuster/internal/user"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
 type Repository interface {
 	Create(ctx context.Context, medicalrecord *MedicalRecords) error
-	List(ctx context.Context, req ListRecordsPayload) ([]ListMedicalRecordsResponse, error)
+	GetByID(ctx context.Context, id string) (*MedicalRecords, error)
+	GetResponseByID(ctx context.Context, id string) (*ListMedicalRecordsResponse, error)
+	ListVersions(ctx context.Context, originalID string) ([]ListMedicalRecordsResponse, error)
+	List(ctx context.Context, req ListRecordsPayload) ([]ListMedicalRecordsResponse, *response.Pagination, error)
+	ListPatientsWithDueRecords(ctx context.Context) ([]string, error)
+	LockDueRecords(ctx context.Context, patientID string) (int, error)
+	ListChain(ctx context.Context, patientID string) ([]MedicalRecords, error)
+	Review(ctx context.Context, id string, status ReviewStatus, reviewerID string, comment *string) error
+	ListVitals(ctx context.Context, patientID string, from, to time.Time, limit int) ([]VitalsTrendPoint, error)
+	ListDeteriorating(ctx context.Context, ward string, since time.Time) ([]DeterioratingPatient, error)
+	ListActiveDrugs(ctx context.Context, patientID string, excludeOriginalID string) ([]string, error)
+}
+
+var listFilterFields = []query.Field{
+	{Param: "identityDetail.identityNumber", Column: "medical_patients.identity_number", DefaultOp: query.OpEq, Ops: []query.Op{query.OpPrefix}, Kind: query.KindInt},
+	{Param: "identityDetail.name", Column: "medical_patients.name", DefaultOp: query.OpContains, Ops: []query.Op{query.OpEq, query.OpPrefix}, Fold: true},
+	{Param: "createdBy.userId", Column: "users.id", DefaultOp: query.OpEq},
+	{Param: "createdBy.nip", Column: "users.nip", DefaultOp: query.OpEq, Ops: []query.Op{query.OpPrefix, query.OpContains}},
+	{Param: "createdBy.name", Column: "users.name", DefaultOp: query.OpContains, Ops: []query.Op{query.OpEq, query.OpPrefix}, Fold: true},
+	// compared as text so an unknown status matches nothing instead of failing the enum cast
+	{Param: "templateId", Column: "medical_records.template_id", DefaultOp: query.OpEq},
+	{Param: "reviewStatus", Column: "medical_records.review_status::text", DefaultOp: query.OpEq},
+	{Param: "diagnosis.code", Column: "medical_record_diagnoses.code", DefaultOp: query.OpEq, Ops: []query.Op{query.OpPrefix}, Fold: true, Exists: diagnosisExists},
+	{Param: "diagnosis.chapter", Column: "medical_record_diagnoses.chapter", DefaultOp: query.OpEq, Fold: true, Exists: diagnosisExists},
+	{Param: "diagnosis.primaryCode", Column: "medical_record_diagnoses.code", DefaultOp: query.OpEq, Ops: []query.Op{query.OpPrefix}, Fold: true, Exists: primaryDiagnosisExists},
+}
+
+const (
+	diagnosisExists        = "SELECT 1 FROM medical_record_diagnoses WHERE medical_record_diagnoses.record_id = medical_records.id"
+	primaryDiagnosisExists = diagnosisExists + " AND medical_record_diagnoses.kind = 'primary'"
+)
+
+var listSortFields = map[string]string{
+	"createdAt": "medical_records.created_at",
+}
+
+const (
+	recordColumns = `
+			medical_records.id, medical_records.original_id, medical_records.version,
+			medical_records.amends_id, medical_records.amend_reason,
+			NOT EXISTS (SELECT 1 FROM medical_records AS newer WHERE newer.amends_id = medical_records.id),
+			medical_records.locked_at IS NOT NULL, medical_records.lock_at, medical_records.signature,
+			medical_records.review_status, medical_records.reviewed_by, medical_records.reviewed_at, medical_records.review_comment,
+			symptoms, medications, medical_records.created_at,
+			medical_records.interaction_warnings, medical_records.interaction_override_reason,
+			medical_records.template_id, medical_records.template_fields,
+			users.id, users.nip, users.name,
+			medical_patients.identity_number, medical_patients.phone_number,
+			medical_patients.name, medical_patients.birth_date, medical_patients.gender,
+			medical_patients.identity_card_key,
+			` + diagnosesColumn + `, ` + prescriptionsColumn + `, ` + attachmentsColumn + `,
+	` + vitalsColumns
+	recordJoins = `
+			FROM medical_records
+			LEFT JOIN users ON users.id = medical_records.user_id
+			LEFT JOIN medical_patients ON medical_patients.id = patient_id
+	` + vitalsJoin
+)
+
+// diagnosesColumn aggregates the diagnoses of a record into a JSON array,
+// primary first.
+const diagnosesColumn = `(
+			SELECT COALESCE(json_agg(json_build_object('code', code, 'type', kind, 'chapter', chapter) ORDER BY position), '[]')
+			FROM medical_record_diagnoses WHERE medical_record_diagnoses.record_id = medical_records.id)`
+
+const prescriptionsColumn = `(
+			SELECT COALESCE(json_agg(json_build_object(
+				'drugId', drug_id, 'genericName', generic_name, 'form', form, 'strength', strength,
+				'dose', dose, 'unit', unit, 'route', route, 'frequency', frequency,
+				'timesPerDay', times_per_day, 'durationDays', duration_days) ORDER BY position), '[]')
+			FROM medical_record_prescriptions WHERE medical_record_prescriptions.record_id = medical_records.id)`
+
+const attachmentsColumn = `(
+			SELECT COALESCE(json_agg(json_build_object('type', kind, 'imageKey', image_key, 'caption', caption) ORDER BY position), '[]')
+			FROM medical_record_attachments WHERE medical_record_attachments.record_id = medical_records.id)`
+
+const (
+	vitalsColumns = `
+			medical_record_vitals.record_id, medical_record_vitals.measured_at,
+			temperature_c::float8, systolic_mmhg, diastolic_mmhg, heart_rate_bpm,
+			respiratory_rate, spo2_pct, weight_kg::float8, height_cm::float8, pain_score,
+			ward, spo2_scale, supplemental_oxygen, consciousness, news2_score, news2_risk, news2_alert
+	`
+	vitalsJoin = `
+			LEFT JOIN medical_record_vitals ON medical_record_vitals.record_id = medical_records.id
+	`
+)
+
+// vitalsRow scans vitalsColumns, which are all NULL for a record
+// without vitals.
+type vitalsRow struct {
+	recordID   *string
+	measuredAt *time.Time
+	news2Alert *bool
+	v          Vitals
+}
+
+func (r *vitalsRow) dest() []any {
+	return []any{&r.recordID, &r.measuredAt,
+		&r.v.TemperatureC, &r.v.SystolicMmHg, &r.v.DiastolicMmHg, &r.v.HeartRateBpm,
+		&r.v.RespiratoryRate, &r.v.SpO2Pct, &r.v.WeightKg, &r.v.HeightCm, &r.v.PainScore,
+		&r.v.Ward, &r.v.SpO2Scale, &r.v.SupplementalOxygen, &r.v.Consciousness, &r.v.NEWS2Score, &r.v.NEWS2Risk, &r.news2Alert}
+}
+
+func (r *vitalsRow) vitals() *Vitals {
+	if r.recordID == nil {
+		return nil
+	}
+	r.v.MeasuredAt = *r.measuredAt
+	r.v.NEWS2Alert = r.news2Alert != nil && *r.news2Alert
+	return &r.v
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// scanRecord reads recordColumns followed by any extra columns.
+func scanRecord(row scanner, extra ...any) (ListMedicalRecordsResponse, error) {
+	m := ListMedicalRecordsResponse{}
+	p := medicalpatients.MedicalPatientsResponse{}
+	u := user.UserResponse{}
+	v := vitalsRow{}
+	var diagnoses, prescriptions, attachments, warnings, templateFields []byte
+	dest := []any{&m.ID, &m.OriginalID, &m.Version, &m.AmendsID, &m.AmendReason, &m.Latest,
+		&m.Locked, &m.LockAt, &m.Signature,
+		&m.ReviewStatus, &m.ReviewedBy, &m.ReviewedAt, &m.ReviewComment,
+		&m.Symptoms, &m.Medications, &m.createdAt,
+		&warnings, &m.InteractionOverrideReason,
+		&m.TemplateID, &templateFields,
+		&u.UserID, &u.NIP, &u.Name,
+		&p.IdentityNumber, &p.PhoneNumber, &p.Name, &p.Birthdate,
+		&p.Gender, &p.IdentityCardScanImg, &diagnoses, &prescriptions, &attachments,
+	}
+	dest = append(dest, v.dest()...)
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return m, err
+	}
+	m.CreatedAt = m.createdAt.Format(time.RFC3339Nano)
+	m.IdentityDetail = p
+	m.CreatedBy = u
+	m.Vitals = v.vitals().response()
+	if err = json.Unmarshal(diagnoses, &m.Diagnoses); err != nil {
+		return m, err
+	}
+	if err = json.Unmarshal(prescriptions, &m.Prescriptions); err != nil {
+		return m, err
+	}
+	if err = json.Unmarshal(attachments, &m.Attachments); err != nil {
+		return m, err
+	}
+	if warnings != nil {
+		if err = json.Unmarshal(warnings, &m.InteractionWarnings); err != nil {
+			return m, err
+		}
+	}
+	if templateFields != nil {
+		if err = json.Unmarshal(templateFields, &m.TemplateFields); err != nil {
+			return m, err
+		}
+	}
+	return m, nil
+}
+
+const modelColumns = `
+		id, user_id, patient_id, symptoms, medications, original_id, version, amends_id, amend_reason, created_at,
+		lock_at, locked_at IS NOT NULL OR lock_at <= current_timestamp, locked_at,
+		chain_seq, prev_hash, content_hash, hash_format, signature,
+		review_status, reviewed_by, reviewed_at, review_comment,
+		interaction_warnings, interaction_override_reason, template_id, template_fields,
+		` + diagnosesColumn + `, ` + prescriptionsColumn + `, ` + attachmentsColumn + `,
+	` + vitalsColumns
+
+const modelFrom = " FROM medical_records " + vitalsJoin
+
+func scanModel(row scanner) (*MedicalRecords, error) {
+	m := &MedicalRecords{}
+	v := vitalsRow{}
+	var diagnoses, prescriptions, attachments, warnings, templateFields []byte
+	dest := []any{&m.ID, &m.UserID, &m.PatientId, &m.Symptoms, &m.Medications,
+		&m.OriginalID, &m.Version, &m.AmendsID, &m.AmendReason, &m.CreatedAt,
+		&m.LockAt, &m.Locked, &m.LockedAt,
+		&m.ChainSeq, &m.PrevHash, &m.ContentHash, &m.HashFormat, &m.Signature,
+		&m.ReviewStatus, &m.ReviewedBy, &m.ReviewedAt, &m.ReviewComment,
+		&warnings, &m.InteractionOverrideReason, &m.TemplateID, &templateFields, &diagnoses, &prescriptions, &attachments}
+	err := row.Scan(append(dest, v.dest()...)...)
+	if err != nil {
+		return nil, err
+	}
+	m.Vitals = v.vitals()
+	if err = json.Unmarshal(diagnoses, &m.Diagnoses); err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(prescriptions, &m.Prescriptions); err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(attachments, &m.Attachments); err != nil {
+		return nil, err
+	}
+	if warnings != nil {
+		if err = json.Unmarshal(warnings, &m.InteractionWarnings); err != nil {
+			return nil, err
+		}
+	}
+	if templateFields != nil {
+		if err = json.Unmarshal(templateFields, &m.TemplateFields); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
 }
 
 type dbRepository struct {
-	db *db.DB
+	db     *db.DB
+	signer *Signer
 }
 
-func NewRepository(db *db.DB) Repository {
-	return &dbRepository{db: db}
+// NewRepository creates the record repository. Records are signed by
+// signer as they are locked.
+func NewRepository(db *db.DB, signer *Signer) Repository {
+	return &dbRepository{db: db, signer: signer}
 }
 
 func (d *dbRepository) Create(ctx context.Context, medicalrecord *MedicalRecords) error {
-	q := `
-        INSERT INTO medical_records (id, user_id, patient_id, symptoms, medications)
-        VALUES ($1, $2, $3, $4, $5);
-    `
-	_, err := d.db.DB().ExecContext(ctx, q, medicalrecord.ID, medicalrecord.UserID, medicalrecord.PatientId, medicalrecord.Symptoms, medicalrecord.Medications)
+	var warnings, templateFields []byte
+	var err error
+	if len(medicalrecord.InteractionWarnings) > 0 {
+		warnings, err = json.Marshal(medicalrecord.InteractionWarnings)
+		if err != nil {
+			return err
+		}
+	}
+	if medicalrecord.TemplateID != nil {
+		templateFields, err = json.Marshal(medicalrecord.TemplateFields)
+		if err != nil {
+			return err
+		}
+	}
+	err = d.db.StartTx(ctx, func(tx *sql.Tx) error {
+		// an amendment keeps the lock time of the version it amends, so
+		// amending cannot extend the grace period
+		q := `
+			INSERT INTO medical_records (id, user_id, patient_id, symptoms, medications, original_id, version, amends_id, amend_reason, review_status,
+				interaction_warnings, interaction_override_reason, template_id, template_fields, lock_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14,
+				COALESCE((SELECT lock_at FROM medical_records WHERE id = $8), current_timestamp + make_interval(secs => $15)));
+		`
+		_, err := tx.ExecContext(ctx, q, medicalrecord.ID, medicalrecord.UserID, medicalrecord.PatientId, medicalrecord.Symptoms, medicalrecord.Medications,
+			medicalrecord.OriginalID, medicalrecord.Version, medicalrecord.AmendsID, medicalrecord.AmendReason, medicalrecord.ReviewStatus,
+			warnings, medicalrecord.InteractionOverrideReason, medicalrecord.TemplateID, templateFields, medicalrecord.LockAfter.Seconds())
+		if err != nil {
+			return err
+		}
+		for i, diagnosis := range medicalrecord.Diagnoses {
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO medical_record_diagnoses (record_id, position, code, chapter, kind)
+				VALUES ($1, $2, $3, $4, $5);
+			`, medicalrecord.ID, i, diagnosis.Code, diagnosis.Chapter, diagnosis.Type)
+			if err != nil {
+				return err
+			}
+		}
+		for i, p := range medicalrecord.Prescriptions {
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO medical_record_prescriptions (record_id, position, drug_id, generic_name, form, strength,
+					dose, unit, route, frequency, times_per_day, duration_days)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12);
+			`, medicalrecord.ID, i, p.DrugID, p.GenericName, p.Form, p.Strength,
+				p.Dose, p.Unit, p.Route, p.Frequency, p.TimesPerDay, p.DurationDays)
+			if err != nil {
+				return err
+			}
+		}
+		for i, a := range medicalrecord.Attachments {
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO medical_record_attachments (record_id, position, kind, image_key, caption)
+				VALUES ($1, $2, $3, $4, $5);
+			`, medicalrecord.ID, i, a.Type, a.ImageKey, a.Caption)
+			if err != nil {
+				return err
+			}
+		}
+		if medicalrecord.Vitals == nil {
+			return nil
+		}
+
+		v := medicalrecord.Vitals
+		q = `
+			INSERT INTO medical_record_vitals (record_id, measured_at, temperature_c, systolic_mmhg, diastolic_mmhg,
+				heart_rate_bpm, respiratory_rate, spo2_pct, weight_kg, height_cm, pain_score,
+				ward, spo2_scale, supplemental_oxygen, consciousness, news2_score, news2_risk, news2_alert)
+			SELECT id, COALESCE($2, created_at), $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18
+			FROM medical_records
+			WHERE id = $1
+			RETURNING measured_at;
+		`
+		return tx.QueryRowContext(ctx, q, medicalrecord.ID, sql.NullTime{Time: v.MeasuredAt, Valid: !v.MeasuredAt.IsZero()},
+			v.TemperatureC, v.SystolicMmHg, v.DiastolicMmHg, v.HeartRateBpm, v.RespiratoryRate, v.SpO2Pct, v.WeightKg, v.HeightCm, v.PainScore,
+			v.Ward, v.SpO2Scale, v.SupplementalOxygen, v.Consciousness, v.NEWS2Score, v.NEWS2Risk, v.NEWS2Alert).Scan(&v.MeasuredAt)
+	})
+	var pgErr *pgconn.PgError
 	if err != nil {
+		if errors.As(err, &pgErr) {
+			switch pgErr.Code {
+			case "23505":
+				return ErrRecordSuperseded
+			case "23503":
+				if pgErr.ConstraintName == "fk_image_key" {
+					// an attachment was collected since it was checked
+					return fmt.Errorf("%w: image not found", ErrInvalidAttachment)
+				}
+				return err
+			default:
+				return err
+			}
+		}
 		return err
 	}
 	return nil
 }
 
-func (d *dbRepository) List(ctx context.Context, req ListRecordsPayload) ([]ListMedicalRecordsResponse, error) {
-	q := `
-			SELECT symptoms, medications, medical_records.created_at,
-				users.id, users.nip, users.name,
-				medical_patients.identity_number, medical_patients.phone_number,
-                medical_patients.name, medical_patients.birth_date, medical_patients.gender,
-                medical_patients.identity_card_url
-			FROM medical_records
-			LEFT JOIN users ON users.id = medical_records.user_id
-			LEFT JOIN medical_patients ON medical_patients.id = patient_id
-	`
-	paramNo := 1
-	params := make([]interface{}, 0)
-	if req.IdentityNumber != "" {
-		q += fmt.Sprintf("WHERE medical_patients.identity_number = $%d ", paramNo)
-		paramNo += 1
-		params = append(params, req.IdentityNumber)
+func (d *dbRepository) GetByID(ctx context.Context, id string) (*MedicalRecords, error) {
+	q := "SELECT " + modelColumns + modelFrom + " WHERE id = $1;"
+	m, err := scanModel(d.db.DB().QueryRowContext(ctx, q, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrRecordNotFound
+	}
+	if err != nil {
+		return nil, err
 	}
-	// fmt.Println("req.UserId", req.UserId)
-	if req.UserId != "" {
-		q += whereOrAnd(paramNo)
-		q += fmt.Sprintf("users.id = $%d ", paramNo)
-		paramNo += 1
-		params = append(params, req.UserId)
+	return m, nil
+}
+
+func (d *dbRepository) GetResponseByID(ctx context.Context, id string) (*ListMedicalRecordsResponse, error) {
+	q := "SELECT " + recordColumns + recordJoins + " WHERE medical_records.id = $1"
+	m, err := scanRecord(d.db.DB().QueryRowContext(ctx, q, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrRecordNotFound
 	}
-	if req.NIP != "" {
-		q += whereOrAnd(paramNo)
-		q += fmt.Sprintf("LOWER(users.nip) = $%d ", paramNo)
-		paramNo += 1
-		params = append(params, req.NIP)
+	if err != nil {
+		return nil, err
 	}
+	return &m, nil
+}
 
-	if req.CreatedAt == "asc" || req.CreatedAt == "desc" {
-		q += `ORDER BY medical_records.created_at ` + req.CreatedAt
+func (d *dbRepository) ListVersions(ctx context.Context, originalID string) ([]ListMedicalRecordsResponse, error) {
+	q := "SELECT " + recordColumns + recordJoins + " WHERE medical_records.original_id = $1 ORDER BY medical_records.version DESC"
+	rows, err := d.db.DB().QueryContext(ctx, q, originalID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := make([]ListMedicalRecordsResponse, 0)
+	for rows.Next() {
+		m, err := scanRecord(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, m)
 	}
+	return res, rows.Err()
+}
 
-	q += fmt.Sprintf(" OFFSET $%d LIMIT $%d", paramNo, paramNo+1)
-	params = append(params, req.Offset)
-	params = append(params, req.Limit)
+func (d *dbRepository) List(ctx context.Context, req ListRecordsPayload) ([]ListMedicalRecordsResponse, *response.Pagination, error) {
+	meta := &response.Pagination{Limit: req.Limit, Offset: req.Offset}
+	// amendments are few, so the estimate of the table stands for its
+	// latest versions as well
+	if len(req.Filters) == 0 && len(req.conditions) == 0 {
+		var err error
+		meta.Total, meta.Estimated, err = d.db.EstimateTotal(ctx, "medical_records")
+		if err != nil {
+			return nil, nil, err
+		}
+	}
 
-	// fmt.Println("query:", q)
+	q := "SELECT " + recordColumns
+	// a cursor narrows the rows, so its total has to be counted apart
+	countInline := !meta.Estimated && req.after == nil
+	if countInline {
+		q += ", " + db.WindowCount
+	}
+	b := query.NewBuilder()
+	if req.Q != "" {
+		q += ", " + headlineColumns(b, req.Q)
+	}
+	conditions := append(query.Conditions(req.Filters), req.conditions...)
+	if !req.IncludeHistory {
+		conditions = append(conditions, latestVersionCondition)
+	}
+	pageConditions := append([]query.Condition{}, conditions...)
+	if req.after != nil {
+		pageConditions = append(pageConditions, req.after.Condition("medical_records.created_at", "medical_records.id"))
+	}
+	q += recordJoins + b.Where(query.And(pageConditions...))
+	q += query.OrderBy(req.sorts)
+	q += fmt.Sprintf(" OFFSET %s LIMIT %s", b.Arg(req.Offset), b.Arg(req.Limit))
 
-	rows, err := d.db.DB().QueryContext(ctx, q, params...)
+	rows, err := d.db.DB().QueryContext(ctx, q, b.Args()...)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	defer rows.Close()
 	res := make([]ListMedicalRecordsResponse, 0)
 	for rows.Next() {
-		m := ListMedicalRecordsResponse{}
-		p := medicalpatients.MedicalPatientsResponse{}
-		u := user.UserResponse{}
-		err = rows.Scan(&m.Symptoms, &m.Medications, &m.CreatedAt,
-			&u.UserID, &u.NIP, &u.Name,
-			&p.IdentityNumber, &p.PhoneNumber, &p.Name, &p.Birthdate,
-			&p.Gender, &p.IdentityCardScanImg,
-		)
+		extra := []any{}
+		if countInline {
+			extra = append(extra, &meta.Total)
+		}
+		var symptoms, medications string
+		if req.Q != "" {
+			extra = append(extra, &symptoms, &medications)
+		}
+		m, err := scanRecord(rows, extra...)
 		if err != nil {
+			return nil, nil, err
+		}
+		if req.Q != "" {
+			m.Highlights = &RecordHighlights{Symptoms: highlight(symptoms), Medications: highlight(medications)}
+		}
+		res = append(res, m)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	// a page past the end has no rows to carry the count
+	if !meta.Estimated && (!countInline || len(res) == 0 && req.Offset > 0) {
+		cb := query.NewBuilder()
+		where := cb.Where(query.And(conditions...))
+		err = d.db.DB().QueryRowContext(ctx, "SELECT COUNT(*)"+recordJoins+where, cb.Args()...).Scan(&meta.Total)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return res, meta, nil
+}
+
+var latestVersionCondition = query.Raw("NOT EXISTS (SELECT 1 FROM medical_records AS newer WHERE newer.amends_id = medical_records.id)")
+
+func (d *dbRepository) ListPatientsWithDueRecords(ctx context.Context) ([]string, error) {
+	q := `
+		SELECT DISTINCT patient_id
+		FROM medical_records
+		WHERE locked_at IS NULL AND lock_at <= current_timestamp AND ` + awaitingNoReview + `;
+	`
+	rows, err := d.db.DB().QueryContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := make([]string, 0)
+	for rows.Next() {
+		var patientID string
+		if err = rows.Scan(&patientID); err != nil {
 			return nil, err
 		}
+		res = append(res, patientID)
+	}
+	return res, rows.Err()
+}
 
-		m.IdentityDetail = p
-		m.CreatedBy = u
-		res = append(res, m)
+// awaitingNoReview keeps a record open while its latest version waits for
+// a co-signature; superseded versions lock on schedule.
+const awaitingNoReview = `NOT (review_status = 'pending_review' AND NOT EXISTS (
+		SELECT 1 FROM medical_records AS newer WHERE newer.amends_id = medical_records.id))`
+
+// LockDueRecords signs the patient's records whose grace period has
+// passed, appending them to the patient's chain in creation order.
+func (d *dbRepository) LockDueRecords(ctx context.Context, patientID string) (int, error) {
+	locked := 0
+	err := d.db.StartTx(ctx, func(tx *sql.Tx) error {
+		// concurrent lockers would otherwise fork the chain
+		_, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext($1));", patientID)
+		if err != nil {
+			return err
+		}
+
+		var seq int64
+		var prevHash string
+		err = tx.QueryRowContext(ctx, `
+			SELECT chain_seq, content_hash
+			FROM medical_records
+			WHERE patient_id = $1 AND chain_seq IS NOT NULL
+			ORDER BY chain_seq DESC
+			LIMIT 1;
+		`, patientID).Scan(&seq, &prevHash)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		rows, err := tx.QueryContext(ctx, "SELECT "+modelColumns+modelFrom+`
+			WHERE patient_id = $1 AND locked_at IS NULL AND lock_at <= current_timestamp AND `+awaitingNoReview+`
+			ORDER BY created_at, id;
+		`, patientID)
+		if err != nil {
+			return err
+		}
+		due := make([]*MedicalRecords, 0)
+		for rows.Next() {
+			m, err := scanModel(rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			due = append(due, m)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return err
+		}
+
+		for _, m := range due {
+			seq++
+			hash, err := chainHash(CurrentHashFormat, prevHash, m)
+			if err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, `
+				UPDATE medical_records
+				SET locked_at = current_timestamp, chain_seq = $1, prev_hash = $2, content_hash = $3, hash_format = $4, signature = $5
+				WHERE id = $6;
+			`, seq, sql.NullString{String: prevHash, Valid: prevHash != ""}, hash, CurrentHashFormat, d.signer.sign(hash), m.ID)
+			if err != nil {
+				return err
+			}
+			prevHash = hash
+		}
+		locked = len(due)
+		return nil
+	})
+	return locked, err
+}
+
+func (d *dbRepository) ListChain(ctx context.Context, patientID string) ([]MedicalRecords, error) {
+	q := "SELECT " + modelColumns + modelFrom + `
+		WHERE patient_id = $1 AND chain_seq IS NOT NULL
+		ORDER BY chain_seq;
+	`
+	rows, err := d.db.DB().QueryContext(ctx, q, patientID)
+	if err != nil {
+		return nil, err
 	}
-	return res, nil
+	defer rows.Close()
+	res := make([]MedicalRecords, 0)
+	for rows.Next() {
+		m, err := scanModel(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, *m)
+	}
+	return res, rows.Err()
+}
+
+// Review records the decision on a version pending review, unless it
+// was amended since.
+func (d *dbRepository) Review(ctx context.Context, id string, status ReviewStatus, reviewerID string, comment *string) error {
+	q := `
+		UPDATE medical_records
+		SET review_status = $1, reviewed_by = $2, reviewed_at = current_timestamp, review_comment = $3
+		WHERE id = $4 AND review_status = 'pending_review'
+			AND NOT EXISTS (SELECT 1 FROM medical_records amendments WHERE amendments.amends_id = medical_records.id);
+	`
+	row, err := d.db.DB().ExecContext(ctx, q, status, reviewerID, comment, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := row.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		var amended bool
+		q = `SELECT EXISTS (SELECT 1 FROM medical_records WHERE amends_id = $1);`
+		if err = d.db.DB().QueryRowContext(ctx, q, id).Scan(&amended); err != nil {
+			return err
+		}
+		if amended {
+			return ErrRecordSuperseded
+		}
+		return ErrRecordNotPendingReview
+	}
+	return nil
+}
+
+// ListVitals returns the latest limit vitals of the patient's current
+// record versions measured in [from, to], newest first.
+func (d *dbRepository) ListVitals(ctx context.Context, patientID string, from, to time.Time, limit int) ([]VitalsTrendPoint, error) {
+	b := query.NewBuilder()
+	where := b.Where(query.And(
+		query.Eq("medical_records.patient_id", patientID),
+		query.Range("medical_record_vitals.measured_at", query.At(from), query.At(to)),
+		latestVersionCondition,
+	))
+	q := "SELECT " + vitalsColumns + `
+		FROM medical_record_vitals
+		JOIN medical_records ON medical_records.id = medical_record_vitals.record_id` + where + `
+		ORDER BY medical_record_vitals.measured_at DESC, medical_records.id DESC
+		LIMIT ` + b.Arg(limit)
+	rows, err := d.db.DB().QueryContext(ctx, q, b.Args()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := make([]VitalsTrendPoint, 0)
+	for rows.Next() {
+		v := vitalsRow{}
+		if err = rows.Scan(v.dest()...); err != nil {
+			return nil, err
+		}
+		res = append(res, VitalsTrendPoint{RecordID: *v.recordID, VitalSigns: *v.vitals().response()})
+	}
+	return res, rows.Err()
+}
+
+// ListDeteriorating returns the patients whose latest scored observation
+// set, measured after since, raised an alert, optionally only those in
+// ward.
+func (d *dbRepository) ListDeteriorating(ctx context.Context, ward string, since time.Time) ([]DeterioratingPatient, error) {
+	b := query.NewBuilder()
+	conditions := []query.Condition{query.Raw("news2_alert"), query.Raw("measured_at > ?", since)}
+	if ward != "" {
+		conditions = append(conditions, query.Eq("ward", ward))
+	}
+	q := `
+		SELECT medical_patients.identity_number, medical_patients.phone_number,
+			medical_patients.name, medical_patients.birth_date, medical_patients.gender,
+			medical_patients.identity_card_key,` + vitalsColumns + `
+		FROM (
+			SELECT DISTINCT ON (medical_records.patient_id) medical_records.patient_id, medical_record_vitals.*
+			FROM medical_record_vitals
+			JOIN medical_records ON medical_records.id = medical_record_vitals.record_id
+			WHERE news2_score IS NOT NULL AND ` + latestVersionCondition.SQL(b) + `
+			ORDER BY medical_records.patient_id, measured_at DESC, record_id DESC
+		) AS medical_record_vitals
+		JOIN medical_patients ON medical_patients.id = medical_record_vitals.patient_id` + b.Where(query.And(conditions...)) + `
+		ORDER BY ward NULLS LAST, news2_score DESC, measured_at;
+	`
+	rows, err := d.db.DB().QueryContext(ctx, q, b.Args()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := make([]DeterioratingPatient, 0)
+	for rows.Next() {
+		p := medicalpatients.MedicalPatientsResponse{}
+		v := vitalsRow{}
+		dest := []any{&p.IdentityNumber, &p.PhoneNumber, &p.Name, &p.Birthdate, &p.Gender, &p.IdentityCardScanImg}
+		if err = rows.Scan(append(dest, v.dest()...)...); err != nil {
+			return nil, err
+		}
+		res = append(res, DeterioratingPatient{IdentityDetail: p, RecordID: *v.recordID, Vitals: *v.vitals().response()})
+	}
+	return res, rows.Err()
 }
 
-func whereOrAnd(paramNo int) string {
-	if paramNo == 1 {
-		return "WHERE "
+// ListActiveDrugs returns the generic names of the drugs the patient is
+// still taking: prescribed on a current, not rejected version of a record
+// other than excludeOriginalID, within the course's duration. A course
+// without a duration is a single dose and counts for a day.
+func (d *dbRepository) ListActiveDrugs(ctx context.Context, patientID string, excludeOriginalID string) ([]string, error) {
+	b := query.NewBuilder()
+	where := b.Where(query.And(
+		query.Eq("medical_records.patient_id", patientID),
+		query.Raw("medical_records.original_id <> ?", excludeOriginalID),
+		query.Raw("medical_records.review_status <> 'rejected'"),
+		query.Raw("medical_records.created_at + make_interval(days => COALESCE(duration_days, 1)) > current_timestamp"),
+		latestVersionCondition,
+	))
+	q := `
+		SELECT DISTINCT medical_record_prescriptions.generic_name
+		FROM medical_record_prescriptions
+		JOIN medical_records ON medical_records.id = medical_record_prescriptions.record_id` + where
+	rows, err := d.db.DB().QueryContext(ctx, q, b.Args()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := make([]string, 0)
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		res = append(res, name)
 	}
-	return "OR "
+	return res, rows.Err()
 }
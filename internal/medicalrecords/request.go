@@ -4,14 +4,26 @@ import (
 	"fmt"
 	"strconv"
 
+	"github.com/citadel-corp/halosuster/internal/common/cursor"
+	"github.com/citadel-corp/halosuster/internal/common/query"
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 )
 
 type PostMedicalRecord struct {
-	IdentityNumber int64  `json:"identityNumber"`
-	UserId         string `json:"userId"`
-	Symptoms       string `json:"symptoms"`
-	Medications    string `json:"medications"`
+	IdentityNumber int64                 `json:"identityNumber"`
+	UserId         string                `json:"userId"`
+	Symptoms       string                `json:"symptoms"`
+	Medications    string                `json:"medications"`
+	Prescriptions  []PrescriptionPayload `json:"prescriptions"`
+	Vitals         *VitalSigns           `json:"vitals"`
+	Diagnoses      []DiagnosisPayload    `json:"diagnoses"`
+	Attachments    []AttachmentPayload   `json:"attachments"`
+	// InteractionOverrideReason is required to save prescriptions with a
+	// severe interaction.
+	InteractionOverrideReason string `json:"interactionOverrideReason"`
+	// TemplateFields are checked against the template with TemplateID.
+	TemplateID     string         `json:"templateId"`
+	TemplateFields map[string]any `json:"templateFields"`
 }
 
 func (p PostMedicalRecord) Validate() error {
@@ -23,15 +35,97 @@ func (p PostMedicalRecord) Validate() error {
 	return validation.ValidateStruct(&p,
 		validation.Field(&p.IdentityNumber, validation.Required),
 		validation.Field(&p.Symptoms, validation.Required, validation.Length(1, 2000)),
-		validation.Field(&p.Medications, validation.Required, validation.Length(1, 2000)),
+		validation.Field(&p.Medications, validation.When(len(p.Prescriptions) == 0, validation.Required), validation.Length(0, 2000)),
+		validation.Field(&p.Prescriptions, validation.Length(0, maxPrescriptions)),
+		validation.Field(&p.Vitals),
+		validation.Field(&p.Diagnoses, validation.Length(0, maxDiagnoses), validation.By(validDiagnoses)),
+		validation.Field(&p.Attachments, validation.Length(0, maxAttachments), validation.By(uniqueImages)),
+		validation.Field(&p.InteractionOverrideReason, validation.Length(0, 500)),
+		validation.Field(&p.TemplateFields, validation.When(p.TemplateID == "", validation.Empty.Error("requires templateId"))),
 	)
 }
 
+// AmendMedicalRecord replaces the content of a record. Vitals, diagnoses
+// and attachments left out are carried over from the amended version, and so
+// are prescriptions and medications when both are left out. Free-text
+// medications without prescriptions replace the prescription lines.
+// Template fields left out are carried over too; the template cannot be
+// changed.
+type AmendMedicalRecord struct {
+	UserId        string                `json:"-"`
+	Symptoms      string                `json:"symptoms"`
+	Medications   string                `json:"medications"`
+	Prescriptions []PrescriptionPayload `json:"prescriptions"`
+	Vitals        *VitalSigns           `json:"vitals"`
+	Diagnoses     []DiagnosisPayload    `json:"diagnoses"`
+	Attachments   []AttachmentPayload   `json:"attachments"`
+	Reason        string                `json:"reason"`
+
+	InteractionOverrideReason string         `json:"interactionOverrideReason"`
+	TemplateFields            map[string]any `json:"templateFields"`
+}
+
+func (p AmendMedicalRecord) Validate() error {
+	return validation.ValidateStruct(&p,
+		validation.Field(&p.Symptoms, validation.Required, validation.Length(1, 2000)),
+		validation.Field(&p.Medications, validation.Length(0, 2000)),
+		validation.Field(&p.Prescriptions, validation.Length(0, maxPrescriptions)),
+		validation.Field(&p.Vitals),
+		validation.Field(&p.Diagnoses, validation.Length(0, maxDiagnoses), validation.By(validDiagnoses)),
+		validation.Field(&p.Attachments, validation.Length(0, maxAttachments), validation.By(uniqueImages)),
+		validation.Field(&p.Reason, validation.Required, validation.Length(1, 500)),
+		validation.Field(&p.InteractionOverrideReason, validation.Length(0, 500)),
+	)
+}
+
+type ReviewMedicalRecord struct {
+	UserId   string         `json:"-"`
+	Decision ReviewDecision `json:"decision"`
+	Comment  string         `json:"comment"`
+}
+
+func (p ReviewMedicalRecord) Validate() error {
+	return validation.ValidateStruct(&p,
+		validation.Field(&p.Decision, validation.Required, validation.In(ReviewDecisions...)),
+		validation.Field(&p.Comment, validation.When(p.Decision == Reject, validation.Required), validation.Length(0, 1000)),
+	)
+}
+
+type GetRecordPayload struct {
+	IncludeHistory bool `schema:"includeHistory" binding:"omitempty"`
+}
+
 type ListRecordsPayload struct {
-	IdentityNumber string
-	UserId         string
-	NIP            string
+	IncludeHistory bool   `schema:"includeHistory" binding:"omitempty"`
 	CreatedAt      string `schema:"createdAt" binding:"omitempty"`
+	Sort           string `schema:"sort" binding:"omitempty"`
 	Limit          int    `schema:"limit" binding:"omitempty"`
 	Offset         int    `schema:"offset" binding:"omitempty"`
+	Cursor         string `schema:"cursor" binding:"omitempty"`
+	// CreatedFrom and CreatedTo take a date or an RFC 3339 time.
+	CreatedFrom string `schema:"createdFrom" binding:"omitempty"`
+	CreatedTo   string `schema:"createdTo" binding:"omitempty"`
+	// Q searches symptoms and medications.
+	Q string `schema:"q" binding:"omitempty"`
+
+	Filters []query.Filter `schema:"-"`
+	sorts   []query.Sort
+	after   *cursor.Cursor
+	keyset  bool
+	// conditions are imposed by the service rather than asked for by the client
+	conditions []query.Condition
+}
+
+// fingerprint identifies the listing for its cursors.
+func (p ListRecordsPayload) fingerprint() string {
+	return cursor.Fingerprint([]string{strconv.FormatBool(p.IncludeHistory), p.CreatedAt, p.Sort, p.CreatedFrom, p.CreatedTo, p.Q}, p.Filters)
+}
+
+type VitalsTrendPayload struct {
+	From string `schema:"from" binding:"omitempty"`
+	To   string `schema:"to" binding:"omitempty"`
+}
+
+type DeterioratingPayload struct {
+	Ward string `schema:"ward" binding:"omitempty"`
 }
@@ -1,14 +1,93 @@
 package medicalrecords
 
 import (
+	"time"
+
+	"github.com/citadel-corp/halosuster/internal/interactions"
 	"github.com/citadel-corp/halosuster/internal/medicalpatients"
 	"github.com/citadel-corp/halosuster/internal/user"
 )
 
 type ListMedicalRecordsResponse struct {
+	ID             string                                  `json:"id"`
+	OriginalID     string                                  `json:"originalId"`
+	Version        int                                     `json:"version"`
+	AmendsID       *string                                 `json:"amendsId,omitempty"`
+	AmendReason    *string                                 `json:"amendReason,omitempty"`
+	Latest         bool                                    `json:"latest"`
+	Locked         bool                                    `json:"locked"`
+	LockAt         time.Time                               `json:"lockAt"`
+	Signature      *string                                 `json:"signature,omitempty"`
+	ReviewStatus   ReviewStatus                            `json:"reviewStatus"`
+	ReviewedBy     *string                                 `json:"reviewedBy,omitempty"`
+	ReviewedAt     *time.Time                              `json:"reviewedAt,omitempty"`
+	ReviewComment  *string                                 `json:"reviewComment,omitempty"`
 	IdentityDetail medicalpatients.MedicalPatientsResponse `json:"identityDetail"`
 	Symptoms       string                                  `json:"symptoms"`
 	Medications    string                                  `json:"medications"`
-	CreatedAt      string                                  `json:"createdAt"`
-	CreatedBy      user.UserResponse                       `json:"createdBy"`
+	Vitals         *VitalSigns                             `json:"vitals,omitempty"`
+	Diagnoses      []DiagnosisResponse                     `json:"diagnoses"`
+	Prescriptions  []Prescription                          `json:"prescriptions"`
+	Attachments    []AttachmentResponse                    `json:"attachments"`
+	// interaction fields are omitted when the prescriptions raised no warnings
+	InteractionWarnings       []interactions.Warning `json:"interactionWarnings,omitempty"`
+	InteractionOverrideReason *string                `json:"interactionOverrideReason,omitempty"`
+	TemplateID                *string                `json:"templateId,omitempty"`
+	TemplateFields            map[string]any         `json:"templateFields,omitempty"`
+	CreatedAt                 string                 `json:"createdAt"`
+	CreatedBy                 user.UserResponse      `json:"createdBy"`
+	Highlights                *RecordHighlights      `json:"highlights,omitempty"`
+
+	createdAt time.Time
+}
+
+// RecordHighlights are excerpts of the fields matching a search,
+// HTML-escaped with the matched terms in <mark> tags.
+type RecordHighlights struct {
+	Symptoms    *string `json:"symptoms,omitempty"`
+	Medications *string `json:"medications,omitempty"`
+}
+
+type MedicalRecordResponse struct {
+	ListMedicalRecordsResponse
+	History []ListMedicalRecordsResponse `json:"history,omitempty"`
+}
+
+type ChainBreak struct {
+	RecordID string `json:"recordId"`
+	ChainSeq int64  `json:"chainSeq"`
+	Reason   string `json:"reason"`
+}
+
+type ChainVerificationResponse struct {
+	IdentityNumber string       `json:"identityNumber"`
+	Verified       int          `json:"verified"`
+	Valid          bool         `json:"valid"`
+	Breaks         []ChainBreak `json:"breaks"`
+}
+
+type VitalsTrendPoint struct {
+	RecordID string `json:"recordId"`
+	VitalSigns
+}
+
+type VitalsTrendResponse struct {
+	IdentityNumber string             `json:"identityNumber"`
+	From           time.Time          `json:"from"`
+	To             time.Time          `json:"to"`
+	Truncated      bool               `json:"truncated"`
+	Points         []VitalsTrendPoint `json:"points"`
+}
+
+type DeterioratingPatient struct {
+	IdentityDetail medicalpatients.MedicalPatientsResponse `json:"identityDetail"`
+	RecordID       string                                  `json:"recordId"`
+	Vitals         VitalSigns                              `json:"vitals"`
+}
+
+// WardDeterioration groups deteriorating patients by the ward of their
+// latest observation; Ward is null for observations without one.
+type WardDeterioration struct {
+	Ward     *string                `json:"ward"`
+	Patients []DeterioratingPatient `json:"patients"`
 }
@@ -0,0 +1,52 @@
+package medicalrecords
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/citadel-corp/halosuster/internal/common/query"
+)
+
+// searchConfig is the text search configuration the search_vector column
+// is built with. Its stemmer strips Indonesian affixes and particles, so
+// "batuk" also finds "batuknya" and "pusing" finds "kepusingan".
+const searchConfig = "indonesian"
+
+// searchQuery parses q like a web search box: quoted phrases, "or" and a
+// leading "-" to exclude a word. It never fails on malformed input.
+func searchQuery(b *query.Builder, q string) string {
+	return fmt.Sprintf("websearch_to_tsquery('%s', %s)", searchConfig, b.Arg(q))
+}
+
+func searchCondition(q string) query.Condition {
+	return query.Raw("medical_records.search_vector @@ websearch_to_tsquery('"+searchConfig+"', ?)", q)
+}
+
+// Matches are delimited with control characters that survive HTML
+// escaping, and only then turned into tags.
+const (
+	markStart = "\x02"
+	markStop  = "\x03"
+)
+
+var headlineOptions = "StartSel=" + markStart + ", StopSel=" + markStop + ", MaxFragments=2, MaxWords=30, MinWords=10"
+
+// headlineColumns selects an excerpt of symptoms and of medications around
+// the terms matching q.
+func headlineColumns(b *query.Builder, q string) string {
+	tsquery, options := searchQuery(b, q), b.Arg(headlineOptions)
+	return fmt.Sprintf("ts_headline('%[1]s', medical_records.symptoms, %[2]s, %[3]s), ts_headline('%[1]s', medical_records.medications, %[2]s, %[3]s)",
+		searchConfig, tsquery, options)
+}
+
+// highlight escapes a headline for HTML and wraps the matched terms in
+// <mark> tags. It returns nil for a headline without matches, which
+// ts_headline produces for the field that did not match.
+func highlight(headline string) *string {
+	if !strings.Contains(headline, markStart) {
+		return nil
+	}
+	s := strings.NewReplacer(markStart, "<mark>", markStop, "</mark>").Replace(html.EscapeString(headline))
+	return &s
+}
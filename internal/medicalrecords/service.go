@@ -2,30 +2,82 @@ package medicalrecords
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/citadel-corp/halosuster/internal/common/cursor"
 	"github.com/citadel-corp/halosuster/internal/common/id"
+	"github.com/citadel-corp/halosuster/internal/common/query"
+	"github.com/citadel-corp/halosuster/internal/common/response"
+	"github.com/citadel-corp/halosuster/internal/drugs"
+	"github.com/citadel-corp/halosuster/internal/icd10"
+	"github.com/citadel-corp/halosuster/internal/image"
+	"github.com/citadel-corp/halosuster/internal/interactions"
 	"github.com/citadel-corp/halosuster/internal/medicalpatients"
+	"github.com/citadel-corp/halosuster/internal/recordtemplates"
+	"github.com/rs/zerolog/log"
 )
 
 type Service interface {
-	CreateMedicalRecord(ctx context.Context, req PostMedicalRecord) error
-	ListMedicalRecords(ctx context.Context, req ListRecordsPayload) ([]ListMedicalRecordsResponse, error)
+	CreateMedicalRecord(ctx context.Context, req PostMedicalRecord) (*ListMedicalRecordsResponse, error)
+	GetMedicalRecord(ctx context.Context, id string, req GetRecordPayload) (*MedicalRecordResponse, error)
+	AmendMedicalRecord(ctx context.Context, id string, req AmendMedicalRecord) (*ListMedicalRecordsResponse, error)
+	ListReviewInbox(ctx context.Context, userID string, req ListRecordsPayload) ([]ListMedicalRecordsResponse, *response.Pagination, error)
+	ReviewMedicalRecord(ctx context.Context, id string, req ReviewMedicalRecord) (*ListMedicalRecordsResponse, error)
+	LockDueRecords(ctx context.Context) (int, error)
+	VerifyChain(ctx context.Context, identityNumber string) (*ChainVerificationResponse, error)
+	GetVitalsTrend(ctx context.Context, identityNumber string, req VitalsTrendPayload) (*VitalsTrendResponse, error)
+	ListDeteriorating(ctx context.Context, req DeterioratingPayload) ([]WardDeterioration, error)
+	ListMedicalRecords(ctx context.Context, req ListRecordsPayload) ([]ListMedicalRecordsResponse, *response.Pagination, error)
 }
 
 type medicalRecordsService struct {
 	repository        Repository
 	patientRepository medicalpatients.Repository
+	icd10Service      icd10.Service
+	drugService       drugs.Service
+	interactions      *interactions.Table
+	templateService   recordtemplates.Service
+	imageService      image.Service
+	gracePeriod       time.Duration
+	thresholds        AlertThresholds
+	alerts            *AlertHook
+	signer            *Signer
+	cursors           cursor.Codec
 }
 
-func NewService(repository Repository, patientRepository medicalpatients.Repository) Service {
+// NewService creates the record service. Records stay amendable by their
+// author for gracePeriod, after which they are locked and signed. New
+// vitals crossing thresholds are published on alerts. Prescriptions are
+// checked for interactions against interactionTable. Attachments refer
+// to images uploaded through imageService. Chains are verified against
+// the signatures of signer.
+func NewService(repository Repository, patientRepository medicalpatients.Repository, icd10Service icd10.Service,
+	drugService drugs.Service, interactionTable *interactions.Table, templateService recordtemplates.Service,
+	imageService image.Service, gracePeriod time.Duration, thresholds AlertThresholds, alerts *AlertHook,
+	signer *Signer, cursors cursor.Codec) Service {
 	return &medicalRecordsService{
 		repository:        repository,
 		patientRepository: patientRepository,
+		icd10Service:      icd10Service,
+		drugService:       drugService,
+		interactions:      interactionTable,
+		templateService:   templateService,
+		imageService:      imageService,
+		gracePeriod:       gracePeriod,
+		thresholds:        thresholds,
+		alerts:            alerts,
+		signer:            signer,
+		cursors:           cursors,
 	}
 }
 
-func (s *medicalRecordsService) CreateMedicalRecord(ctx context.Context, req PostMedicalRecord) error {
+func (s *medicalRecordsService) CreateMedicalRecord(ctx context.Context, req PostMedicalRecord) (*ListMedicalRecordsResponse, error) {
 	var err error
 	idNumber := strconv.Itoa(int(req.IdentityNumber))
 
@@ -33,38 +85,675 @@ func (s *medicalRecordsService) CreateMedicalRecord(ctx context.Context, req Pos
 	patient, err := s.patientRepository.GetByIdentityNumber(ctx, idNumber)
 	if err != nil {
 		if err == medicalpatients.ErrPatientNotFound {
-			return ErrIdNumberDoesNotExist
+			return nil, ErrIdNumberDoesNotExist
 		}
-		return err
+		return nil, err
 	}
 
+	recordID := id.GenerateStringID(16)
 	medicalRecord := &MedicalRecords{
-		ID:          id.GenerateStringID(16),
+		ID:          recordID,
 		UserID:      req.UserId,
 		PatientId:   patient.ID,
 		Symptoms:    req.Symptoms,
 		Medications: req.Medications,
+		OriginalID:  recordID,
+		Version:     1,
+		LockAfter:   s.gracePeriod,
+	}
+	if req.Vitals != nil {
+		medicalRecord.Vitals = req.Vitals.model()
+		medicalRecord.Vitals.scoreNEWS2(s.thresholds)
+	}
+	medicalRecord.Diagnoses, err = s.codeDiagnoses(req.Diagnoses)
+	if err != nil {
+		return nil, err
+	}
+	if req.TemplateID != "" {
+		err = s.applyTemplate(ctx, medicalRecord, req.TemplateID, req.TemplateFields)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = s.attach(ctx, medicalRecord, req.Attachments, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(req.Prescriptions) > 0 {
+		err = s.prescribe(ctx, medicalRecord, req.Prescriptions, req.Medications)
+		if err != nil {
+			return nil, err
+		}
+		err = s.checkInteractions(ctx, medicalRecord, req.InteractionOverrideReason)
+		if err != nil {
+			return nil, err
+		}
 	}
+	medicalRecord.ReviewStatus = reviewStatusFor(medicalRecord)
 	err = s.repository.Create(ctx, medicalRecord)
+	if err != nil {
+		return nil, err
+	}
+	if medicalRecord.Vitals != nil && medicalRecord.Vitals.NEWS2Alert {
+		s.publishAlert(ctx, medicalRecord, idNumber)
+	}
+
+	return s.getResponse(ctx, medicalRecord.ID)
+}
+
+func (s *medicalRecordsService) getResponse(ctx context.Context, id string) (*ListMedicalRecordsResponse, error) {
+	res, err := s.repository.GetResponseByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	s.describe(res)
+	return res, nil
+}
+
+// prescribe checks every line against the drug catalogue and renders the
+// lines, followed by notes, into the record's medications.
+func (s *medicalRecordsService) prescribe(ctx context.Context, record *MedicalRecords, payload []PrescriptionPayload, notes string) error {
+	record.Prescriptions = make([]Prescription, 0, len(payload))
+	for i, p := range payload {
+		line, err := s.prescription(ctx, p)
+		if errors.Is(err, drugs.ErrDrugNotFound) {
+			return fmt.Errorf("%w: prescriptions[%d]: drug %s not found", ErrInvalidPrescription, i, p.DrugID)
+		}
+		if err != nil {
+			return fmt.Errorf("%w: prescriptions[%d]: %w", ErrInvalidPrescription, i, err)
+		}
+		record.Prescriptions = append(record.Prescriptions, *line)
+	}
+	record.Medications = renderMedications(record.Prescriptions, notes)
+	if len(record.Medications) > 2000 {
+		return fmt.Errorf("%w: rendered medications are longer than 2000 characters", ErrInvalidPrescription)
+	}
+	return nil
+}
+
+// applyTemplate checks values against the template's required fields and
+// stores them on the record.
+func (s *medicalRecordsService) applyTemplate(ctx context.Context, record *MedicalRecords, templateID string, values map[string]any) error {
+	template, err := s.templateService.GetByID(ctx, templateID)
+	if errors.Is(err, recordtemplates.ErrTemplateNotFound) {
+		return fmt.Errorf("%w: %s", ErrUnknownTemplate, templateID)
+	}
 	if err != nil {
 		return err
 	}
+	if err = template.Check(values); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidTemplateFields, err)
+	}
+	if values == nil {
+		values = make(map[string]any)
+	}
+	record.TemplateID, record.TemplateFields = &template.ID, values
+	return nil
+}
 
+// checkInteractions checks the record's prescriptions against the
+// patient's allergies, the drugs they are still taking from other records
+// and each other. Saving a severe interaction needs an override reason.
+func (s *medicalRecordsService) checkInteractions(ctx context.Context, record *MedicalRecords, overrideReason string) error {
+	allergies, err := s.patientRepository.ListAllergies(ctx, record.PatientId)
+	if err != nil {
+		return err
+	}
+	allergens := make([]string, len(allergies))
+	for i, a := range allergies {
+		allergens[i] = a.Allergen
+	}
+	active, err := s.repository.ListActiveDrugs(ctx, record.PatientId, record.OriginalID)
+	if err != nil {
+		return err
+	}
+	prescribed := make([]string, len(record.Prescriptions))
+	for i, p := range record.Prescriptions {
+		prescribed[i] = p.GenericName
+	}
+
+	warnings := s.interactions.Check(prescribed, active, allergens)
+	if len(warnings) == 0 {
+		return nil
+	}
+	record.InteractionWarnings = warnings
+	if interactions.HasSevere(warnings) {
+		if overrideReason == "" {
+			return &InteractionError{Warnings: warnings}
+		}
+		record.InteractionOverrideReason = &overrideReason
+	}
 	return nil
 }
 
-func (s *medicalRecordsService) ListMedicalRecords(ctx context.Context, req ListRecordsPayload) ([]ListMedicalRecordsResponse, error) {
-	if req.Limit == 0 {
-		req.Limit = 5
+func (s *medicalRecordsService) prescription(ctx context.Context, p PrescriptionPayload) (*Prescription, error) {
+	drug, err := s.drugService.GetByID(ctx, p.DrugID)
+	if err != nil {
+		return nil, err
+	}
+	if !drug.HasRoute(p.Route) {
+		return nil, fmt.Errorf("route must be one of %s", strings.Join(drug.Routes, ", "))
+	}
+	line := &Prescription{
+		DrugID:      drug.ID,
+		GenericName: drug.GenericName,
+		Form:        drug.Form,
+		Unit:        drug.DoseUnit,
+		Route:       strings.ToLower(p.Route),
+	}
+	if p.Strength != "" {
+		if !drug.HasStrength(p.Strength) {
+			return nil, fmt.Errorf("strength must be one of %s", strings.Join(drug.Strengths, ", "))
+		}
+		line.Strength = &p.Strength
+	}
+	// the payload has been validated, so these parse
+	dose, _ := parseDose(p.Dose)
+	freq, _ := parseFrequency(p.Frequency)
+	line.Frequency, line.TimesPerDay = freq.label, freq.timesPerDay
+	if p.Duration != "" {
+		days, _ := parseDuration(p.Duration)
+		line.DurationDays = &days
 	}
+	dose, err = drug.ConvertDose(dose, p.Unit)
+	if err != nil {
+		return nil, err
+	}
+	line.Dose = math.Round(dose*1000) / 1000
+	if err = drug.CheckDose(line.Dose, line.TimesPerDay); err != nil {
+		return nil, err
+	}
+	return line, nil
+}
+
+func (s *medicalRecordsService) codeDiagnoses(payload []DiagnosisPayload) ([]Diagnosis, error) {
+	diagnoses, err := codeDiagnoses(s.icd10Service, payload)
+	if errors.Is(err, icd10.ErrCodeNotFound) {
+		return nil, fmt.Errorf("%w: %v", ErrUnknownDiagnosis, err)
+	}
+	return diagnoses, err
+}
+
+// describe adds what is not stored with the record: the catalogue
+// descriptions of its diagnoses and access URLs for its images.
+func (s *medicalRecordsService) describe(record *ListMedicalRecordsResponse) {
+	for i := range record.Diagnoses {
+		d := &record.Diagnoses[i]
+		if code, err := s.icd10Service.Lookup(d.Code); err == nil {
+			d.DescriptionEN, d.DescriptionID = code.DescriptionEN, code.DescriptionID
+		}
+	}
+	for i := range record.Attachments {
+		a := &record.Attachments[i]
+		a.URL = s.presign(a.ImageKey)
+	}
+	record.IdentityDetail.IdentityCardScanImg = s.presign(record.IdentityDetail.IdentityCardScanImg)
+}
+
+// presign returns a short-lived URL of the image, or an empty string
+// when none can be made.
+func (s *medicalRecordsService) presign(key string) string {
+	url, err := s.imageService.PresignURL(key)
+	if err != nil {
+		log.Error().Msg(fmt.Sprintf("Cannot presign image %s: %v", key, err))
+		return ""
+	}
+	return url
+}
+
+// attach checks every image exists and was uploaded by the record's
+// author. Images already attached to the amended version are kept
+// without checking again.
+func (s *medicalRecordsService) attach(ctx context.Context, record *MedicalRecords, payload []AttachmentPayload, previous []Attachment) error {
+	record.Attachments = make([]Attachment, 0, len(payload))
+	for i, a := range payload {
+		attached := slices.ContainsFunc(previous, func(p Attachment) bool { return p.ImageKey == a.ImageKey })
+		if !attached {
+			info, err := s.imageService.Stat(ctx, a.ImageKey)
+			if errors.Is(err, image.ErrImageNotFound) {
+				return fmt.Errorf("%w: attachments[%d]: image %s not found", ErrInvalidAttachment, i, a.ImageKey)
+			}
+			if err != nil {
+				return err
+			}
+			if info.UploadedBy != record.UserID {
+				return fmt.Errorf("%w: attachments[%d]: image %s was uploaded by another user", ErrInvalidAttachment, i, a.ImageKey)
+			}
+		}
+		attachment := Attachment{Type: a.Type, ImageKey: a.ImageKey}
+		if a.Caption != "" {
+			attachment.Caption = &a.Caption
+		}
+		record.Attachments = append(record.Attachments, attachment)
+	}
+	return nil
+}
+
+func (s *medicalRecordsService) GetMedicalRecord(ctx context.Context, id string, req GetRecordPayload) (*MedicalRecordResponse, error) {
+	record, err := s.getResponse(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	res := &MedicalRecordResponse{ListMedicalRecordsResponse: *record}
+	if req.IncludeHistory {
+		res.History, err = s.repository.ListVersions(ctx, record.OriginalID)
+		if err != nil {
+			return nil, err
+		}
+		for i := range res.History {
+			s.describe(&res.History[i])
+		}
+	}
+	return res, nil
+}
+
+// AmendMedicalRecord stores the amendment as a new version. Only the
+// latest version can be amended; the repository rejects a second
+// amendment of the same version with ErrRecordSuperseded.
+func (s *medicalRecordsService) AmendMedicalRecord(ctx context.Context, recordID string, req AmendMedicalRecord) (*ListMedicalRecordsResponse, error) {
+	previous, err := s.repository.GetByID(ctx, recordID)
+	if err != nil {
+		return nil, err
+	}
+	if previous.Locked {
+		return nil, ErrRecordLocked
+	}
+	original := previous
+	if previous.OriginalID != previous.ID {
+		original, err = s.repository.GetByID(ctx, previous.OriginalID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if original.UserID != req.UserId {
+		return nil, ErrNotRecordAuthor
+	}
+
+	amendment := &MedicalRecords{
+		ID:          id.GenerateStringID(16),
+		UserID:      req.UserId,
+		PatientId:   previous.PatientId,
+		Symptoms:    req.Symptoms,
+		Medications: req.Medications,
+		OriginalID:  previous.OriginalID,
+		Version:     previous.Version + 1,
+		AmendsID:    &previous.ID,
+		AmendReason: &req.Reason,
+		Vitals:      previous.Vitals,
+		Diagnoses:   previous.Diagnoses,
+		// the template stays, and so do its values unless replaced
+		TemplateID:     previous.TemplateID,
+		TemplateFields: previous.TemplateFields,
+		Attachments:    previous.Attachments,
+	}
+	switch {
+	case req.Prescriptions != nil:
+		err = s.prescribe(ctx, amendment, req.Prescriptions, req.Medications)
+		if err != nil {
+			return nil, err
+		}
+		err = s.checkInteractions(ctx, amendment, req.InteractionOverrideReason)
+		if err != nil {
+			return nil, err
+		}
+	case req.Medications == "":
+		amendment.Medications, amendment.Prescriptions = previous.Medications, previous.Prescriptions
+		amendment.InteractionWarnings = previous.InteractionWarnings
+		amendment.InteractionOverrideReason = previous.InteractionOverrideReason
+	}
+	if req.Vitals != nil {
+		amendment.Vitals = req.Vitals.model()
+	}
+	if req.Diagnoses != nil {
+		amendment.Diagnoses, err = s.codeDiagnoses(req.Diagnoses)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if req.Attachments != nil {
+		err = s.attach(ctx, amendment, req.Attachments, previous.Attachments)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if req.TemplateFields != nil {
+		if previous.TemplateID == nil {
+			return nil, fmt.Errorf("%w: the record was not written with a template", ErrInvalidTemplateFields)
+		}
+		err = s.applyTemplate(ctx, amendment, *previous.TemplateID, req.TemplateFields)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if amendment.Vitals != nil {
+		amendment.Vitals.scoreNEWS2(s.thresholds)
+	}
+	amendment.ReviewStatus = reviewStatusFor(amendment)
+	err = s.repository.Create(ctx, amendment)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.getResponse(ctx, amendment.ID)
+	if err != nil {
+		return nil, err
+	}
+	// carried over vitals have already been alerted on
+	if req.Vitals != nil && amendment.Vitals.NEWS2Alert {
+		s.publishAlert(ctx, amendment, strconv.FormatInt(res.IdentityDetail.IdentityNumber, 10))
+	}
+	return res, nil
+}
+
+func (s *medicalRecordsService) publishAlert(ctx context.Context, record *MedicalRecords, identityNumber string) {
+	v := record.Vitals
+	s.alerts.Publish(ctx, DeteriorationAlert{
+		RecordID:       record.ID,
+		PatientID:      record.PatientId,
+		IdentityNumber: identityNumber,
+		Ward:           v.Ward,
+		Score:          *v.NEWS2Score,
+		Risk:           *v.NEWS2Risk,
+		MeasuredAt:     v.MeasuredAt,
+		RecordedBy:     record.UserID,
+	})
+}
+
+func (s *medicalRecordsService) ListMedicalRecords(ctx context.Context, req ListRecordsPayload) ([]ListMedicalRecordsResponse, *response.Pagination, error) {
+	var err error
+	req.Limit, req.Offset = query.NormalizePage(req.Limit, req.Offset)
 
 	if req.CreatedAt == "" {
 		req.CreatedAt = "desc"
 	}
 
-	res, err := s.repository.List(ctx, req)
+	from, to, err := parseTimeRange(req.CreatedFrom, req.CreatedTo)
+	if err != nil {
+		return nil, nil, err
+	}
+	if from != nil || to != nil {
+		req.conditions = append(req.conditions, query.Range("medical_records.created_at", query.AtIfSet(from), query.AtIfSet(to)))
+	}
+	req.Q = strings.TrimSpace(req.Q)
+	if req.Q != "" {
+		req.conditions = append(req.conditions, searchCondition(req.Q))
+	}
+
+	if req.Cursor != "" {
+		req.after, err = s.cursors.Decode(req.Cursor)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err = req.after.Check(req.fingerprint()); err != nil {
+			return nil, nil, err
+		}
+		if req.Sort != "" && strings.TrimPrefix(req.Sort, "-") != "createdAt" {
+			return nil, nil, fmt.Errorf("%w: cursor paging only supports sorting by createdAt", query.ErrInvalidSort)
+		}
+		req.Offset = 0
+		req.sorts = []query.Sort{{Column: "medical_records.created_at", Desc: req.after.Desc}}
+	} else {
+		req.sorts, err = query.ParseSort(req.Sort, listSortFields)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(req.sorts) == 0 && (req.CreatedAt == "asc" || req.CreatedAt == "desc") {
+			req.sorts = []query.Sort{{Column: "medical_records.created_at", Desc: req.CreatedAt == "desc"}}
+		}
+	}
+	// ties on created_at are broken by id so the order is total and
+	// the last row of a page can serve as a cursor
+	if len(req.sorts) == 1 && req.sorts[0].Column == "medical_records.created_at" {
+		req.sorts = append(req.sorts, query.Sort{Column: "medical_records.id", Desc: req.sorts[0].Desc})
+		req.keyset = true
+	}
+
+	res, meta, err := s.repository.List(ctx, req)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range res {
+		s.describe(&res[i])
+	}
+	if req.keyset && len(res) == req.Limit {
+		last := res[len(res)-1]
+		meta.NextCursor = s.cursors.Encode(cursor.Cursor{CreatedAt: last.createdAt, ID: last.ID, Desc: req.sorts[0].Desc, Query: req.fingerprint()})
+	}
+	return res, meta, nil
+}
+
+// ListReviewInbox lists the latest versions waiting for a co-signature
+// that userID is allowed to give, i.e. those written by someone else.
+func (s *medicalRecordsService) ListReviewInbox(ctx context.Context, userID string, req ListRecordsPayload) ([]ListMedicalRecordsResponse, *response.Pagination, error) {
+	req.IncludeHistory = false
+	req.conditions = append(req.conditions,
+		query.Eq("medical_records.review_status", ReviewPending),
+		query.Raw("medical_records.user_id <> ?", userID),
+	)
+	if req.CreatedAt == "" && req.Sort == "" {
+		// oldest first, so nothing waits forever
+		req.CreatedAt = "asc"
+	}
+	return s.ListMedicalRecords(ctx, req)
+}
+
+func (s *medicalRecordsService) ReviewMedicalRecord(ctx context.Context, recordID string, req ReviewMedicalRecord) (*ListMedicalRecordsResponse, error) {
+	record, err := s.getResponse(ctx, recordID)
+	if err != nil {
+		return nil, err
+	}
+	if record.ReviewStatus != ReviewPending {
+		return nil, ErrRecordNotPendingReview
+	}
+	if !record.Latest {
+		return nil, ErrRecordSuperseded
+	}
+	if record.CreatedBy.UserID == req.UserId {
+		return nil, ErrSelfReview
+	}
+
+	status := ReviewApproved
+	if req.Decision == Reject {
+		status = ReviewRejected
+	}
+	var comment *string
+	if req.Comment != "" {
+		comment = &req.Comment
+	}
+	err = s.repository.Review(ctx, recordID, status, req.UserId, comment)
+	if err != nil {
+		return nil, err
+	}
+	return s.getResponse(ctx, recordID)
+}
+
+func reviewStatusFor(r *MedicalRecords) ReviewStatus {
+	if requiresCoSignature(r.Medications) {
+		return ReviewPending
+	}
+	return ReviewNotRequired
+}
+
+func (s *medicalRecordsService) LockDueRecords(ctx context.Context) (int, error) {
+	patientIDs, err := s.repository.ListPatientsWithDueRecords(ctx)
+	if err != nil {
+		return 0, err
+	}
+	locked := 0
+	for _, patientID := range patientIDs {
+		n, err := s.repository.LockDueRecords(ctx, patientID)
+		if err != nil {
+			return locked, err
+		}
+		locked += n
+	}
+	return locked, nil
+}
+
+// VerifyChain walks the patient's signed records in chain order and
+// reports every link whose sequence, hash or signature does not hold.
+func (s *medicalRecordsService) VerifyChain(ctx context.Context, identityNumber string) (*ChainVerificationResponse, error) {
+	patient, err := s.patientRepository.GetByIdentityNumber(ctx, identityNumber)
+	if err != nil {
+		return nil, err
+	}
+	chain, err := s.repository.ListChain(ctx, patient.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &ChainVerificationResponse{
+		IdentityNumber: identityNumber,
+		Verified:       len(chain),
+		Breaks:         make([]ChainBreak, 0),
+	}
+	var expectedSeq int64 = 1
+	expectedPrev := ""
+	for i := range chain {
+		r := &chain[i]
+		seq := *r.ChainSeq
+		prevHash := ""
+		if r.PrevHash != nil {
+			prevHash = *r.PrevHash
+		}
+		if seq != expectedSeq {
+			res.Breaks = append(res.Breaks, ChainBreak{RecordID: r.ID, ChainSeq: seq,
+				Reason: fmt.Sprintf("expected sequence %d, records are missing", expectedSeq)})
+		}
+		if prevHash != expectedPrev {
+			res.Breaks = append(res.Breaks, ChainBreak{RecordID: r.ID, ChainSeq: seq,
+				Reason: "previous hash does not match the preceding record"})
+		}
+		format := 0
+		if r.HashFormat != nil {
+			format = *r.HashFormat
+		}
+		hash, err := chainHash(format, prevHash, r)
+		if errors.Is(err, ErrUnknownHashFormat) {
+			res.Breaks = append(res.Breaks, ChainBreak{RecordID: r.ID, ChainSeq: seq,
+				Reason: fmt.Sprintf("hash format %d is unknown", format)})
+		} else if err != nil {
+			return nil, err
+		} else if r.ContentHash == nil || *r.ContentHash != hash {
+			res.Breaks = append(res.Breaks, ChainBreak{RecordID: r.ID, ChainSeq: seq,
+				Reason: "content does not match its hash"})
+		} else if r.Signature == nil || !s.signer.validSignature(hash, *r.Signature) {
+			res.Breaks = append(res.Breaks, ChainBreak{RecordID: r.ID, ChainSeq: seq,
+				Reason: "signature is invalid"})
+		}
+		expectedSeq = seq + 1
+		if r.ContentHash != nil {
+			expectedPrev = *r.ContentHash
+		}
+	}
+	res.Valid = len(res.Breaks) == 0
+	return res, nil
+}
+
+const (
+	defaultTrendRange = 30 * 24 * time.Hour
+	maxTrendPoints    = 1000
+)
+
+// GetVitalsTrend returns the patient's vitals over [from, to], which
+// defaults to the last 30 days, oldest first. Beyond maxTrendPoints the
+// oldest are left out, as the latest matter most.
+func (s *medicalRecordsService) GetVitalsTrend(ctx context.Context, identityNumber string, req VitalsTrendPayload) (*VitalsTrendResponse, error) {
+	fromBound, toBound, err := parseTimeRange(req.From, req.To)
+	if err != nil {
+		return nil, err
+	}
+	to := time.Now().UTC()
+	if toBound != nil {
+		to = *toBound
+	}
+	from := to.Add(-defaultTrendRange)
+	if fromBound != nil {
+		from = *fromBound
+	}
+	if from.After(to) {
+		return nil, fmt.Errorf("%w: from must not be after to", ErrInvalidDateRange)
+	}
+
+	patient, err := s.patientRepository.GetByIdentityNumber(ctx, identityNumber)
 	if err != nil {
 		return nil, err
 	}
+	points, err := s.repository.ListVitals(ctx, patient.ID, from, to, maxTrendPoints+1)
+	if err != nil {
+		return nil, err
+	}
+	res := &VitalsTrendResponse{
+		IdentityNumber: identityNumber,
+		From:           from,
+		To:             to,
+		Points:         points,
+	}
+	if len(points) > maxTrendPoints {
+		res.Points, res.Truncated = points[:maxTrendPoints], true
+	}
+	slices.Reverse(res.Points)
 	return res, nil
 }
+
+// parseTimeRange reads optional bounds given as a date or an RFC 3339
+// time; a date as upper bound includes the whole day. A bound left empty
+// is nil.
+func parseTimeRange(fromParam, toParam string) (from, to *time.Time, err error) {
+	if fromParam != "" {
+		t, _, err := parseTimeBound(fromParam)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: from %v", ErrInvalidDateRange, err)
+		}
+		from = &t
+	}
+	if toParam != "" {
+		t, isDate, err := parseTimeBound(toParam)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: to %v", ErrInvalidDateRange, err)
+		}
+		if isDate {
+			t = t.Add(24*time.Hour - time.Nanosecond)
+		}
+		to = &t
+	}
+	if from != nil && to != nil && from.After(*to) {
+		return nil, nil, fmt.Errorf("%w: from must not be after to", ErrInvalidDateRange)
+	}
+	return from, to, nil
+}
+
+func parseTimeBound(s string) (t time.Time, isDate bool, err error) {
+	if t, err = time.Parse(time.DateOnly, s); err == nil {
+		return t, true, nil
+	}
+	t, err = time.Parse(time.RFC3339, s)
+	if err != nil {
+		return t, false, errors.New("must be a date or an RFC 3339 time")
+	}
+	return t.UTC(), false, nil
+}
+
+func (s *medicalRecordsService) ListDeteriorating(ctx context.Context, req DeterioratingPayload) ([]WardDeterioration, error) {
+	patients, err := s.repository.ListDeteriorating(ctx, req.Ward, time.Now().Add(-s.thresholds.Window))
+	if err != nil {
+		return nil, err
+	}
+	// the repository orders by ward, so each ward is one run
+	res := make([]WardDeterioration, 0)
+	for _, p := range patients {
+		p.IdentityDetail.IdentityCardScanImg = s.presign(p.IdentityDetail.IdentityCardScanImg)
+		if n := len(res); n == 0 || !sameWard(res[n-1].Ward, p.Vitals.Ward) {
+			res = append(res, WardDeterioration{Ward: p.Vitals.Ward})
+		}
+		res[len(res)-1].Patients = append(res[len(res)-1].Patients, p)
+	}
+	return res, nil
+}
+
+func sameWard(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
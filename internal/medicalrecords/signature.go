@@ -0,0 +1,238 @@
+package medicalrecords
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// MinSigningKeyLength is the shortest signing key accepted. With an
+// empty or short key anyone could forge signatures.
+const MinSigningKeyLength = 32
+
+// Signer signs chain hashes with the server key.
+type Signer struct {
+	key []byte
+}
+
+func NewSigner(key []byte) (*Signer, error) {
+	if len(key) < MinSigningKeyLength {
+		return nil, ErrSigningKeyTooShort
+	}
+	return &Signer{key: key}, nil
+}
+
+// Hash formats. A record is hashed in the format it was signed with,
+// which is stored along with it, so changing how records are hashed does
+// not break the chains already signed. Content added to records needs a
+// new format.
+const (
+	// HashFormatJSON marshalled the content as JSON. Its hash depends on
+	// the shape of the structs marshalled, which are frozen in
+	// legacyhash.go.
+	HashFormatJSON = 1
+	// HashFormatCanonical writes a fixed list of fields, see
+	// canonicalContent.
+	HashFormatCanonical = 2
+
+	// CurrentHashFormat is what records are signed with.
+	CurrentHashFormat = HashFormatCanonical
+)
+
+// chainHash hashes the record content together with the hash of the
+// record before it in the patient's chain, so removing or editing any
+// earlier record changes every hash after it.
+func chainHash(format int, prevHash string, r *MedicalRecords) (string, error) {
+	var content []byte
+	var err error
+	switch format {
+	case HashFormatJSON:
+		content, err = jsonContent(prevHash, r)
+	case HashFormatCanonical:
+		content, err = canonicalContent(prevHash, r)
+	default:
+		return "", fmt.Errorf("%w: %d", ErrUnknownHashFormat, format)
+	}
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// canonicalContent writes the format byte and then every field in a
+// fixed order. Strings are length-prefixed, numbers fixed-size, optional
+// values preceded by whether they are present and lists by their length.
+func canonicalContent(prevHash string, r *MedicalRecords) ([]byte, error) {
+	c := &canonicalWriter{}
+	c.WriteByte(HashFormatCanonical)
+	c.string(prevHash)
+	c.string(r.ID)
+	c.string(r.PatientId)
+	c.string(r.UserID)
+	c.string(r.OriginalID)
+	c.int(int64(r.Version))
+	c.optString(r.AmendsID)
+	c.optString(r.AmendReason)
+	c.string(r.Symptoms)
+	c.string(r.Medications)
+	c.time(r.CreatedAt)
+
+	c.present(r.Vitals != nil)
+	if v := r.Vitals; v != nil {
+		c.time(v.MeasuredAt)
+		c.optFloat(v.TemperatureC)
+		c.optInt(v.SystolicMmHg)
+		c.optInt(v.DiastolicMmHg)
+		c.optInt(v.HeartRateBpm)
+		c.optInt(v.RespiratoryRate)
+		c.optInt(v.SpO2Pct)
+		c.optFloat(v.WeightKg)
+		c.optFloat(v.HeightCm)
+		c.optInt(v.PainScore)
+		c.optString(v.Ward)
+		c.optInt(v.SpO2Scale)
+		c.optBool(v.SupplementalOxygen)
+		c.optString((*string)(v.Consciousness))
+		c.optInt(v.NEWS2Score)
+		c.optString((*string)(v.NEWS2Risk))
+		c.bool(v.NEWS2Alert)
+	}
+
+	c.int(int64(len(r.Diagnoses)))
+	for _, d := range r.Diagnoses {
+		c.string(d.Code)
+		c.string(string(d.Type))
+		c.string(d.Chapter)
+	}
+
+	c.int(int64(len(r.Prescriptions)))
+	for _, p := range r.Prescriptions {
+		c.string(p.DrugID)
+		c.string(p.GenericName)
+		c.string(p.Form)
+		c.optString(p.Strength)
+		c.float(p.Dose)
+		c.string(p.Unit)
+		c.string(p.Route)
+		c.string(p.Frequency)
+		c.optFloat(p.TimesPerDay)
+		c.optInt(p.DurationDays)
+	}
+
+	c.int(int64(len(r.InteractionWarnings)))
+	for _, w := range r.InteractionWarnings {
+		c.string(string(w.Kind))
+		c.string(string(w.Severity))
+		c.string(w.Drug)
+		c.string(w.With)
+		c.string(w.Description)
+	}
+	c.optString(r.InteractionOverrideReason)
+
+	c.optString(r.TemplateID)
+	keys := make([]string, 0, len(r.TemplateFields))
+	for k := range r.TemplateFields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	c.int(int64(len(keys)))
+	for _, k := range keys {
+		// values are what the template field types allow: strings,
+		// numbers, booleans and lists of them
+		value, err := json.Marshal(r.TemplateFields[k])
+		if err != nil {
+			return nil, fmt.Errorf("cannot hash template field %s: %w", k, err)
+		}
+		c.string(k)
+		c.string(string(value))
+	}
+
+	c.int(int64(len(r.Attachments)))
+	for _, a := range r.Attachments {
+		c.string(string(a.Type))
+		c.string(a.ImageKey)
+		c.optString(a.Caption)
+	}
+	return c.Bytes(), nil
+}
+
+type canonicalWriter struct {
+	bytes.Buffer
+}
+
+func (c *canonicalWriter) int(n int64) {
+	c.Write(binary.BigEndian.AppendUint64(nil, uint64(n)))
+}
+
+func (c *canonicalWriter) float(f float64) {
+	c.Write(binary.BigEndian.AppendUint64(nil, math.Float64bits(f)))
+}
+
+func (c *canonicalWriter) string(s string) {
+	c.int(int64(len(s)))
+	c.WriteString(s)
+}
+
+func (c *canonicalWriter) bool(b bool) {
+	if b {
+		c.WriteByte(1)
+	} else {
+		c.WriteByte(0)
+	}
+}
+
+func (c *canonicalWriter) present(ok bool) {
+	c.bool(ok)
+}
+
+func (c *canonicalWriter) time(t time.Time) {
+	c.string(t.UTC().Format(time.RFC3339Nano))
+}
+
+func (c *canonicalWriter) optString(s *string) {
+	c.present(s != nil)
+	if s != nil {
+		c.string(*s)
+	}
+}
+
+func (c *canonicalWriter) optInt(n *int) {
+	c.present(n != nil)
+	if n != nil {
+		c.int(int64(*n))
+	}
+}
+
+func (c *canonicalWriter) optFloat(f *float64) {
+	c.present(f != nil)
+	if f != nil {
+		c.float(*f)
+	}
+}
+
+func (c *canonicalWriter) optBool(b *bool) {
+	c.present(b != nil)
+	if b != nil {
+		c.bool(*b)
+	}
+}
+
+// sign binds a chain hash to the server key; without the key a forged
+// chain cannot carry valid signatures.
+func (s *Signer) sign(hash string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(hash))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *Signer) validSignature(hash, signature string) bool {
+	return hmac.Equal([]byte(s.sign(hash)), []byte(signature))
+}
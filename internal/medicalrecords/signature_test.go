@@ -0,0 +1,327 @@
+package medicalrecords
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/citadel-corp/halosuster/internal/interactions"
+	"github.com/citadel-corp/halosuster/internal/medicalpatients"
+)
+
+var testSigningKey = []byte(strings.Repeat("k", MinSigningKeyLength))
+
+func testRecord(id string) MedicalRecords {
+	return MedicalRecords{
+		ID:          id,
+		UserID:      "user000000000001",
+		PatientId:   "patient000000001",
+		Symptoms:    "fever",
+		Medications: "paracetamol",
+		OriginalID:  id,
+		Version:     1,
+		CreatedAt:   time.Date(2024, 5, 1, 8, 30, 0, 0, time.UTC),
+	}
+}
+
+func TestNewSigner(t *testing.T) {
+	for _, key := range [][]byte{nil, []byte(""), testSigningKey[:MinSigningKeyLength-1]} {
+		if _, err := NewSigner(key); !errors.Is(err, ErrSigningKeyTooShort) {
+			t.Errorf("NewSigner(%d bytes) error = %v, want ErrSigningKeyTooShort", len(key), err)
+		}
+	}
+	if _, err := NewSigner(testSigningKey); err != nil {
+		t.Errorf("NewSigner() error = %v", err)
+	}
+}
+
+func TestChainHashJSON(t *testing.T) {
+	// records signed in this format are verified against these, so they
+	// must not change
+	tests := []struct {
+		name   string
+		record MedicalRecords
+		prev   string
+		want   string
+	}{
+		{name: "plain", record: testRecord("record0000000001"), want: "99ecde6ff053bd618ac523bc4fefe9d2b9ba9df7d57d5bf79f4cf6d8a4c50c43"},
+		{name: "full", record: fullRecord(), prev: "prev", want: "790f6e20d6dce5bcf11958ca382a7afd397ab5611dff1fe3393ce7e4545f87d8"},
+	}
+	for _, tt := range tests {
+		hash, err := chainHash(HashFormatJSON, tt.prev, &tt.record)
+		if err != nil {
+			t.Fatalf("chainHash(%s) error = %v", tt.name, err)
+		}
+		if hash != tt.want {
+			t.Errorf("chainHash(%s) = %s, want %s", tt.name, hash, tt.want)
+		}
+	}
+
+	// optional parts left empty hash like records made before they existed
+	r := testRecord("record0000000001")
+	empty := r
+	empty.Diagnoses, empty.Prescriptions, empty.Attachments = []Diagnosis{}, []Prescription{}, []Attachment{}
+	if got := mustHash(t, HashFormatJSON, "", &empty); got != tests[0].want {
+		t.Errorf("chainHash() with empty optional parts = %s, want %s", got, tests[0].want)
+	}
+}
+
+func TestChainHashCanonical(t *testing.T) {
+	// checked against an encoder written apart from this one
+	tests := []struct {
+		name   string
+		record MedicalRecords
+		prev   string
+		want   string
+	}{
+		{name: "plain", record: testRecord("record0000000001"), want: "c70ba53c3d938a8fdfdaea598db2030f0f258e82912411e1e68f8ad2f076349f"},
+		{name: "full", record: fullRecord(), prev: "prev", want: "4b4fafb4d0737416cebde0f2a27c0cc82df87d35c391c69f72bb40e931982564"},
+	}
+	for _, tt := range tests {
+		if got := mustHash(t, HashFormatCanonical, tt.prev, &tt.record); got != tt.want {
+			t.Errorf("chainHash(%s) = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestChainHashChanges(t *testing.T) {
+	for _, format := range []int{HashFormatJSON, HashFormatCanonical} {
+		r := fullRecord()
+		hash := mustHash(t, format, "", &r)
+
+		// the time zone a time was read in does not matter
+		local := fullRecord()
+		local.CreatedAt = r.CreatedAt.In(time.FixedZone("WIB", 7*60*60))
+		local.Vitals.MeasuredAt = r.Vitals.MeasuredAt.In(time.FixedZone("WIB", 7*60*60))
+		if got := mustHash(t, format, "", &local); got != hash {
+			t.Errorf("chainHash(%d) in another time zone = %s, want %s", format, got, hash)
+		}
+
+		changes := map[string]func(r *MedicalRecords){
+			"symptoms":       func(r *MedicalRecords) { r.Symptoms = "cough" },
+			"medications":    func(r *MedicalRecords) { r.Medications = "ibuprofen" },
+			"author":         func(r *MedicalRecords) { r.UserID = "user000000000002" },
+			"created at":     func(r *MedicalRecords) { r.CreatedAt = r.CreatedAt.Add(time.Microsecond) },
+			"vitals":         func(r *MedicalRecords) { r.Vitals.PainScore = ptr(3) },
+			"diagnoses":      func(r *MedicalRecords) { r.Diagnoses[0].Code = "A01.1" },
+			"prescriptions":  func(r *MedicalRecords) { r.Prescriptions[0].Dose = 2 },
+			"warnings":       func(r *MedicalRecords) { r.InteractionWarnings = nil },
+			"template field": func(r *MedicalRecords) { r.TemplateFields["healed"] = true },
+			"attachments":    func(r *MedicalRecords) { r.Attachments[0].Caption = nil },
+		}
+		for name, change := range changes {
+			changed := fullRecord()
+			change(&changed)
+			if mustHash(t, format, "", &changed) == hash {
+				t.Errorf("chainHash(%d) did not change with the %s", format, name)
+			}
+		}
+		if mustHash(t, format, hash, &r) == hash {
+			t.Errorf("chainHash(%d) did not change with the previous hash", format)
+		}
+	}
+
+	r := testRecord("record0000000001")
+	if mustHash(t, HashFormatJSON, "", &r) == mustHash(t, HashFormatCanonical, "", &r) {
+		t.Error("chainHash() is the same in both formats")
+	}
+	if _, err := chainHash(0, "", &r); !errors.Is(err, ErrUnknownHashFormat) {
+		t.Errorf("chainHash(0) error = %v, want ErrUnknownHashFormat", err)
+	}
+}
+
+func mustHash(t *testing.T, format int, prevHash string, r *MedicalRecords) string {
+	t.Helper()
+	hash, err := chainHash(format, prevHash, r)
+	if err != nil {
+		t.Fatalf("chainHash() error = %v", err)
+	}
+	return hash
+}
+
+// fullRecord has every optional part of a record.
+func fullRecord() MedicalRecords {
+	r := testRecord("record0000000002")
+	amends, reason, override, template := "record0000000001", "typo", "monitored", "template00000001"
+	strength, caption := "500 mg", "left arm"
+	temperature, timesPerDay := 38.2, 3.0
+	consciousness, risk := Alert, RiskLowMedium
+	oxygen := true
+	r.OriginalID, r.Version, r.AmendsID, r.AmendReason = "record0000000001", 2, &amends, &reason
+	r.Vitals = &Vitals{
+		MeasuredAt:         time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC),
+		TemperatureC:       &temperature,
+		SystolicMmHg:       ptr(120),
+		HeartRateBpm:       ptr(95),
+		SpO2Scale:          ptr(SpO2Scale1),
+		SupplementalOxygen: &oxygen,
+		Consciousness:      &consciousness,
+		NEWS2Score:         ptr(3),
+		NEWS2Risk:          &risk,
+		NEWS2Alert:         true,
+	}
+	r.Diagnoses = []Diagnosis{{Code: "A01.0", Type: PrimaryDiagnosis, Chapter: "I"}}
+	r.Prescriptions = []Prescription{{DrugID: "drug000000000001", GenericName: "paracetamol", Form: "tablet",
+		Strength: &strength, Dose: 1, Unit: "tablet", Route: "oral", Frequency: "3x1", TimesPerDay: &timesPerDay, DurationDays: ptr(5)}}
+	r.InteractionWarnings = []interactions.Warning{{Kind: interactions.DrugDrug, Severity: interactions.Severe, Drug: "paracetamol", With: "warfarin", Description: "bleeding"}}
+	r.InteractionOverrideReason = &override
+	r.TemplateID = &template
+	r.TemplateFields = map[string]any{"woundSize": 2.5, "dressing": "dry", "healed": false}
+	r.Attachments = []Attachment{{Type: AttachmentPhoto, ImageKey: "key", Caption: &caption}}
+	return r
+}
+
+func TestSignature(t *testing.T) {
+	signer, err := NewSigner(testSigningKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewSigner([]byte(strings.Repeat("x", MinSigningKeyLength)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := testRecord("record0000000001")
+	hash := mustHash(t, CurrentHashFormat, "", &r)
+	signature := signer.sign(hash)
+	if !signer.validSignature(hash, signature) {
+		t.Error("validSignature() rejected its own signature")
+	}
+	if other.validSignature(hash, signature) {
+		t.Error("validSignature() accepted a signature made with another key")
+	}
+	if signer.validSignature(mustHash(t, CurrentHashFormat, hash, &r), signature) {
+		t.Error("validSignature() accepted the signature of another hash")
+	}
+}
+
+// chainRepository serves a fixed chain; every other method panics.
+type chainRepository struct {
+	Repository
+	chain []MedicalRecords
+}
+
+func (c *chainRepository) ListChain(ctx context.Context, patientID string) ([]MedicalRecords, error) {
+	return c.chain, nil
+}
+
+type patientRepository struct {
+	medicalpatients.Repository
+}
+
+func (patientRepository) GetByIdentityNumber(ctx context.Context, idNumber string) (*medicalpatients.MedicalPatients, error) {
+	return &medicalpatients.MedicalPatients{ID: "patient000000001"}, nil
+}
+
+// signedChain links and signs records as LockDueRecords does.
+func signedChain(t *testing.T, signer *Signer, n int) []MedicalRecords {
+	chain := make([]MedicalRecords, n)
+	prevHash := ""
+	for i := range chain {
+		r := testRecord("record000000000" + string(rune('1'+i)))
+		seq := int64(i + 1)
+		format := CurrentHashFormat
+		hash := mustHash(t, format, prevHash, &r)
+		signature := signer.sign(hash)
+		r.ChainSeq, r.ContentHash, r.HashFormat, r.Signature = &seq, &hash, &format, &signature
+		if prevHash != "" {
+			prev := prevHash
+			r.PrevHash = &prev
+		}
+		chain[i] = r
+		prevHash = hash
+	}
+	return chain
+}
+
+func TestVerifyChain(t *testing.T) {
+	signer, err := NewSigner(testSigningKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		tamper     func(chain []MedicalRecords) []MedicalRecords
+		wantBreaks []string
+	}{
+		{
+			name:   "intact",
+			tamper: func(chain []MedicalRecords) []MedicalRecords { return chain },
+		},
+		{
+			name: "edited content",
+			tamper: func(chain []MedicalRecords) []MedicalRecords {
+				chain[1].Symptoms = "nothing"
+				return chain
+			},
+			wantBreaks: []string{"content does not match its hash"},
+		},
+		{
+			name: "rehashed without the key",
+			tamper: func(chain []MedicalRecords) []MedicalRecords {
+				chain[2].Symptoms = "nothing"
+				hash := mustHash(t, CurrentHashFormat, *chain[2].PrevHash, &chain[2])
+				chain[2].ContentHash = &hash
+				return chain
+			},
+			wantBreaks: []string{"signature is invalid"},
+		},
+		{
+			name: "removed record",
+			tamper: func(chain []MedicalRecords) []MedicalRecords {
+				return append(chain[:1], chain[2:]...)
+			},
+			wantBreaks: []string{"expected sequence 2, records are missing", "previous hash does not match the preceding record"},
+		},
+		{
+			name: "unsigned record",
+			tamper: func(chain []MedicalRecords) []MedicalRecords {
+				chain[0].Signature = nil
+				return chain
+			},
+			wantBreaks: []string{"signature is invalid"},
+		},
+		{
+			name: "signed in an earlier format",
+			tamper: func(chain []MedicalRecords) []MedicalRecords {
+				format := HashFormatJSON
+				hash := mustHash(t, format, *chain[2].PrevHash, &chain[2])
+				signature := signer.sign(hash)
+				chain[2].HashFormat, chain[2].ContentHash, chain[2].Signature = &format, &hash, &signature
+				return chain
+			},
+		},
+		{
+			name: "unknown format",
+			tamper: func(chain []MedicalRecords) []MedicalRecords {
+				chain[2].HashFormat = ptr(9)
+				return chain
+			},
+			wantBreaks: []string{"hash format 9 is unknown"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &medicalRecordsService{
+				repository:        &chainRepository{chain: tt.tamper(signedChain(t, signer, 3))},
+				patientRepository: patientRepository{},
+				signer:            signer,
+			}
+			res, err := s.VerifyChain(context.Background(), "1234567890123456")
+			if err != nil {
+				t.Fatalf("VerifyChain() error = %v", err)
+			}
+			if res.Valid != (len(tt.wantBreaks) == 0) {
+				t.Errorf("VerifyChain() valid = %v with breaks %+v", res.Valid, res.Breaks)
+			}
+			reasons := make([]string, len(res.Breaks))
+			for i, b := range res.Breaks {
+				reasons[i] = b.Reason
+			}
+			if strings.Join(reasons, "; ") != strings.Join(tt.wantBreaks, "; ") {
+				t.Errorf("VerifyChain() breaks = %q, want %q", reasons, tt.wantBreaks)
+			}
+		})
+	}
+}
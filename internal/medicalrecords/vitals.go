@@ -0,0 +1,279 @@
+package medicalrecords
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+// Measurement is a single vital sign as sent by the client. Unit may be
+// left empty for the canonical unit of the sign.
+type Measurement struct {
+	Value float64 `json:"value"`
+	Unit  string  `json:"unit"`
+}
+
+type BloodPressure struct {
+	Systolic  float64 `json:"systolic"`
+	Diastolic float64 `json:"diastolic"`
+	Unit      string  `json:"unit"`
+}
+
+// VitalSigns is one observation set in the API. Every sign is optional
+// but at least one has to be present. NEWS2 is computed by the server
+// once the set has every parameter the score needs.
+type VitalSigns struct {
+	MeasuredAt         *time.Time     `json:"measuredAt,omitempty"`
+	Ward               *string        `json:"ward,omitempty"`
+	Temperature        *Measurement   `json:"temperature,omitempty"`
+	BloodPressure      *BloodPressure `json:"bloodPressure,omitempty"`
+	HeartRate          *Measurement   `json:"heartRate,omitempty"`
+	RespiratoryRate    *Measurement   `json:"respiratoryRate,omitempty"`
+	SpO2               *Measurement   `json:"spo2,omitempty"`
+	SpO2Scale          *int           `json:"spo2Scale,omitempty"`
+	SupplementalOxygen *bool          `json:"supplementalOxygen,omitempty"`
+	Consciousness      *Consciousness `json:"consciousness,omitempty"`
+	Weight             *Measurement   `json:"weight,omitempty"`
+	Height             *Measurement   `json:"height,omitempty"`
+	PainScore          *Measurement   `json:"painScore,omitempty"`
+	NEWS2              *NEWS2Result   `json:"news2,omitempty"`
+}
+
+type NEWS2Result struct {
+	Score int       `json:"score"`
+	Risk  NEWS2Risk `json:"risk"`
+	Alert bool      `json:"alert"`
+}
+
+// Vitals is an observation set as stored, always in canonical units.
+// MeasuredAt defaults to the creation time of the record.
+type Vitals struct {
+	MeasuredAt      time.Time `json:"measuredAt"`
+	TemperatureC    *float64  `json:"temperatureC"`
+	SystolicMmHg    *int      `json:"systolicMmHg"`
+	DiastolicMmHg   *int      `json:"diastolicMmHg"`
+	HeartRateBpm    *int      `json:"heartRateBpm"`
+	RespiratoryRate *int      `json:"respiratoryRate"`
+	SpO2Pct         *int      `json:"spo2Pct"`
+	WeightKg        *float64  `json:"weightKg"`
+	HeightCm        *float64  `json:"heightCm"`
+	PainScore       *int      `json:"painScore"`
+
+	Ward               *string        `json:"ward,omitempty"`
+	SpO2Scale          *int           `json:"spo2Scale,omitempty"`
+	SupplementalOxygen *bool          `json:"supplementalOxygen,omitempty"`
+	Consciousness      *Consciousness `json:"consciousness,omitempty"`
+	NEWS2Score         *int           `json:"news2Score,omitempty"`
+	NEWS2Risk          *NEWS2Risk     `json:"news2Risk,omitempty"`
+	NEWS2Alert         bool           `json:"news2Alert,omitempty"`
+}
+
+// vitalSpec is the canonical unit of a sign, the physiologically
+// plausible range in that unit and the other units accepted on input.
+type vitalSpec struct {
+	unit     string
+	min, max float64
+	decimals int
+	convert  map[string]func(float64) float64
+}
+
+var (
+	temperatureSpec = vitalSpec{unit: "C", min: 25, max: 45, decimals: 1, convert: map[string]func(float64) float64{
+		"F": func(f float64) float64 { return (f - 32) * 5 / 9 },
+	}}
+	systolicSpec        = vitalSpec{unit: "mmHg", min: 40, max: 300}
+	diastolicSpec       = vitalSpec{unit: "mmHg", min: 20, max: 200}
+	heartRateSpec       = vitalSpec{unit: "bpm", min: 20, max: 300}
+	respiratoryRateSpec = vitalSpec{unit: "/min", min: 2, max: 80}
+	spo2Spec            = vitalSpec{unit: "%", min: 50, max: 100}
+	weightSpec          = vitalSpec{unit: "kg", min: 0.3, max: 500, decimals: 2, convert: map[string]func(float64) float64{
+		"g":  func(g float64) float64 { return g / 1000 },
+		"lb": func(lb float64) float64 { return lb * 0.45359237 },
+	}}
+	heightSpec = vitalSpec{unit: "cm", min: 20, max: 280, decimals: 1, convert: map[string]func(float64) float64{
+		"m":  func(m float64) float64 { return m * 100 },
+		"in": func(in float64) float64 { return in * 2.54 },
+	}}
+	painScoreSpec = vitalSpec{unit: "0-10", min: 0, max: 10}
+)
+
+// canonical converts value to the canonical unit of the sign, rounded to
+// the precision it is stored with, and checks it is in range.
+func (s vitalSpec) canonical(value float64, unit string) (float64, error) {
+	if unit != "" && unit != s.unit {
+		convert, ok := s.convert[unit]
+		if !ok {
+			return 0, fmt.Errorf("unit must be one of %s", strings.Join(s.units(), ", "))
+		}
+		value = convert(value)
+	}
+	scale := math.Pow(10, float64(s.decimals))
+	value = math.Round(value*scale) / scale
+	if value < s.min || value > s.max {
+		return 0, fmt.Errorf("must be between %g and %g %s", s.min, s.max, s.unit)
+	}
+	return value, nil
+}
+
+func (s vitalSpec) units() []string {
+	units := []string{s.unit}
+	for u := range s.convert {
+		units = append(units, u)
+	}
+	sort.Strings(units[1:])
+	return units
+}
+
+func measurementRule(s vitalSpec) validation.RuleFunc {
+	return func(value interface{}) error {
+		m, _ := value.(*Measurement)
+		if m == nil {
+			return nil
+		}
+		_, err := s.canonical(m.Value, m.Unit)
+		return err
+	}
+}
+
+func validBloodPressure(value interface{}) error {
+	bp, _ := value.(*BloodPressure)
+	if bp == nil {
+		return nil
+	}
+	if bp.Unit != "" && bp.Unit != systolicSpec.unit {
+		return fmt.Errorf("unit must be %s", systolicSpec.unit)
+	}
+	systolic, err := systolicSpec.canonical(bp.Systolic, "")
+	if err != nil {
+		return fmt.Errorf("systolic %w", err)
+	}
+	diastolic, err := diastolicSpec.canonical(bp.Diastolic, "")
+	if err != nil {
+		return fmt.Errorf("diastolic %w", err)
+	}
+	if diastolic >= systolic {
+		return errors.New("diastolic must be lower than systolic")
+	}
+	return nil
+}
+
+// measuredAtSkew tolerates clocks of bedside devices running slightly ahead.
+const measuredAtSkew = 5 * time.Minute
+
+func (v VitalSigns) Validate() error {
+	if v.Temperature == nil && v.BloodPressure == nil && v.HeartRate == nil && v.RespiratoryRate == nil &&
+		v.SpO2 == nil && v.SupplementalOxygen == nil && v.Consciousness == nil &&
+		v.Weight == nil && v.Height == nil && v.PainScore == nil {
+		return errors.New("at least one vital sign is required")
+	}
+	return validation.ValidateStruct(&v,
+		validation.Field(&v.MeasuredAt, validation.By(func(value interface{}) error {
+			t, _ := value.(*time.Time)
+			if t != nil && t.After(time.Now().Add(measuredAtSkew)) {
+				return errors.New("must not be in the future")
+			}
+			return nil
+		})),
+		validation.Field(&v.Ward, validation.NilOrNotEmpty, validation.Length(1, 50)),
+		validation.Field(&v.Temperature, validation.By(measurementRule(temperatureSpec))),
+		validation.Field(&v.BloodPressure, validation.By(validBloodPressure)),
+		validation.Field(&v.HeartRate, validation.By(measurementRule(heartRateSpec))),
+		validation.Field(&v.RespiratoryRate, validation.By(measurementRule(respiratoryRateSpec))),
+		validation.Field(&v.SpO2, validation.By(measurementRule(spo2Spec))),
+		validation.Field(&v.SpO2Scale, validation.In(SpO2Scales...)),
+		validation.Field(&v.Consciousness, validation.In(ConsciousnessLevels...)),
+		validation.Field(&v.Weight, validation.By(measurementRule(weightSpec))),
+		validation.Field(&v.Height, validation.By(measurementRule(heightSpec))),
+		validation.Field(&v.PainScore, validation.By(measurementRule(painScoreSpec))),
+	)
+}
+
+// model converts validated vital signs to canonical units.
+func (v VitalSigns) model() *Vitals {
+	res := &Vitals{
+		Ward:               v.Ward,
+		SpO2Scale:          v.SpO2Scale,
+		SupplementalOxygen: v.SupplementalOxygen,
+		Consciousness:      v.Consciousness,
+	}
+	if v.MeasuredAt != nil {
+		res.MeasuredAt = v.MeasuredAt.UTC()
+	}
+	float := func(s vitalSpec, m *Measurement) *float64 {
+		if m == nil {
+			return nil
+		}
+		value, _ := s.canonical(m.Value, m.Unit)
+		return &value
+	}
+	integer := func(s vitalSpec, m *Measurement) *int {
+		value := float(s, m)
+		if value == nil {
+			return nil
+		}
+		n := int(math.Round(*value))
+		return &n
+	}
+	res.TemperatureC = float(temperatureSpec, v.Temperature)
+	if v.BloodPressure != nil {
+		res.SystolicMmHg = integer(systolicSpec, &Measurement{Value: v.BloodPressure.Systolic})
+		res.DiastolicMmHg = integer(diastolicSpec, &Measurement{Value: v.BloodPressure.Diastolic})
+	}
+	res.HeartRateBpm = integer(heartRateSpec, v.HeartRate)
+	res.RespiratoryRate = integer(respiratoryRateSpec, v.RespiratoryRate)
+	res.SpO2Pct = integer(spo2Spec, v.SpO2)
+	res.WeightKg = float(weightSpec, v.Weight)
+	res.HeightCm = float(heightSpec, v.Height)
+	res.PainScore = integer(painScoreSpec, v.PainScore)
+	return res
+}
+
+// response renders stored vitals in their canonical units.
+func (v *Vitals) response() *VitalSigns {
+	if v == nil {
+		return nil
+	}
+	measuredAt := v.MeasuredAt
+	res := &VitalSigns{
+		MeasuredAt:         &measuredAt,
+		Ward:               v.Ward,
+		SpO2Scale:          v.SpO2Scale,
+		SupplementalOxygen: v.SupplementalOxygen,
+		Consciousness:      v.Consciousness,
+	}
+	if v.NEWS2Score != nil && v.NEWS2Risk != nil {
+		res.NEWS2 = &NEWS2Result{Score: *v.NEWS2Score, Risk: *v.NEWS2Risk, Alert: v.NEWS2Alert}
+	}
+	float := func(s vitalSpec, value *float64) *Measurement {
+		if value == nil {
+			return nil
+		}
+		return &Measurement{Value: *value, Unit: s.unit}
+	}
+	integer := func(s vitalSpec, value *int) *Measurement {
+		if value == nil {
+			return nil
+		}
+		return &Measurement{Value: float64(*value), Unit: s.unit}
+	}
+	res.Temperature = float(temperatureSpec, v.TemperatureC)
+	if v.SystolicMmHg != nil && v.DiastolicMmHg != nil {
+		res.BloodPressure = &BloodPressure{
+			Systolic:  float64(*v.SystolicMmHg),
+			Diastolic: float64(*v.DiastolicMmHg),
+			Unit:      systolicSpec.unit,
+		}
+	}
+	res.HeartRate = integer(heartRateSpec, v.HeartRateBpm)
+	res.RespiratoryRate = integer(respiratoryRateSpec, v.RespiratoryRate)
+	res.SpO2 = integer(spo2Spec, v.SpO2Pct)
+	res.Weight = float(weightSpec, v.WeightKg)
+	res.Height = float(heightSpec, v.HeightCm)
+	res.PainScore = integer(painScoreSpec, v.PainScore)
+	return res
+}
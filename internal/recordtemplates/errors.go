@@ -0,0 +1,8 @@
+package recordtemplates
+
+import "errors"
+
+var (
+	ErrTemplateNotFound      = errors.New("template not found")
+	ErrTemplateAlreadyExists = errors.New("a template with this name already exists for the ward")
+)
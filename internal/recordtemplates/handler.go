@@ -0,0 +1,110 @@
+package recordtemplates
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/citadel-corp/halosuster/internal/common/middleware"
+	"github.com/citadel-corp/halosuster/internal/common/request"
+	"github.com/citadel-corp/halosuster/internal/common/response"
+	"github.com/gorilla/schema"
+)
+
+type Handler struct {
+	service Service
+}
+
+func NewHandler(service Service) *Handler {
+	return &Handler{service: service}
+}
+
+func (h *Handler) CreateTemplate(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserID(r)
+	if err != nil {
+		response.JSON(w, http.StatusUnauthorized, response.ResponseBody{
+			Message: "unauthorized",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	var req PostTemplate
+
+	err = request.DecodeJSON(w, r, &req)
+	if err != nil {
+		response.JSON(w, http.StatusBadRequest, response.ResponseBody{
+			Message: "Failed to decode JSON",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	req.UserId = userId
+
+	err = req.Validate()
+	if err != nil {
+		response.JSON(w, http.StatusBadRequest, response.ResponseBody{
+			Message: "Bad request",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	template, err := h.service.Create(r.Context(), req)
+	if errors.Is(err, ErrTemplateAlreadyExists) {
+		response.JSON(w, http.StatusConflict, response.ResponseBody{
+			Message: "conflict",
+			Error:   err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		response.JSON(w, http.StatusInternalServerError, response.ResponseBody{
+			Message: "Internal server error",
+			Error:   err.Error(),
+		})
+		return
+	}
+	response.JSON(w, http.StatusCreated, response.ResponseBody{
+		Message: "Template created successfully",
+		Data:    template,
+	})
+}
+
+func (h *Handler) ListTemplates(w http.ResponseWriter, r *http.Request) {
+	var req ListTemplatesPayload
+
+	newSchema := schema.NewDecoder()
+	newSchema.IgnoreUnknownKeys(true)
+
+	if err := newSchema.Decode(&req, r.URL.Query()); err != nil {
+		response.JSON(w, http.StatusBadRequest, response.ResponseBody{
+			Message: "Bad request",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	templates, err := h.service.List(r.Context(), req)
+	if err != nil {
+		response.JSON(w, http.StatusInternalServerError, response.ResponseBody{
+			Message: "Internal server error",
+			Error:   err.Error(),
+		})
+		return
+	}
+	response.JSON(w, http.StatusOK, response.ResponseBody{
+		Message: "Templates fetched successfully",
+		Data:    templates,
+	})
+}
+
+func getUserID(r *http.Request) (string, error) {
+	if authValue, ok := r.Context().Value(middleware.ContextAuthKey{}).(string); ok {
+		return authValue, nil
+	} else {
+		slog.Error("cannot parse auth value from context")
+		return "", errors.New("cannot parse auth value from context")
+	}
+}
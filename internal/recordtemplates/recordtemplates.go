@@ -0,0 +1,117 @@
+package recordtemplates
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+type FieldType string
+
+const (
+	TextField    FieldType = "text"
+	NumberField  FieldType = "number"
+	BooleanField FieldType = "boolean"
+	ChoiceField  FieldType = "choice"
+)
+
+var FieldTypes []interface{} = []interface{}{TextField, NumberField, BooleanField, ChoiceField}
+
+// Section is a named part of the symptoms form with the text it starts
+// out with, e.g. "Keluhan utama" with a checklist to fill in.
+type Section struct {
+	Title       string `json:"title"`
+	DefaultText string `json:"defaultText"`
+}
+
+// Field is a structured value a record made from the template carries
+// next to its free text. Options apply to choice fields, Min and Max to
+// number fields.
+type Field struct {
+	Key      string    `json:"key"`
+	Label    string    `json:"label"`
+	Type     FieldType `json:"type"`
+	Required bool      `json:"required"`
+	Options  []string  `json:"options,omitempty"`
+	Min      *float64  `json:"min,omitempty"`
+	Max      *float64  `json:"max,omitempty"`
+}
+
+// Template describes a common visit type. A template without a ward is
+// offered on every ward. Templates are not edited once records refer to
+// them; a changed checklist is a new template.
+type Template struct {
+	ID        string
+	Name      string
+	Ward      *string
+	Sections  []Section
+	Fields    []Field
+	CreatedBy *string
+	CreatedAt time.Time
+}
+
+const maxTextValue = 2000
+
+// Check validates the structured values of a record against the
+// template: required fields are present, every value has the field's
+// type and no value is for a field the template does not have.
+func (t *Template) Check(values map[string]any) error {
+	errs := validation.Errors{}
+	for key := range values {
+		if !slices.ContainsFunc(t.Fields, func(f Field) bool { return f.Key == key }) {
+			errs[key] = errors.New("is not a field of the template")
+		}
+	}
+	for _, f := range t.Fields {
+		value, ok := values[f.Key]
+		if !ok || value == nil || value == "" {
+			if f.Required {
+				errs[f.Key] = validation.ErrRequired
+			}
+			continue
+		}
+		if err := f.check(value); err != nil {
+			errs[f.Key] = err
+		}
+	}
+	return errs.Filter()
+}
+
+func (f Field) check(value any) error {
+	switch f.Type {
+	case NumberField:
+		n, ok := value.(float64)
+		if !ok || math.IsNaN(n) {
+			return errors.New("must be a number")
+		}
+		if f.Min != nil && n < *f.Min {
+			return fmt.Errorf("must be no less than %g", *f.Min)
+		}
+		if f.Max != nil && n > *f.Max {
+			return fmt.Errorf("must be no greater than %g", *f.Max)
+		}
+	case BooleanField:
+		if _, ok := value.(bool); !ok {
+			return errors.New("must be true or false")
+		}
+	case ChoiceField:
+		s, ok := value.(string)
+		if !ok || !slices.Contains(f.Options, s) {
+			return fmt.Errorf("must be one of %s", strings.Join(f.Options, ", "))
+		}
+	default:
+		s, ok := value.(string)
+		if !ok {
+			return errors.New("must be text")
+		}
+		if len(s) > maxTextValue {
+			return fmt.Errorf("must be no longer than %d characters", maxTextValue)
+		}
+	}
+	return nil
+}
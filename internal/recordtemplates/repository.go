@@ -0,0 +1,108 @@
+package recordtemplates
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/citadel-corp/halosuster/internal/common/db"
+	"github.com/citadel-corp/halosuster/internal/common/query"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+type Repository interface {
+	Create(ctx context.Context, template *Template) error
+	GetByID(ctx context.Context, id string) (*Template, error)
+	List(ctx context.Context, ward string) ([]Template, error)
+}
+
+const templateColumns = "id, name, ward, sections, fields, created_by, created_at"
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanTemplate(row scanner) (*Template, error) {
+	t := &Template{}
+	var sections, fields []byte
+	err := row.Scan(&t.ID, &t.Name, &t.Ward, &sections, &fields, &t.CreatedBy, &t.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(sections, &t.Sections); err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(fields, &t.Fields); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+type dbRepository struct {
+	db *db.DB
+}
+
+func NewRepository(db *db.DB) Repository {
+	return &dbRepository{db: db}
+}
+
+func (d *dbRepository) Create(ctx context.Context, template *Template) error {
+	sections, err := json.Marshal(template.Sections)
+	if err != nil {
+		return err
+	}
+	fields, err := json.Marshal(template.Fields)
+	if err != nil {
+		return err
+	}
+	q := `
+		INSERT INTO record_templates (id, name, ward, sections, fields, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING created_at;
+	`
+	err = d.db.DB().QueryRowContext(ctx, q, template.ID, template.Name, template.Ward, sections, fields,
+		template.CreatedBy).Scan(&template.CreatedAt)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return ErrTemplateAlreadyExists
+	}
+	return err
+}
+
+func (d *dbRepository) GetByID(ctx context.Context, id string) (*Template, error) {
+	q := "SELECT " + templateColumns + " FROM record_templates WHERE id = $1;"
+	t, err := scanTemplate(d.db.DB().QueryRowContext(ctx, q, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTemplateNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// List returns the templates offered on ward, which include those for
+// every ward. An empty ward lists all templates.
+func (d *dbRepository) List(ctx context.Context, ward string) ([]Template, error) {
+	b := query.NewBuilder()
+	where := ""
+	if ward != "" {
+		where = b.Where(query.Or(query.Raw("ward IS NULL"), query.Eq("LOWER(ward)", ward)))
+	}
+	rows, err := d.db.DB().QueryContext(ctx, "SELECT "+templateColumns+" FROM record_templates"+where+
+		" ORDER BY ward NULLS FIRST, lower(name);", b.Args()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := make([]Template, 0)
+	for rows.Next() {
+		t, err := scanTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, *t)
+	}
+	return res, rows.Err()
+}
@@ -0,0 +1,72 @@
+package recordtemplates
+
+import (
+	"errors"
+	"regexp"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+const (
+	maxSections = 20
+	maxFields   = 50
+)
+
+var fieldKeyPattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]*$`)
+
+type PostTemplate struct {
+	UserId   string    `json:"-"`
+	Name     string    `json:"name"`
+	Ward     *string   `json:"ward"`
+	Sections []Section `json:"sections"`
+	Fields   []Field   `json:"fields"`
+}
+
+func (p PostTemplate) Validate() error {
+	return validation.ValidateStruct(&p,
+		validation.Field(&p.Name, validation.Required, validation.Length(1, 100)),
+		validation.Field(&p.Ward, validation.NilOrNotEmpty, validation.Length(1, 50)),
+		validation.Field(&p.Sections, validation.Required, validation.Length(1, maxSections)),
+		validation.Field(&p.Fields, validation.Length(0, maxFields), validation.By(uniqueKeys)),
+	)
+}
+
+func (s Section) Validate() error {
+	return validation.ValidateStruct(&s,
+		validation.Field(&s.Title, validation.Required, validation.Length(1, 100)),
+		validation.Field(&s.DefaultText, validation.Length(0, maxTextValue)),
+	)
+}
+
+func (f Field) Validate() error {
+	return validation.ValidateStruct(&f,
+		validation.Field(&f.Key, validation.Required, validation.Length(1, 50), validation.Match(fieldKeyPattern)),
+		validation.Field(&f.Label, validation.Required, validation.Length(1, 100)),
+		validation.Field(&f.Type, validation.Required, validation.In(FieldTypes...)),
+		validation.Field(&f.Options, validation.When(f.Type == ChoiceField, validation.Required), validation.When(f.Type != ChoiceField, validation.Empty),
+			validation.Each(validation.Required, validation.Length(1, 100))),
+		validation.Field(&f.Min, validation.When(f.Type != NumberField, validation.Nil)),
+		validation.Field(&f.Max, validation.When(f.Type != NumberField, validation.Nil), validation.By(func(interface{}) error {
+			if f.Min != nil && f.Max != nil && *f.Min > *f.Max {
+				return errors.New("must not be less than min")
+			}
+			return nil
+		})),
+	)
+}
+
+func uniqueKeys(value interface{}) error {
+	fields, _ := value.([]Field)
+	seen := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		if seen[f.Key] {
+			return errors.New("keys must be unique, " + f.Key + " is repeated")
+		}
+		seen[f.Key] = true
+	}
+	return nil
+}
+
+type ListTemplatesPayload struct {
+	Ward string `schema:"ward" binding:"omitempty"`
+}
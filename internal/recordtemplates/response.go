@@ -0,0 +1,23 @@
+package recordtemplates
+
+import "time"
+
+type TemplateResponse struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Ward      *string   `json:"ward"`
+	Sections  []Section `json:"sections"`
+	Fields    []Field   `json:"fields"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func templateResponse(t Template) TemplateResponse {
+	return TemplateResponse{
+		ID:        t.ID,
+		Name:      t.Name,
+		Ward:      t.Ward,
+		Sections:  t.Sections,
+		Fields:    t.Fields,
+		CreatedAt: t.CreatedAt,
+	}
+}
@@ -0,0 +1,58 @@
+package recordtemplates
+
+import (
+	"context"
+	"strings"
+
+	"github.com/citadel-corp/halosuster/internal/common/id"
+)
+
+type Service interface {
+	Create(ctx context.Context, req PostTemplate) (*TemplateResponse, error)
+	List(ctx context.Context, req ListTemplatesPayload) ([]TemplateResponse, error)
+	GetByID(ctx context.Context, id string) (*Template, error)
+}
+
+type templateService struct {
+	repository Repository
+}
+
+func NewService(repository Repository) Service {
+	return &templateService{repository: repository}
+}
+
+func (s *templateService) Create(ctx context.Context, req PostTemplate) (*TemplateResponse, error) {
+	template := &Template{
+		ID:        id.GenerateStringID(16),
+		Name:      strings.TrimSpace(req.Name),
+		Ward:      req.Ward,
+		Sections:  req.Sections,
+		Fields:    req.Fields,
+		CreatedBy: &req.UserId,
+	}
+	if template.Fields == nil {
+		template.Fields = make([]Field, 0)
+	}
+	err := s.repository.Create(ctx, template)
+	if err != nil {
+		return nil, err
+	}
+	res := templateResponse(*template)
+	return &res, nil
+}
+
+func (s *templateService) List(ctx context.Context, req ListTemplatesPayload) ([]TemplateResponse, error) {
+	templates, err := s.repository.List(ctx, strings.ToLower(strings.TrimSpace(req.Ward)))
+	if err != nil {
+		return nil, err
+	}
+	res := make([]TemplateResponse, len(templates))
+	for i, t := range templates {
+		res[i] = templateResponse(t)
+	}
+	return res, nil
+}
+
+func (s *templateService) GetByID(ctx context.Context, id string) (*Template, error) {
+	return s.repository.GetByID(ctx, id)
+}
@@ -8,4 +8,5 @@ var (
 	ErrWrongPassword      = errors.New("wrong password")
 	ErrNIPAlreadyExists   = errors.New("NIP already exists")
 	ErrValidationFailed   = errors.New("validation failed")
+	ErrUserHasRecords     = errors.New("user has written medical records")
 )
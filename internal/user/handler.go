@@ -2,8 +2,11 @@ package user
 
 import (
 	"errors"
+	"log/slog"
 	"net/http"
 
+	"github.com/citadel-corp/halosuster/internal/common/middleware"
+	"github.com/citadel-corp/halosuster/internal/common/query"
 	"github.com/citadel-corp/halosuster/internal/common/request"
 	"github.com/citadel-corp/halosuster/internal/common/response"
 	"github.com/gorilla/mux"
@@ -208,7 +211,24 @@ func (h *Handler) ListUsers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	users, err := h.service.ListUsers(r.Context(), req)
+	filters, err := query.ParseFilters(r.URL.Query(), listFilterFields)
+	if err != nil {
+		response.JSON(w, http.StatusBadRequest, response.ResponseBody{
+			Message: "Bad request",
+			Error:   err.Error(),
+		})
+		return
+	}
+	req.Filters = filters
+
+	users, meta, err := h.service.ListUsers(r.Context(), req)
+	if errors.Is(err, query.ErrInvalidSort) {
+		response.JSON(w, http.StatusBadRequest, response.ResponseBody{
+			Message: "Bad request",
+			Error:   err.Error(),
+		})
+		return
+	}
 	if err != nil {
 		response.JSON(w, http.StatusInternalServerError, response.ResponseBody{
 			Message: "Internal server error",
@@ -216,10 +236,11 @@ func (h *Handler) ListUsers(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
-	response.JSON(w, http.StatusOK, response.ResponseBody{
+	response.JSONWithHeaders(w, http.StatusOK, response.ResponseBody{
 		Message: "success",
 		Data:    users,
-	})
+		Meta:    meta,
+	}, response.PaginationLinks(r, meta))
 }
 
 func (h *Handler) UpdateNurse(w http.ResponseWriter, r *http.Request) {
@@ -280,6 +301,13 @@ func (h *Handler) DeleteNurse(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
+	if errors.Is(err, ErrUserHasRecords) {
+		response.JSON(w, http.StatusConflict, response.ResponseBody{
+			Message: "Nurse has written medical records and cannot be deleted",
+			Error:   err.Error(),
+		})
+		return
+	}
 	if err != nil {
 		response.JSON(w, http.StatusInternalServerError, response.ResponseBody{
 			Message: "Internal server error",
@@ -331,3 +359,60 @@ func (h *Handler) GrantNurseAccess(w http.ResponseWriter, r *http.Request) {
 		Message: "User password set",
 	})
 }
+
+func (h *Handler) SetNurseRoles(w http.ResponseWriter, r *http.Request) {
+	var req SetNurseRolesPayload
+
+	err := request.DecodeJSON(w, r, &req)
+	if err != nil {
+		response.JSON(w, http.StatusBadRequest, response.ResponseBody{
+			Message: "Failed to decode JSON",
+			Error:   err.Error(),
+		})
+		return
+	}
+	grantedBy, err := getUserID(r)
+	if err != nil {
+		response.JSON(w, http.StatusUnauthorized, response.ResponseBody{
+			Message: "unauthorized",
+			Error:   err.Error(),
+		})
+		return
+	}
+	params := mux.Vars(r)
+	userID := params["userId"]
+	err = h.service.SetNurseRoles(r.Context(), userID, grantedBy, req)
+	if errors.Is(err, ErrUserNotFound) {
+		response.JSON(w, http.StatusNotFound, response.ResponseBody{
+			Message: "Not found",
+			Error:   err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, ErrValidationFailed) {
+		response.JSON(w, http.StatusBadRequest, response.ResponseBody{
+			Message: "Bad request",
+			Error:   err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		response.JSON(w, http.StatusInternalServerError, response.ResponseBody{
+			Message: "Internal server error",
+			Error:   err.Error(),
+		})
+		return
+	}
+	response.JSON(w, http.StatusOK, response.ResponseBody{
+		Message: "User roles set",
+	})
+}
+
+func getUserID(r *http.Request) (string, error) {
+	if authValue, ok := r.Context().Value(middleware.ContextAuthKey{}).(string); ok {
+		return authValue, nil
+	} else {
+		slog.Error("cannot parse auth value from context")
+		return "", errors.New("cannot parse auth value from context")
+	}
+}
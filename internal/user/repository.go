@@ -6,9 +6,11 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
-	"strings"
 
 	"github.com/citadel-corp/halosuster/internal/common/db"
+	"github.com/citadel-corp/halosuster/internal/common/query"
+	"github.com/citadel-corp/halosuster/internal/common/response"
+	"github.com/citadel-corp/halosuster/internal/image"
 	"github.com/jackc/pgx/v5/pgconn"
 )
 
@@ -16,9 +18,23 @@ type Repository interface {
 	Create(ctx context.Context, user *User) error
 	GetByNIP(ctx context.Context, nip int) (*User, error)
 	GetByID(ctx context.Context, id string) (*User, error)
-	List(ctx context.Context, req ListUserPayload) ([]*User, error)
+	List(ctx context.Context, req ListUserPayload) ([]*User, *response.Pagination, error)
 	Update(ctx context.Context, user *User) error
 	DeleteByID(ctx context.Context, id string) error
+	ListRoles(ctx context.Context, userID string) ([]NurseRole, error)
+	SetRoles(ctx context.Context, userID string, roles []NurseRole, grantedBy string) error
+}
+
+var listFilterFields = []query.Field{
+	{Param: "userId", Column: "id", DefaultOp: query.OpEq},
+	{Param: "name", Column: "name", DefaultOp: query.OpContains, Ops: []query.Op{query.OpEq, query.OpPrefix}, Fold: true},
+	{Param: "nip", Column: "nip", DefaultOp: query.OpContains, Ops: []query.Op{query.OpEq, query.OpPrefix}},
+}
+
+var listSortFields = map[string]string{
+	"createdAt": "created_at",
+	"name":      "name",
+	"nip":       "nip",
 }
 
 type dbRepository struct {
@@ -33,19 +49,22 @@ func NewRepository(db *db.DB) Repository {
 func (d *dbRepository) Create(ctx context.Context, user *User) error {
 	createUserQuery := `
 		INSERT INTO users (
-			id, name, nip, user_type, hashed_password, identity_card_url
+			id, name, nip, user_type, hashed_password, identity_card_key
 		) VALUES (
 			$1, $2, $3, $4, $5, $6
 		);
 	`
 	nipStr := strconv.Itoa(user.NIP)
-	_, err := d.db.DB().ExecContext(ctx, createUserQuery, user.ID, user.Name, nipStr, user.UserType, user.HashedPassword, user.IdentityCardURL)
+	_, err := d.db.DB().ExecContext(ctx, createUserQuery, user.ID, user.Name, nipStr, user.UserType, user.HashedPassword, user.IdentityCardKey)
 	var pgErr *pgconn.PgError
 	if err != nil {
 		if errors.As(err, &pgErr) {
 			switch pgErr.Code {
 			case "23505":
 				return ErrNIPAlreadyExists
+			case "23503":
+				// the image was collected since it was checked
+				return image.ErrImageNotFound
 			default:
 				return err
 			}
@@ -58,14 +77,14 @@ func (d *dbRepository) Create(ctx context.Context, user *User) error {
 // GetByNIP implements Repository.
 func (d *dbRepository) GetByNIP(ctx context.Context, nip int) (*User, error) {
 	getUserQuery := `
-		SELECT id, name, nip, user_type, hashed_password, identity_card_url, created_at
+		SELECT id, name, nip, user_type, hashed_password, identity_card_key, created_at
 		FROM users
 		WHERE nip = $1;
 	`
 	row := d.db.DB().QueryRowContext(ctx, getUserQuery, strconv.Itoa(nip))
 	u := &User{}
 	var nipStr string
-	err := row.Scan(&u.ID, &u.Name, &nipStr, &u.UserType, &u.HashedPassword, &u.IdentityCardURL, &u.CreatedAt)
+	err := row.Scan(&u.ID, &u.Name, &nipStr, &u.UserType, &u.HashedPassword, &u.IdentityCardKey, &u.CreatedAt)
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, ErrUserNotFound
 	}
@@ -78,14 +97,14 @@ func (d *dbRepository) GetByNIP(ctx context.Context, nip int) (*User, error) {
 
 func (d *dbRepository) GetByID(ctx context.Context, id string) (*User, error) {
 	getUserQuery := `
-		SELECT id, name, nip, user_type, hashed_password, identity_card_url, created_at
+		SELECT id, name, nip, user_type, hashed_password, identity_card_key, created_at
 		FROM users
 		WHERE id = $1;
 	`
 	row := d.db.DB().QueryRowContext(ctx, getUserQuery, id)
 	u := &User{}
 	var nipStr string
-	err := row.Scan(&u.ID, &u.Name, &nipStr, &u.UserType, &u.HashedPassword, &u.IdentityCardURL, &u.CreatedAt)
+	err := row.Scan(&u.ID, &u.Name, &nipStr, &u.UserType, &u.HashedPassword, &u.IdentityCardKey, &u.CreatedAt)
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, ErrUserNotFound
 	}
@@ -98,72 +117,76 @@ func (d *dbRepository) GetByID(ctx context.Context, id string) (*User, error) {
 }
 
 // List implements Repository.
-func (d *dbRepository) List(ctx context.Context, req ListUserPayload) ([]*User, error) {
-	paramNo := 1
-	listQuery := "SELECT id, name, nip, user_type, hashed_password, identity_card_url, created_at FROM users WHERE "
-	params := make([]interface{}, 0)
-	if req.UserID != "" {
-		listQuery += fmt.Sprintf("id = $%d AND ", paramNo)
-		paramNo += 1
-		params = append(params, req.UserID)
-	}
-	if req.Name != "" {
-		listQuery += fmt.Sprintf("name LIKE '%%%s%%' AND ", req.Name)
+func (d *dbRepository) List(ctx context.Context, req ListUserPayload) ([]*User, *response.Pagination, error) {
+	meta := &response.Pagination{Limit: req.Limit, Offset: req.Offset}
+	if len(req.Filters) == 0 && req.RoleType == IgnoreRole {
+		var err error
+		meta.Total, meta.Estimated, err = d.db.EstimateTotal(ctx, "users")
+		if err != nil {
+			return nil, nil, err
+		}
 	}
-	if req.nipStr != "" {
-		listQuery += fmt.Sprintf("nip LIKE '%%%s%%' AND ", req.nipStr)
+
+	listQuery := "SELECT id, name, nip, user_type, hashed_password, identity_card_key, created_at"
+	if !meta.Estimated {
+		listQuery += ", " + db.WindowCount
 	}
+	listQuery += " FROM users"
+	b := query.NewBuilder()
+	conditions := query.Conditions(req.Filters)
 	switch req.RoleType {
 	case ITType:
-		listQuery += fmt.Sprintf("user_type = $%d AND ", paramNo)
-		params = append(params, "IT")
+		conditions = append(conditions, query.Eq("user_type", IT))
 	case NurseType:
-		listQuery += fmt.Sprintf("user_type = $%d AND ", paramNo)
-		params = append(params, "Nurse")
-	}
-	switch req.CreatedAtType {
-	case Ascending:
-		listQuery += fmt.Sprintf(" ORDER BY created_at ASC ")
-	case Descending:
-		listQuery += fmt.Sprintf(" ORDER BY created_at DESC ")
+		conditions = append(conditions, query.Eq("user_type", Nurse))
 	}
-	if strings.HasSuffix(listQuery, "AND ") {
-		listQuery, _ = strings.CutSuffix(listQuery, "AND ")
-	}
-	listQuery += fmt.Sprintf(" LIMIT %d OFFSET %d;", req.Limit, req.Offset)
-	if strings.Contains(listQuery, "WHERE  LIMIT") {
-		listQuery = strings.Replace(listQuery, "WHERE  LIMIT", "LIMIT", 1)
-	}
-	if strings.Contains(listQuery, "WHERE  ORDER") {
-		listQuery = strings.Replace(listQuery, "WHERE  ORDER", "ORDER", 1)
-	}
-	rows, err := d.db.DB().QueryContext(ctx, listQuery, params...)
+	where := b.Where(query.And(conditions...))
+	whereArgs := len(b.Args())
+	listQuery += where
+	listQuery += query.OrderBy(req.sorts)
+	listQuery += fmt.Sprintf(" LIMIT %s OFFSET %s;", b.Arg(req.Limit), b.Arg(req.Offset))
+	rows, err := d.db.DB().QueryContext(ctx, listQuery, b.Args()...)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	defer rows.Close()
 	res := make([]*User, 0)
 	for rows.Next() {
 		u := &User{}
 		var nipStr string
-		err = rows.Scan(&u.ID, &u.Name, &nipStr, &u.UserType, &u.HashedPassword, &u.IdentityCardURL, &u.CreatedAt)
+		dest := []any{&u.ID, &u.Name, &nipStr, &u.UserType, &u.HashedPassword, &u.IdentityCardKey, &u.CreatedAt}
+		if !meta.Estimated {
+			dest = append(dest, &meta.Total)
+		}
+		err = rows.Scan(dest...)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		nip, _ := strconv.Atoi(nipStr)
 		u.NIP = nip
 		res = append(res, u)
 	}
-	return res, nil
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	// a page past the end has no rows to carry the count
+	if len(res) == 0 && req.Offset > 0 && !meta.Estimated {
+		err = d.db.DB().QueryRowContext(ctx, "SELECT COUNT(*) FROM users"+where, b.Args()[:whereArgs]...).Scan(&meta.Total)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return res, meta, nil
 }
 
 // Update implements Repository.
 func (d *dbRepository) Update(ctx context.Context, user *User) error {
 	q := `
         UPDATE users
-        SET name = $1, nip = $2, user_type = $3, hashed_password = $4, identity_card_url = $5
+        SET name = $1, nip = $2, user_type = $3, hashed_password = $4, identity_card_key = $5
         WHERE id = $6;
     `
-	row, err := d.db.DB().ExecContext(ctx, q, user.Name, strconv.Itoa(user.NIP), user.UserType, user.HashedPassword, user.IdentityCardURL, user.ID)
+	row, err := d.db.DB().ExecContext(ctx, q, user.Name, strconv.Itoa(user.NIP), user.UserType, user.HashedPassword, user.IdentityCardKey, user.ID)
 	if err != nil {
 		return err
 	}
@@ -184,6 +207,10 @@ func (d *dbRepository) DeleteByID(ctx context.Context, id string) error {
         WHERE id = $1;
     `
 	row, err := d.db.DB().ExecContext(ctx, q, id)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+		return ErrUserHasRecords
+	}
 	if err != nil {
 		return err
 	}
@@ -196,3 +223,42 @@ func (d *dbRepository) DeleteByID(ctx context.Context, id string) error {
 	}
 	return nil
 }
+
+func (d *dbRepository) ListRoles(ctx context.Context, userID string) ([]NurseRole, error) {
+	rows, err := d.db.DB().QueryContext(ctx, "SELECT role FROM nurse_roles WHERE user_id = $1 ORDER BY role;", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := make([]NurseRole, 0)
+	for rows.Next() {
+		var role NurseRole
+		if err = rows.Scan(&role); err != nil {
+			return nil, err
+		}
+		res = append(res, role)
+	}
+	return res, rows.Err()
+}
+
+// SetRoles replaces the roles of the user with roles. Roles the user
+// already has keep when and by whom they were granted.
+func (d *dbRepository) SetRoles(ctx context.Context, userID string, roles []NurseRole, grantedBy string) error {
+	return d.db.StartTx(ctx, func(tx *sql.Tx) error {
+		names := make([]string, len(roles))
+		for i, role := range roles {
+			names[i] = string(role)
+		}
+		q := "DELETE FROM nurse_roles WHERE user_id = $1 AND NOT (role::text = ANY($2::text[]));"
+		if _, err := tx.ExecContext(ctx, q, userID, names); err != nil {
+			return err
+		}
+		q = `
+			INSERT INTO nurse_roles (user_id, role, granted_by)
+			SELECT $1, unnest($2::text[])::nurse_role, $3
+			ON CONFLICT (user_id, role) DO NOTHING;
+		`
+		_, err := tx.ExecContext(ctx, q, userID, names, grantedBy)
+		return err
+	})
+}
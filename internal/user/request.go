@@ -1,11 +1,12 @@
 package user
 
 import (
-	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/citadel-corp/halosuster/internal/common/query"
+	"github.com/citadel-corp/halosuster/internal/image"
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 )
 
@@ -47,10 +48,11 @@ var nurseNIPValidationRule = validation.NewStringRule(func(s string) bool {
 	return true
 }, "NIP must be valid")
 
-var imgUrlValidationRule = validation.NewStringRule(func(s string) bool {
-	match, _ := regexp.MatchString(`^(http:\/\/www\.|https:\/\/www\.|http:\/\/|https:\/\/|\/|\/\/)?[A-z0-9_-]*?[:]?[A-z0-9_-]*?[@]?[A-z0-9]+([\-\.]{1}[a-z0-9]+)*\.[a-z]{2,5}(:[0-9]{1,5})?(\/{1}[A-z0-9_\-\:x\=\(\)]+)*(\.(jpg|jpeg|png))?$`, s)
-	return match
-}, "image url is not valid")
+// imgValidationRule accepts the key of an uploaded image, or its URL as
+// uploads returned before images were private.
+var imgValidationRule = validation.NewStringRule(func(s string) bool {
+	return image.ValidKey(image.KeyOf(s))
+}, "image must be the key or url of an uploaded image")
 
 type CreateITUserPayload struct {
 	NIP      int    `json:"nip"`
@@ -82,7 +84,7 @@ func (p CreateNurseUserPayload) Validate() error {
 	return validation.ValidateStruct(&p,
 		validation.Field(&p.nipStr, validation.Required, validation.Length(13, 15), nurseNIPValidationRule),
 		validation.Field(&p.Name, validation.Required, validation.Length(5, 50)),
-		validation.Field(&p.IdentityCardScanImg, validation.Required, imgUrlValidationRule),
+		validation.Field(&p.IdentityCardScanImg, validation.Required, imgValidationRule),
 	)
 }
 
@@ -119,27 +121,20 @@ func (p NurseUserLoginPayload) Validate() error {
 }
 
 type ListUserPayload struct {
-	UserID    string `schema:"userId" binding:"omitempty"`
 	Limit     int    `schema:"limit" binding:"omitempty"`
 	Offset    int    `schema:"offset" binding:"omitempty"`
-	Name      string `schema:"name" binding:"omitempty"`
-	NIP       int    `schema:"nip" binding:"omitempty"`
 	Role      string `schema:"role" binding:"omitempty"`
 	CreatedAt string `schema:"createdAt" binding:"omitempty"`
+	Sort      string `schema:"sort" binding:"omitempty"`
 
-	nipStr        string
-	CreatedAtType CreatedAtType
-	RoleType      RoleType
+	Filters  []query.Filter `schema:"-"`
+	RoleType RoleType
+	sorts    []query.Sort
 }
 
-type CreatedAtType int
 type RoleType int
 
 const (
-	Ascending CreatedAtType = iota
-	Descending
-	IgnoreCreatedAt
-
 	ITType RoleType = iota
 	NurseType
 	IgnoreRole
@@ -161,6 +156,16 @@ func (p UpdateNursePayload) Validate() error {
 	)
 }
 
+type SetNurseRolesPayload struct {
+	Roles []NurseRole `json:"roles"`
+}
+
+func (p SetNurseRolesPayload) Validate() error {
+	return validation.ValidateStruct(&p,
+		validation.Field(&p.Roles, validation.NotNil, validation.Each(validation.In(NurseRoles...))),
+	)
+}
+
 type GrantNurseAccessPayload struct {
 	Password string `json:"password"`
 }
@@ -14,4 +14,6 @@ type UserResponse struct {
 	NIP       int       `json:"nip"`
 	Name      string    `json:"name"`
 	CreatedAt time.Time `json:"createdAt"`
+	// IdentityCardScanImg is a short-lived URL, set for nurses only.
+	IdentityCardScanImg string `json:"identityCardScanImg,omitempty"`
 }
@@ -4,12 +4,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"strconv"
 	"time"
 
 	"github.com/citadel-corp/halosuster/internal/common/id"
 	"github.com/citadel-corp/halosuster/internal/common/jwt"
 	"github.com/citadel-corp/halosuster/internal/common/password"
+	"github.com/citadel-corp/halosuster/internal/common/query"
+	"github.com/citadel-corp/halosuster/internal/common/response"
+	"github.com/citadel-corp/halosuster/internal/image"
 )
 
 type Service interface {
@@ -17,18 +19,32 @@ type Service interface {
 	CreateNurseUser(ctx context.Context, req CreateNurseUserPayload) (*UserAuthResponse, error)
 	LoginITUser(ctx context.Context, req ITUserLoginPayload) (*UserAuthResponse, error)
 	LoginNurseUser(ctx context.Context, req NurseUserLoginPayload) (*UserAuthResponse, error)
-	ListUsers(ctx context.Context, req ListUserPayload) ([]*UserResponse, error)
+	ListUsers(ctx context.Context, req ListUserPayload) ([]*UserResponse, *response.Pagination, error)
 	UpdateNurse(ctx context.Context, userID string, req UpdateNursePayload) error
 	DeleteNurse(ctx context.Context, userID string) error
 	GrantNurseAccess(ctx context.Context, userID string, req GrantNurseAccessPayload) error
+	SetNurseRoles(ctx context.Context, userID string, grantedBy string, req SetNurseRolesPayload) error
 }
 
 type userService struct {
-	repository Repository
+	repository   Repository
+	imageService image.Service
+	tokens       jwt.Signer
+	passwords    password.Hasher
+	tokenTTL     time.Duration
 }
 
-func NewService(repository Repository) Service {
-	return &userService{repository: repository}
+// NewService creates the user service. Access tokens are signed by
+// tokens and expire after tokenTTL.
+func NewService(repository Repository, imageService image.Service, tokens jwt.Signer, passwords password.Hasher,
+	tokenTTL time.Duration) Service {
+	return &userService{
+		repository:   repository,
+		imageService: imageService,
+		tokens:       tokens,
+		passwords:    passwords,
+		tokenTTL:     tokenTTL,
+	}
 }
 
 func (s *userService) CreateITUser(ctx context.Context, req CreateITUserPayload) (*UserAuthResponse, error) {
@@ -36,7 +52,7 @@ func (s *userService) CreateITUser(ctx context.Context, req CreateITUserPayload)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %w", ErrValidationFailed, err)
 	}
-	hashedPassword, err := password.Hash(req.Password)
+	hashedPassword, err := s.passwords.Hash(req.Password)
 	if err != nil {
 		return nil, err
 	}
@@ -52,7 +68,7 @@ func (s *userService) CreateITUser(ctx context.Context, req CreateITUserPayload)
 		return nil, err
 	}
 	// create access token with signed jwt
-	accessToken, err := jwt.Sign(time.Hour*2, fmt.Sprint(user.ID), string(IT))
+	accessToken, err := s.tokens.Sign(s.tokenTTL, fmt.Sprint(user.ID), string(IT), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -69,14 +85,25 @@ func (s *userService) CreateNurseUser(ctx context.Context, req CreateNurseUserPa
 	if err != nil {
 		return nil, fmt.Errorf("%w: %w", ErrValidationFailed, err)
 	}
+	identityCardKey := image.KeyOf(req.IdentityCardScanImg)
+	_, err = s.imageService.Stat(ctx, identityCardKey)
+	if errors.Is(err, image.ErrImageNotFound) {
+		return nil, fmt.Errorf("%w: identityCardScanImg: %w", ErrValidationFailed, err)
+	}
+	if err != nil {
+		return nil, err
+	}
 	user := &User{
 		ID:              id.GenerateStringID(16),
 		NIP:             req.NIP,
 		Name:            req.Name,
 		UserType:        Nurse,
-		IdentityCardURL: &req.IdentityCardScanImg,
+		IdentityCardKey: &identityCardKey,
 	}
 	err = s.repository.Create(ctx, user)
+	if errors.Is(err, image.ErrImageNotFound) {
+		return nil, fmt.Errorf("%w: identityCardScanImg: %w", ErrValidationFailed, err)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -96,7 +123,7 @@ func (s *userService) LoginITUser(ctx context.Context, req ITUserLoginPayload) (
 	if err != nil {
 		return nil, err
 	}
-	match, err := password.Matches(req.Password, *user.HashedPassword)
+	match, err := s.passwords.Matches(req.Password, *user.HashedPassword)
 	if err != nil {
 		return nil, err
 	}
@@ -104,7 +131,7 @@ func (s *userService) LoginITUser(ctx context.Context, req ITUserLoginPayload) (
 		return nil, ErrWrongPassword
 	}
 	// create access token with signed jwt
-	accessToken, err := jwt.Sign(time.Hour*2, fmt.Sprint(user.ID), string(IT))
+	accessToken, err := s.tokens.Sign(s.tokenTTL, fmt.Sprint(user.ID), string(IT), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -129,7 +156,7 @@ func (s *userService) LoginNurseUser(ctx context.Context, req NurseUserLoginPayl
 	if user.HashedPassword == nil {
 		return nil, ErrPasswordNotCreated
 	}
-	match, err := password.Matches(req.Password, *user.HashedPassword)
+	match, err := s.passwords.Matches(req.Password, *user.HashedPassword)
 	if err != nil {
 		return nil, err
 	}
@@ -137,7 +164,15 @@ func (s *userService) LoginNurseUser(ctx context.Context, req NurseUserLoginPayl
 		return nil, ErrWrongPassword
 	}
 	// create access token with signed jwt
-	accessToken, err := jwt.Sign(time.Hour*2, fmt.Sprint(user.ID), string(Nurse))
+	roles, err := s.repository.ListRoles(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	roleNames := make([]string, len(roles))
+	for i, role := range roles {
+		roleNames[i] = string(role)
+	}
+	accessToken, err := s.tokens.Sign(s.tokenTTL, fmt.Sprint(user.ID), string(Nurse), roleNames)
 	if err != nil {
 		return nil, err
 	}
@@ -150,10 +185,8 @@ func (s *userService) LoginNurseUser(ctx context.Context, req NurseUserLoginPayl
 }
 
 // ListUsers implements Service.
-func (s *userService) ListUsers(ctx context.Context, req ListUserPayload) ([]*UserResponse, error) {
-	if req.Limit == 0 {
-		req.Limit = 5
-	}
+func (s *userService) ListUsers(ctx context.Context, req ListUserPayload) ([]*UserResponse, *response.Pagination, error) {
+	req.Limit, req.Offset = query.NormalizePage(req.Limit, req.Offset)
 	req.RoleType = IgnoreRole
 	if req.Role == "it" {
 		req.RoleType = ITType
@@ -161,18 +194,17 @@ func (s *userService) ListUsers(ctx context.Context, req ListUserPayload) ([]*Us
 		req.RoleType = NurseType
 	}
 
-	req.CreatedAtType = IgnoreCreatedAt
-	if req.CreatedAt == "asc" {
-		req.CreatedAtType = Ascending
-	} else if req.CreatedAt == "desc" {
-		req.CreatedAtType = Descending
+	sorts, err := query.ParseSort(req.Sort, listSortFields)
+	if err != nil {
+		return nil, nil, err
 	}
-	if req.NIP != 0 {
-		req.nipStr = strconv.Itoa(req.NIP)
+	if len(sorts) == 0 && (req.CreatedAt == "asc" || req.CreatedAt == "desc") {
+		sorts = []query.Sort{{Column: "created_at", Desc: req.CreatedAt == "desc"}}
 	}
-	users, err := s.repository.List(ctx, req)
+	req.sorts = sorts
+	users, meta, err := s.repository.List(ctx, req)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	res := make([]*UserResponse, len(users))
 	for i, user := range users {
@@ -182,8 +214,14 @@ func (s *userService) ListUsers(ctx context.Context, req ListUserPayload) ([]*Us
 			Name:      user.Name,
 			CreatedAt: user.CreatedAt,
 		}
+		if user.IdentityCardKey != nil {
+			res[i].IdentityCardScanImg, err = s.imageService.PresignURL(*user.IdentityCardKey)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
 	}
-	return res, nil
+	return res, meta, nil
 }
 
 // UpdateNurse implements Service.
@@ -233,10 +271,26 @@ func (s *userService) GrantNurseAccess(ctx context.Context, userID string, req G
 	if user.UserType != Nurse {
 		return ErrUserNotFound
 	}
-	hashedPassword, err := password.Hash(req.Password)
+	hashedPassword, err := s.passwords.Hash(req.Password)
 	if err != nil {
 		return err
 	}
 	user.HashedPassword = &hashedPassword
 	return s.repository.Update(ctx, user)
 }
+
+// SetNurseRoles implements Service.
+func (s *userService) SetNurseRoles(ctx context.Context, userID string, grantedBy string, req SetNurseRolesPayload) error {
+	err := req.Validate()
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrValidationFailed, err)
+	}
+	user, err := s.repository.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.UserType != Nurse {
+		return ErrUserNotFound
+	}
+	return s.repository.SetRoles(ctx, userID, req.Roles, grantedBy)
+}
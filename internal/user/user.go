@@ -7,7 +7,7 @@ type User struct {
 	NIP             int
 	Name            string
 	UserType        UserType
-	IdentityCardURL *string
+	IdentityCardKey *string
 	HashedPassword  *string
 	CreatedAt       time.Time
 }
@@ -18,3 +18,16 @@ const (
 	IT    UserType = "IT"
 	Nurse UserType = "Nurse"
 )
+
+// NurseRole is granted to nurses on top of what every nurse may do. It
+// is carried by access tokens, so it takes effect on the next login.
+type NurseRole string
+
+const (
+	// HeadNurse may define record templates.
+	HeadNurse NurseRole = "head_nurse"
+	// ClinicalReviewer may co-sign records pending review.
+	ClinicalReviewer NurseRole = "clinical_reviewer"
+)
+
+var NurseRoles = []any{HeadNurse, ClinicalReviewer}
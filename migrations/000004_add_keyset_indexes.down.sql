@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS medical_records_created_at_id;
+DROP INDEX IF EXISTS medical_patients_created_at_id;
@@ -0,0 +1,4 @@
+CREATE INDEX IF NOT EXISTS medical_patients_created_at_id
+	ON medical_patients(created_at, id);
+CREATE INDEX IF NOT EXISTS medical_records_created_at_id
+	ON medical_records(created_at, id);
@@ -0,0 +1,4 @@
+ALTER TABLE medical_patients
+	DROP CONSTRAINT IF EXISTS fk_created_by;
+ALTER TABLE medical_patients
+	DROP COLUMN IF EXISTS created_by;
@@ -0,0 +1,4 @@
+ALTER TABLE medical_patients
+	ADD COLUMN IF NOT EXISTS created_by VARCHAR(16);
+ALTER TABLE medical_patients
+	ADD CONSTRAINT fk_created_by FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL;
@@ -0,0 +1,13 @@
+DROP TRIGGER IF EXISTS medical_records_append_only ON medical_records;
+DROP FUNCTION IF EXISTS medical_records_append_only;
+
+DROP INDEX IF EXISTS medical_records_original_id;
+ALTER TABLE medical_records
+	DROP CONSTRAINT IF EXISTS fk_amends_id;
+ALTER TABLE medical_records
+	DROP CONSTRAINT IF EXISTS fk_original_id;
+ALTER TABLE medical_records
+	DROP COLUMN IF EXISTS amend_reason,
+	DROP COLUMN IF EXISTS amends_id,
+	DROP COLUMN IF EXISTS version,
+	DROP COLUMN IF EXISTS original_id;
@@ -0,0 +1,42 @@
+ALTER TABLE medical_records
+	ADD COLUMN IF NOT EXISTS original_id VARCHAR(16);
+UPDATE medical_records SET original_id = id WHERE original_id IS NULL;
+ALTER TABLE medical_records
+	ALTER COLUMN original_id SET NOT NULL;
+ALTER TABLE medical_records
+	ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
+-- a version can be amended only once, which keeps each history linear
+ALTER TABLE medical_records
+	ADD COLUMN IF NOT EXISTS amends_id VARCHAR(16) UNIQUE;
+ALTER TABLE medical_records
+	ADD COLUMN IF NOT EXISTS amend_reason VARCHAR(500);
+
+ALTER TABLE medical_records
+	ADD CONSTRAINT fk_original_id FOREIGN KEY (original_id) REFERENCES medical_records(id) ON DELETE CASCADE;
+ALTER TABLE medical_records
+	ADD CONSTRAINT fk_amends_id FOREIGN KEY (amends_id) REFERENCES medical_records(id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS medical_records_original_id
+	ON medical_records USING HASH(original_id);
+
+-- clinical content is append-only: corrections are new versions
+CREATE OR REPLACE FUNCTION medical_records_append_only() RETURNS trigger AS $$
+BEGIN
+	IF NEW.user_id IS DISTINCT FROM OLD.user_id
+		OR NEW.patient_id IS DISTINCT FROM OLD.patient_id
+		OR NEW.symptoms IS DISTINCT FROM OLD.symptoms
+		OR NEW.medications IS DISTINCT FROM OLD.medications
+		OR NEW.created_at IS DISTINCT FROM OLD.created_at
+		OR NEW.original_id IS DISTINCT FROM OLD.original_id
+		OR NEW.version IS DISTINCT FROM OLD.version
+		OR NEW.amends_id IS DISTINCT FROM OLD.amends_id
+		OR NEW.amend_reason IS DISTINCT FROM OLD.amend_reason THEN
+		RAISE EXCEPTION 'medical record % is append-only', OLD.id;
+	END IF;
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER medical_records_append_only
+	BEFORE UPDATE ON medical_records
+	FOR EACH ROW EXECUTE FUNCTION medical_records_append_only();
@@ -0,0 +1,27 @@
+CREATE OR REPLACE FUNCTION medical_records_append_only() RETURNS trigger AS $$
+BEGIN
+	IF NEW.user_id IS DISTINCT FROM OLD.user_id
+		OR NEW.patient_id IS DISTINCT FROM OLD.patient_id
+		OR NEW.symptoms IS DISTINCT FROM OLD.symptoms
+		OR NEW.medications IS DISTINCT FROM OLD.medications
+		OR NEW.created_at IS DISTINCT FROM OLD.created_at
+		OR NEW.original_id IS DISTINCT FROM OLD.original_id
+		OR NEW.version IS DISTINCT FROM OLD.version
+		OR NEW.amends_id IS DISTINCT FROM OLD.amends_id
+		OR NEW.amend_reason IS DISTINCT FROM OLD.amend_reason THEN
+		RAISE EXCEPTION 'medical record % is append-only', OLD.id;
+	END IF;
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP INDEX IF EXISTS medical_records_unlocked;
+ALTER TABLE medical_records
+	DROP CONSTRAINT IF EXISTS medical_records_patient_chain_seq;
+ALTER TABLE medical_records
+	DROP COLUMN IF EXISTS signature,
+	DROP COLUMN IF EXISTS content_hash,
+	DROP COLUMN IF EXISTS prev_hash,
+	DROP COLUMN IF EXISTS chain_seq,
+	DROP COLUMN IF EXISTS locked_at,
+	DROP COLUMN IF EXISTS lock_at;
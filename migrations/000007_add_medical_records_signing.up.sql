@@ -0,0 +1,41 @@
+ALTER TABLE medical_records
+	ADD COLUMN IF NOT EXISTS lock_at TIMESTAMP;
+-- records written before signing existed are locked on the next run
+UPDATE medical_records SET lock_at = created_at WHERE lock_at IS NULL;
+ALTER TABLE medical_records
+	ALTER COLUMN lock_at SET NOT NULL;
+ALTER TABLE medical_records
+	ADD COLUMN IF NOT EXISTS locked_at TIMESTAMP,
+	ADD COLUMN IF NOT EXISTS chain_seq BIGINT,
+	ADD COLUMN IF NOT EXISTS prev_hash CHAR(64),
+	ADD COLUMN IF NOT EXISTS content_hash CHAR(64),
+	ADD COLUMN IF NOT EXISTS signature CHAR(64);
+
+ALTER TABLE medical_records
+	ADD CONSTRAINT medical_records_patient_chain_seq UNIQUE (patient_id, chain_seq);
+
+CREATE INDEX IF NOT EXISTS medical_records_unlocked
+	ON medical_records(lock_at) WHERE locked_at IS NULL;
+
+-- once locked a record cannot change at all, and only the signing
+-- columns may be filled in before that
+CREATE OR REPLACE FUNCTION medical_records_append_only() RETURNS trigger AS $$
+BEGIN
+	IF OLD.locked_at IS NOT NULL THEN
+		RAISE EXCEPTION 'medical record % is locked', OLD.id;
+	END IF;
+	IF NEW.user_id IS DISTINCT FROM OLD.user_id
+		OR NEW.patient_id IS DISTINCT FROM OLD.patient_id
+		OR NEW.symptoms IS DISTINCT FROM OLD.symptoms
+		OR NEW.medications IS DISTINCT FROM OLD.medications
+		OR NEW.created_at IS DISTINCT FROM OLD.created_at
+		OR NEW.original_id IS DISTINCT FROM OLD.original_id
+		OR NEW.version IS DISTINCT FROM OLD.version
+		OR NEW.amends_id IS DISTINCT FROM OLD.amends_id
+		OR NEW.amend_reason IS DISTINCT FROM OLD.amend_reason
+		OR NEW.lock_at IS DISTINCT FROM OLD.lock_at THEN
+		RAISE EXCEPTION 'medical record % is append-only', OLD.id;
+	END IF;
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,31 @@
+CREATE OR REPLACE FUNCTION medical_records_append_only() RETURNS trigger AS $$
+BEGIN
+	IF OLD.locked_at IS NOT NULL THEN
+		RAISE EXCEPTION 'medical record % is locked', OLD.id;
+	END IF;
+	IF NEW.user_id IS DISTINCT FROM OLD.user_id
+		OR NEW.patient_id IS DISTINCT FROM OLD.patient_id
+		OR NEW.symptoms IS DISTINCT FROM OLD.symptoms
+		OR NEW.medications IS DISTINCT FROM OLD.medications
+		OR NEW.created_at IS DISTINCT FROM OLD.created_at
+		OR NEW.original_id IS DISTINCT FROM OLD.original_id
+		OR NEW.version IS DISTINCT FROM OLD.version
+		OR NEW.amends_id IS DISTINCT FROM OLD.amends_id
+		OR NEW.amend_reason IS DISTINCT FROM OLD.amend_reason
+		OR NEW.lock_at IS DISTINCT FROM OLD.lock_at THEN
+		RAISE EXCEPTION 'medical record % is append-only', OLD.id;
+	END IF;
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP INDEX IF EXISTS medical_records_pending_review;
+ALTER TABLE medical_records
+	DROP CONSTRAINT IF EXISTS fk_reviewed_by;
+ALTER TABLE medical_records
+	DROP COLUMN IF EXISTS review_comment,
+	DROP COLUMN IF EXISTS reviewed_at,
+	DROP COLUMN IF EXISTS reviewed_by,
+	DROP COLUMN IF EXISTS review_status;
+
+DROP TYPE IF EXISTS review_status;
@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS medical_record_vitals_append_only ON medical_record_vitals;
+DROP FUNCTION IF EXISTS medical_record_vitals_append_only;
+
+DROP TABLE IF EXISTS medical_record_vitals;
@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS
+medical_record_vitals (
+    record_id VARCHAR(16) PRIMARY KEY,
+    measured_at TIMESTAMP NOT NULL,
+    temperature_c NUMERIC(4,1),
+    systolic_mmhg SMALLINT,
+    diastolic_mmhg SMALLINT,
+    heart_rate_bpm SMALLINT,
+    respiratory_rate SMALLINT,
+    spo2_pct SMALLINT,
+    weight_kg NUMERIC(5,2),
+    height_cm NUMERIC(4,1),
+    pain_score SMALLINT
+);
+
+ALTER TABLE medical_record_vitals
+	ADD CONSTRAINT fk_record_id FOREIGN KEY (record_id) REFERENCES medical_records(id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS medical_record_vitals_measured_at
+	ON medical_record_vitals(measured_at);
+
+-- vitals belong to a record version; corrections are amendments
+CREATE OR REPLACE FUNCTION medical_record_vitals_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'vitals of medical record % are append-only', OLD.record_id;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER medical_record_vitals_append_only
+	BEFORE UPDATE ON medical_record_vitals
+	FOR EACH ROW EXECUTE FUNCTION medical_record_vitals_append_only();
@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS medical_record_vitals_news2_alert;
+
+ALTER TABLE medical_record_vitals
+	DROP COLUMN IF EXISTS supplemental_oxygen,
+	DROP COLUMN IF EXISTS consciousness,
+	DROP COLUMN IF EXISTS spo2_scale,
+	DROP COLUMN IF EXISTS ward,
+	DROP COLUMN IF EXISTS news2_score,
+	DROP COLUMN IF EXISTS news2_risk,
+	DROP COLUMN IF EXISTS news2_alert;
@@ -0,0 +1,11 @@
+ALTER TABLE medical_record_vitals
+	ADD COLUMN IF NOT EXISTS supplemental_oxygen BOOLEAN,
+	ADD COLUMN IF NOT EXISTS consciousness CHAR(1),
+	ADD COLUMN IF NOT EXISTS spo2_scale SMALLINT,
+	ADD COLUMN IF NOT EXISTS ward VARCHAR(50),
+	ADD COLUMN IF NOT EXISTS news2_score SMALLINT,
+	ADD COLUMN IF NOT EXISTS news2_risk VARCHAR(16),
+	ADD COLUMN IF NOT EXISTS news2_alert BOOLEAN NOT NULL DEFAULT false;
+
+CREATE INDEX IF NOT EXISTS medical_record_vitals_news2_alert
+	ON medical_record_vitals(record_id) WHERE news2_alert;
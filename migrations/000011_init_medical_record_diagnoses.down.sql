@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS medical_record_diagnoses_append_only ON medical_record_diagnoses;
+DROP FUNCTION IF EXISTS medical_record_diagnoses_append_only;
+
+DROP TABLE IF EXISTS medical_record_diagnoses;
+DROP TYPE IF EXISTS diagnosis_type;
@@ -0,0 +1,32 @@
+DROP TYPE IF EXISTS diagnosis_type;
+CREATE TYPE diagnosis_type AS ENUM('primary', 'secondary');
+
+CREATE TABLE IF NOT EXISTS
+medical_record_diagnoses (
+    record_id VARCHAR(16) NOT NULL,
+    position SMALLINT NOT NULL,
+    code VARCHAR(8) NOT NULL,
+    chapter VARCHAR(5) NOT NULL,
+    kind diagnosis_type NOT NULL,
+    PRIMARY KEY (record_id, code)
+);
+
+ALTER TABLE medical_record_diagnoses
+	ADD CONSTRAINT fk_record_id FOREIGN KEY (record_id) REFERENCES medical_records(id) ON DELETE CASCADE;
+
+CREATE UNIQUE INDEX IF NOT EXISTS medical_record_diagnoses_primary
+	ON medical_record_diagnoses(record_id) WHERE kind = 'primary';
+CREATE INDEX IF NOT EXISTS medical_record_diagnoses_code
+	ON medical_record_diagnoses(code text_pattern_ops);
+CREATE INDEX IF NOT EXISTS medical_record_diagnoses_chapter
+	ON medical_record_diagnoses(chapter);
+
+CREATE OR REPLACE FUNCTION medical_record_diagnoses_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'diagnoses of medical record % are append-only', OLD.record_id;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER medical_record_diagnoses_append_only
+	BEFORE UPDATE ON medical_record_diagnoses
+	FOR EACH ROW EXECUTE FUNCTION medical_record_diagnoses_append_only();
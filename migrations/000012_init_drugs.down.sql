@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS medical_record_prescriptions_append_only ON medical_record_prescriptions;
+DROP FUNCTION IF EXISTS medical_record_prescriptions_append_only;
+
+DROP TABLE IF EXISTS medical_record_prescriptions;
+DROP TABLE IF EXISTS drugs;
@@ -0,0 +1,54 @@
+CREATE TABLE IF NOT EXISTS
+drugs (
+    id VARCHAR(16) PRIMARY KEY,
+    generic_name VARCHAR(100) NOT NULL,
+    form VARCHAR(30) NOT NULL,
+    strengths TEXT[] NOT NULL DEFAULT '{}',
+    routes TEXT[] NOT NULL,
+    dose_unit VARCHAR(10) NOT NULL,
+    min_dose NUMERIC(10,3) NOT NULL,
+    max_dose NUMERIC(10,3) NOT NULL,
+    max_daily_dose NUMERIC(10,3),
+    created_at TIMESTAMP DEFAULT current_timestamp,
+    updated_at TIMESTAMP DEFAULT current_timestamp,
+    CHECK (min_dose > 0 AND min_dose <= max_dose),
+    CHECK (max_daily_dose IS NULL OR max_daily_dose >= max_dose)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS drugs_generic_name_form
+	ON drugs(lower(generic_name), lower(form));
+
+CREATE TABLE IF NOT EXISTS
+medical_record_prescriptions (
+    record_id VARCHAR(16) NOT NULL,
+    position SMALLINT NOT NULL,
+    drug_id VARCHAR(16) NOT NULL,
+    generic_name VARCHAR(100) NOT NULL,
+    form VARCHAR(30) NOT NULL,
+    strength VARCHAR(30),
+    dose NUMERIC(10,3) NOT NULL,
+    unit VARCHAR(10) NOT NULL,
+    route VARCHAR(30) NOT NULL,
+    frequency VARCHAR(30) NOT NULL,
+    times_per_day NUMERIC(5,2),
+    duration_days SMALLINT,
+    PRIMARY KEY (record_id, position)
+);
+
+ALTER TABLE medical_record_prescriptions
+	ADD CONSTRAINT fk_record_id FOREIGN KEY (record_id) REFERENCES medical_records(id) ON DELETE CASCADE;
+ALTER TABLE medical_record_prescriptions
+	ADD CONSTRAINT fk_drug_id FOREIGN KEY (drug_id) REFERENCES drugs(id);
+
+CREATE INDEX IF NOT EXISTS medical_record_prescriptions_drug_id
+	ON medical_record_prescriptions USING HASH(drug_id);
+
+CREATE OR REPLACE FUNCTION medical_record_prescriptions_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'prescriptions of medical record % are append-only', OLD.record_id;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER medical_record_prescriptions_append_only
+	BEFORE UPDATE ON medical_record_prescriptions
+	FOR EACH ROW EXECUTE FUNCTION medical_record_prescriptions_append_only();
@@ -0,0 +1,52 @@
+CREATE TABLE IF NOT EXISTS
+patient_allergies (
+    id VARCHAR(16) PRIMARY KEY,
+    patient_id VARCHAR(16) NOT NULL,
+    allergen VARCHAR(100) NOT NULL,
+    reaction VARCHAR(500),
+    recorded_by VARCHAR(16),
+    created_at TIMESTAMP DEFAULT current_timestamp
+);
+
+ALTER TABLE patient_allergies
+	ADD CONSTRAINT fk_patient_id FOREIGN KEY (patient_id) REFERENCES medical_patients(id) ON DELETE CASCADE;
+ALTER TABLE patient_allergies
+	ADD CONSTRAINT fk_recorded_by FOREIGN KEY (recorded_by) REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS patient_allergies_patient_id_allergen
+	ON patient_allergies(patient_id, lower(allergen));
+
+ALTER TABLE medical_records
+	ADD COLUMN IF NOT EXISTS interaction_warnings JSONB,
+	ADD COLUMN IF NOT EXISTS interaction_override_reason VARCHAR(500);
+
+-- the interaction check and its override are part of the clinical content
+CREATE OR REPLACE FUNCTION medical_records_append_only() RETURNS trigger AS $$
+BEGIN
+	IF OLD.locked_at IS NOT NULL THEN
+		RAISE EXCEPTION 'medical record % is locked', OLD.id;
+	END IF;
+	IF NEW.user_id IS DISTINCT FROM OLD.user_id
+		OR NEW.patient_id IS DISTINCT FROM OLD.patient_id
+		OR NEW.symptoms IS DISTINCT FROM OLD.symptoms
+		OR NEW.medications IS DISTINCT FROM OLD.medications
+		OR NEW.created_at IS DISTINCT FROM OLD.created_at
+		OR NEW.original_id IS DISTINCT FROM OLD.original_id
+		OR NEW.version IS DISTINCT FROM OLD.version
+		OR NEW.amends_id IS DISTINCT FROM OLD.amends_id
+		OR NEW.amend_reason IS DISTINCT FROM OLD.amend_reason
+		OR NEW.interaction_warnings IS DISTINCT FROM OLD.interaction_warnings
+		OR NEW.interaction_override_reason IS DISTINCT FROM OLD.interaction_override_reason
+		OR NEW.lock_at IS DISTINCT FROM OLD.lock_at THEN
+		RAISE EXCEPTION 'medical record % is append-only', OLD.id;
+	END IF;
+	IF OLD.review_status <> 'pending_review' AND (
+		NEW.review_status IS DISTINCT FROM OLD.review_status
+		OR NEW.reviewed_by IS DISTINCT FROM OLD.reviewed_by
+		OR NEW.reviewed_at IS DISTINCT FROM OLD.reviewed_at
+		OR NEW.review_comment IS DISTINCT FROM OLD.review_comment) THEN
+		RAISE EXCEPTION 'medical record % has already been reviewed', OLD.id;
+	END IF;
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS users_name_trgm;
+DROP INDEX IF EXISTS medical_patients_name_trgm;
+
+DROP INDEX IF EXISTS medical_records_search_vector;
+ALTER TABLE medical_records
+	DROP COLUMN IF EXISTS search_vector;
@@ -0,0 +1,17 @@
+-- symptoms weigh more than medications when ranking matches
+ALTER TABLE medical_records
+	ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+		setweight(to_tsvector('indonesian', symptoms), 'A') ||
+		setweight(to_tsvector('indonesian', medications), 'B')
+	) STORED;
+
+CREATE INDEX IF NOT EXISTS medical_records_search_vector
+	ON medical_records USING GIN(search_vector);
+
+-- name filters default to contains, which a btree on lower(name) cannot serve
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS medical_patients_name_trgm
+	ON medical_patients USING GIN(lower(name) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS users_name_trgm
+	ON users USING GIN(lower(name) gin_trgm_ops);
@@ -0,0 +1,38 @@
+CREATE OR REPLACE FUNCTION medical_records_append_only() RETURNS trigger AS $$
+BEGIN
+	IF OLD.locked_at IS NOT NULL THEN
+		RAISE EXCEPTION 'medical record % is locked', OLD.id;
+	END IF;
+	IF NEW.user_id IS DISTINCT FROM OLD.user_id
+		OR NEW.patient_id IS DISTINCT FROM OLD.patient_id
+		OR NEW.symptoms IS DISTINCT FROM OLD.symptoms
+		OR NEW.medications IS DISTINCT FROM OLD.medications
+		OR NEW.created_at IS DISTINCT FROM OLD.created_at
+		OR NEW.original_id IS DISTINCT FROM OLD.original_id
+		OR NEW.version IS DISTINCT FROM OLD.version
+		OR NEW.amends_id IS DISTINCT FROM OLD.amends_id
+		OR NEW.amend_reason IS DISTINCT FROM OLD.amend_reason
+		OR NEW.interaction_warnings IS DISTINCT FROM OLD.interaction_warnings
+		OR NEW.interaction_override_reason IS DISTINCT FROM OLD.interaction_override_reason
+		OR NEW.lock_at IS DISTINCT FROM OLD.lock_at THEN
+		RAISE EXCEPTION 'medical record % is append-only', OLD.id;
+	END IF;
+	IF OLD.review_status <> 'pending_review' AND (
+		NEW.review_status IS DISTINCT FROM OLD.review_status
+		OR NEW.reviewed_by IS DISTINCT FROM OLD.reviewed_by
+		OR NEW.reviewed_at IS DISTINCT FROM OLD.reviewed_at
+		OR NEW.review_comment IS DISTINCT FROM OLD.review_comment) THEN
+		RAISE EXCEPTION 'medical record % has already been reviewed', OLD.id;
+	END IF;
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP INDEX IF EXISTS medical_records_template_id;
+ALTER TABLE medical_records
+	DROP CONSTRAINT IF EXISTS fk_template_id;
+ALTER TABLE medical_records
+	DROP COLUMN IF EXISTS template_fields,
+	DROP COLUMN IF EXISTS template_id;
+
+DROP TABLE IF EXISTS record_templates;
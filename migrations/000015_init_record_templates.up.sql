@@ -0,0 +1,58 @@
+CREATE TABLE IF NOT EXISTS
+record_templates (
+    id VARCHAR(16) PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    ward VARCHAR(50),
+    sections JSONB NOT NULL,
+    fields JSONB NOT NULL DEFAULT '[]',
+    created_by VARCHAR(16),
+    created_at TIMESTAMP DEFAULT current_timestamp
+);
+
+ALTER TABLE record_templates
+	ADD CONSTRAINT fk_created_by FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS record_templates_name_ward
+	ON record_templates(lower(name), lower(COALESCE(ward, '')));
+
+ALTER TABLE medical_records
+	ADD COLUMN IF NOT EXISTS template_id VARCHAR(16),
+	ADD COLUMN IF NOT EXISTS template_fields JSONB;
+
+ALTER TABLE medical_records
+	ADD CONSTRAINT fk_template_id FOREIGN KEY (template_id) REFERENCES record_templates(id);
+
+CREATE INDEX IF NOT EXISTS medical_records_template_id
+	ON medical_records USING HASH(template_id);
+
+CREATE OR REPLACE FUNCTION medical_records_append_only() RETURNS trigger AS $$
+BEGIN
+	IF OLD.locked_at IS NOT NULL THEN
+		RAISE EXCEPTION 'medical record % is locked', OLD.id;
+	END IF;
+	IF NEW.user_id IS DISTINCT FROM OLD.user_id
+		OR NEW.patient_id IS DISTINCT FROM OLD.patient_id
+		OR NEW.symptoms IS DISTINCT FROM OLD.symptoms
+		OR NEW.medications IS DISTINCT FROM OLD.medications
+		OR NEW.created_at IS DISTINCT FROM OLD.created_at
+		OR NEW.original_id IS DISTINCT FROM OLD.original_id
+		OR NEW.version IS DISTINCT FROM OLD.version
+		OR NEW.amends_id IS DISTINCT FROM OLD.amends_id
+		OR NEW.amend_reason IS DISTINCT FROM OLD.amend_reason
+		OR NEW.interaction_warnings IS DISTINCT FROM OLD.interaction_warnings
+		OR NEW.interaction_override_reason IS DISTINCT FROM OLD.interaction_override_reason
+		OR NEW.template_id IS DISTINCT FROM OLD.template_id
+		OR NEW.template_fields IS DISTINCT FROM OLD.template_fields
+		OR NEW.lock_at IS DISTINCT FROM OLD.lock_at THEN
+		RAISE EXCEPTION 'medical record % is append-only', OLD.id;
+	END IF;
+	IF OLD.review_status <> 'pending_review' AND (
+		NEW.review_status IS DISTINCT FROM OLD.review_status
+		OR NEW.reviewed_by IS DISTINCT FROM OLD.reviewed_by
+		OR NEW.reviewed_at IS DISTINCT FROM OLD.reviewed_at
+		OR NEW.review_comment IS DISTINCT FROM OLD.review_comment) THEN
+		RAISE EXCEPTION 'medical record % has already been reviewed', OLD.id;
+	END IF;
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
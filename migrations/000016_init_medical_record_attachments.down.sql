@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS medical_record_attachments_append_only ON medical_record_attachments;
+DROP FUNCTION IF EXISTS medical_record_attachments_append_only;
+
+DROP TABLE IF EXISTS medical_record_attachments;
+DROP TYPE IF EXISTS attachment_type;
@@ -0,0 +1,30 @@
+DROP TYPE IF EXISTS attachment_type;
+CREATE TYPE attachment_type AS ENUM('photo', 'lab_result', 'consent_form', 'ecg');
+
+CREATE TABLE IF NOT EXISTS
+medical_record_attachments (
+    record_id VARCHAR(16) NOT NULL,
+    position SMALLINT NOT NULL,
+    kind attachment_type NOT NULL,
+    image_key VARCHAR(100) NOT NULL,
+    caption VARCHAR(200),
+    PRIMARY KEY (record_id, position)
+);
+
+ALTER TABLE medical_record_attachments
+	ADD CONSTRAINT fk_record_id FOREIGN KEY (record_id) REFERENCES medical_records(id) ON DELETE CASCADE;
+
+CREATE UNIQUE INDEX IF NOT EXISTS medical_record_attachments_record_id_image_key
+	ON medical_record_attachments(record_id, image_key);
+CREATE INDEX IF NOT EXISTS medical_record_attachments_image_key
+	ON medical_record_attachments USING HASH(image_key);
+
+CREATE OR REPLACE FUNCTION medical_record_attachments_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'attachments of medical record % are append-only', OLD.record_id;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER medical_record_attachments_append_only
+	BEFORE UPDATE ON medical_record_attachments
+	FOR EACH ROW EXECUTE FUNCTION medical_record_attachments_append_only();
@@ -0,0 +1,5 @@
+-- the public URLs cannot be restored, the columns keep the keys
+DROP INDEX IF EXISTS medical_patients_identity_card_key;
+
+ALTER TABLE medical_patients RENAME COLUMN identity_card_key TO identity_card_url;
+ALTER TABLE users RENAME COLUMN identity_card_key TO identity_card_url;
@@ -0,0 +1,13 @@
+-- images are private now; keep object keys instead of their public URLs
+UPDATE users
+	SET identity_card_url = regexp_replace(split_part(identity_card_url, '?', 1), '^.*/', '')
+	WHERE identity_card_url LIKE '%/%';
+ALTER TABLE users RENAME COLUMN identity_card_url TO identity_card_key;
+
+UPDATE medical_patients
+	SET identity_card_url = regexp_replace(split_part(identity_card_url, '?', 1), '^.*/', '')
+	WHERE identity_card_url LIKE '%/%';
+ALTER TABLE medical_patients RENAME COLUMN identity_card_url TO identity_card_key;
+
+CREATE INDEX IF NOT EXISTS medical_patients_identity_card_key
+	ON medical_patients USING HASH(identity_card_key);
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS
+images (
+    key VARCHAR(100) PRIMARY KEY,
+    uploaded_by CHAR(16),
+    size BIGINT NOT NULL,
+    content_type VARCHAR(50) NOT NULL,
+    sha256 CHAR(64) NOT NULL,
+    width INT NOT NULL,
+    height INT NOT NULL,
+    uploaded_at TIMESTAMP NOT NULL DEFAULT current_timestamp
+);
+
+ALTER TABLE images
+	ADD CONSTRAINT fk_uploaded_by FOREIGN KEY (uploaded_by) REFERENCES users(id) ON DELETE SET NULL;
+
+-- an uploader sending the same content again gets the image they have
+CREATE UNIQUE INDEX IF NOT EXISTS images_uploaded_by_sha256
+	ON images(uploaded_by, sha256);
+CREATE INDEX IF NOT EXISTS images_uploaded_by_uploaded_at
+	ON images(uploaded_by, uploaded_at DESC);
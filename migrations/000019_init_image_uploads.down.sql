@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS image_upload_chunks;
+DROP TABLE IF EXISTS image_uploads;
+
+DELETE FROM images WHERE width IS NULL OR height IS NULL;
+ALTER TABLE images
+	ALTER COLUMN width SET NOT NULL,
+	ALTER COLUMN height SET NOT NULL;
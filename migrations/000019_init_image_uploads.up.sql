@@ -0,0 +1,35 @@
+-- documents such as PDFs have no dimensions
+ALTER TABLE images
+	ALTER COLUMN width DROP NOT NULL,
+	ALTER COLUMN height DROP NOT NULL;
+
+CREATE TABLE IF NOT EXISTS
+image_uploads (
+    id CHAR(16) PRIMARY KEY,
+    uploaded_by CHAR(16),
+    document_type VARCHAR(30) NOT NULL,
+    size BIGINT NOT NULL,
+    received BIGINT NOT NULL DEFAULT 0,
+    image_key VARCHAR(100),
+    created_at TIMESTAMP NOT NULL DEFAULT current_timestamp,
+    expires_at TIMESTAMP NOT NULL
+);
+
+-- uploads of deleted users are left to expire, which deletes their chunks
+ALTER TABLE image_uploads
+	ADD CONSTRAINT fk_uploaded_by FOREIGN KEY (uploaded_by) REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS image_uploads_expires_at
+	ON image_uploads(expires_at);
+
+CREATE TABLE IF NOT EXISTS
+image_upload_chunks (
+    upload_id CHAR(16) NOT NULL,
+    start_offset BIGINT NOT NULL,
+    key VARCHAR(100) NOT NULL,
+    size BIGINT NOT NULL,
+    PRIMARY KEY (upload_id, start_offset)
+);
+
+ALTER TABLE image_upload_chunks
+	ADD CONSTRAINT fk_upload_id FOREIGN KEY (upload_id) REFERENCES image_uploads(id) ON DELETE CASCADE;
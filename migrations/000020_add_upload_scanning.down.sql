@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS quarantined_files;
+
+ALTER TABLE image_uploads
+	DROP COLUMN IF EXISTS status_detail,
+	DROP COLUMN IF EXISTS status;
@@ -0,0 +1,18 @@
+ALTER TABLE image_uploads
+	ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'uploading',
+	ADD COLUMN status_detail TEXT;
+
+UPDATE image_uploads SET status = 'ready' WHERE image_key IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS
+quarantined_files (
+    key VARCHAR(100) PRIMARY KEY,
+    uploaded_by CHAR(16),
+    size BIGINT NOT NULL,
+    sha256 CHAR(64) NOT NULL,
+    signature TEXT NOT NULL,
+    quarantined_at TIMESTAMP NOT NULL DEFAULT current_timestamp
+);
+
+ALTER TABLE quarantined_files
+	ADD CONSTRAINT fk_uploaded_by FOREIGN KEY (uploaded_by) REFERENCES users(id) ON DELETE SET NULL;
@@ -0,0 +1,14 @@
+DROP TRIGGER IF EXISTS medical_record_attachments_no_delete ON medical_record_attachments;
+DROP TRIGGER IF EXISTS medical_record_prescriptions_no_delete ON medical_record_prescriptions;
+DROP TRIGGER IF EXISTS medical_record_diagnoses_no_delete ON medical_record_diagnoses;
+DROP TRIGGER IF EXISTS medical_record_vitals_no_delete ON medical_record_vitals;
+DROP TRIGGER IF EXISTS medical_records_no_delete ON medical_records;
+DROP FUNCTION IF EXISTS medical_records_no_delete;
+
+ALTER TABLE medical_records
+	DROP CONSTRAINT IF EXISTS fk_user_id,
+	DROP CONSTRAINT IF EXISTS fk_patient_id;
+ALTER TABLE medical_records
+	ADD CONSTRAINT fk_user_id FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE medical_records
+	ADD CONSTRAINT fk_patient_id FOREIGN KEY (patient_id) REFERENCES medical_patients(id) ON DELETE CASCADE;
@@ -0,0 +1,32 @@
+-- records outlive their authors and patients: deleting either is refused
+-- while they have records, instead of taking the records with them
+ALTER TABLE medical_records
+	DROP CONSTRAINT IF EXISTS fk_user_id,
+	DROP CONSTRAINT IF EXISTS fk_patient_id;
+ALTER TABLE medical_records
+	ADD CONSTRAINT fk_user_id FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE RESTRICT;
+ALTER TABLE medical_records
+	ADD CONSTRAINT fk_patient_id FOREIGN KEY (patient_id) REFERENCES medical_patients(id) ON DELETE RESTRICT;
+
+-- append-only covers deletes too, of records and of what belongs to them
+CREATE OR REPLACE FUNCTION medical_records_no_delete() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'medical record % cannot be deleted', OLD.id;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER medical_records_no_delete
+	BEFORE DELETE ON medical_records
+	FOR EACH ROW EXECUTE FUNCTION medical_records_no_delete();
+CREATE TRIGGER medical_record_vitals_no_delete
+	BEFORE DELETE ON medical_record_vitals
+	FOR EACH ROW EXECUTE FUNCTION medical_record_vitals_append_only();
+CREATE TRIGGER medical_record_diagnoses_no_delete
+	BEFORE DELETE ON medical_record_diagnoses
+	FOR EACH ROW EXECUTE FUNCTION medical_record_diagnoses_append_only();
+CREATE TRIGGER medical_record_prescriptions_no_delete
+	BEFORE DELETE ON medical_record_prescriptions
+	FOR EACH ROW EXECUTE FUNCTION medical_record_prescriptions_append_only();
+CREATE TRIGGER medical_record_attachments_no_delete
+	BEFORE DELETE ON medical_record_attachments
+	FOR EACH ROW EXECUTE FUNCTION medical_record_attachments_append_only();
@@ -0,0 +1,2 @@
+ALTER TABLE image_uploads
+	DROP COLUMN IF EXISTS scan_started_at;
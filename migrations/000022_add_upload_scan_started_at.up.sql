@@ -0,0 +1,5 @@
+-- a scan cut short by a restart is retried once it is this old
+ALTER TABLE image_uploads
+	ADD COLUMN IF NOT EXISTS scan_started_at TIMESTAMP;
+
+UPDATE image_uploads SET scan_started_at = created_at WHERE status = 'scanning';
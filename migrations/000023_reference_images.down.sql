@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS users_identity_card_key;
+
+ALTER TABLE medical_record_attachments
+	DROP CONSTRAINT IF EXISTS fk_image_key;
+ALTER TABLE medical_patients
+	DROP CONSTRAINT IF EXISTS fk_identity_card_key;
+ALTER TABLE users
+	DROP CONSTRAINT IF EXISTS fk_identity_card_key;
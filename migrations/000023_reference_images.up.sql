@@ -0,0 +1,28 @@
+-- images referred to before the images table existed are registered, so
+-- the references below can be enforced; their objects are not read, so
+-- size, hash and uploader are unknown, and they count as uploaded when
+-- first referred to
+INSERT INTO images (key, size, content_type, sha256, uploaded_at)
+SELECT DISTINCT ON (key) key, 0, 'application/octet-stream', repeat('0', 64), referenced_at
+FROM (
+	SELECT identity_card_key AS key, created_at AS referenced_at FROM users
+	UNION ALL SELECT identity_card_key, created_at FROM medical_patients
+	UNION ALL SELECT a.image_key, r.created_at
+		FROM medical_record_attachments a JOIN medical_records r ON r.id = a.record_id
+) referenced
+WHERE key IS NOT NULL AND key <> '' AND length(key) <= 100 AND referenced_at IS NOT NULL
+ORDER BY key, referenced_at
+ON CONFLICT (key) DO NOTHING;
+
+-- a referenced image cannot be collected as an orphan, even when the
+-- reference commits while the collector is deleting it; rows that were
+-- never valid keys are left unchecked
+ALTER TABLE users
+	ADD CONSTRAINT fk_identity_card_key FOREIGN KEY (identity_card_key) REFERENCES images(key) ON DELETE RESTRICT NOT VALID;
+ALTER TABLE medical_patients
+	ADD CONSTRAINT fk_identity_card_key FOREIGN KEY (identity_card_key) REFERENCES images(key) ON DELETE RESTRICT NOT VALID;
+ALTER TABLE medical_record_attachments
+	ADD CONSTRAINT fk_image_key FOREIGN KEY (image_key) REFERENCES images(key) ON DELETE RESTRICT NOT VALID;
+
+CREATE INDEX IF NOT EXISTS users_identity_card_key
+	ON users USING HASH(identity_card_key);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS nurse_roles;
+DROP TYPE IF EXISTS nurse_role;
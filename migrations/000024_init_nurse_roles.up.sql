@@ -0,0 +1,17 @@
+DROP TYPE IF EXISTS nurse_role;
+CREATE TYPE nurse_role AS ENUM('head_nurse');
+
+-- roles nurses are granted on top of what every nurse may do
+CREATE TABLE IF NOT EXISTS
+nurse_roles (
+    user_id CHAR(16) NOT NULL,
+    role nurse_role NOT NULL,
+    granted_by CHAR(16),
+    granted_at TIMESTAMP NOT NULL DEFAULT current_timestamp,
+    PRIMARY KEY (user_id, role)
+);
+
+ALTER TABLE nurse_roles
+	ADD CONSTRAINT fk_user_id FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE nurse_roles
+	ADD CONSTRAINT fk_granted_by FOREIGN KEY (granted_by) REFERENCES users(id) ON DELETE SET NULL;
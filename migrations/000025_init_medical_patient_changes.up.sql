@@ -0,0 +1,18 @@
+-- every change of a patient's demographics, for their timeline
+CREATE TABLE IF NOT EXISTS
+medical_patient_changes (
+    id VARCHAR(16) PRIMARY KEY,
+    patient_id VARCHAR(16) NOT NULL,
+    -- changed fields, each {"from": ..., "to": ...}
+    changes JSONB NOT NULL,
+    changed_by VARCHAR(16),
+    changed_at TIMESTAMP NOT NULL DEFAULT current_timestamp
+);
+
+ALTER TABLE medical_patient_changes
+	ADD CONSTRAINT fk_patient_id FOREIGN KEY (patient_id) REFERENCES medical_patients(id) ON DELETE CASCADE;
+ALTER TABLE medical_patient_changes
+	ADD CONSTRAINT fk_changed_by FOREIGN KEY (changed_by) REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS medical_patient_changes_patient_id
+	ON medical_patient_changes USING HASH(patient_id);
@@ -0,0 +1,6 @@
+-- enum values cannot be dropped, so the type is made again without it
+DELETE FROM nurse_roles WHERE role = 'clinical_reviewer';
+ALTER TYPE nurse_role RENAME TO nurse_role_old;
+CREATE TYPE nurse_role AS ENUM('head_nurse');
+ALTER TABLE nurse_roles ALTER COLUMN role TYPE nurse_role USING role::text::nurse_role;
+DROP TYPE nurse_role_old;
@@ -0,0 +1 @@
+ALTER TYPE nurse_role ADD VALUE IF NOT EXISTS 'clinical_reviewer';
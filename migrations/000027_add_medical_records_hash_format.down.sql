@@ -0,0 +1,2 @@
+ALTER TABLE medical_records
+	DROP COLUMN IF EXISTS hash_format;
@@ -0,0 +1,8 @@
+ALTER TABLE medical_records
+	ADD COLUMN IF NOT EXISTS hash_format SMALLINT;
+
+-- records signed so far were hashed as JSON; they are locked, so the
+-- append-only trigger is held off while their format is filled in
+ALTER TABLE medical_records DISABLE TRIGGER medical_records_append_only;
+UPDATE medical_records SET hash_format = 1 WHERE content_hash IS NOT NULL;
+ALTER TABLE medical_records ENABLE TRIGGER medical_records_append_only;
@@ -0,0 +1,9 @@
+-- objects of images already unregistered, kept until they are deleted so
+-- that a failed deletion is retried rather than leaking the object
+CREATE TABLE IF NOT EXISTS
+image_deletions (
+    key VARCHAR(100) PRIMARY KEY,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT current_timestamp
+);
@@ -0,0 +1,8 @@
+// Package migrations embeds the database migrations into the binary, so
+// it can migrate the database without the files being deployed.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS